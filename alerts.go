@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// alertWebhook receives new-registration alerts from the daemon.
+var alertWebhook string
+
+// newRegistrations returns the domains that were NXDOMAIN in before and
+// resolve in after, whether or not they already serve a certificate. A
+// freshly registered look-alike is the strongest signal brand monitoring
+// gets.
+func newRegistrations(before, after *scanRecord) []ScanResult {
+	var found []ScanResult
+	for _, r := range after.Results {
+		if r.Status == "NXDOMAIN" || r.Status == "DNS ERROR" {
+			continue
+		}
+		if prev, ok := before.result(r.Domain); ok && prev.Status == "NXDOMAIN" {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// registrationAlert is the JSON body posted to --alert-webhook.
+type registrationAlert struct {
+	ScanID         string       `json:"scan_id"`
+	PreviousScanID string       `json:"previous_scan_id"`
+	Domains        []ScanResult `json:"domains"`
+}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendRegistrationAlert logs a and posts it to webhook, if set.
+func sendRegistrationAlert(webhook string, a registrationAlert) error {
+	for _, r := range a.Domains {
+		logger.Printf("ALERT: %s was NXDOMAIN in scan %s and now resolves (%s %s)\n", displayDomain(r.Domain), a.PreviousScanID, r.Status, r.IP)
+	}
+	if webhook == "" {
+		return nil
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := alertClient.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
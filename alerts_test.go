@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRegistrations(t *testing.T) {
+	before := &scanRecord{Results: []ScanResult{
+		{Domain: "a.zz", Status: "NXDOMAIN"},
+		{Domain: "b.zz", Status: "NXDOMAIN"},
+		{Domain: "c.zz", Status: "NXDOMAIN"},
+		{Domain: "d.zz", Status: "TLS ERROR"},
+	}}
+	after := &scanRecord{Results: []ScanResult{
+		{Domain: "a.zz", Status: "OK"},
+		{Domain: "b.zz", Status: "NXDOMAIN"},
+		{Domain: "c.zz", Status: "TLS ERROR"},
+		{Domain: "d.zz", Status: "OK"},
+		{Domain: "e.zz", Status: "OK"},
+	}}
+	found := newRegistrations(before, after)
+	if len(found) != 2 || found[0].Domain != "a.zz" || found[1].Domain != "c.zz" {
+		t.Errorf("new registrations = %+v, want a.zz and c.zz", found)
+	}
+}
+
+func TestSendRegistrationAlert(t *testing.T) {
+	var got registrationAlert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+	err := sendRegistrationAlert(srv.URL, registrationAlert{ScanID: "2", PreviousScanID: "1", Domains: []ScanResult{{Domain: "a.zz", Status: "OK"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ScanID != "2" || len(got.Domains) != 1 || got.Domains[0].Domain != "a.zz" {
+		t.Errorf("webhook got %+v", got)
+	}
+}
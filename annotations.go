@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var annotationsFile string
+
+// annotation is a triage decision about a domain: who owns it, the ticket
+// tracking it and a free-text note.
+type annotation struct {
+	Owner  string `json:"owner,omitempty"`
+	Ticket string `json:"ticket,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// loadAnnotations reads domain,owner,ticket,note lines; the note may
+// contain commas.
+func loadAnnotations(path string) (map[string]annotation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	notes := make(map[string]annotation)
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		domain := strings.ToLower(strings.TrimSpace(rec[0]))
+		if domain == "" || domain == "domain" {
+			continue // blank line or header
+		}
+		var a annotation
+		if len(rec) > 1 {
+			a.Owner = rec[1]
+		}
+		if len(rec) > 2 {
+			a.Ticket = rec[2]
+		}
+		if len(rec) > 3 {
+			a.Note = strings.Join(rec[3:], ",")
+		}
+		notes[domain] = a
+	}
+	return notes, nil
+}
+
+func annotate(r *ScanResult, notes map[string]annotation) {
+	if a, ok := notes[strings.ToLower(r.Domain)]; ok {
+		r.Owner, r.Ticket, r.Annotation = a.Owner, a.Ticket, a.Note
+	}
+}
+
+// annotateResults merges notes into the results they are about.
+func annotateResults(in <-chan ScanResult, notes map[string]annotation) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		for r := range in {
+			annotate(&r, notes)
+			out <- r
+		}
+	}()
+	return out
+}
+
+func (s *fileStore) annotationsPath() string {
+	return filepath.Join(s.dir, "annotations.json")
+}
+
+func (s *fileStore) annotations() (map[string]annotation, error) {
+	notes := make(map[string]annotation)
+	data, err := os.ReadFile(s.annotationsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return notes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return notes, json.Unmarshal(data, &notes)
+}
+
+// importAnnotations merges notes into the stored annotations, replacing
+// those of the same domains. Domains missing from notes keep theirs, so
+// triage decisions outlive the file they came from.
+func (s *fileStore) importAnnotations(notes map[string]annotation) error {
+	stored, err := s.annotations()
+	if err != nil {
+		return err
+	}
+	for domain, a := range notes {
+		stored[domain] = a
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.annotationsPath(), data, 0o600)
+}
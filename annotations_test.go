@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.csv")
+	os.WriteFile(path, []byte("domain,owner,ticket,note\n# parked by marketing\nShop.Example,marketing,SEC-1,\"parked, renew in May\"\nold.example,,SEC-2,\n"), 0o644)
+	notes, err := loadAnnotations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := notes["shop.example"]; a.Owner != "marketing" || a.Ticket != "SEC-1" || a.Note != "parked, renew in May" {
+		t.Errorf("shop.example = %+v", a)
+	}
+
+	r := ScanResult{Domain: "shop.example", Note: "set by a script"}
+	annotate(&r, notes)
+	if r.Owner != "marketing" || r.Annotation != "parked, renew in May" || r.Note != "set by a script" {
+		t.Errorf("annotated = %+v", r)
+	}
+
+	// Stored annotations survive an import that no longer lists them.
+	store, err := newFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.importAnnotations(notes); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.importAnnotations(map[string]annotation{"old.example": {Ticket: "SEC-3"}}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.annotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 || stored["shop.example"].Ticket != "SEC-1" || stored["old.example"].Ticket != "SEC-3" {
+		t.Errorf("stored = %+v", stored)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var assetsFile string
+
+// asset is one line of the --assets inventory: domain,owner,notes.
+type asset struct {
+	Domain string
+	Owner  string
+	Notes  string
+}
+
+func loadAssets(path string) (map[string]asset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	assets := make(map[string]asset)
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		a := asset{Domain: strings.ToLower(strings.TrimSpace(rec[0]))}
+		if a.Domain == "" || a.Domain == "domain" {
+			continue // blank line or header
+		}
+		if len(rec) > 1 {
+			a.Owner = rec[1]
+		}
+		if len(rec) > 2 {
+			a.Notes = strings.Join(rec[2:], ",")
+		}
+		assets[a.Domain] = a
+	}
+	return assets, nil
+}
+
+// assetRow is one line of the reconciliation report.
+type assetRow struct {
+	Bucket string // present, missing or unexpected
+	Result ScanResult
+	Asset  asset
+}
+
+// reconcileAssets sorts results into expected-and-present, expected but
+// missing or broken, and unexpected hits. Expected domains the sweep did
+// not cover are reported missing with status NOT SCANNED.
+func reconcileAssets(assets map[string]asset, results []ScanResult) []assetRow {
+	var rows []assetRow
+	seen := make(map[string]bool, len(results))
+	for _, r := range results {
+		seen[r.Domain] = true
+		a, expected := assets[r.Domain]
+		switch {
+		case expected && r.Status == "OK":
+			rows = append(rows, assetRow{Bucket: "present", Result: r, Asset: a})
+		case expected:
+			rows = append(rows, assetRow{Bucket: "missing", Result: r, Asset: a})
+		case r.Status != "NXDOMAIN":
+			rows = append(rows, assetRow{Bucket: "unexpected", Result: r})
+		}
+	}
+	for d, a := range assets {
+		if !seen[d] {
+			rows = append(rows, assetRow{Bucket: "missing", Result: ScanResult{Domain: d, Status: "NOT SCANNED"}, Asset: a})
+		}
+	}
+
+	order := map[string]int{"unexpected": 0, "missing": 1, "present": 2}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Bucket != rows[j].Bucket {
+			return order[rows[i].Bucket] < order[rows[j].Bucket]
+		}
+		return rows[i].Result.Domain < rows[j].Result.Domain
+	})
+	return rows
+}
+
+func writeAssetReport(path string, rows []assetRow) error {
+	file, err := createAtomic(path, 0o644)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"Bucket", "Domain", "Status", "Owner", "Notes", "IP", "Subject", "Issuer", "ValidTo"})
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.Bucket]++
+		r := row.Result
+		w.Write([]string{row.Bucket, r.Domain, r.Status, row.Asset.Owner, row.Asset.Notes, r.IP, r.Subject, r.Issuer, r.ValidTo})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		file.abort()
+		return err
+	}
+	logger.Printf("Assets: %d present, %d missing or broken, %d unexpected\n", counts["present"], counts["missing"], counts["unexpected"])
+	return file.Close()
+}
+
+// collectResults appends every result passing through to all.
+func collectResults(in <-chan ScanResult, all *[]ScanResult) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		for r := range in {
+			*all = append(*all, r)
+			out <- r
+		}
+	}()
+	return out
+}
+
+func assetReportPath(baseDomain string) string {
+	return outputPath(fmt.Sprintf("%s.assets.csv", baseDomain))
+}
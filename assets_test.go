@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReconcileAssets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assets.csv")
+	inventory := "domain,owner,notes\n# retail\nacme.com, web team, main site\nacme.de,emea\nacme.fr,emea,\"parked, renew 2025\"\nacme.io,platform\n"
+	if err := os.WriteFile(path, []byte(inventory), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assets, err := loadAssets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 4 || assets["acme.com"].Owner != "web team" || assets["acme.fr"].Notes != "parked, renew 2025" {
+		t.Fatalf("assets = %+v", assets)
+	}
+
+	rows := reconcileAssets(assets, []ScanResult{
+		{Domain: "acme.com", Status: "OK"},
+		{Domain: "acme.de", Status: "TLS ERROR"},
+		{Domain: "acme.fr", Status: "NXDOMAIN"},
+		{Domain: "acme.zz", Status: "OK"},
+		{Domain: "acme.yy", Status: "NXDOMAIN"},
+	})
+	want := []struct{ bucket, domain, status string }{
+		{"unexpected", "acme.zz", "OK"},
+		{"missing", "acme.de", "TLS ERROR"},
+		{"missing", "acme.fr", "NXDOMAIN"},
+		{"missing", "acme.io", "NOT SCANNED"},
+		{"present", "acme.com", "OK"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %+v", rows)
+	}
+	for i, w := range want {
+		if r := rows[i]; r.Bucket != w.bucket || r.Result.Domain != w.domain || r.Result.Status != w.status {
+			t.Errorf("row %d = %s %s %s, want %s %s %s", i, r.Bucket, r.Result.Domain, r.Result.Status, w.bucket, w.domain, w.status)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is written to a temporary file next to path and only renamed
+// over it by Close, once synced to disk, so a crash or a failed export
+// never leaves a truncated file under the final name.
+type atomicFile struct {
+	*os.File
+	path   string
+	closed bool
+}
+
+func createAtomic(path string, perm os.FileMode) (*atomicFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &atomicFile{File: tmp, path: path}, nil
+}
+
+// Close syncs the file and renames it into place.
+func (f *atomicFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	err := f.Sync()
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// abort drops the file, leaving whatever was at path before.
+func (f *atomicFile) abort() {
+	if f.closed {
+		return
+	}
+	f.closed = true
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// syncDir makes a rename in dir durable. Not every platform can sync a
+// directory, so failing to is not an error.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// writeFileAtomic is os.WriteFile through an atomicFile.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := createAtomic(path, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.abort()
+		return err
+	}
+	return f.Close()
+}
+
+// discardOutput closes an output that failed part way: an atomic file is
+// dropped rather than published.
+func discardOutput(w io.Closer) {
+	if f, ok := w.(*atomicFile); ok {
+		f.abort()
+		return
+	}
+	w.Close()
+}
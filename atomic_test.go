@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "amazon.csv")
+	os.WriteFile(path, []byte("previous\n"), 0o644)
+
+	f, err := createAtomic(path, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("half a ro")
+	f.abort()
+	if data, _ := os.ReadFile(path); string(data) != "previous\n" {
+		t.Errorf("aborted write replaced the file: %q", data)
+	}
+
+	if f, err = createAtomic(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("Domain\namazon.com\n")
+	if data, _ := os.ReadFile(path); string(data) != "previous\n" {
+		t.Errorf("visible before Close: %q", data)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "Domain\namazon.com\n" {
+		t.Errorf("after Close: %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v", info.Mode())
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(left) > 0 {
+		t.Errorf("temporary files left: %v", left)
+	}
+}
+
+func TestFailedExportIsNotPublished(t *testing.T) {
+	withFastRetries(t)
+	path := filepath.Join(t.TempDir(), "amazon.csv")
+	sink := createSink(path, "csv", "amazon", func(r ScanResult) []byte { return csvRecord(resultRow(r)) })
+	sink.send(ScanResult{Domain: "amazon.com", Status: "OK"})
+	sink.w = &flakyWriter{fails: exportRetries + 1} // the disk fills up
+	sink.send(ScanResult{Domain: "amazon.de", Status: "OK"})
+	sink.send(ScanResult{Domain: "amazon.fr", Status: "OK"})
+	if sink.close() {
+		t.Error("close should report the export as failed")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("half-written export published: %v", err)
+	}
+	got, err := loadExport(sink.spool.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Errorf("spooled %d results, want all 3", len(got))
+	}
+}
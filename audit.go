@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+var auditLogPath string
+
+// auditTrail is the opened --audit-log, nil without one.
+var auditTrail *auditLog
+
+var errSweepStopped = errors.New("stopped before the sweep finished")
+
+// auditEntry is one line of the audit log: a scan starting or finishing.
+type auditEntry struct {
+	Time        string            `json:"time"`
+	Event       string            `json:"event"` // "started" or "finished"
+	ScanID      string            `json:"scan_id"`
+	Mode        string            `json:"mode"` // "cli" or "daemon"
+	Profile     string            `json:"profile,omitempty"`
+	TriggeredBy string            `json:"triggered_by"`
+	User        string            `json:"user"`
+	Host        string            `json:"host"`
+	BaseDomains []string          `json:"base_domains"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+	Targets     int               `json:"targets"`
+	Scanned     int               `json:"scanned,omitempty"` // finished only
+	Error       string            `json:"error,omitempty"`
+}
+
+// auditLog appends entries to a file that is only ever opened for
+// appending, so earlier entries are never rewritten.
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f}, nil
+}
+
+// openAuditTrail opens --audit-log, if set, into auditTrail.
+func openAuditTrail() {
+	if auditLogPath == "" {
+		return
+	}
+	l, err := openAuditLog(auditLogPath)
+	if err != nil {
+		logger.Fatalf("Failed to open audit log: %v\n", err)
+	}
+	auditTrail = l
+}
+
+func (l *auditLog) write(e auditEntry) {
+	if l == nil {
+		return
+	}
+	line, _ := json.Marshal(e)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.f.Write(append(line, '\n'))
+	if err == nil {
+		err = l.f.Sync()
+	}
+	if err != nil {
+		logger.Printf("Failed to write audit log: %v\n", err)
+	}
+}
+
+// auditScan is a scan whose start has been recorded.
+type auditScan struct {
+	log   *auditLog
+	entry auditEntry
+}
+
+// start records e as started, filling in who is running the process and
+// where. A nil log records nothing.
+func (l *auditLog) start(e auditEntry) *auditScan {
+	e.Event, e.Time = "started", time.Now().UTC().Format(time.RFC3339)
+	e.User, e.Host = processUser(), processHost()
+	l.write(e)
+	return &auditScan{log: l, entry: e}
+}
+
+// finish records the end of the scan, with err when it failed or was
+// interrupted.
+func (a *auditScan) finish(scanned int, err error) {
+	e := a.entry
+	e.Event, e.Time, e.Scanned = "finished", time.Now().UTC().Format(time.RFC3339), scanned
+	e.Parameters = nil // recorded at the start
+	if err != nil {
+		e.Error = err.Error()
+	}
+	a.log.write(e)
+}
+
+func processUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func processHost() string {
+	host, _ := os.Hostname()
+	return host
+}
+
+// auditedScan is one scan of an audit log export, its start and finish
+// entries joined.
+type auditedScan struct {
+	ScanID      string            `json:"scan_id"`
+	Mode        string            `json:"mode"`
+	Profile     string            `json:"profile,omitempty"`
+	TriggeredBy string            `json:"triggered_by"`
+	User        string            `json:"user"`
+	Host        string            `json:"host"`
+	BaseDomains []string          `json:"base_domains"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+	Targets     int               `json:"targets"`
+	StartedAt   string            `json:"started_at"`
+	FinishedAt  string            `json:"finished_at,omitempty"` // empty while running or if the process died
+	Scanned     int               `json:"scanned"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// readAuditLog joins the entries of r into scans, in the order they
+// started. A scan is keyed by its ID and profile, as profiles can start
+// within the same second.
+func readAuditLog(r io.Reader) ([]auditedScan, error) {
+	type key struct{ id, profile string }
+	var scans []auditedScan
+	index := make(map[key]int)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		k := key{e.ScanID, e.Profile}
+		i, ok := index[k]
+		if !ok {
+			i = len(scans)
+			index[k] = i
+			scans = append(scans, auditedScan{ScanID: e.ScanID, Mode: e.Mode, Profile: e.Profile, TriggeredBy: e.TriggeredBy,
+				User: e.User, Host: e.Host, BaseDomains: e.BaseDomains, Targets: e.Targets})
+		}
+		s := &scans[i]
+		switch e.Event {
+		case "started":
+			s.StartedAt, s.Parameters = e.Time, e.Parameters
+		case "finished":
+			s.FinishedAt, s.Scanned, s.Error = e.Time, e.Scanned, e.Error
+		}
+	}
+	return scans, sc.Err()
+}
+
+// runAudit prints the scans of an audit log as a JSON array.
+func runAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep audit [--since <time>] <audit-log>")
+		fs.PrintDefaults()
+	}
+	since := fs.String("since", "", "only scans started at or after this RFC 3339 time")
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	var from time.Time
+	if *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			logger.Fatalf("--since: %v\n", err)
+		}
+		from = t
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		logger.Fatalf("Failed to open audit log: %v\n", err)
+	}
+	defer f.Close()
+	scans, err := readAuditLog(f)
+	if err != nil {
+		logger.Fatalf("Failed to read audit log: %v\n", err)
+	}
+	out := []auditedScan{}
+	for _, s := range scans {
+		if started, err := time.Parse(time.RFC3339, s.StartedAt); err == nil && started.Before(from) {
+			continue
+		}
+		out = append(out, s)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := l.start(auditEntry{ScanID: "20240501T000000Z", Mode: "cli", TriggeredBy: "command line",
+		BaseDomains: []string{"amazon"}, Parameters: map[string]string{"workers": "50"}, Targets: 1200})
+	first.finish(1200, nil)
+	travel := l.start(auditEntry{ScanID: "20240501T000000Z", Mode: "daemon", Profile: "travel", TriggeredBy: "api token ci", Targets: 40})
+
+	// Reopening appends to what is there.
+	if l, err = openAuditLog(path); err != nil {
+		t.Fatal(err)
+	}
+	travel.log = l
+	travel.finish(12, errors.New("context canceled"))
+	l.start(auditEntry{ScanID: "20240502T000000Z", Mode: "daemon", TriggeredBy: "schedule"})
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 5 {
+		t.Fatalf("%d lines:\n%s", lines, data)
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	scans, err := readAuditLog(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scans) != 3 {
+		t.Fatalf("scans = %+v", scans)
+	}
+	if s := scans[0]; s.Mode != "cli" || s.Targets != 1200 || s.Scanned != 1200 || s.Parameters["workers"] != "50" ||
+		s.StartedAt == "" || s.FinishedAt == "" || s.User == "" || s.Error != "" {
+		t.Errorf("cli scan = %+v", s)
+	}
+	if s := scans[1]; s.Profile != "travel" || s.TriggeredBy != "api token ci" || s.Scanned != 12 || s.Error != "context canceled" {
+		t.Errorf("travel scan = %+v", s)
+	}
+	if s := scans[2]; s.StartedAt == "" || s.FinishedAt != "" {
+		t.Errorf("running scan = %+v", s)
+	}
+
+	// Without --audit-log nothing is recorded.
+	var none *auditLog
+	none.start(auditEntry{ScanID: "x"}).finish(0, nil)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// apiRole is what a daemon API token may do. A scan token can also read.
+type apiRole int
+
+const (
+	roleRead apiRole = iota + 1
+	roleScan
+)
+
+var apiRoles = map[string]apiRole{"read": roleRead, "scan": roleScan}
+
+type apiToken struct {
+	name  string
+	role  apiRole
+	token []byte
+}
+
+// apiTokens authenticates daemon API requests against the --api-tokens
+// file. A nil or unconfigured set leaves the dashboard open and disables
+// scan triggers.
+type apiTokens struct {
+	mu     sync.Mutex
+	tokens []apiToken
+}
+
+// loadAPITokens reads "<name> <role> <token>" lines; blank lines and
+// lines starting with # are skipped.
+func loadAPITokens(path string) ([]apiToken, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tokens []apiToken
+	names := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want <name> <role> <token>", path, n)
+		}
+		role, ok := apiRoles[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unknown role %q, want read or scan", path, n, fields[1])
+		}
+		if names[fields[0]] {
+			return nil, fmt.Errorf("%s:%d: token name %s is used twice", path, n, fields[0])
+		}
+		names[fields[0]] = true
+		tokens = append(tokens, apiToken{name: fields[0], role: role, token: []byte(fields[2])})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s: no tokens", path)
+	}
+	return tokens, nil
+}
+
+func (t *apiTokens) set(tokens []apiToken) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = tokens
+}
+
+func (t *apiTokens) enabled() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.tokens) > 0
+}
+
+// lookup returns the token presented as "Authorization: Bearer <token>".
+// Every configured token is compared, so the time taken does not tell
+// which one came close.
+func (t *apiTokens) lookup(r *http.Request) (apiToken, bool) {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return apiToken{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var found apiToken
+	match := false
+	for _, tok := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(got), tok.token) == 1 {
+			found, match = tok, true
+		}
+	}
+	return found, match
+}
+
+// require lets a request through to next only when it carries a token of
+// at least role: 401 without a known token, 403 with one of a lesser role.
+// Without tokens, reads are open and scans are refused.
+func (t *apiTokens) require(role apiRole, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !t.enabled() {
+			if role == roleRead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "scan triggers need --api-tokens", http.StatusForbidden)
+			return
+		}
+		tok, ok := t.lookup(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tls-sweep"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if tok.role < role {
+			http.Error(w, "token "+tok.name+" may not do this", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withCaller(r.Context(), tok.name)))
+	})
+}
+
+type callerKey struct{}
+
+func withCaller(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, callerKey{}, name)
+}
+
+// caller is the name of the token a request was authenticated with, or
+// "anonymous" when the daemon has no tokens.
+func caller(ctx context.Context) string {
+	if name, ok := ctx.Value(callerKey{}).(string); ok {
+		return name
+	}
+	return "anonymous"
+}
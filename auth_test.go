@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAPITokens(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens")
+	os.WriteFile(path, []byte("# dashboards\ngrafana read r-token\n\nci scan s-token\n"), 0o600)
+	tokens, err := loadAPITokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0].name != "grafana" || tokens[0].role != roleRead || tokens[1].role != roleScan || string(tokens[1].token) != "s-token" {
+		t.Errorf("tokens = %+v", tokens)
+	}
+
+	for _, content := range []string{
+		"",
+		"ci scan\n",
+		"ci admin s-token\n",
+		"ci scan a\nci read b\n",
+	} {
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := loadAPITokens(path); err == nil {
+			t.Errorf("%q accepted", content)
+		}
+	}
+}
+
+func TestAPITokensRequire(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(caller(r.Context())))
+	})
+	open := &apiTokens{}
+	tokens := &apiTokens{}
+	tokens.set([]apiToken{{"grafana", roleRead, []byte("r-token")}, {"ci", roleScan, []byte("s-token")}})
+
+	for _, tc := range []struct {
+		tokens *apiTokens
+		role   apiRole
+		auth   string
+		code   int
+		caller string
+	}{
+		{open, roleRead, "", 200, "anonymous"},
+		{open, roleScan, "Bearer s-token", 403, ""},
+		{tokens, roleRead, "", 401, ""},
+		{tokens, roleRead, "Bearer wrong", 401, ""},
+		{tokens, roleRead, "r-token", 401, ""},
+		{tokens, roleRead, "Bearer r-token", 200, "grafana"},
+		{tokens, roleRead, "Bearer s-token", 200, "ci"},
+		{tokens, roleScan, "Bearer r-token", 403, ""},
+		{tokens, roleScan, "Bearer s-token", 200, "ci"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		tc.tokens.require(tc.role, ok).ServeHTTP(w, req)
+		if w.Code != tc.code || (tc.code == 200 && w.Body.String() != tc.caller) {
+			t.Errorf("role %d with %q = %d %q, want %d %q", tc.role, tc.auth, w.Code, w.Body.String(), tc.code, tc.caller)
+		}
+	}
+}
+
+func TestScanTrigger(t *testing.T) {
+	scanNow := make(chan string, 1)
+	ps := &profileSet{runners: map[string]*profileRunner{"travel": {trigger: make(chan string, 1)}}}
+	h := scanTrigger(scanNow, ps)
+
+	for _, tc := range []struct {
+		method, target string
+		code           int
+	}{
+		{"GET", "/scan", 405},
+		{"POST", "/scan", 202},
+		{"POST", "/scan", 202}, // already queued
+		{"POST", "/scan?profile=travel", 202},
+		{"POST", "/scan?profile=retail", 404},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+		if w.Code != tc.code {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.target, w.Code, tc.code)
+		}
+	}
+	if len(scanNow) != 1 || len(ps.runners["travel"].trigger) != 1 {
+		t.Errorf("queued %d default and %d travel scans", len(scanNow), len(ps.runners["travel"].trigger))
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// runBench scans a synthetic target set against a local TLS server for each
+// requested worker count and prints throughput and latency percentiles.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	targets := fs.Int("targets", 1000, "number of synthetic domains scanned per run")
+	workerCounts := fs.String("workers", "1,2,4,8,16,32,64", "comma-separated worker counts to compare")
+	serverDelay := fs.Duration("server-delay", 20*time.Millisecond, "artificial delay before the test server answers a handshake")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout for each dial attempt and for the TLS handshake")
+	perHost := fs.Int("max-per-host", 0, "max simultaneous connections to the test server (0 = unlimited)")
+	dnsLookups := fs.Int("max-dns-lookups", 0, "max concurrent (stubbed) DNS lookups (0 = unlimited)")
+	fs.Parse(args)
+
+	if *targets < 1 {
+		logger.Fatalf("--targets must be at least 1\n")
+	}
+	counts, err := parseWorkerCounts(*workerCounts)
+	if err != nil {
+		logger.Fatalf("Invalid --workers: %v\n", err)
+	}
+
+	ln, err := startBenchServer(*serverDelay)
+	if err != nil {
+		logger.Fatalf("Failed to start bench server: %v\n", err)
+	}
+	defer ln.Close()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &scanner{
+		port:    port,
+		timeout: *timeout,
+		lookupHost: func(string) ([]string, error) {
+			return []string{host}, nil
+		},
+		hostLimit: newKeyedLimiter(*perHost),
+		dnsLimit:  newKeyedLimiter(*dnsLookups),
+	}
+
+	domains := make([]string, *targets)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("bench-%05d.example", i)
+	}
+
+	logger.Printf("Benchmarking %d targets against %s (server delay %s)\n", len(domains), ln.Addr(), *serverDelay)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "workers\tdomains\telapsed\tdomains/s\tp50\tp95\tp99\terrors\t")
+	for _, n := range counts {
+		r := benchRun(s, domains, n)
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%.1f\t%s\t%s\t%s\t%d\t\n",
+			n, len(domains), r.elapsed.Round(time.Millisecond),
+			float64(len(domains))/r.elapsed.Seconds(),
+			r.percentile(50), r.percentile(95), r.percentile(99), r.errors)
+	}
+	tw.Flush()
+}
+
+type benchResult struct {
+	elapsed   time.Duration
+	latencies []time.Duration
+	errors    int
+}
+
+// percentile expects latencies to be sorted.
+func (r benchResult) percentile(p int) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := (len(r.latencies)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return r.latencies[i].Round(time.Microsecond)
+}
+
+func benchRun(s *scanner, domains []string, workers int) benchResult {
+	tasks := make(chan string, len(domains))
+	for _, d := range domains {
+		tasks <- d
+	}
+	close(tasks)
+
+	var mu sync.Mutex
+	var res benchResult
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range tasks {
+				t := time.Now()
+				r := s.scan(domain)
+				d := time.Since(t)
+
+				mu.Lock()
+				res.latencies = append(res.latencies, d)
+				if r.Status != "OK" {
+					res.errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+
+	sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+	return res
+}
+
+func parseWorkerCounts(v string) ([]int, error) {
+	var counts []int
+	for _, f := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("bad worker count %q", f)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
+
+// startBenchServer listens on a loopback port with a throwaway self-signed
+// certificate. Each connection waits delay before the handshake to mimic
+// network latency, otherwise loopback handshakes are purely CPU bound.
+func startBenchServer(delay time.Duration) (net.Listener, error) {
+	cert, err := selfSignedCert("tls-sweep-bench")
+	if err != nil {
+		return nil, err
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				time.Sleep(delay)
+				c.(*tls.Conn).Handshake()
+			}(conn)
+		}
+	}()
+	return ln, nil
+}
+
+func selfSignedCert(commonName string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		Issuer:       pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
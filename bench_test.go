@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWorkerCounts(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{in: "1", want: []int{1}},
+		{in: "1,2, 8", want: []int{1, 2, 8}},
+		{in: "0", wantErr: true},
+		{in: "-4", wantErr: true},
+		{in: "4,x", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWorkerCounts(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWorkerCounts(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWorkerCounts(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var r benchResult
+	if got := r.percentile(50); got != 0 {
+		t.Errorf("empty percentile = %v, want 0", got)
+	}
+
+	for i := 1; i <= 100; i++ {
+		r.latencies = append(r.latencies, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    int
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{1, 1 * time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{95, 95 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := r.percentile(tt.p); got != tt.want {
+			t.Errorf("percentile(%d) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	r.latencies = []time.Duration{3 * time.Millisecond}
+	if got := r.percentile(99); got != 3*time.Millisecond {
+		t.Errorf("single-sample percentile(99) = %v, want 3ms", got)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// certStorePath is --cert-store, the file every certificate seen is
+// recorded in.
+var certStorePath string
+
+// certHistory is the opened --cert-store, nil without one.
+var certHistory *certStore
+
+// certRecord is one certificate of the store, keyed by the SHA-256 of its
+// DER encoding, and the domains it was seen on.
+type certRecord struct {
+	Fingerprint  string         `json:"fingerprint"`
+	Subject      string         `json:"subject"`
+	Issuer       string         `json:"issuer"`
+	SerialNumber string         `json:"serial_number"`
+	NotBefore    string         `json:"not_before"`
+	ValidTo      string         `json:"valid_to"`
+	SPKI         string         `json:"spki_sha256"`
+	FirstSeen    time.Time      `json:"first_seen"`
+	LastSeen     time.Time      `json:"last_seen"`
+	Domains      []certSighting `json:"domains"`
+}
+
+// certSighting is when a certificate was served for one domain.
+type certSighting struct {
+	Domain    string    `json:"domain"`
+	IP        string    `json:"ip"` // the last address it was served from
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// certStore is a JSON file of certRecords, loaded whole and rewritten
+// atomically by save. Sweeps and daemon profiles share it.
+type certStore struct {
+	mu    sync.Mutex
+	path  string
+	certs map[string]*certRecord
+	dirty bool
+}
+
+func loadCertStore(path string) (*certStore, error) {
+	s := &certStore{path: path, certs: make(map[string]*certRecord)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []*certRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, r := range records {
+		s.certs[r.Fingerprint] = r
+	}
+	return s, nil
+}
+
+// openCertHistory loads --cert-store, if set, into certHistory.
+func openCertHistory() {
+	if certStorePath == "" {
+		return
+	}
+	s, err := loadCertStore(certStorePath)
+	if err != nil {
+		logger.Fatalf("Failed to load certificate store: %v\n", err)
+	}
+	certHistory = s
+}
+
+// record notes the leaf certificate of an OK result as seen at now.
+func (s *certStore) record(r ScanResult, now time.Time) {
+	if s == nil || len(r.Chain) == 0 {
+		return
+	}
+	now = now.UTC().Truncate(time.Second)
+	leaf := r.Chain[0]
+	sum := sha256.Sum256(leaf.Raw)
+	fp := hex.EncodeToString(sum[:])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = true
+	c, ok := s.certs[fp]
+	if !ok {
+		c = &certRecord{Fingerprint: fp, Subject: certSubject(leaf), Issuer: leaf.Issuer.CommonName,
+			SerialNumber: fmt.Sprintf("%x", leaf.SerialNumber), NotBefore: timestamp(leaf.NotBefore),
+			ValidTo: timestamp(leaf.NotAfter), SPKI: spkiHash(leaf), FirstSeen: now}
+		s.certs[fp] = c
+	}
+	if now.After(c.LastSeen) {
+		c.LastSeen = now
+	}
+	for i := range c.Domains {
+		if d := &c.Domains[i]; d.Domain == r.Domain {
+			if now.After(d.LastSeen) {
+				d.LastSeen, d.IP = now, r.IP
+			}
+			return
+		}
+	}
+	c.Domains = append(c.Domains, certSighting{Domain: r.Domain, IP: r.IP, FirstSeen: now, LastSeen: now})
+}
+
+// list returns the certificates, first seen first.
+func (s *certStore) list() []certRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted()
+}
+
+func (s *certStore) sorted() []certRecord {
+	out := make([]certRecord, 0, len(s.certs))
+	for _, c := range s.certs {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].FirstSeen.Equal(out[j].FirstSeen) {
+			return out[i].FirstSeen.Before(out[j].FirstSeen)
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// save writes the store back if anything was recorded since it was
+// loaded or last saved.
+func (s *certStore) save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// saveCertHistory saves certHistory, logging rather than failing: the
+// results are exported either way.
+func saveCertHistory() {
+	if err := certHistory.save(); err != nil {
+		logger.Printf("Failed to save certificate store: %v\n", err)
+	}
+}
+
+// recordCerts passes results through, recording every certificate served
+// in the store. It runs before scoring and filters, so the store has every
+// certificate seen, not only those exported.
+func recordCerts(in <-chan ScanResult, s *certStore) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		for r := range in {
+			s.record(r, time.Now())
+			out <- r
+		}
+	}()
+	return out
+}
+
+// certQuery selects certificates of the store for the certs subcommand.
+type certQuery struct {
+	domain      string
+	fingerprint string // a prefix is enough
+	since       time.Time
+}
+
+func (q certQuery) matches(c certRecord) bool {
+	if q.fingerprint != "" && !strings.HasPrefix(c.Fingerprint, strings.ToLower(q.fingerprint)) {
+		return false
+	}
+	if c.LastSeen.Before(q.since) {
+		return false
+	}
+	if q.domain == "" {
+		return true
+	}
+	for _, d := range c.Domains {
+		if strings.EqualFold(d.Domain, q.domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCertTable prints one certificate per line, with the domains it was
+// seen on.
+func writeCertTable(w io.Writer, certs []certRecord) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FINGERPRINT\tSUBJECT\tISSUER\tVALID TO\tFIRST SEEN\tLAST SEEN\tDOMAINS")
+	for _, c := range certs {
+		domains := make([]string, len(c.Domains))
+		for i, d := range c.Domains {
+			domains[i] = d.Domain
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Fingerprint[:16], c.Subject, c.Issuer, c.ValidTo,
+			c.FirstSeen.Format(time.RFC3339), c.LastSeen.Format(time.RFC3339), strings.Join(domains, ","))
+	}
+	tw.Flush()
+}
+
+// runCerts queries a certificate store.
+func runCerts(args []string) {
+	fs := flag.NewFlagSet("certs", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep certs [--domain <domain>] [--fingerprint <sha256>] [--since <time>] [--json] <cert-store>")
+		fs.PrintDefaults()
+	}
+	var q certQuery
+	fs.StringVar(&q.domain, "domain", "", "only certificates seen on this domain")
+	fs.StringVar(&q.fingerprint, "fingerprint", "", "only the certificate with this SHA-256 fingerprint, or a prefix of it")
+	since := fs.String("since", "", "only certificates seen at or after this RFC 3339 time")
+	asJSON := fs.Bool("json", false, "print the certificates and every domain sighting as a JSON array")
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			logger.Fatalf("--since: %v\n", err)
+		}
+		q.since = t
+	}
+	if _, err := os.Stat(args[0]); err != nil {
+		logger.Fatalf("Failed to open certificate store: %v\n", err)
+	}
+	s, err := loadCertStore(args[0])
+	if err != nil {
+		logger.Fatalf("Failed to load certificate store: %v\n", err)
+	}
+	out := []certRecord{}
+	for _, c := range s.list() {
+		if q.matches(c) {
+			out = append(out, c)
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+		return
+	}
+	writeCertTable(os.Stdout, out)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testLeaf(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	c, err := selfSignedCert(cn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func TestCertStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certs.json")
+	s, err := loadCertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, other := testLeaf(t, "shop.example"), testLeaf(t, "other.example")
+	day1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	s.record(ScanResult{Domain: "shop.example", IP: "192.0.2.1", Status: "OK", Chain: []*x509.Certificate{shared}}, day1)
+	s.record(ScanResult{Domain: "shop.zz", IP: "192.0.2.2", Status: "OK", Chain: []*x509.Certificate{shared}}, day2)
+	s.record(ScanResult{Domain: "shop.example", IP: "192.0.2.3", Status: "OK", Chain: []*x509.Certificate{shared}}, day2)
+	s.record(ScanResult{Domain: "other.example", IP: "192.0.2.4", Status: "OK", Chain: []*x509.Certificate{other}}, day2)
+	s.record(ScanResult{Domain: "gone.example", IP: "-", Status: "NXDOMAIN"}, day2)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := loaded.list()
+	if len(certs) != 2 {
+		t.Fatalf("got %d certificates", len(certs))
+	}
+	c := certs[0]
+	if c.Subject != "shop.example" || !c.FirstSeen.Equal(day1) || !c.LastSeen.Equal(day2) || len(c.Domains) != 2 {
+		t.Fatalf("first certificate = %+v", c)
+	}
+	if d := c.Domains[0]; d.Domain != "shop.example" || d.IP != "192.0.2.3" || !d.FirstSeen.Equal(day1) || !d.LastSeen.Equal(day2) {
+		t.Errorf("sighting = %+v", d)
+	}
+
+	for _, q := range []struct {
+		query certQuery
+		want  int
+	}{
+		{certQuery{}, 2},
+		{certQuery{domain: "SHOP.ZZ"}, 1},
+		{certQuery{fingerprint: strings.ToUpper(c.Fingerprint[:8])}, 1},
+		{certQuery{since: day2.Add(time.Second)}, 0},
+	} {
+		n := 0
+		for _, c := range certs {
+			if q.query.matches(c) {
+				n++
+			}
+		}
+		if n != q.want {
+			t.Errorf("%+v matched %d, want %d", q.query, n, q.want)
+		}
+	}
+
+	var b bytes.Buffer
+	writeCertTable(&b, certs[:1])
+	if out := b.String(); !strings.Contains(out, c.Fingerprint[:16]) || !strings.Contains(out, "shop.example,shop.zz") {
+		t.Errorf("table:\n%s", out)
+	}
+}
+
+func TestCertStoreSavesOnlyChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certs.json")
+	s, _ := loadCertStore(path)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCertStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(path); len(matches) != 0 {
+		t.Error("an unchanged store was written")
+	}
+	var none *certStore
+	none.record(ScanResult{Domain: "shop.example"}, time.Now())
+	if err := none.save(); err != nil {
+		t.Error(err)
+	}
+}
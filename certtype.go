@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CA/Browser Forum certificate policy OIDs, by validation level.
+var cabfPolicies = []struct {
+	oid  asn1.ObjectIdentifier
+	kind string
+}{
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 1}, "EV"},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}, "OV"},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 3}, "IV"},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}, "DV"},
+}
+
+// certType is DV, OV, IV or EV from the CA/Browser Forum policy OID of
+// cert, or "" when it has none, as private and non-TLS certificates.
+func certType(cert *x509.Certificate) string {
+	for _, p := range cabfPolicies {
+		for _, oid := range cert.PolicyIdentifiers {
+			if oid.Equal(p.oid) {
+				return p.kind
+			}
+		}
+	}
+	return ""
+}
+
+var ekuNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// extKeyUsage lists the extended key usages of cert, unknown ones as OIDs.
+func extKeyUsage(cert *x509.Certificate) string {
+	var names []string
+	for _, u := range cert.ExtKeyUsage {
+		if name, ok := ekuNames[u]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("eku-%d", u))
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// validityLimits are the Baseline Requirements' maximum validity periods,
+// each for certificates issued from since on, newest first.
+var validityLimits = []struct {
+	since time.Time
+	days  int
+}{
+	{time.Date(2029, 3, 15, 0, 0, 0, 0, time.UTC), 47},
+	{time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC), 100},
+	{time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC), 200},
+	{time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC), 398},
+	{time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC), 825},
+	{time.Date(2015, 4, 1, 0, 0, 0, 0, time.UTC), 1187}, // 39 months
+}
+
+// validityDays is the validity period of cert in days, rounded up. The
+// Baseline Requirements count both NotBefore and NotAfter as valid.
+func validityDays(cert *x509.Certificate) int {
+	d := cert.NotAfter.Sub(cert.NotBefore) + time.Second
+	return int((d + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+// validityViolation describes how cert exceeds the maximum validity of the
+// time it was issued, or is "" when it does not.
+func validityViolation(cert *x509.Certificate) string {
+	for _, l := range validityLimits {
+		if cert.NotBefore.Before(l.since) {
+			continue
+		}
+		if d := cert.NotAfter.Sub(cert.NotBefore) + time.Second; d > time.Duration(l.days)*24*time.Hour {
+			return fmt.Sprintf("%d days, over the %d allowed since %s", validityDays(cert), l.days, l.since.Format("2006-01-02"))
+		}
+		return ""
+	}
+	return ""
+}
+
+// setCertType records the EKU, validation level and validity period of
+// the leaf. Only certificates under the Baseline Requirements, which
+// carry a CA/Browser Forum policy, are held to their validity limits.
+func setCertType(r *ScanResult, cert *x509.Certificate) {
+	r.EKU = extKeyUsage(cert)
+	r.CertType = certType(cert)
+	r.ValidityDays = validityDays(cert)
+	if r.CertType != "" {
+		r.ValidityViolation = validityViolation(cert)
+	}
+}
+
+func validityPeriodCheck(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+	return "validity period of " + r.ValidityViolation, r.ValidityViolation != ""
+}
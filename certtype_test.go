@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+	"time"
+)
+
+func TestCertType(t *testing.T) {
+	day := 24 * time.Hour
+	issued := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	cert := func(policy asn1.ObjectIdentifier, validity time.Duration) *x509.Certificate {
+		c := &x509.Certificate{
+			NotBefore:          issued,
+			NotAfter:           issued.Add(validity - time.Second),
+			ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			UnknownExtKeyUsage: []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 10, 3, 3}},
+		}
+		if policy != nil {
+			c.PolicyIdentifiers = []asn1.ObjectIdentifier{{2, 16, 840, 1, 114412, 1, 1}, policy}
+		}
+		return c
+	}
+
+	var r ScanResult
+	setCertType(&r, cert(asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}, 90*day))
+	if r.CertType != "DV" || r.ValidityDays != 90 || r.ValidityViolation != "" || r.EKU != "serverAuth, clientAuth, 1.3.6.1.4.1.311.10.3.3" {
+		t.Errorf("DV, 90 days: %+v", r)
+	}
+
+	r = ScanResult{}
+	setCertType(&r, cert(asn1.ObjectIdentifier{2, 23, 140, 1, 1}, 397*day))
+	if r.CertType != "EV" || r.ValidityViolation != "397 days, over the 200 allowed since 2026-03-15" {
+		t.Errorf("EV, 397 days: %+v", r)
+	}
+
+	// A private certificate is not held to the Baseline Requirements.
+	r = ScanResult{}
+	setCertType(&r, cert(nil, 3650*day))
+	if r.CertType != "" || r.ValidityDays != 3650 || r.ValidityViolation != "" {
+		t.Errorf("private: %+v", r)
+	}
+}
+
+func TestValidityViolation(t *testing.T) {
+	day := 24 * time.Hour
+	for _, c := range []struct {
+		issued   time.Time
+		validity time.Duration
+		want     bool
+	}{
+		{time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC), 398 * day, false},
+		{time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC), 200 * day, false},
+		{time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC), 200*day + time.Second, true},
+		{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), 399 * day, true},
+		{time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), 825 * day, false},
+		{time.Date(2029, 6, 1, 0, 0, 0, 0, time.UTC), 90 * day, true},
+		{time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC), 3650 * day, false},
+	} {
+		cert := &x509.Certificate{NotBefore: c.issued, NotAfter: c.issued.Add(c.validity - time.Second)}
+		if got := validityViolation(cert); (got != "") != c.want {
+			t.Errorf("issued %s, valid %v: %q", c.issued.Format("2006-01-02"), c.validity, got)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+)
+
+// chainLimit returns the served certificate that expires first. A
+// self-issued root sent along with the chain is skipped: clients use their
+// own copy of it. The leaf counts even when self-signed.
+func chainLimit(chain []*x509.Certificate) *x509.Certificate {
+	var first *x509.Certificate
+	for i, c := range chain {
+		if i > 0 && len(c.RawSubject) > 0 && bytes.Equal(c.RawIssuer, c.RawSubject) {
+			continue
+		}
+		if first == nil || c.NotAfter.Before(first.NotAfter) {
+			first = c
+		}
+	}
+	return first
+}
+
+// setChainValidity records the effective validity of the served chain
+// and, when an intermediate ends it before the leaf does, which one.
+func setChainValidity(r *ScanResult, chain []*x509.Certificate) {
+	limit := chainLimit(chain)
+	if limit == nil {
+		return
+	}
+	r.ChainValidTo = timestamp(limit.NotAfter)
+	if limit != chain[0] {
+		r.ChainLimitedBy = certSubject(limit)
+	}
+}
+
+// intermediateExpiringCheck fails when an intermediate expires within the
+// expiring window, leaf or not, which is how the AddTrust root expiry
+// broke clients in 2020.
+func intermediateExpiringCheck(_ *scanner, r ScanResult, o checkOptions) (string, bool) {
+	if leafOf(r) == nil {
+		return "", false
+	}
+	limit := chainLimit(r.Chain)
+	if limit == r.Chain[0] || limit.NotAfter.After(o.now.AddDate(0, 0, o.expiringDays)) {
+		return "", false
+	}
+	verb := "expires"
+	if o.now.After(limit.NotAfter) {
+		verb = "expired"
+	}
+	return fmt.Sprintf("intermediate %s %s %s, before the leaf", certSubject(limit), verb, limit.NotAfter.Format("2006-01-02")), true
+}
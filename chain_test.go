@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainValidity(t *testing.T) {
+	now := time.Date(2020, 5, 20, 0, 0, 0, 0, time.UTC)
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "shop.example"}, NotAfter: now.AddDate(0, 0, 90)}
+	intermediate := &x509.Certificate{
+		Subject:    pkix.Name{CommonName: "AddTrust External CA Root"},
+		RawSubject: []byte("addtrust"), RawIssuer: []byte("addtrust-legacy"),
+		NotAfter: now.AddDate(0, 0, 10),
+	}
+	// A served root that has already expired is ignored: clients trust
+	// their own copy, or a newer one.
+	root := &x509.Certificate{RawSubject: []byte("root"), RawIssuer: []byte("root"), NotAfter: now.AddDate(0, 0, -1)}
+
+	r := certResult("shop.example", "192.0.2.1", []*x509.Certificate{leaf, intermediate, root})
+	if r.ChainValidTo != "2020-05-30T00:00:00Z" || r.ChainLimitedBy != "AddTrust External CA Root" {
+		t.Errorf("chain validity = %s %q", r.ChainValidTo, r.ChainLimitedBy)
+	}
+	if detail, failed := intermediateExpiringCheck(nil, r, checkOptions{now: now, expiringDays: 30}); !failed || !strings.Contains(detail, "AddTrust") {
+		t.Errorf("30 days: %q %v, want a failure", detail, failed)
+	}
+	if _, failed := intermediateExpiringCheck(nil, r, checkOptions{now: now, expiringDays: 5}); failed {
+		t.Error("5 days: failed, want a pass")
+	}
+
+	r = certResult("shop.example", "192.0.2.1", []*x509.Certificate{leaf})
+	if r.ChainValidTo != "2020-08-18T00:00:00Z" || r.ChainLimitedBy != "" {
+		t.Errorf("leaf only = %s %q", r.ChainValidTo, r.ChainLimitedBy)
+	}
+	if _, failed := intermediateExpiringCheck(nil, r, checkOptions{now: now, expiringDays: 365}); failed {
+		t.Error("leaf only: failed, the leaf is the expiring check's job")
+	}
+}
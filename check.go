@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exit codes of the check subcommand.
+const (
+	checkPassed = 0
+	checkFailed = 1
+	checkError  = 2
+)
+
+// checkFinding is one failed check, as printed and as emitted in JSON.
+type checkFinding struct {
+	Domain string `json:"domain"`
+	Check  string `json:"check"`
+	Detail string `json:"detail"`
+}
+
+// checkFunc inspects one scan result and returns a detail string when the
+// check fails. Chain is set whenever the status is OK.
+type checkFunc func(s *scanner, r ScanResult, opts checkOptions) (string, bool)
+
+type checkOptions struct {
+	now          time.Time
+	expiringDays int
+	// allowedIssuers holds lower-cased CA names, see issuerAllowed.
+	allowedIssuers map[string]bool
+	// lookupCT, when set, searches Certificate Transparency logs.
+	lookupCT func(domain string) ([]ctEntry, error)
+}
+
+var checks = map[string]checkFunc{
+	"unreachable": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		return r.Status, r.Status != "OK"
+	},
+	"expired": func(_ *scanner, r ScanResult, o checkOptions) (string, bool) {
+		leaf := leafOf(r)
+		if leaf == nil || !o.now.After(leaf.NotAfter) {
+			return "", false
+		}
+		return "expired " + leaf.NotAfter.Format("2006-01-02"), true
+	},
+	"expiring": func(_ *scanner, r ScanResult, o checkOptions) (string, bool) {
+		leaf := leafOf(r)
+		if leaf == nil || leaf.NotAfter.After(o.now.AddDate(0, 0, o.expiringDays)) {
+			return "", false
+		}
+		return fmt.Sprintf("expires %s, within %d days", leaf.NotAfter.Format("2006-01-02"), o.expiringDays), true
+	},
+	"weak-key": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		leaf := leafOf(r)
+		if leaf == nil {
+			return "", false
+		}
+		switch k := leaf.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if bits := k.N.BitLen(); bits < 2048 {
+				return fmt.Sprintf("RSA %d bits", bits), true
+			}
+		case *ecdsa.PublicKey:
+			if bits := k.Curve.Params().BitSize; bits < 256 {
+				return fmt.Sprintf("ECDSA %d bits", bits), true
+			}
+		}
+		return "", false
+	},
+	"self-signed": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		leaf := leafOf(r)
+		// CheckSignatureFrom would insist on the CA bit, which
+		// self-signed leaves rarely have.
+		if leaf == nil || !bytes.Equal(leaf.RawIssuer, leaf.RawSubject) ||
+			leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) != nil {
+			return "", false
+		}
+		return "issued by itself", true
+	},
+	"hostname": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		leaf := leafOf(r)
+		if leaf == nil {
+			return "", false
+		}
+		if err := leaf.VerifyHostname(r.Domain); err != nil {
+			return fmt.Sprintf("certificate is for %s", certSubject(leaf)), true
+		}
+		return "", false
+	},
+	"untrusted": func(_ *scanner, r ScanResult, o checkOptions) (string, bool) {
+		leaf := leafOf(r)
+		if leaf == nil {
+			return "", false
+		}
+		intermediates := x509.NewCertPool()
+		for _, c := range r.Chain[1:] {
+			intermediates.AddCert(c)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates, CurrentTime: o.now}); err != nil {
+			return err.Error(), true
+		}
+		return "", false
+	},
+	"renewal-overdue":       renewalCheck,
+	"intermediate-expiring": intermediateExpiringCheck,
+	"legacy-chain":          legacyChainCheck,
+	"must-staple":           mustStapleCheck,
+	"validity-period":       validityPeriodCheck,
+	"unexpected-ca": func(_ *scanner, r ScanResult, o checkOptions) (string, bool) {
+		leaf := leafOf(r)
+		if leaf == nil || issuerAllowed(r.Chain, o.allowedIssuers) {
+			return "", false
+		}
+		return "issued by " + issuerName(leaf) + ", not an allowed CA", true
+	},
+	"tls10": func(s *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		return "accepts TLS 1.0", r.Status == "OK" && s.acceptsVersion(r.IP, r.Domain, tls.VersionTLS10)
+	},
+	"tls11": func(s *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		return "accepts TLS 1.1", r.Status == "OK" && s.acceptsVersion(r.IP, r.Domain, tls.VersionTLS11)
+	},
+	// The legacy ClientHello checks read what checkInsecure filled in, so
+	// one handshake serves all four; runChecks turns it on.
+	"insecure-renegotiation": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		return "no secure renegotiation over TLS 1.2", r.InsecureRenegotiation
+	},
+	"heartbeat": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		return "heartbeat extension enabled", r.Heartbeat
+	},
+	"compression": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		return "accepts TLS compression", r.Compression
+	},
+	"deprecated-extensions": func(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+		return "takes up " + r.DeprecatedExtensions, r.DeprecatedExtensions != ""
+	},
+}
+
+// legacyHelloChecks need the legacy ClientHello of checkInsecure.
+var legacyHelloChecks = []string{"insecure-renegotiation", "heartbeat", "compression", "deprecated-extensions"}
+
+// checkDescriptions says what each check fails on, for SARIF rules.
+var checkDescriptions = map[string]string{
+	"unreachable":            "The domain does not resolve or complete a TLS handshake",
+	"expired":                "The certificate has expired",
+	"expiring":               "The certificate expires soon",
+	"weak-key":               "The certificate key is RSA below 2048 bits or ECDSA below 256 bits",
+	"self-signed":            "The certificate is signed by its own key",
+	"hostname":               "The certificate does not cover the domain",
+	"untrusted":              "The certificate chain does not verify against the system roots",
+	"renewal-overdue":        "A short-lived certificate is past its automated renewal window",
+	"intermediate-expiring":  "An intermediate certificate expires soon, before the leaf",
+	"legacy-chain":           "The served chain relies on an expired cross-sign or root that older clients follow",
+	"unexpected-ca":          "The certificate is not issued by one of the allowed CAs",
+	"tls10":                  "The server accepts TLS 1.0",
+	"tls11":                  "The server accepts TLS 1.1",
+	"insecure-renegotiation": "The server does not support secure renegotiation over TLS 1.2",
+	"heartbeat":              "The server enables the TLS heartbeat extension",
+	"compression":            "The server accepts TLS compression, which CRIME exploits",
+	"deprecated-extensions":  "The server takes up deprecated TLS extensions such as truncated_hmac",
+	"must-staple":            "The certificate requires OCSP stapling but the server does not staple",
+	"validity-period":        "The certificate is valid for longer than the Baseline Requirements allow",
+}
+
+// issuerAllowed reports whether an issuer of chain has an organization or
+// common name in allowed. The whole served chain is considered so that an
+// allowlist can name either the CA ("Let's Encrypt") or the intermediate
+// ("R11").
+func issuerAllowed(chain []*x509.Certificate, allowed map[string]bool) bool {
+	for _, c := range chain {
+		names := append([]string{c.Issuer.CommonName}, c.Issuer.Organization...)
+		for _, n := range names {
+			if allowed[strings.ToLower(n)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func issuerName(cert *x509.Certificate) string {
+	if len(cert.Issuer.Organization) > 0 {
+		return cert.Issuer.Organization[0]
+	}
+	return cert.Issuer.CommonName
+}
+
+// loadAllowedIssuers reads one CA name per line, skipping blanks and #
+// comments.
+func loadAllowedIssuers(path string) (map[string]bool, error) {
+	names, _, err := readDomains(path)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool, len(names))
+	for _, n := range names {
+		allowed[n] = true
+	}
+	return allowed, nil
+}
+
+func leafOf(r ScanResult) *x509.Certificate {
+	if r.Status != "OK" || len(r.Chain) == 0 {
+		return nil
+	}
+	return r.Chain[0]
+}
+
+func checkNames() string {
+	var names []string
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// acceptsVersion reports whether ip completes a handshake for domain with
+// only version enabled.
+func (s *scanner) acceptsVersion(ip, domain string, version uint16) bool {
+	raw, err := s.dialRace([]string{ip}, s.port)
+	if err != nil {
+		return false
+	}
+	conn, err := s.handshakeVersion(raw, domain, version)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep check --input <file> [flags]")
+		fmt.Fprintln(fs.Output(), "Exit status is 0 when every check passed, 1 when one failed and 2 on errors.")
+		fs.PrintDefaults()
+	}
+	input := fs.String("input", "", "file with one domain per line, or - for stdin")
+	failOn := fs.String("fail-on", "expired,unreachable", "comma-separated checks that fail the run: "+checkNames())
+	expiringDays := fs.Int("expiring-days", 30, "days before expiry the expiring check fails")
+	issuersFile := fs.String("allowed-issuers", "", "file with one allowed CA organization or common name per line, for the unexpected-ca check")
+	useCT := fs.Bool("ct", false, "look up renewal-overdue certificates on crt.sh to tell stalled automation from undeployed renewals")
+	format := fs.String("format", "text", "output format: text, json or sarif")
+	issues := fs.String("issues", "", "open a ticket per failed domain and check, unless one is open: github:owner/repo or jira:https://host/PROJECT")
+	issueLabels := fs.String("issue-labels", "tls-sweep", "comma-separated labels of the tickets; the first one marks tls-sweep tickets")
+	registerScanFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return checkError
+	}
+	if *input == "" {
+		fs.Usage()
+		return checkError
+	}
+	if maxWorkers < 1 {
+		fmt.Fprintln(os.Stderr, "--workers must be at least 1")
+		return checkError
+	}
+	if err := checkTLSRange(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return checkError
+	}
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q\n", *format)
+		return checkError
+	}
+
+	var enabled []string
+	for _, name := range strings.Split(*failOn, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := checks[name]; !ok {
+			fmt.Fprintf(os.Stderr, "Unknown check %q (want %s)\n", name, checkNames())
+			return checkError
+		}
+		enabled = append(enabled, name)
+	}
+
+	opts := checkOptions{now: time.Now(), expiringDays: *expiringDays}
+	if *issuersFile != "" {
+		var err error
+		if opts.allowedIssuers, err = loadAllowedIssuers(*issuersFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", *issuersFile, err)
+			return checkError
+		}
+	}
+	if *useCT {
+		opts.lookupCT = crtshLookup
+	}
+	if *issuersFile == "" && slices.Contains(enabled, "unexpected-ca") {
+		fmt.Fprintln(os.Stderr, "The unexpected-ca check needs --allowed-issuers")
+		return checkError
+	}
+
+	var tracker issueTracker
+	var labels []string
+	if *issues != "" {
+		var err error
+		if tracker, err = newIssueTracker(*issues); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return checkError
+		}
+		for _, l := range strings.Split(*issueLabels, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				labels = append(labels, l)
+			}
+		}
+		if len(labels) == 0 {
+			fmt.Fprintln(os.Stderr, "--issue-labels needs at least one label")
+			return checkError
+		}
+	}
+
+	domains, lines, err := readDomains(*input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", *input, err)
+		return checkError
+	}
+
+	findings := runChecks(newScanner(), domains, enabled, opts)
+	if *format == "sarif" {
+		err = writeSARIF(os.Stdout, *input, lines, enabled, findings)
+	} else {
+		err = writeFindings(os.Stdout, *format, len(domains), findings)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write results: %v\n", err)
+		return checkError
+	}
+	if tracker != nil {
+		created, err := fileIssues(tracker, findings, labels)
+		fmt.Fprintf(os.Stderr, "Opened %d issues for %d findings\n", created, len(findings))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to file issues: %v\n", err)
+			return checkError
+		}
+	}
+	if len(findings) > 0 {
+		return checkFailed
+	}
+	return checkPassed
+}
+
+// readDomains reads one domain per line, skipping blanks and # comments,
+// and also returns the line each domain was first found on.
+func readDomains(path string) ([]string, map[string]int, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var domains []string
+	lineOf := make(map[string]int)
+	lines := bufio.NewScanner(r)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domain := strings.ToLower(line)
+		domains = append(domains, domain)
+		if _, ok := lineOf[domain]; !ok {
+			lineOf[domain] = n
+		}
+	}
+	return domains, lineOf, lines.Err()
+}
+
+// runChecks scans domains with s.workerCount() workers and returns the failed
+// checks sorted by domain and check name.
+func runChecks(s *scanner, domains, enabled []string, opts checkOptions) []checkFinding {
+	for _, name := range legacyHelloChecks {
+		if slices.Contains(enabled, name) {
+			s.insecure = true
+		}
+	}
+	tasks := make(chan string)
+	var mu sync.Mutex
+	var findings []checkFinding
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workerCount(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range tasks {
+				r := s.scan(domain)
+				for _, name := range enabled {
+					if detail, failed := checks[name](s, r, opts); failed {
+						mu.Lock()
+						findings = append(findings, checkFinding{Domain: domain, Check: name, Detail: detail})
+						mu.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	for _, d := range domains {
+		tasks <- d
+	}
+	close(tasks)
+	wg.Wait()
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Domain != findings[j].Domain {
+			return findings[i].Domain < findings[j].Domain
+		}
+		return findings[i].Check < findings[j].Check
+	})
+	return findings
+}
+
+func writeFindings(w io.Writer, format string, checked int, findings []checkFinding) error {
+	if format == "json" {
+		if findings == nil {
+			findings = []checkFinding{}
+		}
+		return json.NewEncoder(w).Encode(struct {
+			Checked  int            `json:"checked"`
+			Failures []checkFinding `json:"failures"`
+		}{checked, findings})
+	}
+	for _, f := range findings {
+		if _, err := fmt.Fprintf(w, "FAIL %s %s: %s\n", f.Domain, f.Check, f.Detail); err != nil {
+			return err
+		}
+	}
+	failed := make(map[string]bool)
+	for _, f := range findings {
+		failed[f.Domain] = true
+	}
+	_, err := fmt.Fprintf(w, "%d domains checked, %d failed\n", checked, len(failed))
+	return err
+}
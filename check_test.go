@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunChecks(t *testing.T) {
+	cert, err := selfSignedCert("legacy.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	s := &scanner{
+		port:    port,
+		timeout: time.Second,
+		lookupHost: func(host string) ([]string, error) {
+			if host == "gone.example" {
+				return nil, errors.New("timeout")
+			}
+			return []string{"127.0.0.1"}, nil
+		},
+	}
+	enabled := []string{"expired", "expiring", "self-signed", "tls10", "unreachable", "weak-key"}
+	findings := runChecks(s, []string{"legacy.example", "gone.example"}, enabled, checkOptions{now: time.Now(), expiringDays: 30})
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Domain+" "+f.Check)
+	}
+	want := "gone.example unreachable,legacy.example expiring,legacy.example self-signed,legacy.example tls10"
+	if strings.Join(got, ",") != want {
+		t.Errorf("findings = %v, want %s", got, want)
+	}
+
+	findings = runChecks(s, []string{"legacy.example"}, []string{"expired"}, checkOptions{now: time.Now().AddDate(0, 0, 2)})
+	if len(findings) != 1 || findings[0].Check != "expired" {
+		t.Errorf("two days later: %+v, want expired", findings)
+	}
+}
+
+func TestLegacyHelloChecksShareOneHello(t *testing.T) {
+	cert, err := selfSignedCert("new.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var accepted atomic.Int32
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &scanner{port: port, timeout: time.Second, lookupHost: func(string) ([]string, error) {
+		return []string{"127.0.0.1"}, nil
+	}}
+
+	if findings := runChecks(s, []string{"new.example"}, legacyHelloChecks, checkOptions{now: time.Now()}); len(findings) != 0 {
+		t.Errorf("crypto/tls server: %+v", findings)
+	}
+	// The scan's handshake plus a single legacy ClientHello.
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("%d connections for four checks, want 2", n)
+	}
+}
+
+func TestWriteFindings(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFindings(&buf, "json", 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Checked  int            `json:"checked"`
+		Failures []checkFinding `json:"failures"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil || out.Checked != 3 || out.Failures == nil {
+		t.Errorf("json output %s (%v)", buf.String(), err)
+	}
+
+	buf.Reset()
+	writeFindings(&buf, "text", 2, []checkFinding{{"a.example", "expired", "expired 2024-01-01"}, {"a.example", "tls10", "accepts TLS 1.0"}})
+	if want := "FAIL a.example expired: expired 2024-01-01\nFAIL a.example tls10: accepts TLS 1.0\n2 domains checked, 1 failed\n"; buf.String() != want {
+		t.Errorf("text output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestUnexpectedCA(t *testing.T) {
+	cert, err := selfSignedCert("shadow.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := certResult("shadow.example", "192.0.2.1", []*x509.Certificate{leaf})
+
+	check := checks["unexpected-ca"]
+	if detail, failed := check(nil, r, checkOptions{allowedIssuers: map[string]bool{"let's encrypt": true}}); !failed || detail != "issued by shadow.example, not an allowed CA" {
+		t.Errorf("unexpected-ca = %q, %v", detail, failed)
+	}
+	if _, failed := check(nil, r, checkOptions{allowedIssuers: map[string]bool{"shadow.example": true}}); failed {
+		t.Error("allowed issuer failed the check")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// clientHello is a ClientHello fingerprint the probe presents. Zero fields
+// leave the crypto/tls defaults. The TLS 1.3 cipher suites are fixed by
+// crypto/tls, so ciphers only shapes the TLS 1.2 and older part of the
+// offer.
+type clientHello struct {
+	name       string
+	minVersion uint16
+	maxVersion uint16
+	ciphers    []uint16
+	curves     []tls.CurveID
+}
+
+var clientHellos = map[string]clientHello{
+	// A current browser: TLS 1.2 and 1.3, forward-secret AEAD suites only.
+	"modern": {
+		minVersion: tls.VersionTLS12,
+		maxVersion: tls.VersionTLS13,
+		ciphers: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+	// Android 4.4: no TLS 1.3, CBC and plain-RSA suites, NIST curves only.
+	"android-4": {
+		minVersion: tls.VersionTLS10,
+		maxVersion: tls.VersionTLS12,
+		ciphers: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+			tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+			tls.TLS_RSA_WITH_RC4_128_SHA,
+			tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		},
+		curves: []tls.CurveID{tls.CurveP256, tls.CurveP384},
+	},
+	// FIPS 140 approved algorithms: AES-GCM over ECDHE on NIST curves.
+	"fips": {
+		minVersion: tls.VersionTLS12,
+		maxVersion: tls.VersionTLS13,
+		ciphers: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+		curves: []tls.CurveID{tls.CurveP256, tls.CurveP384},
+	},
+}
+
+// scanClientHello is the fingerprint chosen with --client-hello; the zero
+// value is the crypto/tls default.
+var scanClientHello clientHello
+
+func clientHelloNames() string {
+	var names []string
+	for name := range clientHellos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// setClientHello selects a named fingerprint, or with custom:SUITE,...
+// offers exactly those cipher suites over TLS 1.0 to 1.2.
+func setClientHello(v string) error {
+	if list, ok := strings.CutPrefix(v, "custom:"); ok {
+		ciphers, err := parseCipherSuites(list)
+		if err != nil {
+			return err
+		}
+		scanClientHello = clientHello{name: "custom", minVersion: tls.VersionTLS10, maxVersion: tls.VersionTLS12, ciphers: ciphers}
+		return nil
+	}
+	h, ok := clientHellos[v]
+	if !ok {
+		return fmt.Errorf("unknown ClientHello %q (want one of %s, or custom:SUITE,...)", v, clientHelloNames())
+	}
+	h.name = v
+	scanClientHello = h
+	return nil
+}
+
+// parseCipherSuites resolves a comma-separated list of IANA cipher suite
+// names, insecure ones included.
+func parseCipherSuites(list string) ([]uint16, error) {
+	ids := make(map[string]uint16)
+	for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ids[c.Name] = c.ID
+	}
+	var out []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// apply shapes config after h. A version config already pins wins over the
+// fingerprint's range.
+func (h clientHello) apply(config *tls.Config) {
+	if config.MinVersion == 0 && config.MaxVersion == 0 {
+		config.MinVersion, config.MaxVersion = h.minVersion, h.maxVersion
+	}
+	config.CipherSuites = h.ciphers
+	config.CurvePreferences = h.curves
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSetClientHello(t *testing.T) {
+	defer func(h clientHello) { scanClientHello = h }(scanClientHello)
+
+	if err := setClientHello("netscape"); err == nil {
+		t.Error("unknown fingerprint accepted")
+	}
+	if err := setClientHello("custom:TLS_RSA_WITH_AES_128_CBC_SHA,TLS_BOGUS"); err == nil {
+		t.Error("unknown cipher suite accepted")
+	}
+	if err := setClientHello("custom:TLS_RSA_WITH_AES_128_CBC_SHA, TLS_RSA_WITH_RC4_128_SHA"); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA, tls.TLS_RSA_WITH_RC4_128_SHA}
+	if h := scanClientHello; h.name != "custom" || len(h.ciphers) != 2 || h.ciphers[0] != want[0] || h.ciphers[1] != want[1] || h.maxVersion != tls.VersionTLS12 {
+		t.Errorf("custom = %+v", h)
+	}
+	if err := setClientHello("fips"); err != nil || scanClientHello.name != "fips" {
+		t.Errorf("fips: %v, %+v", err, scanClientHello)
+	}
+}
+
+func TestClientHelloChangesOutcome(t *testing.T) {
+	cert, err := selfSignedCert("legacy.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A server stuck on TLS 1.2 CBC suites, as old appliances are.
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Read(make([]byte, 1))
+				conn.Close()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	for _, tc := range []struct{ hello, status, cipher string }{
+		{"modern", "TLS ERROR", ""},
+		{"android-4", "OK", "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA"},
+	} {
+		h := clientHellos[tc.hello]
+		h.name = tc.hello
+		s := &scanner{port: port, timeout: 2 * time.Second, hello: h, lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil }}
+		r := s.label(s.scan("legacy.example"))
+		if r.Status != tc.status || r.CipherSuite != tc.cipher || r.ClientHello != tc.hello {
+			t.Errorf("%s: got %s %q %q, want %s %q", tc.hello, r.Status, r.CipherSuite, r.ClientHello, tc.status, tc.cipher)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// command is a subcommand, as completed and documented.
+type command struct {
+	name    string // "" for the default sweep
+	summary string
+	usage   string // set for commands without a flag set
+}
+
+// commands lists what main dispatches on, the default sweep first.
+var commands = []command{
+	{"", "sweep every TLD for a base domain", ""},
+	{"bench", "measure throughput at several worker counts", ""},
+	{"job create", "split a sweep into resumable shards", ""},
+	{"job run", "scan the pending shards of a job", ""},
+	{"job status", "show the progress of a job", ""},
+	{"job merge", "merge the shard results of a job", ""},
+	{"coordinator", "hand out targets to remote workers", ""},
+	{"worker", "scan targets leased from a coordinator", ""},
+	{"consume", "scan targets from a NATS or Redis queue", ""},
+	{"daemon", "scan on a schedule and serve the dashboard", ""},
+	{"check", "run CI checks over a list of domains", ""},
+	{"schema", "print the JSON schema of a result", "tls-sweep schema [--version]"},
+	{"verify", "verify a signed manifest", ""},
+	{"retry", "re-scan the failures of a previous export", ""},
+	{"merge", "combine exports, keeping the newest result per target", ""},
+	{"audit", "print the scans of an audit log as JSON", ""},
+	{"resolve", "resolve the targets only and write their addresses", ""},
+	{"handshake", "scan targets a resolve stage already looked up", ""},
+	{"enrich", "enrich, score and filter the results of an earlier scan", ""},
+	{"certs", "query the certificates recorded with --cert-store", ""},
+	{"config validate", "check flags and the files they name without scanning", ""},
+	{"version", "print the version, commit, build date and Go version", "tls-sweep version"},
+	{"self-update", "replace the binary with the latest signed release", ""},
+	{"completion", "print a bash, zsh or fish completion script", "tls-sweep completion bash|zsh|fish"},
+	{"man", "print the man page", "tls-sweep man"},
+}
+
+// flagDoc is one flag as printed by flag.PrintDefaults.
+type flagDoc struct {
+	name, arg, usage string
+}
+
+// commandHelp is what a command prints for -h: its usage lines and flags.
+type commandHelp struct {
+	command
+	usage []string
+	flags []flagDoc
+}
+
+// parseHelp reads the output of a flag set's Usage: "Usage:" lines, then
+// "  -name type" lines each followed by tab-indented usage text.
+func parseHelp(text string) commandHelp {
+	var h commandHelp
+	lines := bufio.NewScanner(strings.NewReader(text))
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case strings.HasPrefix(line, "  -"):
+			name, rest, _ := strings.Cut(strings.TrimPrefix(line, "  -"), "\t")
+			name, arg, _ := strings.Cut(strings.TrimSpace(name), " ")
+			h.flags = append(h.flags, flagDoc{name: name, arg: arg, usage: strings.TrimSpace(rest)})
+		case strings.HasPrefix(line, "    \t") && len(h.flags) > 0:
+			f := &h.flags[len(h.flags)-1]
+			f.usage = strings.TrimSpace(f.usage + " " + strings.TrimSpace(line))
+		case strings.HasPrefix(line, "Usage of ") && strings.HasSuffix(line, ":"):
+			// A flag set without its own Usage.
+			name := strings.TrimSuffix(strings.TrimPrefix(line, "Usage of "), ":")
+			h.usage = append(h.usage, "tls-sweep "+name+" [flags]")
+		case strings.HasPrefix(line, "Usage:"):
+			h.usage = append(h.usage, strings.TrimSpace(strings.TrimPrefix(line, "Usage:")))
+		case strings.HasPrefix(line, "       tls-sweep") && len(h.usage) > 0:
+			h.usage = append(h.usage, strings.TrimSpace(line))
+		}
+	}
+	return h
+}
+
+// helpOf runs this binary with -h to learn the flags of every command, so
+// the completions and the man page always match the flag sets.
+func helpOf() ([]commandHelp, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	var out []commandHelp
+	for _, c := range commands {
+		if c.usage != "" {
+			out = append(out, commandHelp{command: c, usage: []string{c.usage}})
+			continue
+		}
+		args := append(strings.Fields(c.name), "-h")
+		// -h exits non-zero for some flag sets; the text is what counts.
+		text, _ := exec.Command(self, args...).CombinedOutput()
+		h := parseHelp(string(text))
+		if len(h.usage) == 0 {
+			return nil, fmt.Errorf("%s -h printed no usage", strings.Join(append([]string{"tls-sweep"}, args...), " "))
+		}
+		h.command = c
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+func runCompletion(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tls-sweep completion bash|zsh|fish")
+		os.Exit(1)
+	}
+	write := map[string]func(io.Writer, []commandHelp){"bash": writeBashCompletion, "zsh": writeZshCompletion, "fish": writeFishCompletion}[args[0]]
+	if write == nil {
+		logger.Fatalf("Unknown shell %q, want bash, zsh or fish\n", args[0])
+	}
+	help, err := helpOf()
+	if err != nil {
+		logger.Fatalf("Failed to read the flags: %v\n", err)
+	}
+	write(os.Stdout, help)
+}
+
+func runMan(args []string) {
+	help, err := helpOf()
+	if err != nil {
+		logger.Fatalf("Failed to read the flags: %v\n", err)
+	}
+	writeManPage(os.Stdout, help)
+}
+
+func flagWords(flags []flagDoc) string {
+	var words []string
+	for _, f := range flags {
+		words = append(words, "--"+f.name)
+	}
+	return strings.Join(words, " ")
+}
+
+func writeBashCompletion(w io.Writer, help []commandHelp) {
+	var top, jobs []string
+	for _, h := range help {
+		if sub, ok := strings.CutPrefix(h.name, "job "); ok {
+			jobs = append(jobs, sub)
+		} else if h.name != "" {
+			top = append(top, h.name)
+		}
+	}
+	top = append(top, "job")
+	fmt.Fprintln(w, "# bash completion for tls-sweep; load with: source <(tls-sweep completion bash)")
+	fmt.Fprintln(w, "_tls_sweep() {")
+	fmt.Fprintln(w, `	local cur=${COMP_WORDS[COMP_CWORD]} cmd=${COMP_WORDS[1]} words`)
+	fmt.Fprintln(w, `	if [[ $cmd == job ]]; then`)
+	fmt.Fprintln(w, `		if (( COMP_CWORD == 2 )); then`)
+	fmt.Fprintf(w, "\t\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(jobs, " "))
+	fmt.Fprintln(w, "\t\t\treturn")
+	fmt.Fprintln(w, "\t\tfi")
+	fmt.Fprintln(w, `		cmd="job ${COMP_WORDS[2]}"`)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, `	case "$cmd" in`)
+	for _, h := range help {
+		if h.name == "" {
+			continue
+		}
+		fmt.Fprintf(w, "\t%q) words=%q ;;\n", h.name, flagWords(h.flags))
+	}
+	var main commandHelp
+	for _, h := range help {
+		if h.name == "" {
+			main = h
+		}
+	}
+	fmt.Fprintf(w, "\t*) words=%q ;;\n", flagWords(main.flags)+" "+strings.Join(top, " "))
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ $cur == -* || $COMP_CWORD == 1 ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$words" -- "$cur"))`)
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -f -- "$cur"))`)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -F _tls_sweep tls-sweep")
+}
+
+// zshQuote escapes s for a single-quoted _arguments spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func writeZshCompletion(w io.Writer, help []commandHelp) {
+	fmt.Fprintln(w, "#compdef tls-sweep")
+	fmt.Fprintln(w, "# zsh completion for tls-sweep; save as _tls-sweep in a directory of $fpath")
+	fmt.Fprintln(w, "_tls_sweep() {")
+	fmt.Fprintln(w, "\tlocal -a commands opts")
+	fmt.Fprintln(w, "\tcommands=(")
+	for _, h := range help {
+		if h.name != "" && !strings.HasPrefix(h.name, "job ") {
+			fmt.Fprintf(w, "\t\t'%s:%s'\n", h.name, zshQuote(h.summary))
+		}
+	}
+	fmt.Fprintln(w, "\t\t'job:split a sweep into resumable shards and run them'")
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, `	local cmd=${words[2]}`)
+	fmt.Fprintln(w, `	[[ $cmd == job ]] && cmd="job ${words[3]}"`)
+	fmt.Fprintln(w, `	case $cmd in`)
+	// The default sweep comes last, as the catch-all.
+	ordered := append(append([]commandHelp(nil), help[1:]...), help[0])
+	for _, h := range ordered {
+		pattern := "'" + h.name + "'"
+		if h.name == "" {
+			pattern = "*"
+		}
+		fmt.Fprintf(w, "\t%s) opts=(\n", pattern)
+		for _, f := range h.flags {
+			spec := fmt.Sprintf("--%s[%s]", f.name, zshQuote(f.usage))
+			if f.arg != "" {
+				spec += ":" + f.arg + ":"
+			}
+			fmt.Fprintf(w, "\t\t'%s'\n", spec)
+		}
+		fmt.Fprintln(w, "\t) ;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if (( CURRENT == 2 )); then`)
+	fmt.Fprintln(w, `		_describe -t commands command commands`)
+	fmt.Fprintln(w, `	elif [[ ${words[2]} == job ]] && (( CURRENT == 3 )); then`)
+	var jobs []string
+	for _, h := range help {
+		if sub, ok := strings.CutPrefix(h.name, "job "); ok {
+			jobs = append(jobs, sub)
+		}
+	}
+	fmt.Fprintf(w, "\t\tcompadd %s\n", strings.Join(jobs, " "))
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, `		_arguments -S $opts '*:file:_files'`)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, `_tls_sweep "$@"`)
+}
+
+// fishQuote single-quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer, help []commandHelp) {
+	fmt.Fprintln(w, "# fish completion for tls-sweep; save as ~/.config/fish/completions/tls-sweep.fish")
+	var top, jobs []string
+	for _, h := range help {
+		if sub, ok := strings.CutPrefix(h.name, "job "); ok {
+			jobs = append(jobs, sub)
+		} else if h.name != "" {
+			top = append(top, h.name)
+		}
+	}
+	top = append(top, "job")
+	fmt.Fprintln(w, "complete -c tls-sweep -f")
+	for _, h := range help {
+		if h.name != "" && !strings.HasPrefix(h.name, "job ") {
+			fmt.Fprintf(w, "complete -c tls-sweep -n __fish_use_subcommand -a %s -d %s\n", h.name, fishQuote(h.summary))
+		}
+	}
+	fmt.Fprintf(w, "complete -c tls-sweep -n __fish_use_subcommand -a job -d %s\n", fishQuote("split a sweep into resumable shards and run them"))
+	for _, h := range help {
+		if sub, ok := strings.CutPrefix(h.name, "job "); ok {
+			fmt.Fprintf(w, "complete -c tls-sweep -n '__fish_seen_subcommand_from job; and not __fish_seen_subcommand_from %s' -a %s -d %s\n", strings.Join(jobs, " "), sub, fishQuote(h.summary))
+		}
+	}
+	for _, h := range help {
+		cond := "__fish_use_subcommand"
+		switch {
+		case h.name == "":
+		case strings.HasPrefix(h.name, "job "):
+			cond = "'__fish_seen_subcommand_from job; and __fish_seen_subcommand_from " + strings.TrimPrefix(h.name, "job ") + "'"
+		default:
+			cond = "'__fish_seen_subcommand_from " + h.name + "'"
+		}
+		for _, f := range h.flags {
+			line := fmt.Sprintf("complete -c tls-sweep -n %s -l %s -d %s", cond, f.name, fishQuote(f.usage))
+			if f.arg != "" {
+				line += " -r -F"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// roff escapes s for a man page line.
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func writeManPage(w io.Writer, help []commandHelp) {
+	fmt.Fprintln(w, `.TH TLS\-SWEEP 1 "" "tls-sweep" "User Commands"`)
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `tls\-sweep \- sweep every top\-level domain for a base domain and report the TLS certificates served`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	for _, h := range help {
+		if h.name == "" {
+			for _, u := range h.usage {
+				fmt.Fprintf(w, ".B %s\n.br\n", roff(u))
+			}
+		}
+	}
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, "tls\\-sweep resolves the base domain under every TLD in the IANA list, handshakes with each host that answers and exports the certificates found. The commands below scan in other ways or work on the results.")
+	for _, h := range help {
+		if h.name == "" {
+			fmt.Fprintln(w, ".SH OPTIONS")
+		} else {
+			if h.name == "bench" {
+				fmt.Fprintln(w, ".SH COMMANDS")
+			}
+			fmt.Fprintf(w, ".SS %s\n%s.\n", roff(h.name), roff(h.summary))
+			for _, u := range h.usage {
+				fmt.Fprintf(w, ".br\n.B %s\n", roff(u))
+			}
+		}
+		for _, f := range h.flags {
+			fmt.Fprintf(w, ".TP\n.B \\-\\-%s", roff(f.name))
+			if f.arg != "" {
+				fmt.Fprintf(w, " \\fI%s\\fR", roff(f.arg))
+			}
+			fmt.Fprintf(w, "\n%s\n", roff(f.usage))
+		}
+	}
+	fmt.Fprintln(w, ".SH SEE ALSO")
+	fmt.Fprintln(w, "https://github.com/mberlanda/tls\\-sweep")
+}
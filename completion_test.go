@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHelp(t *testing.T) {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	var out bytes.Buffer
+	fs.SetOutput(&out)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep daemon [flags] <base-domain>...")
+		fs.PrintDefaults()
+	}
+	fs.Duration("interval", 24*time.Hour, "time between scans")
+	fs.String("store", "history", "directory scan history is kept in")
+	fs.Bool("x", false, "a short `flag`")
+	fs.Usage()
+
+	h := parseHelp(out.String())
+	if len(h.usage) != 1 || h.usage[0] != "tls-sweep daemon [flags] <base-domain>..." {
+		t.Errorf("usage = %q", h.usage)
+	}
+	want := []flagDoc{
+		{"interval", "duration", "time between scans (default 24h0m0s)"},
+		{"store", "string", `directory scan history is kept in (default "history")`},
+		{"x", "flag", "a short flag"},
+	}
+	if len(h.flags) != len(want) {
+		t.Fatalf("flags = %+v", h.flags)
+	}
+	for i, f := range h.flags {
+		if f != want[i] {
+			t.Errorf("flag %d = %+v, want %+v", i, f, want[i])
+		}
+	}
+
+	if h := parseHelp("Usage of bench:\n  -targets int\n    \tsynthetic domains\n"); len(h.usage) != 1 || h.usage[0] != "tls-sweep bench [flags]" || h.flags[0].name != "targets" {
+		t.Errorf("default usage parsed as %+v", h)
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	help := []commandHelp{
+		{command: command{name: ""}, usage: []string{"tls-sweep [flags] <base-domain>"}, flags: []flagDoc{{"workers", "int", "number of concurrent scan workers"}, {"tui", "", "follow the sweep"}}},
+		{command: command{name: "daemon", summary: "scan on a schedule"}, usage: []string{"tls-sweep daemon [flags]"}, flags: []flagDoc{{"store", "string", "directory [history] it's kept in"}}},
+		{command: command{name: "job run", summary: "scan shards"}, flags: []flagDoc{{"shard", "int", "shard to run"}}},
+	}
+	for shell, write := range map[string]func(*bytes.Buffer){
+		"bash": func(b *bytes.Buffer) { writeBashCompletion(b, help) },
+		"zsh":  func(b *bytes.Buffer) { writeZshCompletion(b, help) },
+		"fish": func(b *bytes.Buffer) { writeFishCompletion(b, help) },
+		"man":  func(b *bytes.Buffer) { writeManPage(b, help) },
+	} {
+		var b bytes.Buffer
+		write(&b)
+		out := b.String()
+		for _, want := range map[string][]string{
+			"bash": {`"daemon") words="--store"`, `"job run") words="--shard"`, "--workers --tui daemon job"},
+			"zsh":  {`'daemon:scan on a schedule'`, `'--store[directory \[history\] it'\''s kept in]:string:'`, "compadd run"},
+			"fish": {`-n '__fish_seen_subcommand_from daemon' -l store -d 'directory [history] it\'s kept in' -r`, "-n __fish_use_subcommand -l tui"},
+			"man":  {".SS daemon", `.B \-\-workers \fIint\fR`, `.B tls\-sweep [flags] <base\-domain>`},
+		}[shell] {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s output lacks %q:\n%s", shell, want, out)
+			}
+		}
+	}
+}
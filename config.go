@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// commonProblems checks the flags the sweep and the daemon share.
+func commonProblems() []error {
+	var problems []error
+	if maxWorkers < 1 {
+		problems = append(problems, fmt.Errorf("--workers must be at least 1, got %d", maxWorkers))
+	}
+	for _, c := range []struct {
+		flag string
+		v    int
+	}{
+		{"--max-per-host", maxPerHost},
+		{"--max-dns-lookups", maxDNSLookups},
+		{"--precheck-workers", precheckWorkers},
+		{"--retries", scanRetries},
+		{"--follow-redirects", maxRedirects},
+	} {
+		if c.v < 0 {
+			problems = append(problems, fmt.Errorf("%s cannot be negative, got %d (0 = the default)", c.flag, c.v))
+		}
+	}
+	if tcpKeepAlive < 0 {
+		problems = append(problems, fmt.Errorf("--tcp-keepalive cannot be negative, got %v (0 = off)", tcpKeepAlive))
+	}
+	if precheckTimeout < 0 {
+		problems = append(problems, fmt.Errorf("--precheck cannot be negative, got %v (0 = off)", precheckTimeout))
+	}
+	if err := checkTLSRange(); err != nil {
+		problems = append(problems, fmt.Errorf("%v; raise --tls-max or lower --tls-min", err))
+	}
+	if scriptPath != "" {
+		if _, err := loadScript(scriptPath); err != nil {
+			problems = append(problems, fmt.Errorf("--script: %v", err))
+		}
+	}
+	if annotationsFile != "" {
+		if _, err := loadAnnotations(annotationsFile); err != nil {
+			problems = append(problems, fmt.Errorf("--annotations: %v", err))
+		}
+	}
+	if syslogURL != "" {
+		if _, _, err := parseSyslogURL(syslogURL, syslogFormat); err != nil {
+			problems = append(problems, fmt.Errorf("--syslog: %v", err))
+		}
+	}
+	if otlpEndpoint != "" {
+		if u, err := url.Parse(otlpEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("--otlp-endpoint %q is not an http:// or https:// collector URL", otlpEndpoint))
+		}
+	}
+	if certStorePath != "" {
+		if _, err := loadCertStore(certStorePath); err != nil {
+			problems = append(problems, fmt.Errorf("--cert-store: %v", err))
+		}
+	}
+	if _, err := parseHexColor(pdfColor); err != nil {
+		problems = append(problems, fmt.Errorf("--pdf-color: %v", err))
+	}
+	if _, err := newScorer(""); err != nil {
+		problems = append(problems, fmt.Errorf("scoring: %v", err))
+	}
+	return problems
+}
+
+// validate checks every flag of the default sweep, and the files they
+// name, before anything is scanned. It reports all the problems rather
+// than the first, so a configuration is fixed in one go.
+func (o *sweepFlags) validate() []error {
+	problems := commonProblems()
+	if logLevel != "info" && logLevel != "debug" {
+		problems = append(problems, fmt.Errorf("unknown --log-level %q (want info or debug)", logLevel))
+	}
+	if statsInterval <= 0 {
+		problems = append(problems, fmt.Errorf("--stats-interval must be positive, got %v", statsInterval))
+	}
+	if sampleSpec != "" {
+		if _, err := sampleCount(sampleSpec, 1); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if budgetSpec != "" {
+		if _, err := parseBudget(budgetSpec); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if outputDir == "-" {
+		// Everything but the export needs a file or the terminal.
+		for _, c := range []struct {
+			flag string
+			set  bool
+		}{
+			{"--pdf", *o.writePDF},
+			{"--graph", *o.graphFormat != ""},
+			{"--manifest", *o.writeManifestFile || *o.signKey != ""},
+			{"--assets", assetsFile != ""},
+			{"--email-report", emailReport != ""},
+			{"--tui", tuiMode},
+		} {
+			if c.set {
+				problems = append(problems, fmt.Errorf("%s cannot be combined with --output -; write to a directory instead", c.flag))
+			}
+		}
+	}
+	switch *o.format {
+	case "csv", "json", "ndjson", "xlsx", "markdown":
+	default:
+		problems = append(problems, fmt.Errorf("unknown --format %q (want csv, json, ndjson, xlsx or markdown)", *o.format))
+	}
+	if *o.graphFormat != "" && *o.graphFormat != "dot" && *o.graphFormat != "graphml" {
+		problems = append(problems, fmt.Errorf("unknown --graph format %q (want dot or graphml)", *o.graphFormat))
+	}
+	if *o.signKey != "" {
+		if _, err := loadSigningKey(*o.signKey); err != nil {
+			problems = append(problems, fmt.Errorf("--sign-key: %v", err))
+		}
+	}
+	if emailReport != "" {
+		if _, err := loadSMTPConfig(smtpConfigPath); err != nil {
+			problems = append(problems, fmt.Errorf("--smtp-config: %v", err))
+		}
+	}
+	if assetsFile != "" {
+		if _, err := loadAssets(assetsFile); err != nil {
+			problems = append(problems, fmt.Errorf("--assets: %v", err))
+		}
+	}
+	if trustMatrix {
+		if _, err := loadTrustStores(extraTrustStore); err != nil {
+			problems = append(problems, fmt.Errorf("--trust-matrix: %v", err))
+		}
+	}
+	if enrichSource != "" {
+		if _, err := newIntelSource(enrichSource); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if monitorFrom != "" {
+		if _, err := monitorTargets(monitorFrom); err != nil {
+			problems = append(problems, fmt.Errorf("--monitor-from: %v", err))
+		}
+	}
+	if screenshotDir != "" {
+		if _, err := findChrome(); err != nil {
+			problems = append(problems, fmt.Errorf("--screenshots: %v", err))
+		}
+	}
+	if pprofAddr != "" {
+		if err := checkListenAddr(pprofAddr); err != nil {
+			problems = append(problems, fmt.Errorf("--pprof: %v", err))
+		}
+	}
+	// The modes that replace the HTTPS handshake exclude each other and
+	// the probes that only make sense over HTTPS.
+	if mxMode && scanProfile != "https" {
+		problems = append(problems, fmt.Errorf("--mx cannot be combined with --profile %s; pick one", scanProfile))
+	}
+	for _, c := range []struct {
+		flag string
+		set  bool
+	}{
+		{"--precheck", precheckTimeout > 0},
+		{"--favicons", fetchFavicons},
+		{"--quic", probeQUIC},
+		{"--follow-redirects", maxRedirects > 0},
+	} {
+		switch {
+		case !c.set:
+		case mxMode:
+			problems = append(problems, fmt.Errorf("%s cannot be combined with --mx", c.flag))
+		case scanProfile != "https":
+			problems = append(problems, fmt.Errorf("%s only applies to --profile https, not %s", c.flag, scanProfile))
+		}
+	}
+	return problems
+}
+
+// daemonFlags are the flags of the daemon that are not package variables.
+type daemonFlags struct {
+	interval       *time.Duration
+	listen         *string
+	storeDir       *string
+	pagerName      *string
+	criticalPath   *string
+	pageExpiryDays *int
+	tokensPath     *string
+	scansPath      *string
+	ctWatch        *time.Duration
+}
+
+// validate checks the daemon's flags and its base domains or --scans
+// definitions, as the sweep's validate does.
+func (o *daemonFlags) validate(args []string) []error {
+	problems := commonProblems()
+	if *o.interval <= 0 {
+		problems = append(problems, fmt.Errorf("--interval must be positive, got %v", *o.interval))
+	} else if bases, _, err := daemonTargets(args, *o.scansPath, *o.interval); err != nil {
+		problems = append(problems, fmt.Errorf("scan definitions: %v", err))
+	} else if *o.ctWatch > 0 && len(bases) == 0 {
+		problems = append(problems, errors.New("--ct-watch watches the daemon's own base domains, and there are none; profiles are not watched"))
+	}
+	if *o.ctWatch != 0 && *o.ctWatch < time.Minute {
+		problems = append(problems, fmt.Errorf("--ct-watch must be at least 1m, crt.sh throttles faster polls; got %v (0 = off)", *o.ctWatch))
+	}
+	if err := checkListenAddr(*o.listen); err != nil {
+		problems = append(problems, fmt.Errorf("--listen: %v", err))
+	}
+	if *o.pageExpiryDays < 0 {
+		problems = append(problems, fmt.Errorf("--page-expiry-days cannot be negative, got %d", *o.pageExpiryDays))
+	}
+	if *o.pagerName != "" {
+		if _, err := newPager(*o.pagerName); err != nil {
+			problems = append(problems, err)
+		}
+		if *o.criticalPath == "" {
+			problems = append(problems, errors.New("--pager needs --critical, the domains to page on"))
+		}
+	}
+	if *o.criticalPath != "" {
+		if _, err := loadCriticalDomains(*o.criticalPath); err != nil {
+			problems = append(problems, fmt.Errorf("--critical: %v", err))
+		}
+	}
+	if *o.tokensPath != "" {
+		if _, err := loadAPITokens(*o.tokensPath); err != nil {
+			problems = append(problems, fmt.Errorf("--api-tokens: %v", err))
+		}
+	}
+	return problems
+}
+
+// checkAddr checks that addr is host:port with a port from 1 to 65535.
+func checkAddr(addr string) error {
+	return checkHostPort(addr, 1)
+}
+
+// checkListenAddr is checkAddr for an address listened on, where port 0
+// picks a free one.
+func checkListenAddr(addr string) error {
+	return checkHostPort(addr, 0)
+}
+
+func checkHostPort(addr string, minPort int) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%v, want host:port", err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < minPort || n > 65535 {
+		return fmt.Errorf("port %q of %s is not a number from %d to 65535", port, addr, minPort)
+	}
+	return nil
+}
+
+// exitInvalid prints every problem and exits.
+func exitInvalid(problems []error) {
+	for _, p := range problems {
+		logger.Printf("Invalid configuration: %v\n", p)
+	}
+	os.Exit(1)
+}
+
+// runConfig is "config validate": it checks the flags of a sweep, or of
+// the daemon, the way they would be checked before scanning, and scans
+// nothing.
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "Usage: tls-sweep config validate [daemon] [flags] <base-domain>...")
+		os.Exit(1)
+	}
+	args = args[1:]
+	usage := func(fs *flag.FlagSet) func() {
+		return func() {
+			fmt.Fprintln(fs.Output(), "Usage: tls-sweep config validate [flags] <base-domain>")
+			fmt.Fprintln(fs.Output(), "       tls-sweep config validate daemon [flags] <base-domain>...")
+			fs.PrintDefaults()
+		}
+	}
+	var problems []error
+	if len(args) > 0 && args[0] == "daemon" {
+		fs, o := newDaemonFlags()
+		fs.Usage = usage(fs)
+		problems = o.validate(parseArgs(fs, args[1:]))
+	} else {
+		fs, o := newSweepFlags()
+		fs.Usage = usage(fs)
+		if len(parseArgs(fs, args)) == 0 {
+			problems = append(problems, errors.New("no base domain given"))
+		}
+		problems = append(problems, o.validate()...)
+	}
+	if len(problems) > 0 {
+		exitInvalid(problems)
+	}
+	fmt.Println("Configuration OK")
+}
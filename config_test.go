@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseFlags parses args into fs, setting the flags it set back to their
+// defaults once the test is done.
+func parseFlags(t *testing.T, fs *flag.FlagSet, args ...string) {
+	t.Helper()
+	profile := scanProfile
+	t.Cleanup(func() {
+		fs.Visit(func(f *flag.Flag) { f.Value.Set(f.DefValue) })
+		scanProfile = profile
+	})
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parseSweepFlags(t *testing.T, args ...string) *sweepFlags {
+	t.Helper()
+	fs, o := newSweepFlags()
+	parseFlags(t, fs, args...)
+	return o
+}
+
+func problemText(problems []error) string {
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = p.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSweepValidateDefaults(t *testing.T) {
+	o := parseSweepFlags(t)
+	if problems := o.validate(); len(problems) > 0 {
+		t.Fatalf("defaults are invalid:\n%s", problemText(problems))
+	}
+}
+
+func TestSweepValidateReportsEveryProblem(t *testing.T) {
+	o := parseSweepFlags(t, "--workers", "0", "--format", "yaml", "--output", "-", "--pdf",
+		"--profile", "postgres", "--mx", "--favicons", "--pprof", "localhost:70000", "--syslog", "http://siem:514")
+	got := problemText(o.validate())
+	for _, want := range []string{
+		"--workers must be at least 1",
+		`unknown --format "yaml"`,
+		"--pdf cannot be combined with --output -",
+		"--mx cannot be combined with --profile postgres",
+		"--favicons cannot be combined with --mx",
+		`--pprof: port "70000"`,
+		`--syslog: unsupported syslog scheme "http"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestSweepValidateHTTPSOnlyProbes(t *testing.T) {
+	o := parseSweepFlags(t, "--profile", "postgres", "--quic")
+	got := problemText(o.validate())
+	if got != "--quic only applies to --profile https, not postgres" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSweepValidateFiles(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	o := parseSweepFlags(t, "--assets", missing, "--script", missing, "--sign-key", missing)
+	got := problemText(o.validate())
+	for _, want := range []string{"--script: ", "--sign-key: ", "--assets: "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestDaemonValidate(t *testing.T) {
+	fs, o := newDaemonFlags()
+	parseFlags(t, fs, "--interval", "0", "--listen", "localhost", "--pager", "pagerduty", "--page-expiry-days", "-1", "--ct-watch", "10s")
+	got := problemText(o.validate(nil))
+	for _, want := range []string{
+		"--interval must be positive",
+		"--listen: ",
+		"--page-expiry-days cannot be negative",
+		"--pager needs --critical",
+		"--ct-watch must be at least 1m",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestDaemonValidateNeedsTargets(t *testing.T) {
+	fs, o := newDaemonFlags()
+	parseFlags(t, fs)
+	if got := problemText(o.validate(nil)); !strings.Contains(got, "scan definitions: ") {
+		t.Errorf("got %q", got)
+	}
+	if got := o.validate([]string{"amazon"}); len(got) > 0 {
+		t.Errorf("valid daemon flags rejected:\n%s", problemText(got))
+	}
+}
+
+func TestCheckAddr(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"siem:514":       true,
+		"[::1]:65535":    true,
+		"siem":           false,
+		"siem:0":         false,
+		"siem:65536":     false,
+		"siem:syslog":    false,
+		"localhost:8080": true,
+	} {
+		if err := checkAddr(addr); (err == nil) != ok {
+			t.Errorf("checkAddr(%q) = %v", addr, err)
+		}
+	}
+	if err := checkListenAddr("localhost:0"); err != nil {
+		t.Errorf("checkListenAddr(localhost:0) = %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ctHost is a host named by a certificate logged to CT that the daemon's
+// scans include from then on.
+type ctHost struct {
+	Domain     string    `json:"domain"`
+	BaseDomain string    `json:"base_domain"`
+	CertID     int64     `json:"crtsh_id"`
+	NotBefore  string    `json:"not_before"` // as crt.sh gives it, in UTC
+	FoundAt    time.Time `json:"found_at"`
+}
+
+// ctWatcher polls crt.sh for certificates naming hosts that contain a base
+// domain but are not targets of the sweep, such as amazon-login.com or
+// secure.amazonshop.net, and keeps them in path for every scan to come.
+type ctWatcher struct {
+	path   string
+	search func(pattern string) ([]ctEntry, error)
+	// found has room for one: a scan is due for hosts found since the
+	// last one.
+	found chan struct{}
+
+	mu    sync.Mutex
+	bases []string
+	hosts map[string]ctHost
+}
+
+// ctHostPattern is a host name as certificates carry them once the
+// wildcard is cut off; e-mail addresses and IPs in name_value are not.
+var ctHostPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z][a-z0-9-]*[a-z0-9]$`)
+
+func loadCTWatcher(path string) (*ctWatcher, error) {
+	w := &ctWatcher{path: path, search: crtshSearch, found: make(chan struct{}, 1), hosts: make(map[string]ctHost)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hosts []ctHost
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, h := range hosts {
+		w.hosts[h.Domain] = h
+	}
+	return w, nil
+}
+
+// crtshSearch returns the unexpired certificates crt.sh has logged with a
+// name matching pattern, % matching anything. It is never cached: a poll
+// is for what is new.
+func crtshSearch(pattern string) ([]ctEntry, error) {
+	body, err := metadata().get("https://crt.sh/?output=json&exclude=expired&q="+url.QueryEscape(pattern), 0)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ctEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("crt.sh: %v", err)
+	}
+	return entries, nil
+}
+
+// setBases replaces the base domains watched, as a reload does.
+func (w *ctWatcher) setBases(bases []string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.bases = bases
+}
+
+// domains is every host found so far, sorted.
+func (w *ctWatcher) domains() []string {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]string, 0, len(w.hosts))
+	for d := range w.hosts {
+		out = append(out, d)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// due fires when hosts were found; it never fires on a nil watcher.
+func (w *ctWatcher) due() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.found
+}
+
+// poll searches CT for every base domain and keeps the hosts not seen
+// before that no target under tlds covers, itself or as a parent. It
+// returns them, having saved them, and the searches that failed.
+func (w *ctWatcher) poll(tlds []string, now time.Time) ([]ctHost, error) {
+	w.mu.Lock()
+	bases := w.bases
+	w.mu.Unlock()
+	var added []ctHost
+	var errs []error
+	for _, base := range bases {
+		entries, err := w.search("%" + base + "%")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", base, err))
+			continue
+		}
+		covered := make(map[string]bool)
+		for _, t := range expandTemplates(base, tlds, targetTemplates) {
+			covered[t] = true
+		}
+		w.mu.Lock()
+		for _, e := range entries {
+			for _, name := range strings.Split(e.NameValue, "\n") {
+				host := strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "*."), ".")
+				if _, known := w.hosts[host]; known || !strings.Contains(host, base) || !ctHostPattern.MatchString(host) || coveredBy(host, covered) {
+					continue
+				}
+				h := ctHost{Domain: host, BaseDomain: base, CertID: e.ID, NotBefore: e.NotBefore, FoundAt: now.UTC().Truncate(time.Second)}
+				w.hosts[host] = h
+				added = append(added, h)
+			}
+		}
+		w.mu.Unlock()
+	}
+	if len(added) > 0 {
+		if err := w.save(); err != nil {
+			errs = append(errs, fmt.Errorf("saving %s: %v", w.path, err))
+		}
+	}
+	return added, errors.Join(errs...)
+}
+
+// coveredBy reports whether host or one of its parents is in targets.
+func coveredBy(host string, targets map[string]bool) bool {
+	for d := host; ; {
+		if targets[d] {
+			return true
+		}
+		_, parent, ok := strings.Cut(d, ".")
+		if !ok {
+			return false
+		}
+		d = parent
+	}
+}
+
+func (w *ctWatcher) save() error {
+	w.mu.Lock()
+	hosts := make([]ctHost, 0, len(w.hosts))
+	for _, h := range w.hosts {
+		hosts = append(hosts, h)
+	}
+	w.mu.Unlock()
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Domain < hosts[j].Domain })
+	data, err := json.MarshalIndent(hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(w.path, append(data, '\n'), 0o644)
+}
+
+// run polls every interval until ctx is done, and asks for a scan whenever
+// a poll found hosts.
+func (w *ctWatcher) run(ctx context.Context, interval time.Duration) {
+	for {
+		tlds, err := loadTLDs(true)
+		if err != nil {
+			logger.Printf("CT poll skipped: failed to load TLDs: %v\n", err)
+		} else {
+			added, err := w.poll(tlds, time.Now())
+			if err != nil {
+				logger.Printf("CT poll failed: %v\n", err)
+			}
+			if len(added) > 0 {
+				names := make([]string, len(added))
+				for i, h := range added {
+					names[i] = h.Domain
+				}
+				logger.Printf("CT logged %d new hosts matching the base domains, scanning: %s\n", len(added), strings.Join(names, ", "))
+				select {
+				case w.found <- struct{}{}:
+				default:
+				}
+			}
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCTWatcherPoll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ct-hosts.json")
+	w, err := loadCTWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := []ctEntry{
+		{ID: 1, NameValue: "amazon.com\nwww.amazon.com", NotBefore: "2026-10-01T00:00:00"},
+		{ID: 2, NameValue: "*.amazon-login.com\namazon-login.com", NotBefore: "2026-10-13T08:00:00"},
+		{ID: 3, NameValue: "secure.Amazonshop.net.\nsupport@amazon-help.com", NotBefore: "2026-10-13T09:00:00"},
+	}
+	var patterns []string
+	w.search = func(pattern string) ([]ctEntry, error) {
+		patterns = append(patterns, pattern)
+		if pattern == "%ebay%" {
+			return nil, errors.New("crt.sh: 503 Service Unavailable")
+		}
+		return logged, nil
+	}
+	w.setBases([]string{"amazon", "ebay"})
+
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	added, err := w.poll([]string{"com", "de"}, now)
+	if err == nil || !strings.Contains(err.Error(), "ebay: crt.sh: 503") {
+		t.Errorf("poll error = %v, want the failed ebay search", err)
+	}
+	if strings.Join(patterns, ",") != "%amazon%,%ebay%" {
+		t.Errorf("searched %v", patterns)
+	}
+	// amazon.com and its subdomains are targets already; the e-mail
+	// address is no host.
+	if len(added) != 2 || added[0].Domain != "amazon-login.com" || added[0].CertID != 2 || added[1].Domain != "secure.amazonshop.net" || !added[1].FoundAt.Equal(now) {
+		t.Errorf("added %+v", added)
+	}
+
+	logged = append(logged, ctEntry{ID: 4, NameValue: "amazon-login.com\namazon-verify.de", NotBefore: "2026-10-14T10:00:00"})
+	if added, _ := w.poll([]string{"com", "de"}, now); len(added) != 1 || added[0].Domain != "amazon-verify.de" {
+		t.Errorf("second poll added %+v, want only the host not known yet", added)
+	}
+	if added, _ := w.poll([]string{"com", "de"}, now); len(added) != 0 {
+		t.Errorf("third poll added %+v, want nothing new", added)
+	}
+
+	reloaded, err := loadCTWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(reloaded.domains(), ","); got != "amazon-login.com,amazon-verify.de,secure.amazonshop.net" {
+		t.Errorf("reloaded hosts = %s", got)
+	}
+}
+
+func TestExtraHosts(t *testing.T) {
+	targets := [][]string{{"amazon.com", "amazon.de"}, {"ebay.com"}}
+	if got := extraHosts(targets, []string{"amazon-login.com", "ebay.com"}); len(got) != 1 || got[0] != "amazon-login.com" {
+		t.Errorf("extraHosts = %v", got)
+	}
+	if got := (*ctWatcher)(nil).domains(); got != nil {
+		t.Errorf("nil watcher has hosts %v", got)
+	}
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// newDaemonFlags defines the daemon's flags, shared with config validate.
+func newDaemonFlags() (*flag.FlagSet, *daemonFlags) {
+	o := &daemonFlags{}
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep daemon [flags] <base-domain>...")
+		fs.PrintDefaults()
+	}
+	o.interval = fs.Duration("interval", 24*time.Hour, "time between scans")
+	o.listen = fs.String("listen", "localhost:8080", "address the dashboard is served on")
+	o.storeDir = fs.String("store", "history", "directory scan history is kept in")
+	fs.StringVar(&alertWebhook, "alert-webhook", "", "URL new-registration alerts are POSTed to as JSON")
+	o.pagerName = fs.String("pager", "", "page on critical domains through pagerduty ($PAGERDUTY_ROUTING_KEY) or opsgenie ($OPSGENIE_API_KEY)")
+	o.criticalPath = fs.String("critical", "", "file of critical domains, one per line, paged on with --pager; re-read on SIGHUP")
+	o.pageExpiryDays = fs.Int("page-expiry-days", 14, "page when a critical domain's certificate expires within this many days")
+	o.tokensPath = fs.String("api-tokens", "", "file of \"<name> <role> <token>\" lines; read tokens open the dashboard and scan tokens can also trigger scans; re-read on SIGHUP")
+	o.ctWatch = fs.Duration("ct-watch", 0, "poll crt.sh this often for new certificates naming hosts that contain a base domain, such as amazon-login.com, and scan those hosts from then on (0 = off)")
+	o.scansPath = fs.String("scans", "", "JSON scan definition file, or directory of them, re-read on SIGHUP; a definition with a name is a profile of its own")
+	registerScanFlags(fs)
+	registerResultFlags(fs)
+	registerPDFFlags(fs)
+	return fs, o
+}
+
+func runDaemon(args []string) {
+	fs, o := newDaemonFlags()
+	interval, listen, storeDir, pagerName, criticalPath, pageExpiryDays, tokensPath, scansPath, ctWatch := o.interval, o.listen, o.storeDir, o.pagerName, o.criticalPath, o.pageExpiryDays, o.tokensPath, o.scansPath, o.ctWatch
+	args = parseArgs(fs, args)
+	if len(args) == 0 && *scansPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if problems := o.validate(args); len(problems) > 0 {
+		exitInvalid(problems)
+	}
+
+	store, err := newFileStore(*storeDir)
+	if err != nil {
+		logger.Fatalf("Failed to open history store: %v\n", err)
+	}
+	dash, err := newDashboard(store, "")
+	if err != nil {
+		logger.Fatalf("Failed to load dashboard templates: %v\n", err)
+	}
+	var script *resultScript
+	if scriptPath != "" {
+		if script, err = loadScript(scriptPath); err != nil {
+			logger.Fatalf("Failed to load script: %v\n", err)
+		}
+	}
+	bases, defs, err := daemonTargets(args, *scansPath, *interval)
+	if err != nil {
+		logger.Fatalf("Failed to load scan definitions: %v\n", err)
+	}
+	if err := importAnnotationsFile(store); err != nil {
+		logger.Fatalf("Failed to import annotations: %v\n", err)
+	}
+	var alerts *criticalAlerts
+	if *pagerName != "" {
+		p, err := newPager(*pagerName)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		alerts = &criticalAlerts{pager: p, expiryDays: *pageExpiryDays}
+		if alerts.domains, err = loadCriticalDomains(*criticalPath); err != nil {
+			logger.Fatalf("Failed to load critical domains: %v\n", err)
+		}
+	}
+	tokens := &apiTokens{}
+	if *tokensPath != "" {
+		loaded, err := loadAPITokens(*tokensPath)
+		if err != nil {
+			logger.Fatalf("Failed to load API tokens: %v\n", err)
+		}
+		tokens.set(loaded)
+	}
+	var sink *syslogSink
+	if syslogURL != "" {
+		if sink, err = dialSyslog(syslogURL, syslogFormat); err != nil {
+			logger.Fatalf("Failed to connect to syslog collector: %v\n", err)
+		}
+		defer sink.close()
+	}
+
+	profiles := &profileSet{dir: filepath.Join(*storeDir, "profiles"), runners: make(map[string]*profileRunner)}
+	scanNow := make(chan string, 1)
+	pages := http.NewServeMux()
+	dash.routes(pages)
+	pages.Handle("/profiles/", profiles)
+	mux := http.NewServeMux()
+	mux.Handle("/", tokens.require(roleRead, pages))
+	mux.Handle("/scan", tokens.require(roleScan, scanTrigger(scanNow, profiles)))
+	// The probes stay open for the kubelet.
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		// A stat is enough: listing would read every stored scan per probe.
+		if _, err := os.Stat(filepath.Join(*storeDir, "scans")); err != nil {
+			http.Error(w, "history store unavailable: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logger.Fatalf("Failed to listen on %s: %v\n", *listen, err)
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	logger.Printf("Dashboard listening on http://%s\n", ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	openAuditTrail()
+	openCertHistory()
+	startTracing()
+	defer tracing.shutdown()
+	var ct *ctWatcher
+	if *ctWatch > 0 {
+		if ct, err = loadCTWatcher(filepath.Join(*storeDir, "ct-hosts.json")); err != nil {
+			logger.Fatalf("Failed to load CT hosts: %v\n", err)
+		}
+		ct.setBases(bases)
+		go ct.run(ctx, *ctWatch)
+	}
+	params := flagParameters(fs)
+	run := func(ctx context.Context, p *profileRunner) { p.run(ctx, sink, alerts, params) }
+	if err := profiles.update(ctx, defs, run); err != nil {
+		logger.Fatalf("Failed to open profile history: %v\n", err)
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	triggeredBy := "startup"
+	for {
+		if len(bases) > 0 {
+			audit := auditEntry{Mode: "daemon", TriggeredBy: triggeredBy, Parameters: params}
+			if err := daemonScan(ctx, store, bases, targetTemplates, ct.domains(), script, alertWebhook, sink, alerts, audit); err != nil {
+				logger.Printf("Scan failed: %v\n", err)
+			}
+		}
+	wait:
+		select {
+		case <-ticker.C:
+			triggeredBy = "schedule"
+		case by := <-scanNow:
+			triggeredBy = "api token " + by
+		case <-ct.due():
+			triggeredBy = "ct log"
+		case <-hup:
+			// A reload applies from the next scan on; a broken file keeps
+			// the previous definitions running.
+			reloaded, reloadedDefs, err := daemonTargets(args, *scansPath, *interval)
+			if err == nil {
+				err = profiles.update(ctx, reloadedDefs, run)
+			}
+			if err != nil {
+				logger.Printf("Reload failed, keeping previous scan definitions: %v\n", err)
+			} else {
+				bases = reloaded
+				ct.setBases(bases)
+				logger.Printf("Reloaded scan definitions: %s; profiles: %s\n", strings.Join(bases, ", "), strings.Join(profiles.names(), ", "))
+			}
+			if err := importAnnotationsFile(store); err != nil {
+				logger.Printf("Reload failed, keeping previous annotations: %v\n", err)
+			}
+			profiles.importAnnotations()
+			if *tokensPath != "" {
+				if loaded, err := loadAPITokens(*tokensPath); err != nil {
+					logger.Printf("Reload failed, keeping previous API tokens: %v\n", err)
+				} else {
+					tokens.set(loaded)
+				}
+			}
+			if alerts != nil {
+				if domains, err := loadCriticalDomains(*criticalPath); err != nil {
+					logger.Printf("Reload failed, keeping previous critical domains: %v\n", err)
+				} else {
+					alerts.setDomains(domains)
+				}
+			}
+			goto wait
+		case <-ctx.Done():
+			srv.Close()
+			profiles.wait()
+			return
+		}
+	}
+}
+
+// scanTrigger queues a scan on POST /scan: of the profile named by the
+// profile parameter, or of the daemon's own base domains without one.
+func scanTrigger(scanNow chan string, profiles *profileSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name, by := r.FormValue("profile"), caller(r.Context())
+		if name == "" {
+			queueScan(scanNow, by)
+		} else if !profiles.trigger(name, by) {
+			http.Error(w, "no profile "+name, http.StatusNotFound)
+			return
+		}
+		target := "base domains"
+		if name != "" {
+			target = "profile " + name
+		}
+		logger.Printf("Scan of %s triggered by %s\n", target, by)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "scan queued")
+	})
+}
+
+// queueScan asks for a scan on behalf of by through c, a channel with room
+// for one, unless one is queued already.
+func queueScan(c chan string, by string) {
+	select {
+	case c <- by:
+	default:
+	}
+}
+
+// importAnnotationsFile merges --annotations, if set, into the store.
+func importAnnotationsFile(store historyStore) error {
+	if annotationsFile == "" {
+		return nil
+	}
+	notes, err := loadAnnotations(annotationsFile)
+	if err != nil {
+		return err
+	}
+	return store.importAnnotations(notes)
+}
+
+// scanDefinition is one file of the --scans directory, e.g. a key of a
+// mounted ConfigMap. A definition with a name is a profile: its own
+// targets, schedule, script and webhook, scanned into its own history.
+// Those without one add to the daemon's positional base domains.
+type scanDefinition struct {
+	Name         string   `json:"name"`
+	BaseDomains  []string `json:"base_domains"`
+	Interval     string   `json:"interval"`      // default --interval
+	Script       string   `json:"script"`        // default --script
+	Templates    []string `json:"templates"`     // default --template
+	AlertWebhook string   `json:"alert_webhook"` // not inherited from --alert-webhook
+}
+
+// daemonProfile is a named scan definition, loaded.
+type daemonProfile struct {
+	name      string
+	bases     []string
+	templates []string
+	interval  time.Duration
+	script    *resultScript
+	webhook   string
+}
+
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// daemonTargets merges the positional base domains with those of every
+// unnamed scan definition under path, and loads the named ones as
+// profiles, scanned every interval unless they set their own.
+func daemonTargets(positional []string, path string, interval time.Duration) ([]string, []daemonProfile, error) {
+	bases := append([]string(nil), positional...)
+	var profiles []daemonProfile
+	if path != "" {
+		files := []string{path}
+		if info, err := os.Stat(path); err != nil {
+			return nil, nil, err
+		} else if info.IsDir() {
+			// Kubernetes mounts the real files under ..data; the top-level
+			// *.json entries are symlinks that always point at a complete set.
+			if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+				return nil, nil, err
+			}
+		}
+		seen := make(map[string]bool)
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, nil, err
+			}
+			var def scanDefinition
+			if err := json.Unmarshal(data, &def); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", f, err)
+			}
+			if def.Name == "" {
+				bases = append(bases, def.BaseDomains...)
+				continue
+			}
+			p, err := loadProfile(def, interval)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", f, err)
+			}
+			if seen[p.name] {
+				return nil, nil, fmt.Errorf("%s: profile %s is defined twice", f, p.name)
+			}
+			seen[p.name] = true
+			profiles = append(profiles, p)
+		}
+	}
+
+	bases = normalizeBases(bases)
+	if len(bases) == 0 && len(profiles) == 0 {
+		return nil, nil, fmt.Errorf("no base domains configured")
+	}
+	return bases, profiles, nil
+}
+
+// loadProfile loads a named definition. Each profile gets its own copy of
+// the script, as profiles scan concurrently.
+func loadProfile(def scanDefinition, interval time.Duration) (daemonProfile, error) {
+	p := daemonProfile{name: def.Name, interval: interval, webhook: def.AlertWebhook}
+	if !profileName.MatchString(p.name) {
+		return p, fmt.Errorf("profile name %q: want lower-case letters, digits, - and _", p.name)
+	}
+	if p.bases = normalizeBases(def.BaseDomains); len(p.bases) == 0 {
+		return p, fmt.Errorf("profile %s has no base domains", p.name)
+	}
+	if def.Interval != "" {
+		d, err := time.ParseDuration(def.Interval)
+		if err != nil || d <= 0 {
+			return p, fmt.Errorf("profile %s: interval %q is not a positive duration", p.name, def.Interval)
+		}
+		p.interval = d
+	}
+	p.templates = targetTemplates
+	if len(def.Templates) > 0 {
+		p.templates = nil
+		for _, tmpl := range def.Templates {
+			tmpl = strings.ToLower(strings.TrimSpace(tmpl))
+			if err := checkTemplate(tmpl); err != nil {
+				return p, fmt.Errorf("profile %s: %v", p.name, err)
+			}
+			p.templates = append(p.templates, tmpl)
+		}
+	}
+	path := def.Script
+	if path == "" {
+		path = scriptPath
+	}
+	if path != "" {
+		script, err := loadScript(path)
+		if err != nil {
+			return p, fmt.Errorf("profile %s: %v", p.name, err)
+		}
+		p.script = script
+	}
+	return p, nil
+}
+
+// extraHosts is hosts less those among targets already.
+func extraHosts(targets [][]string, hosts []string) []string {
+	seen := make(map[string]bool)
+	for _, domains := range targets {
+		for _, d := range domains {
+			seen[d] = true
+		}
+	}
+	var out []string
+	for _, h := range hosts {
+		if !seen[h] {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// normalizeBases lower-cases base domains and drops blanks and repeats.
+func normalizeBases(bases []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, b := range bases {
+		b = strings.ToLower(strings.TrimSpace(b))
+		if b == "" || seen[b] {
+			continue
+		}
+		seen[b] = true
+		out = append(out, b)
+	}
+	return out
+}
+
+// daemonScan sweeps every base domain once, in the shape of templates, and
+// hosts as they are, and records the results as one scan. NXDOMAIN results
+// are kept so that domains appearing later show up in diffs. New
+// registrations are posted to webhook, if set. script, sink and alerts may
+// be nil. The scan is recorded in the audit log from audit, which names
+// what triggered it.
+func daemonScan(ctx context.Context, store historyStore, bases, templates, hosts []string, script *resultScript, webhook string, sink *syslogSink, alerts *criticalAlerts, audit auditEntry) (err error) {
+	tlds, err := loadTLDs(true)
+	if err != nil {
+		return err
+	}
+
+	rec := &scanRecord{BaseDomains: bases, StartedAt: time.Now().UTC()}
+	rec.ID = newScanID(rec.StartedAt)
+	notes, err := store.annotations()
+	if err != nil {
+		return err
+	}
+	root := tracing.start("scan", stringAttr("tls_sweep.base_domains", strings.Join(bases, ",")), stringAttr("tls_sweep.profile", audit.Profile))
+	generate := root.child("generate targets")
+	targets := make([][]string, len(bases))
+	total := 0
+	for i, base := range bases {
+		targets[i] = expandTargetsWith(base, tlds, templates)
+		total += len(targets[i])
+	}
+	if extra := extraHosts(targets, hosts); len(extra) > 0 {
+		targets = append(targets, extra)
+		total += len(extra)
+	}
+	generate.set(intAttr("tls_sweep.targets", total))
+	generate.end()
+	audit.ScanID, audit.BaseDomains, audit.Targets = rec.ID, bases, total
+	audited := auditTrail.start(audit)
+	defer func() {
+		audited.finish(len(rec.Results), err)
+		if err != nil {
+			root.fail(err.Error())
+		}
+		root.end()
+	}()
+
+	s := newScanner()
+	s.span = root
+	for _, domains := range targets {
+		results := make(chan ScanResult, len(domains))
+		go sweep(ctx, s, domains, results)
+		processed := annotateResults(recordCerts(results, certHistory), notes)
+		if script != nil {
+			processed = scriptResults(processed, script)
+		}
+		if sink != nil {
+			processed = syslogResults(processed, sink)
+		}
+		for r := range processed {
+			if r.Status != "NXDOMAIN" {
+				runResultHook(r)
+			}
+			rec.Results = append(rec.Results, r)
+		}
+	}
+	saveCertHistory()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	rec.FinishedAt = time.Now().UTC()
+	export := root.child("export", stringAttr("tls_sweep.scan_id", rec.ID))
+	defer export.end()
+
+	var prev *scanRecord
+	if scans, err := store.list(); err == nil && len(scans) > 0 {
+		prev, _ = store.load(scans[0].ID)
+	}
+	if err := deliver("history store", func() error { return store.save(rec) }); err != nil {
+		name := audit.Profile
+		if name == "" {
+			name = "daemon"
+		}
+		sink := newResultSink("history store", "history", name, nil)
+		sink.giveUp(err)
+		sink.spoolAll(rec.Results)
+		sink.close()
+		return err
+	}
+	logger.Printf("Scan %s recorded %d results\n", rec.ID, len(rec.Results))
+
+	if alerts != nil {
+		if err := alerts.page(rec.Results, time.Now()); err != nil {
+			logger.Printf("Paging failed: %v\n", err)
+		}
+	}
+
+	if prev != nil {
+		if found := newRegistrations(prev, rec); len(found) > 0 {
+			alert := registrationAlert{ScanID: rec.ID, PreviousScanID: prev.ID, Domains: found}
+			if err := sendRegistrationAlert(webhook, alert); err != nil {
+				logger.Printf("Failed to send new-registration alert: %v\n", err)
+			}
+		}
+	}
+
+	var found []ScanResult
+	for _, r := range rec.Results {
+		if r.Status != "NXDOMAIN" {
+			found = append(found, r)
+		}
+	}
+	runPostScanHook(found)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDaemonTargets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "retail.json"), []byte(`{"base_domains": ["Amazon", "ebay"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a definition"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "travel.json"), []byte(`{"name": "travel", "base_domains": ["Booking", "expedia"], "interval": "6h", "alert_webhook": "https://hooks.example/travel", "templates": ["{base}.{tld}", "{Base}-Login.{tld}"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, profiles, err := daemonTargets([]string{"google", "amazon"}, dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "google,amazon,ebay" {
+		t.Errorf("targets = %v", got)
+	}
+	if len(profiles) != 1 || profiles[0].name != "travel" || strings.Join(profiles[0].bases, ",") != "booking,expedia" ||
+		profiles[0].interval != 6*time.Hour || profiles[0].webhook != "https://hooks.example/travel" ||
+		strings.Join(profiles[0].templates, ",") != "{base}.{tld},{base}-login.{tld}" {
+		t.Errorf("profiles = %+v", profiles)
+	}
+
+	if _, _, err := daemonTargets(nil, t.TempDir(), time.Hour); err == nil {
+		t.Error("an empty definition directory should be rejected")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := daemonTargets(nil, dir, time.Hour); err == nil {
+		t.Error("a malformed definition should be rejected")
+	}
+}
+
+func TestDaemonProfileErrors(t *testing.T) {
+	for _, def := range []string{
+		`{"name": "Travel Team", "base_domains": ["booking"]}`,
+		`{"name": "travel"}`,
+		`{"name": "travel", "base_domains": ["booking"], "interval": "daily"}`,
+		`{"name": "travel", "base_domains": ["booking"], "script": "missing.star"}`,
+		`{"name": "travel", "base_domains": ["booking"], "templates": ["login-{base}"]}`,
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "p.json"), []byte(def), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := daemonTargets(nil, dir, time.Hour); err == nil {
+			t.Errorf("%s accepted", def)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, f := range []string{"a.json", "b.json"} {
+		os.WriteFile(filepath.Join(dir, f), []byte(`{"name": "travel", "base_domains": ["booking"]}`), 0o644)
+	}
+	if _, _, err := daemonTargets(nil, dir, time.Hour); err == nil {
+		t.Error("a profile defined twice should be rejected")
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// dashboard serves a read-only web UI over the history store: the list of
+// scans, each scan's results, per-domain history, an expiry timeline and a
+// diff between two scans.
+type dashboard struct {
+	store historyStore
+	tmpl  *template.Template
+}
+
+// newDashboard serves store. Links start with prefix, the path the
+// dashboard is mounted under, or "" at the root.
+func newDashboard(store historyStore, prefix string) (*dashboard, error) {
+	funcs := template.FuncMap{
+		"join": strings.Join,
+		"url": func(path string) string {
+			return prefix + path
+		},
+		"duration": func(from, to time.Time) string {
+			return to.Sub(from).Round(time.Second).String()
+		},
+		"errors": func(s scanSummary) int {
+			return s.Total - s.ByStatus["OK"] - s.ByStatus["NXDOMAIN"]
+		},
+		// next returns the scan before i in a newest-first listing.
+		"next": func(list []scanSummary, i int) *scanSummary {
+			if i+1 < len(list) {
+				return &list[i+1]
+			}
+			return nil
+		},
+		"statusClass": func(status string) string {
+			switch status {
+			case "OK":
+				return "ok"
+			case "NXDOMAIN":
+				return "muted"
+			}
+			return "err"
+		},
+		"expiryClass": func(days int) string {
+			switch {
+			case days < 0:
+				return "err"
+			case days < 30:
+				return "warn"
+			}
+			return "ok"
+		},
+	}
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	return &dashboard{store: store, tmpl: tmpl}, nil
+}
+
+func (d *dashboard) routes(mux *http.ServeMux) {
+	mux.HandleFunc("/", d.index)
+	mux.HandleFunc("/scans/", d.scan)
+	mux.HandleFunc("/domains/", d.domain)
+	mux.HandleFunc("/timeline", d.timeline)
+	mux.HandleFunc("/diff", d.diff)
+}
+
+func (d *dashboard) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := d.tmpl.ExecuteTemplate(w, name, data); err != nil {
+		logger.Printf("Rendering %s failed: %v\n", name, err)
+	}
+}
+
+func (d *dashboard) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	scans, err := d.store.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.render(w, "index.html", scans)
+}
+
+func (d *dashboard) scan(w http.ResponseWriter, r *http.Request) {
+	id, pdf := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/scans/"), "/report.pdf")
+	rec, err := d.store.load(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if pdf {
+		w.Header().Set("Content-Type", "application/pdf")
+		if err := writePDFReport(w, buildPDFReport(rec, time.Now()), pdfBrand, pdfColor, time.Now()); err != nil {
+			logger.Printf("Rendering the PDF report of %s failed: %v\n", id, err)
+		}
+		return
+	}
+	data := struct {
+		Record   *scanRecord
+		Rows     []ScanResult
+		NotFound int
+	}{Record: rec}
+	for _, res := range rec.Results {
+		if res.Status == "NXDOMAIN" {
+			data.NotFound++
+			continue
+		}
+		data.Rows = append(data.Rows, res)
+	}
+	d.render(w, "scan.html", data)
+}
+
+func (d *dashboard) domain(w http.ResponseWriter, r *http.Request) {
+	domain := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/domains/"))
+	scans, err := d.store.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type row struct {
+		ScanID string
+		Result ScanResult
+	}
+	data := struct {
+		Domain string
+		Note   *annotation
+		Rows   []row
+	}{Domain: domain}
+	if notes, err := d.store.annotations(); err == nil {
+		if a, ok := notes[domain]; ok {
+			data.Note = &a
+		}
+	}
+	for _, s := range scans {
+		rec, err := d.store.load(s.ID)
+		if err != nil {
+			continue
+		}
+		if res, ok := rec.result(domain); ok {
+			data.Rows = append(data.Rows, row{ScanID: s.ID, Result: res})
+		}
+	}
+	d.render(w, "domain.html", data)
+}
+
+type timelineEntry struct {
+	Result   ScanResult
+	Expires  time.Time
+	DaysLeft int
+}
+
+type timelineMonth struct {
+	Month   string
+	Width   int
+	Entries []timelineEntry
+}
+
+func (d *dashboard) timeline(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		ScanID string
+		Months []timelineMonth
+	}{}
+
+	scans, err := d.store.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(scans) > 0 {
+		rec, err := d.store.load(scans[0].ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.ScanID = rec.ID
+		data.Months = expiryTimeline(rec.Results, time.Now())
+	}
+	d.render(w, "timeline.html", data)
+}
+
+// expiryTimeline groups certificates by expiry month, soonest first.
+func expiryTimeline(results []ScanResult, now time.Time) []timelineMonth {
+	var entries []timelineEntry
+	for _, res := range results {
+		exp, ok := parseValidTo(res.ValidTo)
+		if !ok {
+			continue
+		}
+		entries = append(entries, timelineEntry{
+			Result:   res,
+			Expires:  exp,
+			DaysLeft: int(exp.Sub(now).Hours() / 24),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Expires.Before(entries[j].Expires) })
+
+	var months []timelineMonth
+	for _, e := range entries {
+		m := e.Expires.Format("2006-01")
+		if len(months) == 0 || months[len(months)-1].Month != m {
+			months = append(months, timelineMonth{Month: m})
+		}
+		last := &months[len(months)-1]
+		last.Entries = append(last.Entries, e)
+		last.Width = 8 * len(last.Entries)
+	}
+	return months
+}
+
+func (d *dashboard) diff(w http.ResponseWriter, r *http.Request) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" || to == "" {
+		scans, err := d.store.list()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(scans) < 2 {
+			d.render(w, "diff.html", struct{ From, To string }{})
+			return
+		}
+		from, to = scans[1].ID, scans[0].ID
+	}
+
+	before, err := d.store.load(from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("scan %s: %v", from, err), http.StatusNotFound)
+		return
+	}
+	after, err := d.store.load(to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("scan %s: %v", to, err), http.StatusNotFound)
+		return
+	}
+	d.render(w, "diff.html", struct {
+		From, To string
+		Changes  []scanChange
+	}{from, to, diffScans(before, after)})
+}
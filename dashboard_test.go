@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboardPages(t *testing.T) {
+	store, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &scanRecord{ID: "20240501T000000Z", BaseDomains: []string{"example"}, Results: []ScanResult{
+		{Domain: "example.com", Status: "OK", Subject: "example.com", Issuer: "Test CA", ValidTo: "2024-06-01"},
+	}}
+	second := &scanRecord{ID: "20240502T000000Z", BaseDomains: []string{"example"}, Results: []ScanResult{
+		{Domain: "example.com", Status: "OK", Subject: "example.com", Issuer: "Test CA", ValidTo: "2025-06-01"},
+		{Domain: "example.net", Status: "TLS ERROR"},
+	}}
+	for _, rec := range []*scanRecord{first, second} {
+		if err := store.save(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.importAnnotations(map[string]annotation{"example.net": {Owner: "web team", Ticket: "SEC-12"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := newDashboard(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	d.routes(mux)
+
+	for _, tc := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/", 200, "/diff?from=20240501T000000Z"},
+		{"/scans/20240502T000000Z", 200, "example.net"},
+		{"/scans/20240502T000000Z/report.pdf", 200, "%PDF-1.4"},
+		{"/scans/missing", 404, ""},
+		{"/domains/example.com", 200, "2025-06-01"},
+		{"/domains/example.net", 200, "ticket SEC-12"},
+		{"/timeline", 200, "2025-06"},
+		{"/diff", 200, "example.net"},
+		{"/diff?from=20240501T000000Z&to=nope", 404, ""},
+		{"/nope", 404, ""},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		if rec.Code != tc.code {
+			t.Errorf("GET %s = %d, want %d", tc.path, rec.Code, tc.code)
+			continue
+		}
+		if !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("GET %s: body does not contain %q", tc.path, tc.want)
+		}
+	}
+}
+
+func TestExpiryTimeline(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	months := expiryTimeline([]ScanResult{
+		{Domain: "late.com", ValidTo: "2024-07-15"},
+		{Domain: "none.com", Status: "TLS ERROR"},
+		{Domain: "soon.com", ValidTo: "2024-05-11"},
+		{Domain: "expired.com", ValidTo: "2024-04-01"},
+		{Domain: "also-late.com", ValidTo: "2024-07-01"},
+	}, now)
+
+	if len(months) != 3 || months[0].Month != "2024-04" || months[2].Month != "2024-07" {
+		t.Fatalf("months = %+v", months)
+	}
+	if months[0].Entries[0].DaysLeft >= 0 || months[1].Entries[0].DaysLeft != 10 {
+		t.Errorf("days left = %d, %d", months[0].Entries[0].DaysLeft, months[1].Entries[0].DaysLeft)
+	}
+	if months[2].Entries[0].Result.Domain != "also-late.com" {
+		t.Errorf("July entries not sorted by expiry: %+v", months[2].Entries)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// startPprof serves the net/http/pprof handlers on addr in the background.
+// A dedicated mux is used so nothing else leaks onto the debug listener. The
+// listener is bound synchronously so a bad address fails before the scan.
+func startPprof(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	logger.Printf("pprof listening on %s\n", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			logger.Printf("pprof listener failed: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// logRuntimeStats periodically logs goroutine, heap and progress counters at
+// debug level. A flat "scanned" count across several ticks points at a stall.
+func logRuntimeStats(interval time.Duration) {
+	var m runtime.MemStats
+	for range time.Tick(interval) {
+		runtime.ReadMemStats(&m)
+		debugf("goroutines=%d heap_alloc=%s heap_sys=%s heap_objects=%d num_gc=%d scanned=%d",
+			runtime.NumGoroutine(), formatBytes(m.HeapAlloc), formatBytes(m.HeapSys),
+			m.HeapObjects, m.NumGC, scanned.Load())
+	}
+}
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// connectionAttemptDelay is the stagger between connection attempts
+// recommended by RFC 8305 section 5.
+const connectionAttemptDelay = 250 * time.Millisecond
+
+// dialRace connects to one of ips Happy Eyeballs style: addresses are
+// interleaved by family (IPv6 first), a new attempt starts every
+// connectionAttemptDelay or as soon as the previous one fails, and the first
+// established connection wins. Hosts with a broken IPv6 path therefore still
+// connect over IPv4 instead of timing out.
+//
+// Each attempt first takes a per-host slot; the dial timeout only starts once
+// the slot is held so that waiting on a busy host is not reported as an error.
+func (s *scanner) dialRace(ips []string, port string) (net.Conn, error) {
+	if len(ips) == 0 {
+		return nil, errors.New("no addresses to connect to")
+	}
+	addrs := interleaveFamilies(ips)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type attempt struct {
+		conn net.Conn
+		err  error
+	}
+	attempts := make(chan attempt, len(addrs))
+
+	next, pending := 0, 0
+	var stagger <-chan time.Time
+	start := func() {
+		ip := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := s.dialHost(ctx, ip, port)
+			attempts <- attempt{conn, err}
+		}()
+		if next < len(addrs) {
+			stagger = time.After(connectionAttemptDelay)
+		} else {
+			stagger = nil
+		}
+	}
+
+	start()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case a := <-attempts:
+			pending--
+			if a.err == nil {
+				// Close any losers that still manage to connect.
+				go func(n int) {
+					for ; n > 0; n-- {
+						if l := <-attempts; l.conn != nil {
+							l.conn.Close()
+						}
+					}
+				}(pending)
+				return a.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = a.err
+			}
+			if next < len(addrs) {
+				start()
+			}
+		case <-stagger:
+			start()
+		}
+	}
+	return nil, firstErr
+}
+
+func (s *scanner) dialHost(ctx context.Context, ip, port string) (net.Conn, error) {
+	release, err := s.hostLimit.acquire(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	dial := s.dialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(dialCtx, "tcp", net.JoinHostPort(ip, port))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, release: release}, nil
+}
+
+// connectStatus classifies a failed TCP connect: REFUSED when the host
+// answered with a reset, FILTERED when nothing answered in time or a router
+// reported the host unreachable, FD EXHAUSTED when we had no socket to
+// connect with, TLS ERROR otherwise.
+func connectStatus(err error) string {
+	var netErr net.Error
+	switch {
+	case fdExhausted(err):
+		return "FD EXHAUSTED"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "REFUSED"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "FILTERED"
+	}
+	return "TLS ERROR"
+}
+
+// handshakeStatus classifies a failed handshake: RESET when the server
+// dropped the connection in response to the ClientHello, which middleboxes
+// and SNI filters do, TLS ERROR otherwise.
+func handshakeStatus(err error) string {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "RESET"
+	}
+	return "TLS ERROR"
+}
+
+// lookup resolves host while holding one of the --max-dns-lookups slots,
+// which are shared by every lookup regardless of the resolver behind it.
+func (s *scanner) lookup(host string) ([]string, error) {
+	release, err := s.dnsLimit.acquire(context.Background(), "dns")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.lookupHost(host)
+}
+
+// interleaveFamilies orders ips alternating between IPv6 and IPv4, keeping
+// the resolver's order within each family (RFC 8305 section 4).
+func interleaveFamilies(ips []string) []string {
+	var v6, v4 []string
+	for _, ip := range ips {
+		if ipFamily(ip) == "IPv6" {
+			v6 = append(v6, ip)
+		} else {
+			v4 = append(v4, ip)
+		}
+	}
+
+	out := make([]string, 0, len(ips))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			out = append(out, v6[i])
+		}
+		if i < len(v4) {
+			out = append(out, v4[i])
+		}
+	}
+	return out
+}
+
+// otherFamily returns the addresses in ips that are not of family.
+func otherFamily(ips []string, family string) []string {
+	var out []string
+	for _, ip := range ips {
+		if ipFamily(ip) != family {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
+
+func remoteIP(conn net.Conn) string {
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	return ip
+}
+
+func ipFamily(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "IPv6"
+	}
+	return "IPv4"
+}
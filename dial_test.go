@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterleaveFamilies(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"empty", nil, []string{}},
+		{"v4 only", []string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.1", "192.0.2.2"}},
+		{"v6 only", []string{"2001:db8::1", "2001:db8::2"}, []string{"2001:db8::1", "2001:db8::2"}},
+		{"v6 first", []string{"192.0.2.1", "2001:db8::1"}, []string{"2001:db8::1", "192.0.2.1"}},
+		{
+			"alternates keeping order",
+			[]string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "2001:db8::1", "2001:db8::2"},
+			[]string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2", "192.0.2.3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interleaveFamilies(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("interleaveFamilies(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// dualStackListeners binds 127.0.0.1 and ::1 on the same port.
+func dualStackListeners(t *testing.T) (v4, v6 net.Listener, port string) {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		l4, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, p, _ := net.SplitHostPort(l4.Addr().String())
+		l6, err := net.Listen("tcp", net.JoinHostPort("::1", p))
+		if err == nil {
+			t.Cleanup(func() { l4.Close(); l6.Close() })
+			return l4, l6, p
+		}
+		l4.Close()
+		if strings.Contains(err.Error(), "cannot assign") {
+			t.Skip("IPv6 loopback unavailable")
+		}
+	}
+	t.Skip("could not bind both families on one port")
+	return
+}
+
+func acceptAndHold(t *testing.T, ln net.Listener) {
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { c.Close() })
+		}
+	}()
+}
+
+func TestDialRaceFallsBackToWorkingFamily(t *testing.T) {
+	v4, v6, port := dualStackListeners(t)
+	v6.Close() // connections to ::1 are now refused
+	acceptAndHold(t, v4)
+
+	s := &scanner{port: port, timeout: time.Second}
+	start := time.Now()
+	conn, err := s.dialRace([]string{"127.0.0.1", "::1"}, port)
+	if err != nil {
+		t.Fatalf("dialRace: %v", err)
+	}
+	defer conn.Close()
+
+	if ip := remoteIP(conn); ip != "127.0.0.1" {
+		t.Errorf("winner = %s, want 127.0.0.1", ip)
+	}
+	// A refused attempt must start the next one immediately, not after the
+	// stagger delay.
+	if d := time.Since(start); d >= connectionAttemptDelay {
+		t.Errorf("fallback took %v, want < %v", d, connectionAttemptDelay)
+	}
+}
+
+func TestDialRaceStaggersPastHangingAddress(t *testing.T) {
+	v4, _, port := dualStackListeners(t)
+	acceptAndHold(t, v4)
+
+	// Attempts to ::1 hang until cancelled, like a black-holed IPv6 route.
+	s := &scanner{
+		port:    port,
+		timeout: 5 * time.Second,
+		dialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if strings.HasPrefix(addr, "[::1]") {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+
+	start := time.Now()
+	conn, err := s.dialRace([]string{"::1", "127.0.0.1"}, port)
+	if err != nil {
+		t.Fatalf("dialRace: %v", err)
+	}
+	defer conn.Close()
+	d := time.Since(start)
+
+	if ip := remoteIP(conn); ip != "127.0.0.1" {
+		t.Errorf("winner = %s, want 127.0.0.1", ip)
+	}
+	if d < connectionAttemptDelay || d > 3*connectionAttemptDelay {
+		t.Errorf("second attempt won after %v, want about %v", d, connectionAttemptDelay)
+	}
+}
+
+func TestDialRaceAllFail(t *testing.T) {
+	_, v6, port := dualStackListeners(t)
+	v6.Close()
+
+	s := &scanner{port: port, timeout: time.Second}
+	if conn, err := s.dialRace([]string{"::1"}, port); err == nil {
+		conn.Close()
+		t.Fatal("dialRace succeeded against a closed port")
+	}
+}
+
+// TestScanRetriesOtherFamilyOnHandshakeFailure leaves ::1 listening without
+// ever accepting, so TCP connects through the backlog but the handshake
+// stalls, while 127.0.0.1 serves TLS.
+func TestScanRetriesOtherFamilyOnHandshakeFailure(t *testing.T) {
+	v4, _, port := dualStackListeners(t)
+
+	cert, err := selfSignedCert("dual.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsLn := tls.NewListener(v4, &tls.Config{Certificates: []tls.Certificate{cert}})
+	go func() {
+		for {
+			c, err := tlsLn.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+
+	s := &scanner{
+		port:    port,
+		timeout: 300 * time.Millisecond,
+		lookupHost: func(string) ([]string, error) {
+			return []string{"127.0.0.1", "::1"}, nil
+		},
+	}
+	r := s.scan("dual.example")
+	if r.Status != "OK" || r.IP != "127.0.0.1" || r.Family != "IPv4" {
+		t.Errorf("scan = %+v, want OK over IPv4", r)
+	}
+}
+
+func TestScanDialFailureHasNoFamily(t *testing.T) {
+	_, v6, port := dualStackListeners(t)
+	v6.Close()
+
+	s := &scanner{
+		port:    port,
+		timeout: time.Second,
+		lookupHost: func(string) ([]string, error) {
+			return []string{"::1"}, nil
+		},
+	}
+	r := s.scan("down.example")
+	if r.Status != "REFUSED" || r.Family != "" {
+		t.Errorf("scan = %+v, want REFUSED with no family", r)
+	}
+}
+
+func TestScanFilteredAndReset(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// Read the ClientHello, then abort with a RST.
+			conn.Read(make([]byte, 1024))
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	s := &scanner{
+		port:       port,
+		timeout:    time.Second,
+		lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+	}
+	if r := s.scan("reset.example"); r.Status != "RESET" {
+		t.Errorf("scan = %+v, want RESET", r)
+	}
+
+	s.dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+	}
+	s.timeout = 50 * time.Millisecond
+	if r := s.scan("filtered.example"); r.Status != "FILTERED" {
+		t.Errorf("scan = %+v, want FILTERED", r)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// tcpKeepAlive is --tcp-keepalive, the keepalive probe interval of scan
+// connections, 0 for none.
+var tcpKeepAlive = 15 * time.Second
+
+// tcpFastOpen is --tcp-fastopen: send the ClientHello with the SYN to
+// servers that gave us a Fast Open cookie before. Only Linux does this;
+// elsewhere, and on kernels without it, connects are plain.
+var tcpFastOpen bool
+
+// newScanDialer is the dialer every TCP connection of a scanner goes
+// through.
+func newScanDialer() *net.Dialer {
+	d := &net.Dialer{KeepAlive: tcpKeepAlive}
+	if tcpKeepAlive == 0 {
+		d.KeepAlive = -1
+	}
+	if tcpFastOpen {
+		d.Control = fastOpenControl
+	}
+	return d
+}
+
+// fdExhausted reports whether err is the process or the system running out
+// of file descriptors. Lookups flatten the error into a *net.DNSError, so
+// its text is checked too.
+func fdExhausted(err error) bool {
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && strings.Contains(dnsErr.Err, "too many open files")
+}
+
+var fdWarning sync.Once
+
+// warnFDExhausted logs, once per run, that results are failing for want of
+// file descriptors rather than because of the targets.
+func warnFDExhausted(r ScanResult, workers int) {
+	if r.Status != "FD EXHAUSTED" {
+		return
+	}
+	fdWarning.Do(func() {
+		logger.Printf("Out of file descriptors at %d workers (%v); results are FD EXHAUSTED until connections close. Lower --workers or raise the open file limit (ulimit -n)\n", workers, r.Err)
+	})
+}
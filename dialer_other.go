@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// fastOpenControl leaves connects alone: --tcp-fastopen is Linux only.
+func fastOpenControl(network, address string, c syscall.RawConn) error {
+	return nil
+}
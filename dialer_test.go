@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFDExhausted(t *testing.T) {
+	for _, c := range []struct {
+		err     error
+		connect string
+		lookup  string
+	}{
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("socket", syscall.EMFILE)}, "FD EXHAUSTED", "FD EXHAUSTED"},
+		{fmt.Errorf("dial: %w", syscall.ENFILE), "FD EXHAUSTED", "FD EXHAUSTED"},
+		{&net.DNSError{Err: "dial udp 192.0.2.53:53: socket: too many open files", Name: "shop.example"}, "FD EXHAUSTED", "FD EXHAUSTED"},
+		{&net.DNSError{Err: "no such host", Name: "shop.example", IsNotFound: true}, "TLS ERROR", "NXDOMAIN"},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "REFUSED", "DNS ERROR"},
+	} {
+		if got := connectStatus(c.err); got != c.connect {
+			t.Errorf("connectStatus(%v) = %s, want %s", c.err, got, c.connect)
+		}
+		if got := dnsStatus(c.err); got != c.lookup {
+			t.Errorf("dnsStatus(%v) = %s, want %s", c.err, got, c.lookup)
+		}
+	}
+}
+
+func TestNewScanDialer(t *testing.T) {
+	defer func(d time.Duration, fo bool) { tcpKeepAlive, tcpFastOpen = d, fo }(tcpKeepAlive, tcpFastOpen)
+
+	tcpKeepAlive, tcpFastOpen = 0, false
+	if d := newScanDialer(); d.KeepAlive >= 0 || d.Control != nil {
+		t.Errorf("--tcp-keepalive 0 dialer = %+v, want keepalives off and no Control", d)
+	}
+
+	// Fast Open falls back to a plain connect when the server or the
+	// kernel does not do it, so the dialer works either way.
+	tcpKeepAlive, tcpFastOpen = 30*time.Second, true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			c.Write([]byte("hi"))
+			c.Close()
+		}
+	}()
+	d := newScanDialer()
+	if d.KeepAlive != 30*time.Second {
+		t.Errorf("KeepAlive = %v, want 30s", d.KeepAlive)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "hi" {
+		t.Errorf("read %q, %v", buf, err)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A coordinator hands out batches of targets to remote workers over
+// HTTP/JSON and collects their results. Workers pull work, so they can sit
+// behind NAT or different egress IPs and only need to reach the coordinator.
+//
+//	POST /lease    {"worker": "..."}            -> 200 leaseResponse, 204 none pending, 410 sweep done
+//	POST /results  {"lease_id": "...", ...}     -> 204
+//
+// A lease that is not reported back within the lease timeout is returned to
+// the pending queue and handed to the next worker that asks.
+type coordinator struct {
+	batch        int
+	leaseTimeout time.Duration
+
+	mu       sync.Mutex
+	targets  []string
+	isTarget map[string]bool
+	pending  []string
+	leases   map[string]*lease
+	// results holds every result of a target, one per mail host and
+	// port with --mx, keyed by the target.
+	results map[string][]ScanResult
+	done    chan struct{}
+}
+
+type lease struct {
+	worker  string
+	targets map[string]bool
+	expires time.Time
+}
+
+type leaseRequest struct {
+	Worker string `json:"worker"`
+}
+
+type leaseResponse struct {
+	LeaseID string   `json:"lease_id"`
+	Targets []string `json:"targets"`
+}
+
+type resultsRequest struct {
+	LeaseID string       `json:"lease_id"`
+	Results []ScanResult `json:"results"`
+}
+
+func newCoordinator(targets []string, batch int, leaseTimeout time.Duration) *coordinator {
+	c := &coordinator{
+		batch:        batch,
+		leaseTimeout: leaseTimeout,
+		targets:      targets,
+		isTarget:     make(map[string]bool, len(targets)),
+		pending:      append([]string(nil), targets...),
+		leases:       make(map[string]*lease),
+		results:      make(map[string][]ScanResult),
+		done:         make(chan struct{}),
+	}
+	for _, t := range targets {
+		c.isTarget[t] = true
+	}
+	if len(targets) == 0 {
+		close(c.done)
+	}
+	return c
+}
+
+// lease hands out up to c.batch pending targets. It returns ok=false when
+// nothing is pending right now, and finished=true once every target has a
+// result.
+func (c *coordinator) lease(worker string, now time.Time) (resp leaseResponse, ok, finished bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reclaimLocked(now)
+	if len(c.results) == len(c.targets) {
+		return resp, false, true
+	}
+	if len(c.pending) == 0 {
+		return resp, false, false
+	}
+
+	n := min(c.batch, len(c.pending))
+	l := &lease{worker: worker, targets: make(map[string]bool, n), expires: now.Add(c.leaseTimeout)}
+	for _, t := range c.pending[:n] {
+		l.targets[t] = true
+	}
+	resp = leaseResponse{LeaseID: newLeaseID(), Targets: append([]string(nil), c.pending[:n]...)}
+	c.pending = c.pending[n:]
+	c.leases[resp.LeaseID] = l
+	return resp, true, false
+}
+
+// complete records results for a lease. Late results for an expired lease
+// are still kept if nobody else has reported the target yet; the results of
+// a target all come from one report.
+func (c *coordinator) complete(leaseID string, results []ScanResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l := c.leases[leaseID]
+	reported := make(map[string][]ScanResult)
+	for _, r := range results {
+		if c.isTarget[r.Domain] {
+			reported[r.Domain] = append(reported[r.Domain], r)
+		}
+	}
+	for domain, rs := range reported {
+		if _, seen := c.results[domain]; !seen {
+			c.results[domain] = rs
+		}
+		if l != nil {
+			delete(l.targets, domain)
+		}
+	}
+	if l != nil && len(l.targets) == 0 {
+		delete(c.leases, leaseID)
+	}
+	if len(c.results) == len(c.targets) {
+		select {
+		case <-c.done:
+		default:
+			close(c.done)
+		}
+	}
+}
+
+// reclaimLocked puts the unfinished targets of expired leases back in the
+// pending queue.
+func (c *coordinator) reclaimLocked(now time.Time) {
+	for id, l := range c.leases {
+		if now.Before(l.expires) {
+			continue
+		}
+		for t := range l.targets {
+			if _, seen := c.results[t]; !seen {
+				c.pending = append(c.pending, t)
+			}
+		}
+		logger.Printf("Lease %s of worker %s expired, %d targets requeued\n", id, l.worker, len(l.targets))
+		delete(c.leases, id)
+	}
+}
+
+func (c *coordinator) progress() (done, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.results), len(c.targets)
+}
+
+// ordered returns the results in target order.
+func (c *coordinator) ordered() []ScanResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]ScanResult, 0, len(c.targets))
+	for _, t := range c.targets {
+		out = append(out, c.results[t]...)
+	}
+	return out
+}
+
+func (c *coordinator) handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lease", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req leaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, ok, finished := c.lease(req.Worker, time.Now())
+		switch {
+		case finished:
+			w.WriteHeader(http.StatusGone)
+		case !ok:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+		}
+	})
+	mux.HandleFunc("/results", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req resultsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.complete(req.LeaseID, req.Results)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return requireToken(token, mux)
+}
+
+// requireToken rejects requests without the shared bearer token. An empty
+// token disables the check.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newLeaseID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func runCoordinator(args []string) {
+	fs := flag.NewFlagSet("coordinator", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:7070", "address to accept worker connections on")
+	batch := fs.Int("batch", 50, "targets handed to a worker per lease")
+	leaseTimeout := fs.Duration("lease-timeout", 5*time.Minute, "requeue a lease if its results are not reported within this time")
+	token := fs.String("token", os.Getenv("TLS_SWEEP_TOKEN"), "shared bearer token workers must present (default $TLS_SWEEP_TOKEN)")
+	fs.BoolVar(&forceRefresh, "force-tld-refresh", false, "ignore the cached TLD list and fetch it from IANA")
+	registerFetchFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep coordinator [flags] <base-domain>")
+		fs.PrintDefaults()
+	}
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *batch < 1 {
+		logger.Fatalf("--batch must be at least 1\n")
+	}
+	baseDomain := pos[0]
+
+	tlds, err := loadTLDs(!forceRefresh)
+	if err != nil {
+		logger.Fatalf("Failed to load TLDs: %v\n", err)
+	}
+	c := newCoordinator(expandTargets(baseDomain, tlds), *batch, *leaseTimeout)
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logger.Fatalf("Failed to listen: %v\n", err)
+	}
+	srv := &http.Server{Handler: c.handler(*token)}
+	go srv.Serve(ln)
+	logger.Printf("Coordinating %d targets on %s\n", len(c.targets), ln.Addr())
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-c.done:
+			break wait
+		case <-ticker.C:
+			done, total := c.progress()
+			logger.Printf("Progress: %d/%d targets\n", done, total)
+		}
+	}
+
+	results := c.ordered()
+	all := make(chan ScanResult, len(results))
+	for _, r := range results {
+		all <- r
+	}
+	close(all)
+	exportToCsv(baseDomain, all)
+
+	// Keep answering 410 for a moment so polling workers learn they are done.
+	time.Sleep(5 * time.Second)
+	srv.Shutdown(context.Background())
+}
+
+func runWorker(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	addr := fs.String("coordinator", "http://localhost:7070", "coordinator base URL")
+	token := fs.String("token", os.Getenv("TLS_SWEEP_TOKEN"), "shared bearer token (default $TLS_SWEEP_TOKEN)")
+	poll := fs.Duration("poll-interval", 5*time.Second, "wait between lease requests when no work is pending")
+	registerScanFlags(fs)
+	fs.Parse(args)
+	if maxWorkers < 1 {
+		logger.Fatalf("--workers must be at least 1\n")
+	}
+	if err := checkTLSRange(); err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+
+	host, _ := os.Hostname()
+	w := &remoteWorker{
+		base:   strings.TrimSuffix(*addr, "/"),
+		token:  *token,
+		name:   fmt.Sprintf("%s-%d", host, os.Getpid()),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	s := newScanner()
+
+	for {
+		l, err := w.lease()
+		switch {
+		case errors.Is(err, errSweepDone):
+			logger.Println("Coordinator reports the sweep is done.")
+			return
+		case err != nil:
+			logger.Printf("Lease failed: %v\n", err)
+			time.Sleep(*poll)
+			continue
+		case l == nil:
+			time.Sleep(*poll)
+			continue
+		}
+
+		results := make(chan ScanResult, len(l.Targets))
+		go sweep(context.Background(), s, l.Targets, results)
+		var batch []ScanResult
+		for r := range results {
+			batch = append(batch, r)
+		}
+
+		for attempt := 1; ; attempt++ {
+			if err = w.report(l.LeaseID, batch); err == nil || attempt == 3 {
+				break
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err != nil {
+			logger.Printf("Dropping %d results after failed reports: %v\n", len(batch), err)
+			continue
+		}
+		logger.Printf("Reported %d results\n", len(batch))
+	}
+}
+
+var errSweepDone = errors.New("sweep done")
+
+type remoteWorker struct {
+	base   string
+	token  string
+	name   string
+	client *http.Client
+}
+
+// lease returns nil without error when the coordinator has no work pending.
+func (w *remoteWorker) lease() (*leaseResponse, error) {
+	resp, err := w.post("/lease", leaseRequest{Worker: w.name})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var l leaseResponse
+		if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+			return nil, err
+		}
+		return &l, nil
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusGone:
+		return nil, errSweepDone
+	default:
+		return nil, fmt.Errorf("coordinator answered %s", resp.Status)
+	}
+}
+
+func (w *remoteWorker) report(leaseID string, results []ScanResult) error {
+	resp, err := w.post("/results", resultsRequest{LeaseID: leaseID, Results: results})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("coordinator answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *remoteWorker) post(path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.base+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	return w.client.Do(req)
+}
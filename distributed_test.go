@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCoordinatorLeaseAndComplete(t *testing.T) {
+	c := newCoordinator([]string{"a", "b", "c"}, 2, time.Minute)
+	now := time.Now()
+
+	l1, ok, finished := c.lease("w1", now)
+	if !ok || finished || len(l1.Targets) != 2 {
+		t.Fatalf("first lease = %+v ok=%v finished=%v", l1, ok, finished)
+	}
+	l2, ok, _ := c.lease("w2", now)
+	if !ok || len(l2.Targets) != 1 || l2.Targets[0] != "c" {
+		t.Fatalf("second lease = %+v", l2)
+	}
+	if _, ok, finished := c.lease("w3", now); ok || finished {
+		t.Fatal("expected nothing pending while leases are out")
+	}
+
+	c.complete(l1.LeaseID, []ScanResult{{Domain: "a", Status: "OK"}, {Domain: "b", Status: "NXDOMAIN"}})
+	// --mx reports one result per mail host of the same target.
+	c.complete(l2.LeaseID, []ScanResult{{Domain: "c", MX: "mx1.c", Status: "OK"}, {Domain: "c", MX: "mx2.c", Status: "OK"}})
+
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("done not closed after all results")
+	}
+	if _, _, finished := c.lease("w1", now); !finished {
+		t.Error("lease after completion should report finished")
+	}
+	got := c.ordered()
+	if len(got) != 4 || got[0].Domain != "a" || got[2].MX != "mx1.c" || got[3].MX != "mx2.c" {
+		t.Errorf("ordered = %+v", got)
+	}
+}
+
+func TestCoordinatorRequeuesExpiredLease(t *testing.T) {
+	c := newCoordinator([]string{"a", "b"}, 2, time.Minute)
+	now := time.Now()
+
+	l, _, _ := c.lease("slow", now)
+	c.complete(l.LeaseID, []ScanResult{{Domain: "a", Status: "OK"}})
+
+	again, ok, _ := c.lease("fast", now.Add(2*time.Minute))
+	if !ok || len(again.Targets) != 1 || again.Targets[0] != "b" {
+		t.Fatalf("requeued lease = %+v ok=%v", again, ok)
+	}
+
+	// The slow worker reports late; the first result wins and nothing breaks.
+	c.complete(l.LeaseID, []ScanResult{{Domain: "b", Status: "TLS ERROR"}})
+	c.complete(again.LeaseID, []ScanResult{{Domain: "b", Status: "OK"}})
+	if r := c.ordered()[1]; r.Status != "TLS ERROR" {
+		t.Errorf("b = %+v, want the first reported result", r)
+	}
+}
+
+func TestCoordinatorHandlerToken(t *testing.T) {
+	c := newCoordinator([]string{"a"}, 10, time.Minute)
+	srv := httptest.NewServer(c.handler("secret"))
+	defer srv.Close()
+
+	body, _ := json.Marshal(leaseRequest{Worker: "w"})
+	resp, err := http.Post(srv.URL+"/lease", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("without token: %s", resp.Status)
+	}
+
+	w := &remoteWorker{base: srv.URL, token: "secret", name: "w", client: srv.Client()}
+	l, err := w.lease()
+	if err != nil || l == nil || len(l.Targets) != 1 {
+		t.Fatalf("lease = %+v, %v", l, err)
+	}
+	if err := w.report(l.LeaseID, []ScanResult{{Domain: "a", Status: "OK"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.lease(); err != errSweepDone {
+		t.Fatalf("lease after completion err = %v, want errSweepDone", err)
+	}
+}
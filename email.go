@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	emailReport    string // comma-separated recipients, from --email-report
+	smtpConfigPath string
+)
+
+// smtpConfig is the --smtp-config file. The password is best given as
+// password_env, the name of an environment variable holding it, so that
+// the file can be committed.
+type smtpConfig struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"`
+	From        string `json:"from"`
+	// TLS connects with implicit TLS (port 465); otherwise STARTTLS is
+	// used whenever the server offers it.
+	TLS bool `json:"tls"`
+}
+
+func loadSMTPConfig(path string) (*smtpConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c smtpConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if c.Host == "" || c.From == "" {
+		return nil, fmt.Errorf("%s: host and from are required", path)
+	}
+	if c.Port == 0 {
+		c.Port = 587
+		if c.TLS {
+			c.Port = 465
+		}
+	}
+	if c.PasswordEnv != "" {
+		c.Password = os.Getenv(c.PasswordEnv)
+	}
+	return &c, nil
+}
+
+// reportRecipients splits --email-report.
+func reportRecipients(list string) []string {
+	var to []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	return to
+}
+
+// reportSummary is the subject and plain-text body of the report mail.
+func reportSummary(baseDomain string, results []ScanResult) (string, string) {
+	byStatus := make(map[string]int)
+	failures := 0
+	for _, r := range results {
+		byStatus[r.Status]++
+		if isFailure(r.Status) {
+			failures++
+		}
+	}
+	subject := fmt.Sprintf("tls-sweep %s: %d results, %d failures", baseDomain, len(results), failures)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Scan of %s finished %s.\n\n", baseDomain, time.Now().UTC().Format(time.RFC1123))
+	statuses := make([]string, 0, len(byStatus))
+	for s := range byStatus {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	for _, s := range statuses {
+		fmt.Fprintf(&body, "%-12s %d\n", s, byStatus[s])
+	}
+	body.WriteString("\nThe full report is attached.\n")
+	return subject, body.String()
+}
+
+// buildReportMail assembles a multipart/mixed message with each file
+// attached.
+func buildReportMail(from string, to []string, subject, body string, files []string) ([]byte, error) {
+	var msg bytes.Buffer
+	w := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%q\r\n\r\n",
+		from, strings.Join(to, ", "), mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z), w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		ctype := mime.TypeByExtension(filepath.Ext(f))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {ctype},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(f)})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.StdEncoding.EncodeToString(data)
+		for len(enc) > 76 {
+			fmt.Fprintf(part, "%s\r\n", enc[:76])
+			enc = enc[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", enc)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// sendReport mails the summary of results with files attached.
+func sendReport(c *smtpConfig, to []string, baseDomain string, results []ScanResult, files []string) error {
+	subject, body := reportSummary(baseDomain, results)
+	msg, err := buildReportMail(c.From, to, subject, body, files)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	if !c.TLS {
+		return smtp.SendMail(addr, auth, c.From, to, msg)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, &tls.Config{ServerName: c.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	wc, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
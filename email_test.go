@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one message and sends its DATA on the returned channel.
+func fakeSMTP(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				got <- data.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 unsupported")
+			}
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p, got
+}
+
+func TestSendReport(t *testing.T) {
+	host, port, got := fakeSMTP(t)
+	report := filepath.Join(t.TempDir(), "example.csv")
+	if err := os.WriteFile(report, []byte("Domain,Status\na.example,OK\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &smtpConfig{Host: host, Port: port, From: "sweep@example.com"}
+	results := []ScanResult{{Domain: "a.example", Status: "OK"}, {Domain: "b.example", Status: "TLS ERROR"}}
+	if err := sendReport(c, reportRecipients("ops@example.com, sec@example.com"), "example", results, []string{report}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := msg.Header.Get("Subject"); s != "tls-sweep example: 2 results, 1 failures" {
+		t.Errorf("Subject = %q", s)
+	}
+	if to := msg.Header.Get("To"); to != "ops@example.com, sec@example.com" {
+		t.Errorf("To = %q", to)
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := io.ReadAll(body); !strings.Contains(string(text), "TLS ERROR") {
+		t.Errorf("body = %q, want the status counts", text)
+	}
+	attachment, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.FileName() != "example.csv" {
+		t.Errorf("attachment name = %q", attachment.FileName())
+	}
+}
+
+func TestLoadSMTPConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smtp.json")
+	os.WriteFile(path, []byte(`{"host":"smtp.example.com","from":"sweep@example.com","username":"sweep","password_env":"TEST_SMTP_PASSWORD","tls":true}`), 0o600)
+	os.Setenv("TEST_SMTP_PASSWORD", "s3cret")
+	defer os.Unsetenv("TEST_SMTP_PASSWORD")
+
+	c, err := loadSMTPConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 465 || c.Password != "s3cret" {
+		t.Errorf("config = %+v, want port 465 and the password from the environment", c)
+	}
+
+	os.WriteFile(path, []byte(`{"host":"smtp.example.com"}`), 0o600)
+	if _, err := loadSMTPConfig(path); err == nil {
+		t.Error("config without from accepted")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// enrichSource is --enrich: shodan or censys.
+var enrichSource string
+
+// hostIntel is what an internet-wide scanner knows about an IP.
+type hostIntel struct {
+	ports    []int
+	services []string // "product version", as fingerprinted from banners
+	org      string
+	certs    []string // SHA-256 of every certificate seen on the IP
+}
+
+type intelSource interface {
+	host(ip string) (hostIntel, error)
+}
+
+// newIntelSource returns the --enrich source, keyed from the environment.
+func newIntelSource(name string) (intelSource, error) {
+	switch name {
+	case "shodan":
+		key := os.Getenv("SHODAN_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("--enrich shodan needs $SHODAN_API_KEY")
+		}
+		return &shodanSource{f: metadata(), api: "https://api.shodan.io", key: key}, nil
+	case "censys":
+		id, secret := os.Getenv("CENSYS_API_ID"), os.Getenv("CENSYS_API_SECRET")
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("--enrich censys needs $CENSYS_API_ID and $CENSYS_API_SECRET")
+		}
+		return &censysSource{f: metadata(), api: "https://search.censys.io", id: id, secret: secret}, nil
+	}
+	return nil, fmt.Errorf("unknown enrichment source %q (want shodan or censys)", name)
+}
+
+// intelTTL is how long a host lookup is reused across runs; both services
+// rescan hosts every few days at best.
+const intelTTL = 24 * time.Hour
+
+type shodanSource struct {
+	f        *fetcher
+	api, key string
+}
+
+func (s *shodanSource) host(ip string) (hostIntel, error) {
+	body, err := s.f.get(s.api+"/shodan/host/"+url.PathEscape(ip)+"?key="+url.QueryEscape(s.key), intelTTL)
+	if err != nil {
+		return hostIntel{}, err
+	}
+	var h struct {
+		Ports []int  `json:"ports"`
+		Org   string `json:"org"`
+		Data  []struct {
+			Product string `json:"product"`
+			Version string `json:"version"`
+			SSL     struct {
+				Cert struct {
+					Fingerprint struct {
+						SHA256 string `json:"sha256"`
+					} `json:"fingerprint"`
+				} `json:"cert"`
+			} `json:"ssl"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &h); err != nil {
+		return hostIntel{}, fmt.Errorf("shodan: %v", err)
+	}
+	intel := hostIntel{ports: h.Ports, org: h.Org}
+	for _, d := range h.Data {
+		intel.services = append(intel.services, strings.TrimSpace(d.Product+" "+d.Version))
+		intel.certs = append(intel.certs, d.SSL.Cert.Fingerprint.SHA256)
+	}
+	return intel, nil
+}
+
+type censysSource struct {
+	f               *fetcher
+	api, id, secret string
+}
+
+func (c *censysSource) host(ip string) (hostIntel, error) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth(c.id, c.secret)
+	body, err := c.f.getWithHeader(c.api+"/api/v2/hosts/"+url.PathEscape(ip), req.Header, intelTTL)
+	if err != nil {
+		return hostIntel{}, err
+	}
+	var h struct {
+		Result struct {
+			AutonomousSystem struct {
+				Name string `json:"name"`
+			} `json:"autonomous_system"`
+			Services []struct {
+				Port     int `json:"port"`
+				Software []struct {
+					Product string `json:"product"`
+					Version string `json:"version"`
+				} `json:"software"`
+				Certificate string `json:"certificate"`
+			} `json:"services"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &h); err != nil {
+		return hostIntel{}, fmt.Errorf("censys: %v", err)
+	}
+	intel := hostIntel{org: h.Result.AutonomousSystem.Name}
+	for _, s := range h.Result.Services {
+		intel.ports = append(intel.ports, s.Port)
+		for _, sw := range s.Software {
+			intel.services = append(intel.services, strings.TrimSpace(sw.Product+" "+sw.Version))
+		}
+		intel.certs = append(intel.certs, s.Certificate)
+	}
+	return intel, nil
+}
+
+// enricher looks every IP up once, however many domains point at it.
+type enricher struct {
+	src   intelSource
+	mu    sync.Mutex
+	cache map[string]hostIntel
+}
+
+func newEnricher(src intelSource) *enricher {
+	return &enricher{src: src, cache: make(map[string]hostIntel)}
+}
+
+func (e *enricher) lookup(ip string) hostIntel {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if intel, ok := e.cache[ip]; ok {
+		return intel
+	}
+	intel, err := e.src.host(ip)
+	if err != nil {
+		debugf("No host data for %s: %v", ip, err)
+	}
+	e.cache[ip] = intel
+	return intel
+}
+
+// enrich fills the host fields of an OK result. OtherCerts counts the
+// certificates seen on the IP other than the one served now, a pivot to
+// the other sites sharing the host.
+func (e *enricher) enrich(r *ScanResult) {
+	intel := e.lookup(r.IP)
+	ports := append([]int(nil), intel.ports...)
+	sort.Ints(ports)
+	var list []string
+	for i, p := range ports {
+		if i == 0 || p != ports[i-1] {
+			list = append(list, strconv.Itoa(p))
+		}
+	}
+	r.OpenPorts = strings.Join(list, ",")
+	r.Services = strings.Join(uniqueSorted(intel.services), "; ")
+	r.HostOrg = intel.org
+
+	var own string
+	if len(r.Chain) > 0 {
+		sum := sha256.Sum256(r.Chain[0].Raw)
+		own = hex.EncodeToString(sum[:])
+	}
+	r.OtherCerts = 0
+	for _, c := range uniqueSorted(intel.certs) {
+		if !strings.EqualFold(c, own) {
+			r.OtherCerts++
+		}
+	}
+}
+
+func uniqueSorted(list []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range list {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// enrichResults enriches every OK result.
+func enrichResults(in <-chan ScanResult, e *enricher) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		for r := range in {
+			if r.Status == "OK" {
+				e.enrich(&r)
+			}
+			out <- r
+		}
+	}()
+	return out
+}
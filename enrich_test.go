@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeIntel struct {
+	calls int
+	intel hostIntel
+}
+
+func (f *fakeIntel) host(ip string) (hostIntel, error) {
+	f.calls++
+	return f.intel, nil
+}
+
+func TestEnrich(t *testing.T) {
+	pair, _ := selfSignedCert("a.example")
+	cert, _ := x509.ParseCertificate(pair.Certificate[0])
+	sum := sha256.Sum256(cert.Raw)
+	own := hex.EncodeToString(sum[:])
+
+	src := &fakeIntel{intel: hostIntel{
+		ports:    []int{443, 22, 80, 443},
+		services: []string{"nginx 1.18.0", "OpenSSH 8.2p1", "nginx 1.18.0", ""},
+		org:      "Example Hosting",
+		certs:    []string{own, "AB12", "ab12", "cd34"},
+	}}
+	e := newEnricher(src)
+	in := make(chan ScanResult, 3)
+	in <- ScanResult{Domain: "a.example", IP: "192.0.2.1", Status: "OK", Chain: []*x509.Certificate{cert}}
+	in <- ScanResult{Domain: "b.example", IP: "192.0.2.1", Status: "OK"}
+	in <- ScanResult{Domain: "c.example", IP: "-", Status: "NXDOMAIN"}
+	close(in)
+
+	var got []ScanResult
+	for r := range enrichResults(in, e) {
+		got = append(got, r)
+	}
+	a := got[0]
+	if a.OpenPorts != "22,80,443" || a.Services != "OpenSSH 8.2p1; nginx 1.18.0" || a.HostOrg != "Example Hosting" {
+		t.Errorf("enriched = %q %q %q", a.OpenPorts, a.Services, a.HostOrg)
+	}
+	// ab12 and AB12 are one certificate in two spellings.
+	if a.OtherCerts != 3 || got[1].OtherCerts != 4 {
+		t.Errorf("OtherCerts = %d, %d; want 3, 4", a.OtherCerts, got[1].OtherCerts)
+	}
+	if got[2].OpenPorts != "" {
+		t.Errorf("NXDOMAIN result enriched: %+v", got[2])
+	}
+	if src.calls != 1 {
+		t.Errorf("%d lookups for one IP, want 1", src.calls)
+	}
+}
+
+func TestIntelSources(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/shodan/host/192.0.2.1":
+			if r.URL.Query().Get("key") != "k" {
+				http.Error(w, "no key", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"ports":[443,22],"org":"Org","data":[{"product":"nginx","version":"1.18.0","ssl":{"cert":{"fingerprint":{"sha256":"aa"}}}},{"product":"OpenSSH"}]}`)
+		case "/api/v2/hosts/192.0.2.1":
+			if id, secret, _ := r.BasicAuth(); id != "id" || secret != "s" {
+				http.Error(w, "no auth", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"result":{"autonomous_system":{"name":"AS Org"},"services":[{"port":443,"software":[{"product":"nginx","version":"1.18.0"}],"certificate":"aa"},{"port":22}]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	f := newFetcher(srv.Client(), 0, 0)
+
+	for _, src := range []intelSource{
+		&shodanSource{f: f, api: srv.URL, key: "k"},
+		&censysSource{f: f, api: srv.URL, id: "id", secret: "s"},
+	} {
+		intel, err := src.host("192.0.2.1")
+		if err != nil {
+			t.Fatalf("%T: %v", src, err)
+		}
+		if len(intel.ports) != 2 || len(intel.certs) == 0 || intel.certs[0] != "aa" || intel.services[0] != "nginx 1.18.0" || intel.org == "" {
+			t.Errorf("%T: %+v", src, intel)
+		}
+	}
+
+	t.Setenv("SHODAN_API_KEY", "")
+	if _, err := newIntelSource("shodan"); err == nil {
+		t.Error("shodan without a key accepted")
+	}
+	if _, err := newIntelSource("greynoise"); err == nil {
+		t.Error("unknown source accepted")
+	}
+}
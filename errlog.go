@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	scanRetries  int
+	errorLogPath string
+)
+
+// retryBackoff is the pause before the first retry; later ones wait
+// proportionally longer.
+var retryBackoff = 500 * time.Millisecond
+
+// errorLogEntry is one line of the --error-log file.
+type errorLogEntry struct {
+	Time    time.Time `json:"time"`
+	Domain  string    `json:"domain"`
+	IP      string    `json:"ip,omitempty"`
+	MX      string    `json:"mx,omitempty"`
+	Port    string    `json:"port,omitempty"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	Attempt int       `json:"attempt"`
+}
+
+// errorLog appends failed scan attempts to a file as NDJSON. It is safe
+// for concurrent use, and a nil *errorLog discards everything.
+type errorLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	now func() time.Time
+}
+
+func newErrorLog(path string) (*errorLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &errorLog{f: f, now: time.Now}, nil
+}
+
+var (
+	scanErrorLogOnce sync.Once
+	scanErrorLog     *errorLog
+)
+
+// openScanErrorLog opens --error-log once per process, so every scanner of
+// a long-running command shares the file.
+func openScanErrorLog() *errorLog {
+	scanErrorLogOnce.Do(func() {
+		if errorLogPath == "" {
+			return
+		}
+		var err error
+		if scanErrorLog, err = newErrorLog(errorLogPath); err != nil {
+			logger.Fatalf("Failed to open error log: %v\n", err)
+		}
+	})
+	return scanErrorLog
+}
+
+// record logs r if it failed. Each entry is written with a single write
+// call, so lines never interleave.
+func (l *errorLog) record(r ScanResult, attempt int) {
+	if l == nil || !isFailure(r.Status) {
+		return
+	}
+	e := errorLogEntry{Time: l.now().UTC(), Domain: r.Domain, IP: r.IP, MX: r.MX, Port: r.Port, Status: r.Status, Attempt: attempt}
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		logger.Printf("Failed to write error log: %v\n", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestErrorLogRecordsEveryAttempt(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close() // nothing listens: every attempt is refused
+
+	path := filepath.Join(t.TempDir(), "errors.ndjson")
+	log, err := newErrorLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	s := &scanner{
+		port:       port,
+		timeout:    time.Second,
+		retries:    2,
+		errLog:     log,
+		lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+	}
+	tasks := make(chan scanTask, 1)
+	results := make(chan ScanResult, 1)
+	tasks <- scanTask{domain: "closed.example"}
+	close(tasks)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	worker(s, tasks, results, &wg)
+	if r := <-results; r.Status != "REFUSED" {
+		t.Errorf("result = %+v, want REFUSED", r)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var attempts []int
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		var e errorLogEntry
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatalf("bad line %s: %v", lines.Text(), err)
+		}
+		if e.Domain != "closed.example" || e.Status != "REFUSED" || !strings.Contains(e.Error, "refused") || e.Time.IsZero() {
+			t.Errorf("entry = %+v", e)
+		}
+		attempts = append(attempts, e.Attempt)
+	}
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Errorf("attempts = %v, want 1 2 3", attempts)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFaviconSize bounds how much of /favicon.ico is read.
+const maxFaviconSize = 1 << 20
+
+// fetchFavicon requests /favicon.ico over an established TLS connection and
+// returns its Shodan-style hash. conn is unusable afterwards.
+func fetchFavicon(conn io.ReadWriter, domain string, deadline time.Time) (string, error) {
+	if d, ok := conn.(interface{ SetDeadline(time.Time) error }); ok {
+		d.SetDeadline(deadline)
+	}
+	req := fmt.Sprintf("GET /favicon.ico HTTP/1.1\r\nHost: %s\r\nUser-Agent: tls-sweep\r\nAccept: */*\r\nConnection: close\r\n\r\n", domain)
+	if _, err := io.WriteString(conn, req); err != nil {
+		return "", err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("favicon: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconSize))
+	if err != nil {
+		return "", err
+	}
+	return faviconHash(body), nil
+}
+
+// faviconHash computes the hash Shodan indexes as http.favicon.hash: the
+// signed 32-bit MurmurHash3 of the base64 body, wrapped at 76 columns with a
+// trailing newline as Python's base64.encodebytes does.
+func faviconHash(data []byte) string {
+	enc := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(enc) > 76 {
+		b.WriteString(enc[:76])
+		b.WriteByte('\n')
+		enc = enc[76:]
+	}
+	b.WriteString(enc)
+	b.WriteByte('\n')
+	return strconv.Itoa(int(int32(murmur3([]byte(b.String()), 0))))
+}
+
+// murmur3 is MurmurHash3_x86_32.
+func murmur3(data []byte, seed uint32) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	n := len(data)
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data)
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+		data = data[4:]
+	}
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(n)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMurmur3(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		seed uint32
+		want uint32
+	}{
+		{"", 0, 0},
+		{"hello", 0, 0x248bfa47},
+		{"Hello, world!", 1234, 0xfaf6cdb3},
+		{"abc", 0, 0xb3dd93fa},
+	} {
+		if got := murmur3([]byte(tc.in), tc.seed); got != tc.want {
+			t.Errorf("murmur3(%q, %d) = %#x, want %#x", tc.in, tc.seed, got, tc.want)
+		}
+	}
+}
+
+func TestScanFetchesFavicon(t *testing.T) {
+	icon := []byte("\x00\x00\x01\x00fake icon bytes that are long enough to wrap the base64 output past seventy-six columns")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/favicon.ico" || r.Host != "icon.example" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(icon)
+	}))
+	cert, err := selfSignedCert("icon.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	s := &scanner{
+		port:       port,
+		timeout:    time.Second,
+		favicons:   true,
+		lookupHost: func(string) ([]string, error) { return []string{host}, nil },
+	}
+	r := s.scan("icon.example")
+	if r.Status != "OK" || r.FaviconHash != faviconHash(icon) {
+		t.Errorf("scan = %+v, want favicon hash %s", r, faviconHash(icon))
+	}
+}
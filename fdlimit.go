@@ -0,0 +1,93 @@
+package main
+
+import "sync/atomic"
+
+// fdReserve is the descriptors kept back from the workers for the
+// exports, stores, logs and listeners of a run.
+const fdReserve = 64
+
+// fdsPerWorker is how many descriptors a scan worker holds at most: a
+// lookup socket and two racing connects, and a QUIC socket with --quic.
+func fdsPerWorker() int {
+	if probeQUIC {
+		return 4
+	}
+	return 3
+}
+
+// fitToFDLimit scales workers and precheck, the explicit --precheck-workers
+// (0 for 8 × workers), down to what limit descriptors hold, keeping their
+// proportion and at least one of each.
+func fitToFDLimit(limit uint64, workers, precheck, perWorker int) (int, int) {
+	need := uint64(workers*perWorker + precheck + fdReserve)
+	if limit >= need {
+		return workers, precheck
+	}
+	avail := 0
+	if limit > fdReserve {
+		avail = int(limit - fdReserve)
+	}
+	scale := func(n int) int {
+		return max(1, n*avail/int(need-fdReserve))
+	}
+	if precheck > 0 {
+		precheck = scale(precheck)
+	}
+	return scale(workers), precheck
+}
+
+// fdShares is how many scans may run at once and split the open file
+// limit between them: the daemon's own scan plus one per profile. Zero
+// counts as one.
+var fdShares atomic.Int32
+
+// fdShare is the part of limit one of shares concurrent scans may use,
+// with a reserve for each.
+func fdShare(limit uint64, shares int) uint64 {
+	if shares <= 1 || limit <= fdReserve {
+		return limit
+	}
+	return (limit-fdReserve)/uint64(shares) + fdReserve
+}
+
+// fitWorkersToFDLimit checks workers and precheck (--precheck-workers)
+// against RLIMIT_NOFILE before a scan and returns the counts that fit its
+// share. A soft limit too low for them is raised as far as the hard limit
+// allows; what still does not fit is scanned with fewer workers, with a
+// warning, rather than failing partway through as FD EXHAUSTED.
+func fitWorkersToFDLimit(workers, precheck int) (int, int) {
+	soft, hard, err := openFileLimit()
+	if err != nil {
+		debugf("Could not read the open file limit: %v", err)
+		return workers, precheck
+	}
+	perWorker := fdsPerWorker()
+	checks := 0
+	if precheckTimeout > 0 {
+		checks = precheck
+		if checks == 0 {
+			checks = 8 * workers
+		}
+	}
+	shares := max(1, int(fdShares.Load()))
+	share := uint64(workers*perWorker + checks)
+	need := share*uint64(shares) + fdReserve
+	if soft >= need {
+		return workers, precheck
+	}
+	if raised, err := raiseOpenFileLimit(min(need, hard)); err != nil {
+		debugf("Could not raise the open file limit: %v", err)
+	} else if raised > soft {
+		logger.Printf("Raised the open file limit from %d to %d for %d workers\n", soft, raised, workers*shares)
+		soft = raised
+	}
+	if soft >= need {
+		return workers, precheck
+	}
+	fitted, fittedChecks := fitToFDLimit(fdShare(soft, shares), workers, checks, perWorker)
+	logger.Printf("The open file limit of %d fits %d workers per scan, not %d; scanning with %d. Raise it with ulimit -n %d to use them all\n", soft, fitted, workers, fitted, need)
+	if precheck > 0 {
+		precheck = fittedChecks
+	}
+	return fitted, precheck
+}
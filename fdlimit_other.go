@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+var errNoRlimit = errors.New("no RLIMIT_NOFILE on this platform")
+
+func openFileLimit() (soft, hard uint64, err error) { return 0, 0, errNoRlimit }
+
+func raiseOpenFileLimit(want uint64) (uint64, error) { return 0, errNoRlimit }
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestFitToFDLimit(t *testing.T) {
+	for _, c := range []struct {
+		limit                  uint64
+		workers, precheck      int
+		wantWorkers, wantCheck int
+	}{
+		{4096, 1000, 0, 1000, 0},
+		{1024, 1000, 0, 320, 0},
+		{1024, 1000, 800, 252, 202},
+		{32, 100, 0, 1, 0},
+	} {
+		w, p := fitToFDLimit(c.limit, c.workers, c.precheck, 3)
+		if w != c.wantWorkers || p != c.wantCheck {
+			t.Errorf("fitToFDLimit(%d, %d, %d) = %d, %d, want %d, %d", c.limit, c.workers, c.precheck, w, p, c.wantWorkers, c.wantCheck)
+		}
+	}
+}
+
+func TestFitWorkersRaisesSoftLimit(t *testing.T) {
+	soft, hard, err := openFileLimit()
+	if err != nil {
+		t.Skip(err)
+	}
+	if hard < 1024 {
+		t.Skipf("hard open file limit is only %d", hard)
+	}
+	defer raiseOpenFileLimit(soft)
+	if _, err := raiseOpenFileLimit(256); err != nil {
+		t.Skip(err)
+	}
+	workers, _ := fitWorkersToFDLimit(200, 0)
+	if now, _, _ := openFileLimit(); now < uint64(200*fdsPerWorker()+fdReserve) || workers != 200 {
+		t.Errorf("soft limit %d with %d workers, want it raised to fit all 200", now, workers)
+	}
+}
+
+func TestFDShare(t *testing.T) {
+	if got := fdShare(1024, 1); got != 1024 {
+		t.Errorf("one scan: %d, want the whole limit", got)
+	}
+	// Three profiles and the daemon's own scan.
+	if got := fdShare(1024, 4); got != 304 {
+		t.Errorf("four scans: %d, want 304", got)
+	}
+	if got := fdShare(32, 4); got != 32 {
+		t.Errorf("below the reserve: %d, want 32", got)
+	}
+}
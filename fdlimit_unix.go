@@ -0,0 +1,29 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+// openFileLimit is RLIMIT_NOFILE. The Go runtime already raises the soft
+// limit to the hard one at startup, so this mostly reads what it left.
+func openFileLimit() (soft, hard uint64, err error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, 0, err
+	}
+	return uint64(lim.Cur), uint64(lim.Max), nil
+}
+
+// raiseOpenFileLimit sets the soft RLIMIT_NOFILE to want and returns the
+// new limit. macOS refuses more than kern.maxfilesperproc.
+func raiseOpenFileLimit(want uint64) (uint64, error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	lim.Cur = want
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	return want, nil
+}
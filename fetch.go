@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Settings of the metadata fetcher, see registerFetchFlags.
+var (
+	fetchProxy    *url.URL
+	fetchInterval = time.Second
+	fetchRetries  = 3
+	cacheDir      string
+	noCache       bool
+)
+
+func registerFetchFlags(fs *flag.FlagSet) {
+	fs.Func("fetch-proxy", "HTTP(S) proxy for IANA, crt.sh and other metadata fetches (default $HTTPS_PROXY)", func(v string) error {
+		u, err := url.Parse(v)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("want a proxy URL such as http://proxy:3128, got %q", v)
+		}
+		fetchProxy = u
+		return nil
+	})
+	fs.BoolVar(&noCache, "no-cache", false, "neither read nor write the TLD list and metadata caches, for read-only filesystems")
+	fs.StringVar(&cacheDir, "cache-dir", "", "directory the TLD list and metadata answers are cached in (default: tls-sweep in the user cache directory)")
+	fs.DurationVar(&fetchInterval, "fetch-interval", fetchInterval, "minimum time between two metadata requests to the same host")
+	fs.IntVar(&fetchRetries, "fetch-retries", fetchRetries, "retries of a metadata request that failed or was throttled")
+}
+
+// fetcher is the one way out to public metadata services (IANA, crt.sh,
+// and whichever enrichment comes next). It spaces requests to each host by
+// interval, retries throttled and failed ones with backoff, honouring
+// Retry-After, and caches bodies on disk so that repeated runs do not
+// repeat requests.
+type fetcher struct {
+	client   *http.Client
+	interval time.Duration
+	retries  int
+	cacheDir string // "" disables the cache
+	sleep    func(time.Duration)
+
+	mu   sync.Mutex
+	next map[string]time.Time // earliest start of the next request per host
+}
+
+// metadata is the process-wide fetcher, set up on first use so that the
+// flags are parsed by then.
+var metadata = sync.OnceValue(func() *fetcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if fetchProxy != nil {
+		transport.Proxy = http.ProxyURL(fetchProxy)
+	}
+	f := newFetcher(&http.Client{Transport: transport, Timeout: 60 * time.Second}, fetchInterval, fetchRetries)
+	if !noCache {
+		f.cacheDir = filepath.Join(cacheRoot(), "http")
+	}
+	return f
+})
+
+// cacheRoot is where the TLD list and metadata answers are cached:
+// --cache-dir, else tls-sweep under the user cache directory, else under
+// the temporary directory for accounts without a home, as in containers.
+func cacheRoot() string {
+	if cacheDir != "" {
+		return cacheDir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "tls-sweep")
+	}
+	return filepath.Join(os.TempDir(), "tls-sweep")
+}
+
+func newFetcher(client *http.Client, interval time.Duration, retries int) *fetcher {
+	return &fetcher{client: client, interval: interval, retries: retries, sleep: time.Sleep, next: make(map[string]time.Time)}
+}
+
+// get returns the body of a 200 answer for rawURL. A cached body younger
+// than ttl is returned without a request; ttl 0 bypasses the cache.
+func (f *fetcher) get(rawURL string, ttl time.Duration) ([]byte, error) {
+	return f.getWithHeader(rawURL, nil, ttl)
+}
+
+// getWithHeader is get with extra request headers, such as credentials.
+func (f *fetcher) getWithHeader(rawURL string, header http.Header, ttl time.Duration) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var cached string
+	if ttl > 0 && f.cacheDir != "" {
+		sum := sha256.Sum256([]byte(rawURL))
+		cached = filepath.Join(f.cacheDir, hex.EncodeToString(sum[:]))
+		if info, err := os.Stat(cached); err == nil && time.Since(info.ModTime()) < ttl {
+			if body, err := os.ReadFile(cached); err == nil {
+				debugf("Fetched %s from cache", rawURL)
+				return body, nil
+			}
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		f.wait(u.Host)
+		body, retryAfter, err := f.do(rawURL, header)
+		if err == nil {
+			if cached != "" {
+				f.store(cached, body)
+			}
+			return body, nil
+		}
+		if retryAfter < 0 || attempt >= f.retries {
+			return nil, err
+		}
+		backoff := max(retryAfter, time.Duration(1<<attempt)*time.Second)
+		debugf("Fetching %s failed (%v), retrying in %s", rawURL, err, backoff)
+		f.sleep(backoff)
+	}
+}
+
+// do makes one request. retryAfter is negative when retrying cannot help,
+// otherwise the delay the server asked for, if any.
+func (f *fetcher) do(rawURL string, header http.Header) (body []byte, retryAfter time.Duration, err error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", "tls-sweep (+https://github.com/mberlanda/tls-sweep)")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, time.Duration(secs) * time.Second, fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, -1, fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, 256<<20))
+	return body, 0, err
+}
+
+// wait blocks until host may be asked again.
+func (f *fetcher) wait(host string) {
+	f.mu.Lock()
+	now := time.Now()
+	start := now
+	if t := f.next[host]; t.After(now) {
+		start = t
+	}
+	f.next[host] = start.Add(f.interval)
+	f.mu.Unlock()
+	if d := start.Sub(now); d > 0 {
+		f.sleep(d)
+	}
+}
+
+// store writes body to the cache; a failure only costs a later request.
+func (f *fetcher) store(path string, body []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err == nil {
+		os.Rename(tmp, path)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetcherRetriesAndCaches(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch hits.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "7")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "oops", http.StatusBadGateway)
+		default:
+			w.Write([]byte("ok " + r.Header.Get("User-Agent")))
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(srv.Client(), 0, 3)
+	f.cacheDir = t.TempDir()
+	var slept []time.Duration
+	f.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	body, err := f.get(srv.URL+"/list", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok tls-sweep (+https://github.com/mberlanda/tls-sweep)" {
+		t.Errorf("body = %q", body)
+	}
+	// Retry-After wins over the first backoff, then backoff doubles.
+	if len(slept) != 2 || slept[0] != 7*time.Second || slept[1] != 2*time.Second {
+		t.Errorf("slept %v, want [7s 2s]", slept)
+	}
+
+	if _, err := f.get(srv.URL+"/list", time.Hour); err != nil || hits.Load() != 3 {
+		t.Errorf("cached get: %v after %d requests, want no new request", err, hits.Load())
+	}
+	if _, err := f.get(srv.URL+"/list", 0); err != nil || hits.Load() != 4 {
+		t.Errorf("uncached get: %v after %d requests, want a new one", err, hits.Load())
+	}
+}
+
+func TestFetcherGivesUp(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	f := newFetcher(srv.Client(), 0, 2)
+	f.sleep = func(time.Duration) {}
+
+	if _, err := f.get(srv.URL+"/down", 0); err == nil || hits.Load() != 3 {
+		t.Errorf("down: %v after %d requests, want an error after 3", err, hits.Load())
+	}
+	hits.Store(0)
+	if _, err := f.get(srv.URL+"/missing", 0); err == nil || hits.Load() != 1 {
+		t.Errorf("404: %v after %d requests, want no retry", err, hits.Load())
+	}
+}
+
+func TestFetcherSpacesRequests(t *testing.T) {
+	f := newFetcher(http.DefaultClient, time.Second, 0)
+	var slept []time.Duration
+	f.sleep = func(d time.Duration) { slept = append(slept, d) }
+	// The stub returns at once, so the third request queues behind the
+	// second one's slot.
+	for i := 0; i < 3; i++ {
+		f.wait("crt.sh")
+	}
+	f.wait("data.iana.org") // other hosts are not held up
+	if len(slept) != 2 || slept[0] > time.Second || slept[0] < 900*time.Millisecond || slept[1] > 2*time.Second || slept[1] < 1900*time.Millisecond {
+		t.Errorf("slept %v, want about [1s 2s]", slept)
+	}
+}
+
+func TestFetcherProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+	f := newFetcher(&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}, 0, 0)
+
+	body, err := f.get("http://data.iana.org/TLD/tlds-alpha-by-domain.txt", 0)
+	if err != nil || string(body) != "via proxy" || proxied != "http://data.iana.org/TLD/tlds-alpha-by-domain.txt" {
+		t.Errorf("got %q, %v; proxy saw %q", body, err, proxied)
+	}
+}
+
+func TestCacheRoot(t *testing.T) {
+	cacheDir = t.TempDir()
+	defer func() { cacheDir = "" }()
+	if cacheRoot() != cacheDir {
+		t.Errorf("--cache-dir ignored: %s", cacheRoot())
+	}
+	cacheDir = ""
+	if root := cacheRoot(); filepath.Base(root) != "tls-sweep" || !filepath.IsAbs(root) {
+		t.Errorf("default cache root %s", root)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var onlyFilters []resultFilter
+
+// resultFilter is one --only expression: a JSON field name of ScanResult,
+// or expiry (days until ValidTo), compared with a value.
+type resultFilter struct {
+	field, op, value string
+	num              int
+}
+
+var filterOps = []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"}
+
+// resultFieldIndex maps JSON field names to ScanResult field indices.
+var resultFieldIndex = func() map[string]int {
+	m := make(map[string]int)
+	t := reflect.TypeOf(ScanResult{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			m[name] = i
+		}
+	}
+	return m
+}()
+
+// parseFilter parses expressions like status=OK, expiry<30d or
+// issuer~"Let's Encrypt". = and != compare exactly, ~ and !~ test for a
+// case-insensitive substring, and < <= > >= compare numeric fields.
+func parseFilter(expr string) (resultFilter, error) {
+	end := strings.IndexAny(expr, "!=~<>")
+	if end <= 0 {
+		return resultFilter{}, fmt.Errorf("filter %q: want <field><op><value>", expr)
+	}
+	f := resultFilter{field: strings.TrimSpace(expr[:end])}
+	for _, op := range filterOps {
+		if strings.HasPrefix(expr[end:], op) {
+			f.op = op
+			break
+		}
+	}
+	if f.op == "" {
+		return resultFilter{}, fmt.Errorf("filter %q: unknown operator", expr)
+	}
+	f.value = strings.TrimSpace(expr[end+len(f.op):])
+	if len(f.value) >= 2 && (f.value[0] == '"' || f.value[0] == '\'') && f.value[len(f.value)-1] == f.value[0] {
+		f.value = f.value[1 : len(f.value)-1]
+	}
+
+	numeric := f.field == "expiry"
+	if !numeric {
+		i, ok := resultFieldIndex[f.field]
+		if !ok {
+			return resultFilter{}, fmt.Errorf("filter %q: unknown field %s", expr, f.field)
+		}
+		numeric = reflect.TypeOf(ScanResult{}).Field(i).Type.Kind() == reflect.Int
+	}
+	if strings.ContainsAny(f.op, "<>") && !numeric {
+		return resultFilter{}, fmt.Errorf("filter %q: %s only compares numeric fields", expr, f.op)
+	}
+	if numeric && f.op != "~" && f.op != "!~" {
+		n, err := strconv.Atoi(strings.TrimSuffix(f.value, "d"))
+		if err != nil {
+			return resultFilter{}, fmt.Errorf("filter %q: %s is not a number", expr, f.value)
+		}
+		f.num = n
+	}
+	return f, nil
+}
+
+func (f resultFilter) match(r ScanResult, now time.Time) bool {
+	var value string
+	var num int
+	if f.field == "expiry" {
+		exp, ok := parseValidTo(r.ValidTo)
+		if !ok {
+			return false // no certificate, so no expiry to compare
+		}
+		num = int(exp.Sub(now).Hours() / 24)
+		value = strconv.Itoa(num)
+	} else {
+		v := reflect.ValueOf(r).Field(resultFieldIndex[f.field])
+		switch v.Kind() {
+		case reflect.Int:
+			num = int(v.Int())
+			value = strconv.Itoa(num)
+		case reflect.Bool:
+			value = strconv.FormatBool(v.Bool())
+		default:
+			value = v.String()
+		}
+	}
+
+	contains := strings.Contains(strings.ToLower(value), strings.ToLower(f.value))
+	switch f.op {
+	case "=":
+		return value == f.value
+	case "!=":
+		return value != f.value
+	case "~":
+		return contains
+	case "!~":
+		return !contains
+	case "<":
+		return num < f.num
+	case "<=":
+		return num <= f.num
+	case ">":
+		return num > f.num
+	}
+	return num >= f.num
+}
+
+// filterResults forwards the results matching every filter.
+func filterResults(in <-chan ScanResult, filters []resultFilter) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		now := time.Now()
+	next:
+		for r := range in {
+			for _, f := range filters {
+				if !f.match(r, now) {
+					continue next
+				}
+			}
+			out <- r
+		}
+	}()
+	return out
+}
+
+func addFilter(expr string) error {
+	f, err := parseFilter(expr)
+	if err != nil {
+		return err
+	}
+	onlyFilters = append(onlyFilters, f)
+	return nil
+}
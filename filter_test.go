@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilters(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	le := ScanResult{Domain: "a.example", Status: "OK", Issuer: "Let's Encrypt, R11", ValidTo: "2024-05-20", Score: 45}
+	dc := ScanResult{Domain: "b.example", Status: "OK", Issuer: "DigiCert", ValidTo: "2025-01-01"}
+	bad := ScanResult{Domain: "c.example", Status: "TLS ERROR", Heartbeat: true}
+
+	for _, tc := range []struct {
+		expr string
+		want []bool // le, dc, bad
+	}{
+		{"status=OK", []bool{true, true, false}},
+		{"status!=OK", []bool{false, false, true}},
+		{`issuer~"let's encrypt"`, []bool{true, false, false}},
+		{"issuer!~digicert", []bool{true, false, true}},
+		{"expiry<30d", []bool{true, false, false}},
+		{"expiry>=30", []bool{false, true, false}},
+		{"score>40", []bool{true, false, false}},
+		{"status = 'TLS ERROR'", []bool{false, false, true}},
+		{"heartbeat=true", []bool{false, false, true}},
+		{"heartbeat!=true", []bool{true, true, false}},
+	} {
+		f, err := parseFilter(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		for i, r := range []ScanResult{le, dc, bad} {
+			if got := f.match(r, now); got != tc.want[i] {
+				t.Errorf("%s on %s = %v, want %v", tc.expr, r.Domain, got, tc.want[i])
+			}
+		}
+	}
+
+	for _, expr := range []string{"status", "=OK", "colour=red", "issuer<3", "score>many"} {
+		if _, err := parseFilter(expr); err == nil {
+			t.Errorf("%s: accepted", expr)
+		}
+	}
+}
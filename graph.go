@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// graphNode is a vertex of the infrastructure graph. IDs are prefixed with
+// the kind so that, say, an issuer and a domain sharing a name stay apart.
+type graphNode struct {
+	ID, Kind, Label string
+}
+
+type graphEdge struct {
+	From, To, Kind string
+}
+
+// infraGraph links domains to the certificates they serve, certificates to
+// their issuers, and domains to the IPs they resolved to and those IPs to
+// their ASNs.
+type infraGraph struct {
+	nodes map[string]graphNode
+	edges map[graphEdge]bool
+}
+
+// buildGraph builds the graph of every result with a connection. asnOf may
+// be nil, or return "" when an IP's ASN is unknown.
+func buildGraph(results []ScanResult, asnOf func(ip string) string) *infraGraph {
+	g := &infraGraph{nodes: make(map[string]graphNode), edges: make(map[graphEdge]bool)}
+	for _, r := range results {
+		if r.Status == "NXDOMAIN" || r.Status == "DNS ERROR" {
+			continue
+		}
+		domain := g.node("domain", r.Domain, r.Domain)
+		if r.IP != "" && r.IP != "-" {
+			ip := g.node("ip", r.IP, r.IP)
+			g.edge(domain, ip, "resolves_to")
+			if asnOf != nil {
+				if asn := asnOf(r.IP); asn != "" {
+					g.edge(ip, g.node("asn", asn, "AS"+asn), "announced_by")
+				}
+			}
+		}
+		if len(r.Chain) > 0 {
+			sum := sha256.Sum256(r.Chain[0].Raw)
+			cert := g.node("cert", hex.EncodeToString(sum[:]), r.Subject)
+			g.edge(domain, cert, "serves")
+			if r.Issuer != "" {
+				g.edge(cert, g.node("issuer", r.Issuer, r.Issuer), "issued_by")
+			}
+		}
+	}
+	return g
+}
+
+func (g *infraGraph) node(kind, key, label string) string {
+	id := kind + ":" + key
+	if _, ok := g.nodes[id]; !ok {
+		g.nodes[id] = graphNode{ID: id, Kind: kind, Label: label}
+	}
+	return id
+}
+
+func (g *infraGraph) edge(from, to, kind string) {
+	g.edges[graphEdge{from, to, kind}] = true
+}
+
+// sorted returns nodes and edges in a stable order so repeated exports of
+// the same scan diff cleanly.
+func (g *infraGraph) sorted() ([]graphNode, []graphEdge) {
+	nodes := make([]graphNode, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	edges := make([]graphEdge, 0, len(g.edges))
+	for e := range g.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return nodes, edges
+}
+
+var dotShapes = map[string]string{"domain": "box", "cert": "note", "issuer": "house", "ip": "ellipse", "asn": "hexagon"}
+
+func (g *infraGraph) writeDOT(w io.Writer) error {
+	nodes, edges := g.sorted()
+	var b strings.Builder
+	b.WriteString("digraph tls_sweep {\n")
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s, kind=%s];\n", strconv.Quote(n.ID), strconv.Quote(n.Label), dotShapes[n.Kind], n.Kind)
+	}
+	for _, e := range edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), e.Kind)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type graphmlDoc struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlGraph struct {
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML writes the graph with label and kind attributes, which Gephi
+// and Maltego import as node and edge properties.
+func (g *infraGraph) writeGraphML(w io.Writer) error {
+	nodes, edges := g.sorted()
+	doc := graphmlDoc{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphmlKey{
+			{"label", "node", "label", "string"},
+			{"kind", "node", "kind", "string"},
+			{"ekind", "edge", "kind", "string"},
+		},
+		Graph: graphmlGraph{EdgeDefault: "directed"},
+	}
+	for _, n := range nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{n.ID, []graphmlData{{"label", n.Label}, {"kind", n.Kind}}})
+	}
+	for _, e := range edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{e.From, e.To, []graphmlData{{"ekind", e.Kind}}})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// graphPath is the file the graph of baseDomain's sweep is written to.
+func graphPath(baseDomain, format string) string {
+	return outputPath(fmt.Sprintf("%s.%s", baseDomain, format))
+}
+
+func writeGraph(path, format string, g *infraGraph) error {
+	f, err := createAtomic(path, 0o644)
+	if err != nil {
+		return err
+	}
+	if format == "dot" {
+		err = g.writeDOT(f)
+	} else {
+		err = g.writeGraphML(f)
+	}
+	if err != nil {
+		f.abort()
+		return err
+	}
+	return f.Close()
+}
+
+// cachedASNs wraps the scorer's Team Cymru lookup, asking once per IP.
+// Failed lookups leave the IP without an ASN.
+func cachedASNs(sc *scorer) func(ip string) string {
+	cache := make(map[string]string)
+	return func(ip string) string {
+		if asn, ok := cache[ip]; ok {
+			return asn
+		}
+		asn, err := sc.lookupASN(ip)
+		if err != nil {
+			debugf("No ASN for %s: %v", ip, err)
+		}
+		cache[ip] = asn
+		return asn
+	}
+}
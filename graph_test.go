@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestBuildGraph(t *testing.T) {
+	cert, err := selfSignedCert("shared.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []ScanResult{
+		{Domain: "a.example", IP: "192.0.2.1", Status: "OK", Subject: "shared.example", Issuer: "shared.example", Chain: []*x509.Certificate{leaf}},
+		{Domain: "b.example", IP: "192.0.2.1", Status: "OK", Subject: "shared.example", Issuer: "shared.example", Chain: []*x509.Certificate{leaf}},
+		{Domain: "c.example", IP: "192.0.2.9", Status: "TLS ERROR"},
+		{Domain: "gone.example", IP: "-", Status: "NXDOMAIN"},
+	}
+	g := buildGraph(results, func(ip string) string {
+		if ip == "192.0.2.1" {
+			return "64500"
+		}
+		return ""
+	})
+
+	kinds := make(map[string]int)
+	for _, n := range g.nodes {
+		kinds[n.Kind]++
+	}
+	if kinds["domain"] != 3 || kinds["cert"] != 1 || kinds["issuer"] != 1 || kinds["ip"] != 2 || kinds["asn"] != 1 {
+		t.Errorf("node kinds = %v", kinds)
+	}
+	if len(g.edges) != 7 {
+		t.Errorf("got %d edges, want 7", len(g.edges))
+	}
+
+	var dot bytes.Buffer
+	if err := g.writeDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(dot.String(), "digraph tls_sweep {") || !strings.Contains(dot.String(), `"ip:192.0.2.1" -> "asn:64500" [label=announced_by];`) {
+		t.Errorf("dot output:\n%s", dot.String())
+	}
+
+	var ml bytes.Buffer
+	if err := g.writeGraphML(&ml); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphmlDoc
+	if err := xml.Unmarshal(ml.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Graph.Nodes) != len(g.nodes) || len(doc.Graph.Edges) != len(g.edges) {
+		t.Errorf("graphml has %d nodes and %d edges", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scanRecord is one completed sweep as kept in the history store.
+type scanRecord struct {
+	ID          string       `json:"id"`
+	BaseDomains []string     `json:"base_domains"`
+	StartedAt   time.Time    `json:"started_at"`
+	FinishedAt  time.Time    `json:"finished_at"`
+	Results     []ScanResult `json:"results"`
+}
+
+// scanSummary is what listings need without loading every result.
+type scanSummary struct {
+	ID          string
+	BaseDomains []string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Total       int
+	ByStatus    map[string]int
+}
+
+func (r *scanRecord) summary() scanSummary {
+	s := scanSummary{
+		ID:          r.ID,
+		BaseDomains: r.BaseDomains,
+		StartedAt:   r.StartedAt,
+		FinishedAt:  r.FinishedAt,
+		Total:       len(r.Results),
+		ByStatus:    make(map[string]int),
+	}
+	for _, res := range r.Results {
+		s.ByStatus[res.Status]++
+	}
+	return s
+}
+
+// result returns the result for domain, if the scan covered it.
+func (r *scanRecord) result(domain string) (ScanResult, bool) {
+	for _, res := range r.Results {
+		if res.Domain == domain {
+			return res, true
+		}
+	}
+	return ScanResult{}, false
+}
+
+// historyStore persists completed scans. The only backend today keeps one
+// JSON file per scan in a directory; a database backend only has to satisfy
+// this interface.
+type historyStore interface {
+	save(r *scanRecord) error
+	// list returns summaries, newest first.
+	list() ([]scanSummary, error)
+	load(id string) (*scanRecord, error)
+	// annotations returns the per-domain triage notes, keyed by domain.
+	annotations() (map[string]annotation, error)
+	importAnnotations(notes map[string]annotation) error
+}
+
+type fileStore struct {
+	dir string
+}
+
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "scans"), 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+// newScanID derives a sortable ID from the scan start time.
+func newScanID(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func (s *fileStore) path(id string) string {
+	return filepath.Join(s.dir, "scans", id+".json")
+}
+
+func (s *fileStore) save(r *scanRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(r.ID), data, 0o600)
+}
+
+func (s *fileStore) load(id string) (*scanRecord, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, fmt.Errorf("invalid scan id %q", id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+	var r scanRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("scan %s: %v", id, err)
+	}
+	return &r, nil
+}
+
+func (s *fileStore) list() ([]scanSummary, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "scans", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []scanSummary
+	for _, f := range files {
+		r, err := s.load(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			logger.Printf("Skipping unreadable scan %s: %v\n", f, err)
+			continue
+		}
+		out = append(out, r.summary())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+// scanChange is one difference between two scans of the same domain.
+type scanChange struct {
+	Domain string
+	Kind   string // added, removed or changed
+	Before ScanResult
+	After  ScanResult
+}
+
+// diffScans compares two scans by domain. IP changes alone are not reported
+// because CDN-fronted domains rotate addresses between every scan.
+func diffScans(before, after *scanRecord) []scanChange {
+	old := make(map[string]ScanResult, len(before.Results))
+	for _, r := range before.Results {
+		old[r.Domain] = r
+	}
+
+	var changes []scanChange
+	seen := make(map[string]bool, len(after.Results))
+	for _, r := range after.Results {
+		seen[r.Domain] = true
+		prev, ok := old[r.Domain]
+		switch {
+		case !ok:
+			changes = append(changes, scanChange{Domain: r.Domain, Kind: "added", After: r})
+		case prev.Status != r.Status || prev.Subject != r.Subject || prev.Issuer != r.Issuer || !sameTimestamp(prev.ValidTo, r.ValidTo):
+			changes = append(changes, scanChange{Domain: r.Domain, Kind: "changed", Before: prev, After: r})
+		}
+	}
+	for _, r := range before.Results {
+		if !seen[r.Domain] {
+			changes = append(changes, scanChange{Domain: r.Domain, Kind: "removed", Before: r})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Domain < changes[j].Domain })
+	return changes
+}
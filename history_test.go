@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	store, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, status := range []string{"OK", "TLS ERROR"} {
+		at := start.Add(time.Duration(i) * time.Hour)
+		rec := &scanRecord{
+			ID:          newScanID(at),
+			BaseDomains: []string{"example"},
+			StartedAt:   at,
+			FinishedAt:  at.Add(time.Minute),
+			Results: []ScanResult{
+				{Domain: "example.com", Status: status},
+				{Domain: "example.zz", Status: "NXDOMAIN"},
+			},
+		}
+		if err := store.save(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := store.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "20240501T130000Z" {
+		t.Fatalf("list = %+v, want newest first", list)
+	}
+	if list[0].Total != 2 || list[0].ByStatus["TLS ERROR"] != 1 || list[0].ByStatus["NXDOMAIN"] != 1 {
+		t.Errorf("summary = %+v", list[0])
+	}
+
+	rec, err := store.load(list[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := rec.result("example.com"); !ok || r.Status != "OK" {
+		t.Errorf("result(example.com) = %+v, %v", r, ok)
+	}
+
+	for _, bad := range []string{"", "../scans/x", "a.b"} {
+		if _, err := store.load(bad); err == nil {
+			t.Errorf("load(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestDiffScans(t *testing.T) {
+	before := &scanRecord{Results: []ScanResult{
+		{Domain: "a.com", IP: "192.0.2.1", Status: "OK", Issuer: "CA", ValidTo: "2024-06-01"},
+		{Domain: "b.com", Status: "OK", Issuer: "CA", ValidTo: "2024-06-01"},
+		{Domain: "c.com", Status: "OK"},
+	}}
+	after := &scanRecord{Results: []ScanResult{
+		{Domain: "a.com", IP: "192.0.2.2", Status: "OK", Issuer: "CA", ValidTo: "2024-06-01"},
+		{Domain: "b.com", Status: "OK", Issuer: "CA", ValidTo: "2024-09-01"},
+		{Domain: "d.com", Status: "OK"},
+	}}
+
+	changes := diffScans(before, after)
+	want := []struct{ domain, kind string }{{"b.com", "changed"}, {"c.com", "removed"}, {"d.com", "added"}}
+	if len(changes) != len(want) {
+		t.Fatalf("diff = %+v", changes)
+	}
+	for i, w := range want {
+		if changes[i].Domain != w.domain || changes[i].Kind != w.kind {
+			t.Errorf("change %d = %s %s, want %s %s", i, changes[i].Domain, changes[i].Kind, w.domain, w.kind)
+		}
+	}
+}
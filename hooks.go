@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	execPerResult string
+	execPostScan  string
+)
+
+// registerResultFlags binds the flags that post-process results before
+// export: the annotations, the Starlark script, the syslog sink and the
+// external command hooks.
+func registerResultFlags(fs *flag.FlagSet) {
+	fs.StringVar(&annotationsFile, "annotations", "", "CSV of domain,owner,ticket,note merged into Owner, Ticket and Annotation")
+	fs.StringVar(&scriptPath, "script", "", "Starlark file defining process(result) to filter or annotate each result")
+	fs.StringVar(&syslogURL, "syslog", "", "send every result to this syslog collector, e.g. udp://siem:514 or tcp://siem:601")
+	fs.StringVar(&syslogFormat, "syslog-format", "rfc5424", "syslog message format: rfc5424 or cef")
+	fs.StringVar(&execPerResult, "exec-per-result", "", "run this shell command for every result, with the result JSON on stdin; {} is replaced with the domain")
+	fs.StringVar(&execPostScan, "exec-post-scan", "", "run this shell command once the scan finished, with a JSON array of all results on stdin")
+	fs.StringVar(&otlpEndpoint, "otlp-endpoint", otlpEndpoint, "OTLP/HTTP collector to export traces and metrics of the pipeline to, e.g. http://otel-collector:4318 (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	fs.StringVar(&spoolDir, "spool-dir", "", "where exports and sinks that keep failing spool their results as NDJSON (default: spool in the cache directory)")
+	fs.StringVar(&certStorePath, "cert-store", "", "record every certificate seen, with when and on which domains, in this JSON file for tls-sweep certs")
+	fs.StringVar(&auditLogPath, "audit-log", "", "append a JSON line when a scan starts and finishes: who triggered it, parameters, target count")
+}
+
+// tapResults passes results through, running the per-result hook on each
+// and appending it to kept for the post-scan hook. NXDOMAIN results are
+// skipped, as they are in the CSV.
+func tapResults(in <-chan ScanResult, kept *[]ScanResult) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		for r := range in {
+			if r.Status != "NXDOMAIN" {
+				runResultHook(r)
+				if execPostScan != "" {
+					*kept = append(*kept, r)
+				}
+			}
+			out <- r
+		}
+	}()
+	return out
+}
+
+func runResultHook(r ScanResult) {
+	if execPerResult == "" {
+		return
+	}
+	data, _ := json.Marshal(r)
+	command := strings.ReplaceAll(execPerResult, "{}", shellQuote(r.Domain))
+	if err := runHook(command, data); err != nil {
+		logger.Printf("Per-result hook failed for %s: %v\n", r.Domain, err)
+	}
+}
+
+func runPostScanHook(results []ScanResult) {
+	if execPostScan == "" {
+		return
+	}
+	if results == nil {
+		results = []ScanResult{}
+	}
+	data, _ := json.Marshal(results)
+	if err := runHook(execPostScan, data); err != nil {
+		logger.Printf("Post-scan hook failed: %v\n", err)
+	}
+}
+
+// runHook runs command through sh -c with stdin as its input. Its output goes
+// to stderr so it cannot corrupt a result stream on stdout.
+func runHook(command string, stdin []byte) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// shellQuote quotes s as a single sh word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	dir := t.TempDir()
+	execPerResult = "cat > " + shellQuote(dir) + "/{}.json"
+	execPostScan = "cat > " + shellQuote(filepath.Join(dir, "all.json"))
+	defer func() { execPerResult, execPostScan = "", "" }()
+
+	in := make(chan ScanResult, 3)
+	in <- ScanResult{Domain: "a.com", Status: "OK"}
+	in <- ScanResult{Domain: "it's.com", Status: "TLS ERROR"}
+	in <- ScanResult{Domain: "gone.com", Status: "NXDOMAIN"}
+	close(in)
+
+	var kept []ScanResult
+	n := 0
+	for range tapResults(in, &kept) {
+		n++
+	}
+	runPostScanHook(kept)
+	if n != 3 {
+		t.Errorf("tap forwarded %d results, want 3", n)
+	}
+
+	var r ScanResult
+	data, err := os.ReadFile(filepath.Join(dir, "it's.com.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &r); err != nil || r.Status != "TLS ERROR" {
+		t.Errorf("per-result hook got %s (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.com.json")); err == nil {
+		t.Error("per-result hook ran for an NXDOMAIN result")
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "all.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []ScanResult
+	if err := json.Unmarshal(data, &all); err != nil || len(all) != 2 {
+		t.Errorf("post-scan hook got %s (%v)", data, err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("it's"); got != `'it'\''s'` {
+		t.Errorf("shellQuote = %s", got)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var scanIDN bool
+
+// Punycode parameters, RFC 3492 section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+var errPunycode = errors.New("invalid punycode")
+
+func punyAdapt(delta, points int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > (punyBase-punyTMin)*punyTMax/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+// punyDecode decodes one label without its xn-- prefix.
+func punyDecode(s string) (string, error) {
+	var out []rune
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		out = []rune(s[:i])
+		s = s[i+1:]
+	}
+	n, bias, i := punyInitialN, punyInitialBias, 0
+	for len(s) > 0 {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if len(s) == 0 {
+				return "", errPunycode
+			}
+			c := s[0]
+			s = s[1:]
+			var digit int
+			switch {
+			case 'a' <= c && c <= 'z':
+				digit = int(c - 'a')
+			case 'A' <= c && c <= 'Z':
+				digit = int(c - 'A')
+			case '0' <= c && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", errPunycode
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if i > utf8.MaxRune || w > utf8.MaxRune {
+				return "", errPunycode
+			}
+		}
+		bias = punyAdapt(i-oldi, len(out)+1, oldi == 0)
+		n += i / (len(out) + 1)
+		i %= len(out) + 1
+		if n > utf8.MaxRune {
+			return "", errPunycode
+		}
+		out = append(out[:i], append([]rune{rune(n)}, out[i:]...)...)
+		i++
+	}
+	return string(out), nil
+}
+
+// punyEncode encodes one label, without adding the xn-- prefix.
+func punyEncode(label string) string {
+	runes := []rune(label)
+	var b strings.Builder
+	for _, r := range runes {
+		if r < 0x80 {
+			b.WriteRune(r)
+		}
+	}
+	basic := b.Len()
+	handled := basic
+	if basic > 0 {
+		b.WriteByte('-')
+	}
+	n, bias, delta := punyInitialN, punyInitialBias, 0
+	for handled < len(runes) {
+		m := int(utf8.MaxRune)
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				b.WriteByte(punyDigit(t + (q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			b.WriteByte(punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return b.String()
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// toASCII converts a Unicode domain to its punycode form, label by label.
+// Only lower-casing is applied, not the full IDNA mapping.
+func toASCII(domain string) string {
+	labels := strings.Split(strings.ToLower(domain), ".")
+	for i, l := range labels {
+		for _, r := range l {
+			if r >= 0x80 {
+				labels[i] = "xn--" + punyEncode(l)
+				break
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// toUnicode decodes the xn-- labels of domain, leaving undecodable ones as
+// they are.
+func toUnicode(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i, l := range labels {
+		if len(l) > 4 && strings.EqualFold(l[:4], "xn--") {
+			if u, err := punyDecode(l[4:]); err == nil {
+				labels[i] = u
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// confusables maps letters of other scripts to the ASCII letters they are
+// commonly passed off as in lookalike domains.
+var confusables = map[rune]rune{
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'і': 'i',
+	'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h', 'ӏ': 'l', 'ց': 'g',
+	'ο': 'o', 'α': 'a', 'ν': 'v', 'ρ': 'p', 'ι': 'i', 'κ': 'k', 'υ': 'u',
+	'ı': 'i', 'ɡ': 'g', 'ℓ': 'l',
+}
+
+// displayDomain renders domain for terminals and chat: the Unicode form
+// with every confusable letter in brackets, followed by the punycode form,
+// e.g. "[а]mazon.com (xn--mazon-3ve.com)". ASCII domains are unchanged.
+func displayDomain(domain string) string {
+	u := toUnicode(domain)
+	if u == domain {
+		return domain
+	}
+	var b strings.Builder
+	for _, r := range u {
+		if _, ok := confusables[r]; ok {
+			b.WriteString("[" + string(r) + "]")
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String() + " (" + domain + ")"
+}
+
+// withUnicode sets DomainUnicode on results for internationalized domains.
+func withUnicode(r ScanResult) ScanResult {
+	if u := toUnicode(r.Domain); u != r.Domain {
+		r.DomainUnicode = u
+	}
+	return r
+}
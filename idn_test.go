@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestPunycode(t *testing.T) {
+	for _, tc := range []struct{ unicode, ascii string }{
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"münchen.рф", "xn--mnchen-3ya.xn--p1ai"},
+		{"аmazon.com", "xn--mazon-3ve.com"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"amazon.com", "amazon.com"},
+	} {
+		if got := toASCII(tc.unicode); got != tc.ascii {
+			t.Errorf("toASCII(%s) = %s, want %s", tc.unicode, got, tc.ascii)
+		}
+		if got := toUnicode(tc.ascii); got != tc.unicode {
+			t.Errorf("toUnicode(%s) = %s, want %s", tc.ascii, got, tc.unicode)
+		}
+	}
+	if got := toUnicode("xn--!!.example"); got != "xn--!!.example" {
+		t.Errorf("invalid label decoded to %s", got)
+	}
+}
+
+func TestDisplayDomain(t *testing.T) {
+	if got, want := displayDomain("xn--mazon-3ve.com"), "[а]mazon.com (xn--mazon-3ve.com)"; got != want {
+		t.Errorf("displayDomain = %s, want %s", got, want)
+	}
+	if got := displayDomain("amazon.com"); got != "amazon.com" {
+		t.Errorf("ASCII domain rendered as %s", got)
+	}
+	if r := withUnicode(ScanResult{Domain: "amazon.xn--p1ai"}); r.DomainUnicode != "amazon.рф" {
+		t.Errorf("DomainUnicode = %q", r.DomainUnicode)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// probeInsecure is --probe-insecure.
+var probeInsecure bool
+
+// TLS extensions the legacy probe offers and looks for in the ServerHello.
+const (
+	extServerName     = 0
+	extTruncatedHMAC  = 4
+	extSupportedGroup = 10
+	extPointFormats   = 11
+	extSigAlgs        = 13
+	extHeartbeat      = 15
+	extNPN            = 0x3374
+	extRenegotiation  = 0xff01
+)
+
+// deprecatedExtensions are offered to see whether the server still takes
+// them up, by name.
+var deprecatedExtensions = []struct {
+	id   uint16
+	name string
+}{
+	{extTruncatedHMAC, "truncated_hmac"},
+	{extNPN, "next_protocol_negotiation"},
+}
+
+// legacySuites is a TLS 1.2 and older offer broad enough for any server
+// still speaking those versions.
+var legacySuites = []uint16{
+	0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, // ECDHE-GCM, ChaCha20
+	0xc009, 0xc013, 0xc00a, 0xc014, // ECDHE-CBC
+	0x009c, 0x009d, 0x002f, 0x0035, 0x000a, // RSA
+}
+
+// serverHelloInfo is what a ServerHello answers the legacy probe with.
+type serverHelloInfo struct {
+	version     uint16
+	compression byte
+	extensions  map[uint16]bool
+}
+
+// legacyClientHello is a TLS 1.2 ClientHello record, without
+// supported_versions so that TLS 1.3 servers answer in 1.2 or refuse. It
+// offers DEFLATE compression and the renegotiation_info, heartbeat and
+// deprecated extensions.
+func legacyClientHello(domain string) []byte {
+	ext := func(b []byte, typ uint16, data []byte) []byte {
+		b = binary.BigEndian.AppendUint16(b, typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+		return append(b, data...)
+	}
+	var exts []byte
+	if domain != "" && net.ParseIP(domain) == nil {
+		name := binary.BigEndian.AppendUint16(nil, uint16(len(domain)+3))
+		name = append(name, 0)
+		name = binary.BigEndian.AppendUint16(name, uint16(len(domain)))
+		exts = ext(exts, extServerName, append(name, domain...))
+	}
+	exts = ext(exts, extSupportedGroup, []byte{0, 6, 0, 29, 0, 23, 0, 24})
+	exts = ext(exts, extPointFormats, []byte{1, 0})
+	exts = ext(exts, extSigAlgs, []byte{0, 12, 4, 3, 5, 3, 8, 4, 8, 5, 4, 1, 5, 1})
+	exts = ext(exts, extRenegotiation, []byte{0})
+	exts = ext(exts, extHeartbeat, []byte{1}) // peer_allowed_to_send
+	for _, e := range deprecatedExtensions {
+		exts = ext(exts, e.id, nil)
+	}
+
+	body := []byte{3, 3}
+	random := make([]byte, 32)
+	rand.Read(random)
+	body = append(body, random...)
+	body = append(body, 0) // no session id
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(legacySuites)))
+	for _, cs := range legacySuites {
+		body = binary.BigEndian.AppendUint16(body, cs)
+	}
+	body = append(body, 2, 1, 0) // DEFLATE, null compression
+	body = binary.BigEndian.AppendUint16(body, uint16(len(exts)))
+	body = append(body, exts...)
+
+	hs := append([]byte{1, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+	record := []byte{22, 3, 1}
+	record = binary.BigEndian.AppendUint16(record, uint16(len(hs)))
+	return append(record, hs...)
+}
+
+// errHelloRefused is a server answering the legacy probe with an alert.
+var errHelloRefused = errors.New("ClientHello refused")
+
+// readServerHello reads records from r until the ServerHello is complete.
+func readServerHello(r io.Reader) (serverHelloInfo, error) {
+	var hs []byte
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return serverHelloInfo{}, err
+		}
+		n := int(binary.BigEndian.Uint16(header[3:]))
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return serverHelloInfo{}, err
+		}
+		switch header[0] {
+		case 21:
+			return serverHelloInfo{}, errHelloRefused
+		case 22:
+			hs = append(hs, payload...)
+		default:
+			return serverHelloInfo{}, fmt.Errorf("unexpected record type %d", header[0])
+		}
+		if len(hs) < 4 {
+			continue
+		}
+		if hs[0] != 2 {
+			return serverHelloInfo{}, fmt.Errorf("unexpected handshake message %d", hs[0])
+		}
+		if n := int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3]); len(hs) >= 4+n {
+			return parseServerHello(hs[4 : 4+n])
+		}
+	}
+}
+
+func parseServerHello(b []byte) (serverHelloInfo, error) {
+	info := serverHelloInfo{extensions: make(map[uint16]bool)}
+	if len(b) < 35 {
+		return info, errors.New("short ServerHello")
+	}
+	info.version = binary.BigEndian.Uint16(b)
+	b = b[34:]
+	sid := int(b[0])
+	// session id, cipher suite, compression method
+	if len(b) < 1+sid+3 {
+		return info, errors.New("short ServerHello")
+	}
+	info.compression = b[1+sid+2]
+	b = b[1+sid+3:]
+	if len(b) < 2 {
+		return info, nil // no extensions
+	}
+	extLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < extLen {
+		return info, errors.New("short ServerHello extensions")
+	}
+	b = b[:extLen]
+	for len(b) >= 4 {
+		typ, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			break
+		}
+		info.extensions[typ] = true
+		b = b[4+n:]
+	}
+	return info, nil
+}
+
+// helloLegacy sends the legacy ClientHello to ip and returns the answer.
+func (s *scanner) helloLegacy(ip, domain string) (serverHelloInfo, error) {
+	raw, err := s.dialHost(context.Background(), ip, s.port)
+	if err != nil {
+		return serverHelloInfo{}, err
+	}
+	defer raw.Close()
+	raw.SetDeadline(time.Now().Add(s.timeout))
+	if s.preamble != nil {
+		if raw, err = s.preamble(raw); err != nil {
+			return serverHelloInfo{}, err
+		}
+	}
+	if _, err := raw.Write(legacyClientHello(domain)); err != nil {
+		return serverHelloInfo{}, err
+	}
+	return readServerHello(raw)
+}
+
+// checkInsecure fills the insecure-feature findings of an OK result. A
+// server that refuses TLS 1.2 altogether has none of them.
+func (s *scanner) checkInsecure(r *ScanResult) {
+	info, err := s.helloLegacy(r.IP, r.Domain)
+	if err != nil {
+		debugf("Legacy ClientHello to %s: %v", r.IP, err)
+		return
+	}
+	r.InsecureRenegotiation = !info.extensions[extRenegotiation]
+	r.Heartbeat = info.extensions[extHeartbeat]
+	r.Compression = info.compression != 0
+	r.DeprecatedExtensions = strings.Join(info.deprecated(), ", ")
+}
+
+// deprecated names the deprecated extensions the server took up.
+func (info serverHelloInfo) deprecated() []string {
+	var names []string
+	for _, e := range deprecatedExtensions {
+		if info.extensions[e.id] {
+			names = append(names, e.name)
+		}
+	}
+	return names
+}
+
+// insecureFeatures names the findings set on r.
+func insecureFeatures(r ScanResult) []string {
+	var found []string
+	if r.InsecureRenegotiation {
+		found = append(found, "insecure renegotiation")
+	}
+	if r.Heartbeat {
+		found = append(found, "heartbeat")
+	}
+	if r.Compression {
+		found = append(found, "TLS compression")
+	}
+	if r.DeprecatedExtensions != "" {
+		found = append(found, "deprecated "+r.DeprecatedExtensions)
+	}
+	return found
+}
+
+// boolCell is a finding as a CSV cell: "true" or empty.
+func boolCell(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serverHelloRecord is a TLS 1.2 ServerHello record with compression and
+// empty extensions of the given types.
+func serverHelloRecord(compression byte, exts ...uint16) []byte {
+	body := append([]byte{3, 3}, make([]byte, 32)...)
+	body = append(body, 0, 0xc0, 0x2f, compression)
+	var e []byte
+	for _, typ := range exts {
+		e = binary.BigEndian.AppendUint16(e, typ)
+		e = append(e, 0, 0)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(e)))
+	body = append(body, e...)
+	hs := append([]byte{2, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{22, 3, 3, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+func TestReadServerHello(t *testing.T) {
+	info, err := readServerHello(bytes.NewReader(serverHelloRecord(0, extHeartbeat)))
+	if err != nil || info.version != tls.VersionTLS12 || !info.extensions[extHeartbeat] || info.extensions[extRenegotiation] {
+		t.Errorf("got %+v, %v", info, err)
+	}
+
+	// A ServerHello split across two records.
+	rec := serverHelloRecord(0, extRenegotiation)
+	split := append([]byte{22, 3, 3, 0, 10}, rec[5:15]...)
+	split = append(split, 22, 3, 3, 0, byte(len(rec)-15))
+	split = append(split, rec[15:]...)
+	if info, err := readServerHello(bytes.NewReader(split)); err != nil || !info.extensions[extRenegotiation] {
+		t.Errorf("split: got %+v, %v", info, err)
+	}
+
+	if _, err := readServerHello(bytes.NewReader([]byte{21, 3, 3, 0, 2, 2, 70})); !errors.Is(err, errHelloRefused) {
+		t.Errorf("alert: got %v", err)
+	}
+}
+
+func TestCheckInsecure(t *testing.T) {
+	// A legacy server: no renegotiation_info, heartbeat, DEFLATE and
+	// truncated_hmac on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			header := make([]byte, 5)
+			io.ReadFull(c, header)
+			io.CopyN(io.Discard, c, int64(binary.BigEndian.Uint16(header[3:])))
+			c.Write(serverHelloRecord(1, extHeartbeat, extTruncatedHMAC))
+			c.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &scanner{port: port, timeout: time.Second}
+	r := ScanResult{Domain: "old.example", IP: "127.0.0.1", Status: "OK"}
+	s.checkInsecure(&r)
+	if !r.InsecureRenegotiation || !r.Heartbeat || !r.Compression || r.DeprecatedExtensions != "truncated_hmac" {
+		t.Errorf("legacy server: %+v", r)
+	}
+
+	// crypto/tls supports secure renegotiation and no heartbeat.
+	cert, err := selfSignedCert("new.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modern, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer modern.Close()
+	go func() {
+		for {
+			c, err := modern.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	_, s.port, _ = net.SplitHostPort(modern.Addr().String())
+	if info, err := s.helloLegacy("127.0.0.1", "new.example"); err != nil || !info.extensions[extRenegotiation] {
+		t.Fatalf("crypto/tls server answered %+v, %v", info, err)
+	}
+	r = ScanResult{Domain: "new.example", IP: "127.0.0.1", Status: "OK"}
+	s.checkInsecure(&r)
+	if r.InsecureRenegotiation || r.Heartbeat || r.Compression || r.DeprecatedExtensions != "" {
+		t.Errorf("crypto/tls server: %+v", r)
+	}
+	if got := insecureFeatures(ScanResult{InsecureRenegotiation: true, Heartbeat: true, Compression: true, DeprecatedExtensions: "truncated_hmac"}); len(got) != 4 {
+		t.Errorf("insecureFeatures = %v", got)
+	}
+}
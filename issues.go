@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var issueClient = &http.Client{Timeout: 30 * time.Second}
+
+// issueTracker files check findings as tickets. openTitles returns the
+// titles of the tracker's open tickets carrying label, which is how a
+// finding already filed is recognized.
+type issueTracker interface {
+	openTitles(label string) (map[string]bool, error)
+	create(title, body string, labels []string) error
+}
+
+// issueTitle is the de-duplication key: one ticket per domain and check.
+func issueTitle(f checkFinding) string {
+	return fmt.Sprintf("[tls-sweep] %s: %s", f.Domain, f.Check)
+}
+
+func issueBody(f checkFinding) string {
+	return fmt.Sprintf("The `%s` check failed for %s:\n\n%s\n\n%s.\n\nFiled by tls-sweep check on %s. Close it once fixed; a later failure opens a new one.",
+		f.Check, f.Domain, f.Detail, checkDescriptions[f.Check], time.Now().UTC().Format("2006-01-02"))
+}
+
+// fileIssues opens a ticket for every finding without an open one. The
+// first of labels identifies tls-sweep tickets; each also gets a
+// check:<name> label. It returns how many were opened.
+func fileIssues(t issueTracker, findings []checkFinding, labels []string) (int, error) {
+	open, err := t.openTitles(labels[0])
+	if err != nil {
+		return 0, fmt.Errorf("listing open issues: %v", err)
+	}
+	created := 0
+	for _, f := range findings {
+		title := issueTitle(f)
+		if open[title] {
+			continue
+		}
+		if err := t.create(title, issueBody(f), append(append([]string(nil), labels...), "check:"+f.Check)); err != nil {
+			return created, fmt.Errorf("opening %q: %v", title, err)
+		}
+		open[title] = true
+		created++
+	}
+	return created, nil
+}
+
+// newIssueTracker parses --issues: github:owner/repo, authenticated with
+// $GITHUB_TOKEN, or jira:https://host/PROJECT with $JIRA_USER and
+// $JIRA_TOKEN.
+func newIssueTracker(spec string) (issueTracker, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "github":
+		if strings.Count(target, "/") != 1 {
+			return nil, fmt.Errorf("want github:owner/repo, got %q", spec)
+		}
+		api := os.Getenv("GITHUB_API_URL") // set by GitHub Enterprise runners
+		if api == "" {
+			api = "https://api.github.com"
+		}
+		return &githubTracker{api: strings.TrimSuffix(api, "/"), repo: target, token: os.Getenv("GITHUB_TOKEN")}, nil
+	case "jira":
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("want jira:https://host/PROJECT, got %q", spec)
+		}
+		project := u.Path[strings.LastIndex(strings.TrimSuffix(u.Path, "/"), "/")+1:]
+		u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), project)
+		return &jiraTracker{base: strings.TrimSuffix(u.String(), "/"), project: strings.Trim(project, "/"), user: os.Getenv("JIRA_USER"), token: os.Getenv("JIRA_TOKEN")}, nil
+	}
+	return nil, fmt.Errorf("unknown issue tracker %q (want github:owner/repo or jira:https://host/PROJECT)", spec)
+}
+
+// issueRequest sends a JSON request and decodes a JSON answer into out,
+// which may be nil.
+func issueRequest(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+	if req.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := issueClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func jsonBody(v any) io.Reader {
+	data, _ := json.Marshal(v)
+	return bytes.NewReader(data)
+}
+
+type githubTracker struct {
+	api, repo, token string
+}
+
+func (g *githubTracker) request(method, path string, body io.Reader) *http.Request {
+	req, _ := http.NewRequest(method, g.api+path, body)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	return req
+}
+
+func (g *githubTracker) openTitles(label string) (map[string]bool, error) {
+	titles := make(map[string]bool)
+	for page := 1; ; page++ {
+		var issues []struct {
+			Title       string          `json:"title"`
+			PullRequest json.RawMessage `json:"pull_request"`
+		}
+		path := fmt.Sprintf("/repos/%s/issues?state=open&labels=%s&per_page=100&page=%d", g.repo, url.QueryEscape(label), page)
+		if err := issueRequest(g.request("GET", path, nil), &issues); err != nil {
+			return nil, err
+		}
+		for _, is := range issues {
+			if is.PullRequest == nil {
+				titles[is.Title] = true
+			}
+		}
+		if len(issues) < 100 {
+			return titles, nil
+		}
+	}
+}
+
+func (g *githubTracker) create(title, body string, labels []string) error {
+	payload := map[string]any{"title": title, "body": body, "labels": labels}
+	return issueRequest(g.request("POST", "/repos/"+g.repo+"/issues", jsonBody(payload)), nil)
+}
+
+type jiraTracker struct {
+	base, project, user, token string
+}
+
+func (j *jiraTracker) request(method, path string, body io.Reader) *http.Request {
+	req, _ := http.NewRequest(method, j.base+path, body)
+	if j.token != "" {
+		req.SetBasicAuth(j.user, j.token)
+	}
+	return req
+}
+
+func (j *jiraTracker) openTitles(label string) (map[string]bool, error) {
+	titles := make(map[string]bool)
+	jql := fmt.Sprintf(`project = "%s" AND labels = "%s" AND statusCategory != Done`, j.project, label)
+	for start := 0; ; {
+		var page struct {
+			Total  int `json:"total"`
+			Issues []struct {
+				Fields struct {
+					Summary string `json:"summary"`
+				} `json:"fields"`
+			} `json:"issues"`
+		}
+		q := map[string]any{"jql": jql, "fields": []string{"summary"}, "startAt": start, "maxResults": 100}
+		if err := issueRequest(j.request("POST", "/rest/api/2/search", jsonBody(q)), &page); err != nil {
+			return nil, err
+		}
+		for _, is := range page.Issues {
+			titles[is.Fields.Summary] = true
+		}
+		start += len(page.Issues)
+		if len(page.Issues) == 0 || start >= page.Total {
+			return titles, nil
+		}
+	}
+}
+
+func (j *jiraTracker) create(title, body string, labels []string) error {
+	payload := map[string]any{"fields": map[string]any{
+		"project":     map[string]string{"key": j.project},
+		"summary":     title,
+		"description": body,
+		"issuetype":   map[string]string{"name": "Task"},
+		"labels":      labels,
+	}}
+	return issueRequest(j.request("POST", "/rest/api/2/issue", jsonBody(payload)), nil)
+}
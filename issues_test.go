@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var issueFindings = []checkFinding{
+	{Domain: "a.example", Check: "expired", Detail: "expired 2024-01-01"},
+	{Domain: "b.example", Check: "expired", Detail: "expired 2024-02-01"},
+	{Domain: "b.example", Check: "hostname", Detail: "certificate is for c.example"},
+}
+
+func TestGitHubIssues(t *testing.T) {
+	var mu sync.Mutex
+	var created []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/repos/acme/infra/issues":
+			if r.URL.Query().Get("labels") != "tls-sweep" || r.URL.Query().Get("state") != "open" {
+				t.Errorf("listing with %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`[{"title":"[tls-sweep] a.example: expired"},{"title":"[tls-sweep] b.example: hostname","pull_request":{}}]`))
+		case r.Method == "POST" && r.URL.Path == "/repos/acme/infra/issues":
+			var issue map[string]any
+			json.NewDecoder(r.Body).Decode(&issue)
+			mu.Lock()
+			created = append(created, issue)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_API_URL", srv.URL)
+	t.Setenv("GITHUB_TOKEN", "t0ken")
+
+	tracker, err := newIssueTracker("github:acme/infra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := fileIssues(tracker, issueFindings, []string{"tls-sweep", "security"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a.example is already open; the pull request does not count.
+	if n != 2 || len(created) != 2 {
+		t.Fatalf("opened %d, want 2: %v", n, created)
+	}
+	if created[0]["title"] != "[tls-sweep] b.example: expired" || !strings.Contains(created[0]["body"].(string), "expired 2024-02-01") {
+		t.Errorf("issue = %v", created[0])
+	}
+	labels, _ := json.Marshal(created[1]["labels"])
+	if string(labels) != `["tls-sweep","security","check:hostname"]` {
+		t.Errorf("labels = %s", labels)
+	}
+}
+
+func TestJiraIssues(t *testing.T) {
+	var created []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "bot@acme.example" || pass != "t0ken" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			JQL    string `json:"jql"`
+			Fields struct {
+				Project struct{ Key string } `json:"project"`
+				Summary string               `json:"summary"`
+			} `json:"fields"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/jira/rest/api/2/search":
+			if !strings.Contains(body.JQL, `project = "SEC"`) {
+				t.Errorf("jql = %s", body.JQL)
+			}
+			w.Write([]byte(`{"total":1,"issues":[{"fields":{"summary":"[tls-sweep] b.example: hostname"}}]}`))
+		case "/jira/rest/api/2/issue":
+			if body.Fields.Project.Key != "SEC" {
+				t.Errorf("project = %q", body.Fields.Project.Key)
+			}
+			created = append(created, body.Fields.Summary)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("JIRA_USER", "bot@acme.example")
+	t.Setenv("JIRA_TOKEN", "t0ken")
+
+	tracker, err := newIssueTracker("jira:" + srv.URL + "/jira/SEC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := fileIssues(tracker, issueFindings, []string{"tls-sweep"}); err != nil || n != 2 {
+		t.Fatalf("opened %d, %v; want 2", n, err)
+	}
+	if strings.Join(created, ",") != "[tls-sweep] a.example: expired,[tls-sweep] b.example: expired" {
+		t.Errorf("created %v", created)
+	}
+
+	for _, bad := range []string{"gitlab:acme/infra", "github:acme", "jira:https://host"} {
+		if _, err := newIssueTracker(bad); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const jobFileVersion = 2
+
+// job is a sweep materialized on disk: the expanded target list, the scan
+// settings it was created with and every result collected so far. Running a
+// job only scans what is missing, so an interrupted run resumes where it
+// stopped.
+//
+// Shards never write the job file itself. `job run --shard i/n` keeps its
+// results in a sibling shard file (see shardPath), so shards can run from
+// copies on different machines or side by side on a shared mount, and
+// `job merge` folds the shard files back into the job.
+type job struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	BaseDomain string    `json:"base_domain"`
+	Shard      string    `json:"shard,omitempty"`
+	Config     jobConfig `json:"config"`
+	Targets    []string  `json:"targets"`
+	// Completed holds the results of each finished target; --mx scans
+	// have one per mail host and port.
+	Completed map[string][]ScanResult `json:"completed"`
+}
+
+type jobConfig struct {
+	Workers       int `json:"workers"`
+	MaxPerHost    int `json:"max_per_host"`
+	MaxDNSLookups int `json:"max_dns_lookups"`
+	// Flags are the other scan flags given to job create, in order, and
+	// replayed by job run.
+	Flags []jobFlag `json:"flags,omitempty"`
+}
+
+type jobFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// givenFlags lists the flags in args, in order, as fs parses them. Unlike
+// fs.Visit it keeps every value of a repeatable flag and the values of
+// flag.Func flags, whose String is empty.
+func givenFlags(fs *flag.FlagSet, args []string) []jobFlag {
+	var flags []jobFlag
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			break
+		}
+		if len(a) < 2 || a[0] != '-' {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if !hasValue {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+		}
+		flags = append(flags, jobFlag{Name: name, Value: value})
+	}
+	return flags
+}
+
+// anyFailure reports whether one of a target's results ended in an error.
+func anyFailure(results []ScanResult) bool {
+	return slices.ContainsFunc(results, func(r ScanResult) bool { return isFailure(r.Status) })
+}
+
+func runJob(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: tls-sweep job create|run|status|merge [flags]")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "create":
+		jobCreate(args[1:])
+	case "run":
+		jobRun(args[1:])
+	case "status":
+		jobStatus(args[1:])
+	case "merge":
+		jobMerge(args[1:])
+	default:
+		logger.Fatalf("Unknown job command %q\n", args[0])
+	}
+}
+
+func jobCreate(args []string) {
+	fs := flag.NewFlagSet("job create", flag.ExitOnError)
+	out := fs.String("o", "", "job file to write (default <base-domain>.job.json)")
+	fs.BoolVar(&forceRefresh, "force-tld-refresh", false, "ignore the cached TLD list and fetch it from IANA")
+	registerScanFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep job create [flags] <base-domain>")
+		fs.PrintDefaults()
+	}
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	baseDomain := pos[0]
+	if *out == "" {
+		*out = baseDomain + ".job.json"
+	}
+	if maxWorkers < 1 {
+		logger.Fatalf("--workers must be at least 1\n")
+	}
+	if err := checkTLSRange(); err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+
+	tlds, err := loadTLDs(!forceRefresh)
+	if err != nil {
+		logger.Fatalf("Failed to load TLDs: %v\n", err)
+	}
+
+	// -o and --force-tld-refresh only matter here; the limits have their
+	// own fields.
+	var flags []jobFlag
+	for _, f := range givenFlags(fs, args) {
+		switch f.Name {
+		case "o", "force-tld-refresh", "workers", "max-per-host", "max-dns-lookups":
+		default:
+			flags = append(flags, f)
+		}
+	}
+	j := &job{
+		Version:    jobFileVersion,
+		CreatedAt:  time.Now().UTC(),
+		BaseDomain: baseDomain,
+		Config: jobConfig{
+			Workers:       maxWorkers,
+			MaxPerHost:    maxPerHost,
+			MaxDNSLookups: maxDNSLookups,
+			Flags:         flags,
+		},
+		Targets:   expandTargets(baseDomain, tlds),
+		Completed: make(map[string][]ScanResult),
+	}
+	if err := j.save(*out); err != nil {
+		logger.Fatalf("Failed to write job file: %v\n", err)
+	}
+	logger.Printf("Job with %d targets written to %s\n", len(j.Targets), *out)
+}
+
+func jobRun(args []string) {
+	fs := flag.NewFlagSet("job run", flag.ExitOnError)
+	shard := fs.String("shard", "", "only run shard i of n, e.g. 2/4")
+	failuresOnly := fs.Bool("failures-only", false, "re-scan completed targets that ended in an error status")
+	checkpoint := fs.Duration("checkpoint-interval", 10*time.Second, "how often progress is saved to the job file")
+	registerScanFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep job run [flags] <job-file>")
+		fs.PrintDefaults()
+	}
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	path := pos[0]
+
+	j, err := loadJob(path)
+	if err != nil {
+		logger.Fatalf("Failed to load job: %v\n", err)
+	}
+	inShard, err := parseShard(*shard)
+	if err != nil {
+		logger.Fatalf("Invalid --shard: %v\n", err)
+	}
+
+	// Settings stored in the job win unless overridden on the command line.
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if !explicit["workers"] {
+		maxWorkers = j.Config.Workers
+	}
+	if !explicit["max-per-host"] {
+		maxPerHost = j.Config.MaxPerHost
+	}
+	if !explicit["max-dns-lookups"] {
+		maxDNSLookups = j.Config.MaxDNSLookups
+	}
+	for _, f := range j.Config.Flags {
+		if explicit[f.Name] || fs.Lookup(f.Name) == nil {
+			continue
+		}
+		if err := fs.Set(f.Name, f.Value); err != nil {
+			logger.Fatalf("Invalid --%s stored in the job: %v\n", f.Name, err)
+		}
+	}
+	if maxWorkers < 1 {
+		logger.Fatalf("--workers must be at least 1\n")
+	}
+	if err := checkTLSRange(); err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+
+	// Shard results go to their own file; the job file is only read.
+	out, results := path, j
+	if *shard != "" {
+		out = shardPath(path, *shard)
+		if results, err = loadShard(out, j, *shard); err != nil {
+			logger.Fatalf("Failed to load shard file: %v\n", err)
+		}
+	}
+
+	var pending []string
+	for i, target := range j.Targets {
+		if !inShard(i) {
+			continue
+		}
+		rs, done := results.Completed[target]
+		if !done {
+			rs, done = j.Completed[target]
+		}
+		if *failuresOnly && done && anyFailure(rs) || !*failuresOnly && !done {
+			pending = append(pending, target)
+		}
+	}
+	if len(pending) == 0 {
+		logger.Println("Nothing to do.")
+		return
+	}
+	logger.Printf("Running %d targets from %s, saving to %s\n", len(pending), path, out)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	swept := make(chan ScanResult, maxWorkers)
+	go sweep(ctx, newScanner(), pending, swept)
+
+	// A re-scanned target's results replace the ones it had.
+	fresh := make(map[string]bool)
+	last := time.Now()
+	for r := range swept {
+		if !fresh[r.Domain] {
+			fresh[r.Domain] = true
+			results.Completed[r.Domain] = nil
+		}
+		results.Completed[r.Domain] = append(results.Completed[r.Domain], r)
+		if time.Since(last) >= *checkpoint {
+			if err := results.save(out); err != nil {
+				logger.Printf("Checkpoint failed: %v\n", err)
+			}
+			last = time.Now()
+		}
+	}
+	if err := results.save(out); err != nil {
+		logger.Fatalf("Failed to save job: %v\n", err)
+	}
+
+	if len(fresh) < len(pending) {
+		logger.Printf("Paused after %d of %d targets; run the job again to resume.\n", len(fresh), len(pending))
+		return
+	}
+	logger.Printf("Scanned %d targets.\n", len(fresh))
+
+	if *shard != "" {
+		logger.Printf("Shard results saved to %s; combine shards with `tls-sweep job merge %s`.\n", out, path)
+		return
+	}
+	j.exportIfComplete()
+}
+
+func jobStatus(args []string) {
+	fs := flag.NewFlagSet("job status", flag.ExitOnError)
+	shard := fs.String("shard", "", "only report shard i of n, e.g. 2/4")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep job status [flags] <job-file>")
+		fs.PrintDefaults()
+	}
+	pos := parseArgs(fs, args)
+	if len(pos) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	j, err := loadJob(pos[0])
+	if err != nil {
+		logger.Fatalf("Failed to load job: %v\n", err)
+	}
+	inShard, err := parseShard(*shard)
+	if err != nil {
+		logger.Fatalf("Invalid --shard: %v\n", err)
+	}
+	if *shard != "" {
+		sj, err := loadShard(shardPath(pos[0], *shard), j, *shard)
+		if err != nil {
+			logger.Fatalf("Failed to load shard file: %v\n", err)
+		}
+		for target, rs := range sj.Completed {
+			j.Completed[target] = rs
+		}
+	}
+
+	total, completed, failures := 0, 0, 0
+	byStatus := make(map[string]int)
+	for i, target := range j.Targets {
+		if !inShard(i) {
+			continue
+		}
+		total++
+		if rs, ok := j.Completed[target]; ok {
+			completed++
+			for _, r := range rs {
+				byStatus[r.Status]++
+			}
+			if anyFailure(rs) {
+				failures++
+			}
+		}
+	}
+
+	fmt.Printf("Job:       %s (created %s)\n", j.BaseDomain, j.CreatedAt.Format(time.RFC3339))
+	fmt.Printf("Targets:   %d\n", total)
+	fmt.Printf("Completed: %d\n", completed)
+	fmt.Printf("Remaining: %d\n", total-completed)
+	fmt.Printf("Failures:  %d\n", failures)
+
+	statuses := make([]string, 0, len(byStatus))
+	for status := range byStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Printf("  %-10s %d\n", status, byStatus[status])
+	}
+
+	if *shard == "" {
+		shards, _ := filepath.Glob(shardGlob(pos[0]))
+		for _, sp := range shards {
+			sj, err := loadJob(sp)
+			if err != nil {
+				continue
+			}
+			unmerged := 0
+			for target := range sj.Completed {
+				if _, ok := j.Completed[target]; !ok {
+					unmerged++
+				}
+			}
+			if unmerged > 0 {
+				fmt.Printf("Unmerged:  %d results in %s\n", unmerged, sp)
+			}
+		}
+	}
+}
+
+// jobMerge folds shard result files into the job file. Without explicit
+// shard files it picks up every shard file next to the job.
+func jobMerge(args []string) {
+	fs := flag.NewFlagSet("job merge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep job merge <job-file> [shard-file...]")
+		fs.PrintDefaults()
+	}
+	pos := parseArgs(fs, args)
+	if len(pos) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	path, shards := pos[0], pos[1:]
+
+	j, err := loadJob(path)
+	if err != nil {
+		logger.Fatalf("Failed to load job: %v\n", err)
+	}
+	if len(shards) == 0 {
+		shards, _ = filepath.Glob(shardGlob(path))
+	}
+	if len(shards) == 0 {
+		logger.Fatalf("No shard files found for %s\n", path)
+	}
+
+	merged := 0
+	for _, sp := range shards {
+		sj, err := loadJob(sp)
+		if err != nil {
+			logger.Fatalf("Failed to load shard: %v\n", err)
+		}
+		if err := j.checkSameTargets(sj); err != nil {
+			logger.Fatalf("%s: %v\n", sp, err)
+		}
+		for target, rs := range sj.Completed {
+			j.Completed[target] = rs
+			merged += len(rs)
+		}
+	}
+	if err := j.save(path); err != nil {
+		logger.Fatalf("Failed to save job: %v\n", err)
+	}
+	logger.Printf("Merged %d results from %d shard files into %s (%d of %d targets done)\n",
+		merged, len(shards), path, len(j.Completed), len(j.Targets))
+	j.exportIfComplete()
+}
+
+// exportIfComplete writes the CSV export once every target has a result.
+func (j *job) exportIfComplete() {
+	if len(j.Completed) < len(j.Targets) {
+		return
+	}
+	all := make(chan ScanResult, len(j.Targets))
+	go func() {
+		for _, target := range j.Targets {
+			for _, r := range j.Completed[target] {
+				all <- r
+			}
+		}
+		close(all)
+	}()
+	exportToCsv(j.BaseDomain, all)
+}
+
+func (j *job) checkSameTargets(other *job) error {
+	if other.BaseDomain != j.BaseDomain || !slices.Equal(other.Targets, j.Targets) {
+		return fmt.Errorf("targets do not match the job")
+	}
+	return nil
+}
+
+// shardPath names the file holding the results of one shard, e.g.
+// amazon.job.json + 2/4 -> amazon.job.shard-2-of-4.json.
+func shardPath(path, spec string) string {
+	return strings.TrimSuffix(path, ".json") + ".shard-" + strings.Replace(spec, "/", "-of-", 1) + ".json"
+}
+
+func shardGlob(path string) string {
+	return strings.TrimSuffix(path, ".json") + ".shard-*-of-*.json"
+}
+
+// loadShard loads the results of a previous run of the shard, or starts an
+// empty shard file derived from j.
+func loadShard(path string, j *job, spec string) (*job, error) {
+	sj, err := loadJob(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &job{
+			Version:    j.Version,
+			CreatedAt:  j.CreatedAt,
+			BaseDomain: j.BaseDomain,
+			Shard:      spec,
+			Config:     j.Config,
+			Targets:    j.Targets,
+			Completed:  make(map[string][]ScanResult),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := j.checkSameTargets(sj); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return sj, nil
+}
+
+func loadJob(path string) (*job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var j job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if j.Version != jobFileVersion {
+		return nil, fmt.Errorf("%s: unsupported job file version %d", path, j.Version)
+	}
+	if j.Config.Workers < 1 {
+		return nil, fmt.Errorf("%s: config.workers must be at least 1", path)
+	}
+	if j.Completed == nil {
+		j.Completed = make(map[string][]ScanResult)
+	}
+	return &j, nil
+}
+
+// save writes the job to a temporary file next to path and renames it into
+// place, so an interrupted checkpoint never leaves a truncated job file.
+func (j *job) save(path string) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
+
+// parseShard turns "i/n" into a predicate over target indexes. An empty
+// spec selects every target.
+func parseShard(spec string) (func(int) bool, error) {
+	if spec == "" {
+		return func(int) bool { return true }, nil
+	}
+	i, n, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("expected i/n, got %q", spec)
+	}
+	idx, err1 := strconv.Atoi(i)
+	count, err2 := strconv.Atoi(n)
+	if err1 != nil || err2 != nil || count < 1 || idx < 1 || idx > count {
+		return nil, fmt.Errorf("expected 1 <= i <= n, got %q", spec)
+	}
+	return func(target int) bool { return target%count == idx-1 }, nil
+}
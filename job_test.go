@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	all, err := parseShard("")
+	if err != nil || !all(0) || !all(7) {
+		t.Fatalf("empty spec should select everything (err %v)", err)
+	}
+
+	in, err := parseShard("2/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for i := 0; i < 9; i++ {
+		if in(i) {
+			got = append(got, i)
+		}
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 4 || got[2] != 7 {
+		t.Errorf("shard 2/3 selected %v, want [1 4 7]", got)
+	}
+
+	for _, bad := range []string{"3", "0/2", "3/2", "a/b", "1/0"} {
+		if _, err := parseShard(bad); err == nil {
+			t.Errorf("parseShard(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestShardPath(t *testing.T) {
+	if got := shardPath("out/amazon.job.json", "2/4"); got != "out/amazon.job.shard-2-of-4.json" {
+		t.Errorf("shardPath = %q", got)
+	}
+	if ok, _ := filepath.Match(shardGlob("amazon.job.json"), shardPath("amazon.job.json", "10/12")); !ok {
+		t.Error("shardGlob does not match shardPath")
+	}
+}
+
+func TestJobSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "t.job.json")
+	j := &job{
+		Version:   jobFileVersion,
+		Config:    jobConfig{Workers: 2},
+		Targets:   []string{"a.example", "b.example"},
+		Completed: map[string][]ScanResult{"a.example": {{Domain: "a.example", MX: "mx1.a.example", Status: "OK"}, {Domain: "a.example", MX: "mx2.a.example", Status: "TLS ERROR"}}},
+	}
+	if err := j.save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadJob(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs := got.Completed["a.example"]; len(rs) != 2 || rs[1].Status != "TLS ERROR" || !anyFailure(rs) || len(got.Targets) != 2 {
+		t.Errorf("round trip = %+v", got)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+
+	j.Config.Workers = 0
+	if err := j.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJob(path); err == nil {
+		t.Error("loadJob accepted config.workers = 0")
+	}
+}
+
+func TestGivenFlags(t *testing.T) {
+	fs := flag.NewFlagSet("job create", flag.ContinueOnError)
+	fs.String("o", "", "")
+	fs.Bool("mx", false, "")
+	var templates []string
+	fs.Func("template", "", func(v string) error {
+		templates = append(templates, v)
+		return nil
+	})
+	args := []string{"amazon", "--template", "{base}-login.{tld}", "-mx", "--template={base}shop.{tld}", "-o", "a.json"}
+	if pos := parseArgs(fs, args); len(pos) != 1 {
+		t.Fatalf("positional = %v", pos)
+	}
+	var got []string
+	for _, f := range givenFlags(fs, args) {
+		got = append(got, f.Name+"="+f.Value)
+	}
+	want := "template={base}-login.{tld} mx=true template={base}shop.{tld} o=a.json"
+	if strings.Join(got, " ") != want {
+		t.Errorf("givenFlags = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// legacyChain walks the served chain for the setups that break only some
+// clients and describes the first one found, or returns "". Modern clients
+// build their own path and stop at a root they hold; older ones (Android
+// before 7.1.1, OpenSSL 1.0, Java 8 before 8u141) follow the certificates
+// as served, so an expired cross-sign or root on that path fails them:
+//
+//   - a cross-sign of a root in roots that has expired, or whose issuer
+//     has or is no longer in roots, e.g. ISRG Root X1 signed by DST Root
+//     CA X3;
+//   - an expired self-signed root sent along with the chain;
+//   - any other expired intermediate, which fails everyone.
+func legacyChain(chain []*x509.Certificate, roots []*x509.Certificate, now time.Time) string {
+	held := make(map[string]bool, len(roots))
+	for _, r := range roots {
+		held[string(r.RawSubject)+string(r.RawSubjectPublicKeyInfo)] = true
+	}
+	for _, c := range chain[min(1, len(chain)):] {
+		if len(c.RawSubject) == 0 {
+			continue
+		}
+		name := certSubject(c)
+		selfSigned := bytes.Equal(c.RawIssuer, c.RawSubject)
+		switch {
+		case selfSigned:
+			if now.After(c.NotAfter) {
+				return fmt.Sprintf("serves root %s, expired %s: clients that follow the served chain fail", name, c.NotAfter.Format("2006-01-02"))
+			}
+		case held[string(c.RawSubject)+string(c.RawSubjectPublicKeyInfo)]:
+			by := c.Issuer.CommonName
+			if now.After(c.NotAfter) {
+				return fmt.Sprintf("serves %s cross-signed by %s, expired %s: clients without %s in their store fail", name, by, c.NotAfter.Format("2006-01-02"), name)
+			}
+			switch issuer := findIssuer(c, chain, roots); {
+			case issuer == nil:
+				return fmt.Sprintf("serves %s cross-signed by %s, which is not in current trust stores: clients without %s in their store rely on it", name, by, name)
+			case now.After(issuer.NotAfter):
+				return fmt.Sprintf("serves %s cross-signed by %s, which expired %s: clients without %s in their store fail", name, by, issuer.NotAfter.Format("2006-01-02"), name)
+			}
+		case now.After(c.NotAfter):
+			return fmt.Sprintf("serves intermediate %s, expired %s", name, c.NotAfter.Format("2006-01-02"))
+		}
+	}
+	return ""
+}
+
+// findIssuer looks up the certificate that signed c among the served chain
+// and roots.
+func findIssuer(c *x509.Certificate, chain, roots []*x509.Certificate) *x509.Certificate {
+	for _, set := range [][]*x509.Certificate{chain, roots} {
+		for _, p := range set {
+			if p != c && bytes.Equal(p.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(p) == nil {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// legacyChainCheck fails on the chains legacyChain describes.
+func legacyChainCheck(_ *scanner, r ScanResult, o checkOptions) (string, bool) {
+	if leafOf(r) == nil {
+		return "", false
+	}
+	detail := legacyChain(r.Chain, mozillaRoots(), o.now)
+	return detail, detail != ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLegacyChain(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	newKey := func() *ecdsa.PrivateKey {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	mint := func(cn string, notAfter time.Time, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             now.AddDate(-5, 0, 0),
+			NotAfter:              notAfter,
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// The Let's Encrypt setup of 2021-2024: ISRG Root X1 is trusted on its
+	// own, and also served cross-signed by the expired DST Root CA X3.
+	dstKey, x1Key, r3Key := newKey(), newKey(), newKey()
+	dst := mint("DST Root CA X3", time.Date(2021, 9, 30, 0, 0, 0, 0, time.UTC), dstKey, nil, nil)
+	x1 := mint("ISRG Root X1", now.AddDate(10, 0, 0), x1Key, nil, nil)
+	x1Cross := mint("ISRG Root X1", time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC), x1Key, dst, dstKey)
+	r3 := mint("R3", now.AddDate(3, 0, 0), r3Key, x1, x1Key)
+	leaf := mint("shop.example", now.AddDate(0, 2, 0), newKey(), r3, r3Key)
+	roots := []*x509.Certificate{x1}
+
+	for _, tc := range []struct {
+		name  string
+		chain []*x509.Certificate
+		want  string // substring, "" for a clean chain
+	}{
+		{"modern", []*x509.Certificate{leaf, r3}, ""},
+		{"cross-signed by removed root", []*x509.Certificate{leaf, r3, x1Cross}, "cross-signed by DST Root CA X3, which is not in current trust stores"},
+		{"expired root served", []*x509.Certificate{leaf, r3, x1Cross, dst}, "cross-signed by DST Root CA X3, which expired"},
+		{"expired root alone", []*x509.Certificate{leaf, r3, dst}, "serves root DST Root CA X3, expired 2021-09-30"},
+	} {
+		got := legacyChain(tc.chain, roots, now)
+		if (tc.want == "") != (got == "") || !strings.Contains(got, tc.want) {
+			t.Errorf("%s: %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if got := legacyChain([]*x509.Certificate{leaf, r3, x1Cross}, roots, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); !strings.Contains(got, "expired 2024-09-30: clients without ISRG Root X1") {
+		t.Errorf("after the cross-sign expired: %q", got)
+	}
+}
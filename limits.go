@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// keyedLimiter caps the number of concurrent holders per key, independently
+// of the global worker count. A limit of 0 or less disables it.
+type keyedLimiter struct {
+	limit int
+
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+func newKeyedLimiter(limit int) *keyedLimiter {
+	return &keyedLimiter{limit: limit, sems: make(map[string]chan struct{})}
+}
+
+// acquire blocks until a slot for key is free or ctx is done. The returned
+// release func must be called exactly once when err is nil.
+func (l *keyedLimiter) acquire(ctx context.Context, key string) (release func(), err error) {
+	if l == nil || l.limit <= 0 {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	sem, ok := l.sems[key]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.sems[key] = sem
+	}
+	l.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limitedConn gives its limiter slot back when the connection is closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
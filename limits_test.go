@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiterCapsConcurrency(t *testing.T) {
+	const limit = 3
+	l := newKeyedLimiter(limit)
+
+	var inFlight, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(context.Background(), "192.0.2.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := inFlight.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			inFlight.Add(-1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p != limit {
+		t.Errorf("peak concurrency = %d, want %d", p, limit)
+	}
+}
+
+func TestKeyedLimiterKeysAreIndependent(t *testing.T) {
+	l := newKeyedLimiter(1)
+	release, err := l.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "b"); err != nil {
+		t.Errorf("acquire on another key blocked: %v", err)
+	}
+	if _, err := l.acquire(ctx, "a"); err == nil {
+		t.Error("second acquire on a full key succeeded")
+	}
+}
+
+func TestKeyedLimiterDisabled(t *testing.T) {
+	for _, l := range []*keyedLimiter{nil, newKeyedLimiter(0)} {
+		for i := 0; i < 10; i++ {
+			if _, err := l.acquire(context.Background(), "k"); err != nil {
+				t.Fatalf("disabled limiter blocked: %v", err)
+			}
+		}
+	}
+}
+
+func TestLimitedConnReleasesOnce(t *testing.T) {
+	l := newKeyedLimiter(1)
+	var released atomic.Int32
+
+	release, err := l.acquire(context.Background(), "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := &limitedConn{Conn: client, release: func() {
+		released.Add(1)
+		release()
+	}}
+
+	conn.Close()
+	conn.Close()
+	if n := released.Load(); n != 1 {
+		t.Fatalf("release called %d times, want 1", n)
+	}
+
+	// The slot is free again, and only once: a second holder fills it.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "k"); err != nil {
+		t.Fatalf("slot not released: %v", err)
+	}
+	if _, err := l.acquire(ctx, "k"); err == nil {
+		t.Fatal("double release freed an extra slot")
+	}
+}
+
+// TestScanProbesWithOnePerHost is a scan whose follow-up probes reconnect
+// to the same IP under --max-per-host 1: each must wait for the scan's own
+// connection to be closed, not deadlock on it.
+func TestScanProbesWithOnePerHost(t *testing.T) {
+	httpsPort, _ := redirectServers(t, func(string, string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+	})
+	s := redirectScanner(httpsPort, 2)
+	s.hostLimit = newKeyedLimiter(1)
+	s.sniFuzz = "intranet.example"
+	s.insecure = true
+
+	done := make(chan ScanResult, 1)
+	go func() { done <- s.scan("brand.example") }()
+	select {
+	case r := <-done:
+		if r.Status != "OK" || len(r.Redirects) != 1 || !strings.Contains(r.SNIVariants, "intranet.example") {
+			t.Errorf("scan = %+v", r)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("scan still waiting for a per-host slot")
+	}
+}
@@ -1,108 +1,759 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net"
-	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var logger = log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
 
 const ianaTLDListURL = "https://data.iana.org/TLD/tlds-alpha-by-domain.txt"
-const cacheDir = ".cache"
 
-var cacheFile = fmt.Sprintf("%s/tlds.cache", cacheDir)
 var maxWorkers = 2 * runtime.NumCPU()
 
+var (
+	maxPerHost    int
+	maxDNSLookups int
+	fetchFavicons bool
+	probeQUIC     bool
+	mxMode        bool
+)
+
+var (
+	forceRefresh  bool
+	pprofAddr     string
+	logLevel      string
+	statsInterval time.Duration
+)
+
+// scanned counts the domains processed so far, so that stalls are visible in
+// the periodic runtime stats.
+var scanned atomic.Int64
+
 type ScanResult struct {
-	Domain  string
-	IP      string
-	Status  string
-	Subject string
-	Issuer  string
-	ValidTo string
+	Domain  string `json:"domain"`
+	IP      string `json:"ip"`
+	Family  string `json:"family,omitempty"` // IPv4 or IPv6, whichever connection won the race
+	Status  string `json:"status"`
+	Subject string `json:"subject,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+	ValidTo string `json:"valid_to,omitempty"`
+	Score   int    `json:"score,omitempty"` // brand-abuse risk, 0-100
+	Note    string `json:"note,omitempty"`  // free-form annotation, e.g. set by --script
+
+	Screenshot  string `json:"screenshot,omitempty"`   // path of the PNG saved by --screenshots
+	FaviconHash string `json:"favicon_hash,omitempty"` // Shodan-style http.favicon.hash
+	QUIC        string `json:"quic,omitempty"`         // NONE, or whether HTTP/3 serves the SAME or a DIFFERENT certificate
+	MX          string `json:"mx,omitempty"`           // mail server probed in --mx mode
+	Port        string `json:"port,omitempty"`
+
+	// The parameters the server picked for our default handshake.
+	TLSVersion  string `json:"tls_version,omitempty"`
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	Curve       string `json:"curve,omitempty"` // key exchange group, e.g. X25519
+
+	SerialNumber string `json:"serial_number,omitempty"` // hexadecimal, as CAs and CRLs list it
+	NotBefore    string `json:"not_before,omitempty"`    // issue time of the leaf certificate
+	SPKI         string `json:"spki_sha256,omitempty"`   // SHA-256 of the leaf's public key
+	SharedWith   int    `json:"shared_with,omitempty"`   // other domains serving the same key, with --cert-reuse
+
+	// ChainValidTo is the earliest expiry across the served chain;
+	// ChainLimitedBy names the intermediate when it is not the leaf's.
+	ChainValidTo   string `json:"chain_valid_to,omitempty"`
+	ChainLimitedBy string `json:"chain_limited_by,omitempty"`
+
+	// LegacyChain describes an expired cross-sign or root on the served
+	// chain that older clients follow, see legacyChain.
+	LegacyChain string `json:"legacy_chain,omitempty"`
+
+	// Trust is the --trust-matrix verdict per trust store, e.g.
+	// "android-7=untrusted mozilla=trusted".
+	Trust string `json:"trust,omitempty"`
+
+	// Host data from --enrich: open ports, fingerprinted services and
+	// owner of the IP, and how many other certificates it was seen with.
+	OpenPorts  string `json:"open_ports,omitempty"`
+	Services   string `json:"services,omitempty"`
+	HostOrg    string `json:"host_org,omitempty"`
+	OtherCerts int    `json:"other_certs,omitempty"`
+
+	// Owner, Ticket and Annotation come from --annotations.
+	Owner      string `json:"owner,omitempty"`
+	Ticket     string `json:"ticket,omitempty"`
+	Annotation string `json:"annotation,omitempty"`
+
+	// ThreatMatch lists the --ioc-feed entries the result hits, as
+	// "feed=indicator".
+	ThreatMatch string `json:"threat_match,omitempty"`
+
+	// DomainUnicode is the display form of internationalized domains.
+	DomainUnicode string `json:"domain_unicode,omitempty"`
+	// ClientHello names the --client-hello fingerprint the probe presented.
+	ClientHello string `json:"client_hello,omitempty"`
+	// RTT is the TCP connect time of the probe in milliseconds, about one
+	// round trip; EstimatedRegion is the --region-anchor it is closest to.
+	RTT             int    `json:"rtt_ms,omitempty"`
+	EstimatedRegion string `json:"estimated_region,omitempty"`
+	// SNIVariants lists the --sni-fuzz names the IP answers with another
+	// certificate, as "name=subject".
+	SNIVariants string `json:"sni_variants,omitempty"`
+	// InsecureRenegotiation, Heartbeat, Compression and
+	// DeprecatedExtensions are the --probe-insecure findings: no RFC 5746
+	// secure renegotiation over TLS 1.2, the heartbeat extension behind
+	// Heartbleed enabled, TLS compression (CRIME) accepted, and the
+	// deprecated extensions the server takes up.
+	InsecureRenegotiation bool   `json:"insecure_renegotiation,omitempty"`
+	Heartbeat             bool   `json:"heartbeat,omitempty"`
+	Compression           bool   `json:"compression,omitempty"`
+	DeprecatedExtensions  string `json:"deprecated_extensions,omitempty"`
+	// MustStaple is "stapled" or "missing" for a leaf with the OCSP
+	// Must-Staple extension, by whether the server staples.
+	MustStaple string `json:"must_staple,omitempty"`
+	// EKU lists the leaf's extended key usages and CertType its DV, OV, IV
+	// or EV policy. ValidityDays is its validity period, and
+	// ValidityViolation says how it exceeds the Baseline Requirements.
+	EKU               string `json:"eku,omitempty"`
+	CertType          string `json:"cert_type,omitempty"`
+	ValidityDays      int    `json:"validity_days,omitempty"`
+	ValidityViolation string `json:"validity_violation,omitempty"`
+	// ScannedAt is when the result was taken, in RFC 3339.
+	ScannedAt string `json:"scanned_at,omitempty"`
+	// Redirects is the chain --follow-redirects walked from
+	// https://<domain>/, one hop per request, and FinalURL where it ended.
+	Redirects []redirectHop `json:"redirects,omitempty"`
+	FinalURL  string        `json:"final_url,omitempty"`
+
+	// Chain, the certificates as served, feeds the check subcommand.
+	Chain []*x509.Certificate `json:"-"`
+	// Err is the underlying error of a failed result, for --error-log.
+	Err error `json:"-"`
+}
+
+// isFailure reports whether status is an error outcome worth re-scanning.
+// NXDOMAIN, NO MX, NO STARTTLS and NO TLS are definitive answers, not
+// failures.
+func isFailure(status string) bool {
+	switch status {
+	case "OK", "NXDOMAIN", "NO MX", "NO STARTTLS", "NO TLS":
+		return false
+	}
+	return true
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run tls_sweep.go <base-domain>")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "job":
+			runJob(os.Args[2:])
+			return
+		case "coordinator":
+			runCoordinator(os.Args[2:])
+			return
+		case "worker":
+			runWorker(os.Args[2:])
+			return
+		case "consume":
+			runConsume(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "schema":
+			runSchema(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "retry":
+			runRetry(os.Args[2:])
+			return
+		case "merge":
+			runMerge(os.Args[2:])
+			return
+		case "resolve":
+			runResolve(os.Args[2:])
+			return
+		case "handshake":
+			runHandshake(os.Args[2:])
+			return
+		case "enrich":
+			runEnrich(os.Args[2:])
+			return
+		case "certs":
+			runCerts(os.Args[2:])
+			return
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		case "audit":
+			runAudit(os.Args[2:])
+			return
+		case "version":
+			runVersion(os.Args[2:])
+			return
+		case "self-update":
+			runSelfUpdate(os.Args[2:])
+			return
+		case "completion":
+			runCompletion(os.Args[2:])
+			return
+		case "man":
+			runMan(os.Args[2:])
+			return
+		}
+	}
+
+	fs, opts := newSweepFlags()
+	format, writePDF, graphFormat, writeManifestFile, signKey := opts.format, opts.writePDF, opts.graphFormat, opts.writeManifestFile, opts.signKey
+
+	args := parseArgs(fs, os.Args[1:])
+	if len(args) < 1 {
+		fs.Usage()
 		os.Exit(1)
 	}
-	baseDomain := os.Args[1]
+	baseDomain := toASCII(args[0])
+
+	if outputDir == "-" {
+		logger.SetOutput(os.Stderr)
+	}
+	if problems := opts.validate(); len(problems) > 0 {
+		exitInvalid(problems)
+	}
+	if outputDir != "-" {
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			logger.Fatalf("Failed to create output directory: %v\n", err)
+		}
+	}
+	var mailer *smtpConfig
+	if emailReport != "" {
+		var err error
+		if mailer, err = loadSMTPConfig(smtpConfigPath); err != nil {
+			logger.Fatalf("Failed to load SMTP settings: %v\n", err)
+		}
+	}
+	if pprofAddr != "" {
+		if err := startPprof(pprofAddr); err != nil {
+			logger.Fatalf("Failed to start pprof listener: %v\n", err)
+		}
+	}
+	if logLevel == "debug" {
+		go logRuntimeStats(statsInterval)
+	}
+
+	var script *resultScript
+	if scriptPath != "" {
+		var err error
+		if script, err = loadScript(scriptPath); err != nil {
+			logger.Fatalf("Failed to load script: %v\n", err)
+		}
+	}
+
+	var chrome string
+	if screenshotDir != "" {
+		var err error
+		if chrome, err = findChrome(); err != nil {
+			logger.Fatalf("Screenshots unavailable: %v\n", err)
+		}
+		if err := os.MkdirAll(screenshotDir, 0o755); err != nil {
+			logger.Fatalf("Failed to create screenshot directory: %v\n", err)
+		}
+	}
+
+	var assets map[string]asset
+	if assetsFile != "" {
+		var err error
+		if assets, err = loadAssets(assetsFile); err != nil {
+			logger.Fatalf("Failed to load assets: %v\n", err)
+		}
+	}
+
+	var notes map[string]annotation
+	if annotationsFile != "" {
+		var err error
+		if notes, err = loadAnnotations(annotationsFile); err != nil {
+			logger.Fatalf("Failed to load annotations: %v\n", err)
+		}
+	}
+
+	var stores []trustStore
+	if trustMatrix {
+		var err error
+		if stores, err = loadTrustStores(extraTrustStore); err != nil {
+			logger.Fatalf("Failed to load trust stores: %v\n", err)
+		}
+	}
 
-	forceRefresh := false
-	if len(os.Args) > 2 && os.Args[2] == "--force-tld-refresh" {
-		forceRefresh = true
+	var intel *enricher
+	if enrichSource != "" {
+		src, err := newIntelSource(enrichSource)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		intel = newEnricher(src)
 	}
 
-	var tlds, err = loadTLDs(!forceRefresh)
+	sc, err := newScorer(baseDomain)
 	if err != nil {
-		logger.Fatalf("Failed to load TLDs: %v\n", err)
+		logger.Fatalf("Failed to load ASN reputation: %v\n", err)
 	}
 
-	tasks := make(chan string, len(tlds))
-	results := make(chan ScanResult, len(tlds))
+	startTracing()
+	defer tracing.shutdown()
+	root := tracing.start("sweep", stringAttr("tls_sweep.base_domain", baseDomain))
+	generate := root.child("generate targets")
 
-	var wg sync.WaitGroup
-	for i := 0; i < maxWorkers; i++ {
-		wg.Add(1)
-		go worker(tasks, results, &wg)
+	var domains []string
+	if monitorFrom != "" {
+		if domains, err = monitorTargets(monitorFrom); err != nil {
+			logger.Fatalf("Failed to load previous results: %v\n", err)
+		}
+		logger.Printf("Monitoring %d domains that were OK in %s\n", len(domains), monitorFrom)
+	} else {
+		tlds, err := loadTLDs(!forceRefresh)
+		if err != nil {
+			logger.Fatalf("Failed to load TLDs: %v\n", err)
+		}
+		domains = expandTargets(baseDomain, tlds)
+	}
+	if sampleSpec != "" {
+		n, err := sampleCount(sampleSpec, len(domains))
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		domains = sampleTargets(domains, n, rand.New(rand.NewSource(time.Now().UnixNano())))
+		logger.Printf("Sampling %d targets\n", len(domains))
+	}
+	s := newScanner()
+	if budgetSpec != "" {
+		budget, _ := parseBudget(budgetSpec)
+		plan := s.plan(len(domains), s.workerCount())
+		if n := budget.fit(plan); n < len(domains) {
+			if n == 0 {
+				logger.Fatalf("--budget %s does not allow a single target (%d connections and %v each)\n", budgetSpec, plan.connsPerTarget, plan.targetTime)
+			}
+			domains = sampleTargets(domains, n, rand.New(rand.NewSource(time.Now().UnixNano())))
+			logger.Printf("Budget allows %d of %d targets, sampling\n", n, plan.targets)
+		}
+	}
+	if planOnly {
+		s.plan(len(domains), s.workerCount()).write(os.Stdout)
+		return
 	}
+	generate.set(intAttr("tls_sweep.targets", len(domains)))
+	generate.end()
+	s.span = root
 
-	for _, tld := range tlds {
-		if strings.HasPrefix(tld, "xn--") {
-			continue // skip IDNs
+	var sink *syslogSink
+	if syslogURL != "" {
+		if sink, err = dialSyslog(syslogURL, syslogFormat); err != nil {
+			logger.Fatalf("Failed to connect to syslog collector: %v\n", err)
 		}
-		domain := fmt.Sprintf("%s.%s", baseDomain, tld)
-		tasks <- domain
+		defer sink.close()
 	}
-	close(tasks)
 
+	openAuditTrail()
+	openCertHistory()
+	audit := auditTrail.start(auditEntry{ScanID: newScanID(time.Now()), Mode: "cli", TriggeredBy: "command line",
+		BaseDomains: []string{baseDomain}, Parameters: flagParameters(fs), Targets: len(domains)})
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	results := make(chan ScanResult, len(domains))
+	go sweep(ctx, s, domains, results)
+
+	// Reconciliation sees every result, including those --min-score or
+	// --script drop from the export.
+	var scannedResults []ScanResult
+	processed := results
+	if assets != nil {
+		processed = collectResults(processed, &scannedResults)
+	}
+	if certReuse {
+		processed = reuseResults(processed)
+	}
+	if stores != nil {
+		processed = trustResults(processed, stores)
+	}
+	if certHistory != nil {
+		processed = recordCerts(processed, certHistory)
+	}
+	if intel != nil {
+		processed = enrichResults(processed, intel)
+	}
+	processed = scoreResults(processed, sc)
+	if chrome != "" {
+		processed = screenshotResults(processed, chrome, screenshotDir)
+	}
+	if notes != nil {
+		processed = annotateResults(processed, notes)
+	}
+	if script != nil {
+		processed = scriptResults(processed, script)
+	}
+	if len(onlyFilters) > 0 {
+		processed = filterResults(processed, onlyFilters)
+	}
+	if sink != nil {
+		processed = syslogResults(processed, sink)
+	}
+	if tuiMode {
+		if processed, err = runTUI(processed, len(domains), stop); err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+	}
+	// Results stream into the export as they arrive, so its span lasts
+	// until the last one is written.
+	export := root.child("export", stringAttr("tls_sweep.format", *format))
+	var all []ScanResult
+	switch *format {
+	case "csv":
+		exportToCsv(baseDomain, tapResults(processed, &all))
+	case "xlsx":
+		exportToXLSX(baseDomain, tapResults(processed, &all))
+	case "markdown":
+		exportToMarkdown(baseDomain, tapResults(processed, &all))
+	default:
+		exportToJSON(baseDomain, tapResults(processed, &all), *format == "ndjson")
+	}
+	export.end()
+	saveCertHistory()
+	runPostScanHook(all)
+	var stopped error
+	if ctx.Err() != nil {
+		stopped = errSweepStopped
+		root.fail(stopped.Error())
+	}
+	audit.finish(int(scanned.Load()), stopped)
+	root.end()
+
+	if *writePDF {
+		if err := exportToPDF(baseDomain, all); err != nil {
+			logger.Fatalf("Failed to write PDF report: %v\n", err)
+		}
+		logger.Printf("PDF report written to %s\n", exportPath(baseDomain, "pdf"))
+	}
+
+	if *graphFormat != "" {
+		path := graphPath(baseDomain, *graphFormat)
+		if err := writeGraph(path, *graphFormat, buildGraph(all, cachedASNs(sc))); err != nil {
+			logger.Fatalf("Failed to write graph: %v\n", err)
+		}
+		logger.Printf("Graph written to %s\n", path)
+	}
+
+	if assets != nil {
+		path := assetReportPath(baseDomain)
+		if err := writeAssetReport(path, reconcileAssets(assets, scannedResults)); err != nil {
+			logger.Fatalf("Failed to write asset report: %v\n", err)
+		}
+		logger.Printf("Asset reconciliation written to %s\n", path)
+	}
+
+	if *writeManifestFile || *signKey != "" {
+		files := []string{exportPath(baseDomain, *format)}
+		if *writePDF {
+			files = append(files, exportPath(baseDomain, "pdf"))
+		}
+		if assets != nil {
+			files = append(files, assetReportPath(baseDomain))
+		}
+		if *graphFormat != "" {
+			files = append(files, graphPath(baseDomain, *graphFormat))
+		}
+		params := flagParameters(fs)
+		params["base-domain"] = baseDomain
+		if err := writeManifest(baseDomain, params, files, *signKey); err != nil {
+			logger.Fatalf("Failed to write manifest: %v\n", err)
+		}
+	}
+
+	if mailer != nil {
+		to := reportRecipients(emailReport)
+		attachments := []string{exportPath(baseDomain, *format)}
+		if *writePDF {
+			attachments = append(attachments, exportPath(baseDomain, "pdf"))
+		}
+		if err := sendReport(mailer, to, baseDomain, all, attachments); err != nil {
+			logger.Fatalf("Failed to email report: %v\n", err)
+		}
+		logger.Printf("Report emailed to %s\n", strings.Join(to, ", "))
+	}
+}
+
+// sweepFlags are the flags of the default sweep that are not package
+// variables.
+type sweepFlags struct {
+	format            *string
+	writePDF          *bool
+	graphFormat       *string
+	writeManifestFile *bool
+	signKey           *string
+}
+
+// newSweepFlags defines the flags of the default sweep, shared with config
+// validate.
+func newSweepFlags() (*flag.FlagSet, *sweepFlags) {
+	o := &sweepFlags{}
+	fs := flag.NewFlagSet("tls-sweep", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep [flags] <base-domain>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep bench [flags]")
+		fmt.Fprintln(fs.Output(), "       tls-sweep job create|run|status|merge [flags]")
+		fmt.Fprintln(fs.Output(), "       tls-sweep coordinator [flags] <base-domain>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep worker --coordinator <url> [flags]")
+		fmt.Fprintln(fs.Output(), "       tls-sweep consume --nats <url>|--redis <url> [flags]")
+		fmt.Fprintln(fs.Output(), "       tls-sweep daemon [flags] <base-domain>...")
+		fmt.Fprintln(fs.Output(), "       tls-sweep check --input <file> [--fail-on <checks>]")
+		fmt.Fprintln(fs.Output(), "       tls-sweep schema [--version]")
+		fmt.Fprintln(fs.Output(), "       tls-sweep verify [--key public.pem] <manifest>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep retry [flags] <results.json>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep merge -o <merged.json> <results.json>...")
+		fmt.Fprintln(fs.Output(), "       tls-sweep audit [--since <time>] <audit-log>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep resolve [flags] <base-domain>|--input <domains.txt>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep handshake [flags] <resolved.ndjson>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep enrich [flags] <results.json>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep certs [flags] <cert-store>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep config validate [daemon] [flags] <base-domain>...")
+		fmt.Fprintln(fs.Output(), "       tls-sweep version")
+		fmt.Fprintln(fs.Output(), "       tls-sweep self-update [--check] [--key release.pem]")
+		fmt.Fprintln(fs.Output(), "       tls-sweep completion bash|zsh|fish")
+		fmt.Fprintln(fs.Output(), "       tls-sweep man")
+		fs.PrintDefaults()
+	}
+	registerScanFlags(fs)
+	registerResultFlags(fs)
+	registerScoreFlags(fs)
+	registerScreenshotFlags(fs)
+	fs.BoolVar(&certReuse, "cert-reuse", false, "count the other domains serving the same public key into SharedWith (holds results until the sweep ends)")
+	fs.BoolVar(&trustMatrix, "trust-matrix", false, "validate every chain against each embedded trust store and record the verdicts in Trust")
+	fs.Func("trust-store", "add a trust store as name=bundle.pem to the matrix; repeatable, implies --trust-matrix", addTrustStore)
+	fs.StringVar(&enrichSource, "enrich", "", "add open ports, services and other certificates of each OK result's IP from shodan ($SHODAN_API_KEY) or censys ($CENSYS_API_ID, $CENSYS_API_SECRET)")
+	fs.BoolVar(&scanIDN, "idn", false, "also sweep the internationalized (xn--) TLDs")
+	fs.BoolVar(&tuiMode, "tui", false, "follow the sweep in a terminal UI with a filterable results table; the export is written on exit")
+	fs.BoolVar(&mxMode, "mx", false, "probe each domain's MX hosts on ports 25, 465 and 587 instead of HTTPS")
+	o.format = fs.String("format", "csv", "export format: csv, json, ndjson, xlsx or markdown")
+	o.writePDF = fs.Bool("pdf", false, "also write <base-domain>.pdf, a summary report for non-technical readers")
+	registerPDFFlags(fs)
+	o.graphFormat = fs.String("graph", "", "also write a domain/certificate/issuer/IP/ASN graph: dot or graphml")
+	o.writeManifestFile = fs.Bool("manifest", false, "write <base-domain>.manifest.json with the SHA-256 of every output file")
+	o.signKey = fs.String("sign-key", "", "PEM private key (Ed25519, ECDSA or RSA) the manifest is signed with; implies --manifest")
+	fs.StringVar(&emailReport, "email-report", "", "comma-separated addresses the report is mailed to when the scan ends")
+	fs.StringVar(&smtpConfigPath, "smtp-config", "smtp.json", "JSON file with the SMTP settings for --email-report")
+	fs.StringVar(&assetsFile, "assets", "", "CSV of expected domain,owner,notes to reconcile the results against")
+	fs.Func("only", "only export results matching this filter, e.g. status=OK, 'expiry<30d' or 'issuer~Let'; repeatable", addFilter)
+	fs.StringVar(&monitorFrom, "monitor-from", "", "only re-scan the domains that were OK in this JSON or NDJSON export, skipping TLD expansion")
+	fs.StringVar(&sampleSpec, "sample", "", "only scan a random subset of the targets, a share such as 5% or a number, as a quick canary before a full sweep")
+	fs.BoolVar(&planOnly, "plan", false, "print the worst-case connection count and duration of the sweep, and exit without scanning")
+	fs.StringVar(&budgetSpec, "budget", "", "down-scope the sweep by sampling so that its worst case fits, e.g. connections=10000,duration=20m")
+	fs.BoolVar(&forceRefresh, "force-tld-refresh", false, "ignore the cached TLD list and fetch it from IANA")
+	fs.StringVar(&outputDir, "output", outputDir, "directory the export and every other output file are written to, or - to write the export to stdout and logs to stderr")
+	fs.StringVar(&pprofAddr, "pprof", "", "serve net/http/pprof on this address (e.g. localhost:6060)")
+	fs.StringVar(&logLevel, "log-level", "info", "log level: info or debug")
+	fs.DurationVar(&statsInterval, "stats-interval", 30*time.Second, "how often runtime stats are logged at debug level")
+
+	return fs, o
+}
+
+// registerScanFlags binds the flags that tune how targets are probed. They
+// are shared by the default sweep and the job subcommands.
+func registerScanFlags(fs *flag.FlagSet) {
+	fs.IntVar(&maxWorkers, "workers", maxWorkers, "number of concurrent scan workers")
+	fs.IntVar(&maxPerHost, "max-per-host", 0, "max simultaneous connections to one target IP (0 = unlimited)")
+	fs.IntVar(&maxDNSLookups, "max-dns-lookups", 0, "max concurrent DNS lookups across all workers (0 = unlimited)")
+	fs.Func("profile", "protocol to probe: "+profileNames()+" (default https)", setProfile)
+	fs.Func("client-hello", "ClientHello fingerprint to present: "+clientHelloNames()+", or custom:SUITE,... (default crypto/tls)", setClientHello)
+	fs.Func("tls-min", "lowest TLS version to offer: 1.0, 1.1, 1.2 or 1.3", tlsVersionFlag(&scanTLSMin))
+	fs.Func("tls-max", "highest TLS version to offer: 1.0, 1.1, 1.2 or 1.3", tlsVersionFlag(&scanTLSMax))
+	fs.StringVar(&torProxy, "tor-proxy", torProxy, "Tor SOCKS5 proxy .onion targets are probed through")
+	fs.BoolVar(&probeInsecure, "probe-insecure", false, "also send every OK IP a TLS 1.2 ClientHello to detect missing secure renegotiation, heartbeats, TLS compression and deprecated extensions")
+	fs.StringVar(&sniFuzz, "sni-fuzz", "", "also handshake with every OK IP under these comma-separated server names ({domain} is the target, - no SNI) and record those answered with another certificate in SNIVariants")
+	fs.Func("region-anchor", "estimate the region of OK results from their round trip against this host of known location, as name=host:port; repeatable", addRegionAnchor)
+	fs.BoolVar(&probeQUIC, "quic", false, "also handshake over QUIC (HTTP/3) and compare its certificate with the TCP one")
+	fs.DurationVar(&precheckTimeout, "precheck", 0, "TCP-connect every target with this short timeout first and only scan those that answer (0 = off)")
+	fs.IntVar(&precheckWorkers, "precheck-workers", 0, "concurrent precheck connects (0 = 8 × --workers)")
+	fs.DurationVar(&tcpKeepAlive, "tcp-keepalive", tcpKeepAlive, "interval of TCP keepalive probes on scan connections (0 = off)")
+	fs.BoolVar(&tcpFastOpen, "tcp-fastopen", false, "use TCP Fast Open for scan connections where the kernel supports it (Linux)")
+	fs.IntVar(&scanRetries, "retries", 0, "repeat a failed scan up to this many times")
+	fs.StringVar(&errorLogPath, "error-log", "", "append every failed attempt, with its underlying error, to this NDJSON file")
+	fs.BoolVar(&fetchFavicons, "favicons", false, "fetch /favicon.ico over each TLS connection and record its Shodan-style hash")
+	fs.IntVar(&maxRedirects, "follow-redirects", 0, "request https://<domain>/ of every OK result and follow up to this many redirects, recording each hop's status and certificate in Redirects (0 = off)")
+	fs.Func("template", "generate targets in this shape instead of {base}.{tld}, e.g. {base}-login.{tld} or {base}shop.{tld}; repeatable", addTemplate)
+	fs.BoolVar(&localTimes, "local-time", false, "write ValidTo, NotBefore and ScannedAt in the local time zone instead of UTC")
+	registerFetchFlags(fs)
+}
+
+// expandTargets is baseDomain under every TLD, in the shape of every
+// --template, each target once.
+func expandTargets(baseDomain string, tlds []string) []string {
+	return expandTargetsWith(baseDomain, tlds, targetTemplates)
+}
+
+// expandTargetsWith is expandTargets for templates other than --template.
+func expandTargetsWith(baseDomain string, tlds, templates []string) []string {
+	domains, removed := dedupeTargets(expandTemplates(baseDomain, tlds, templates))
+	if removed > 0 {
+		logger.Printf("Removed %d duplicate targets\n", removed)
+	}
+	return domains
+}
+
+// sweep scans domains with s.workerCount() workers, sending every result to
+// results and closing it when done. Cancelling ctx stops handing out new
+// domains; in-flight scans still complete and are delivered.
+func sweep(ctx context.Context, s *scanner, domains []string, results chan<- ScanResult) {
+	runWorkers(s, results, func(tasks chan<- scanTask) {
+		if s.precheck > 0 && !s.mx {
+			s.precheckStage(ctx, domains, tasks, results)
+			return
+		}
+		for _, domain := range domains {
+			if !feedTask(ctx, tasks, scanTask{domain: domain}) {
+				return
+			}
+		}
+	})
+}
+
+// runWorkers scans the tasks feed sends on s.workerCount() workers into
+// results, and closes results once they are all done.
+func runWorkers(s *scanner, results chan<- ScanResult, feed func(tasks chan<- scanTask)) {
+	tasks := make(chan scanTask)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workerCount(); i++ {
+		wg.Add(1)
+		go worker(s, tasks, results, &wg)
+	}
+	feed(tasks)
+	close(tasks)
 	wg.Wait()
 	close(results)
+}
 
-	exportToCsv(baseDomain, results)
+// feedTask hands t to a worker once no export is retrying, and reports
+// false when ctx was done first.
+func feedTask(ctx context.Context, tasks chan<- scanTask, t scanTask) bool {
+	exportPause.wait(ctx)
+	select {
+	case tasks <- t:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
-func exportToCsv(baseDomain string, results chan ScanResult) {
-	fileName := fmt.Sprintf("%s.csv", baseDomain)
-	file, err := os.Create(fileName)
-	if err != nil {
-		logger.Printf("Failed to create file: %v\n", err)
-		return
+// parseArgs parses fs and returns the positional arguments, allowing flags to
+// appear after them (e.g. `tls-sweep amazon --force-tld-refresh`).
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func debugf(format string, v ...any) {
+	if logLevel == "debug" {
+		logger.Output(2, "[debug] "+fmt.Sprintf(format, v...))
+	}
+}
+
+// exportPath is the file the sweep of baseDomain is exported to.
+func exportPath(baseDomain, format string) string {
+	if format == "markdown" {
+		format = "md"
 	}
-	defer file.Close()
+	return outputPath(fmt.Sprintf("%s.%s", baseDomain, format))
+}
+
+// outputDir is --output, the directory every file of a sweep is written to.
+var outputDir = "."
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// outputPath is name in --output, or - for stdout under --output -.
+func outputPath(name string) string {
+	if outputDir == "-" {
+		return "-"
+	}
+	return filepath.Join(outputDir, name)
+}
 
-	writer.Write([]string{"Domain", "IP", "Status", "Subject", "Issuer", "ValidTo"})
+// createOutput creates the output file path, which only appears once
+// closed; - is stdout.
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return createAtomic(path, 0o644)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// resultColumns heads the tabular exports; resultRow fills them.
+var resultColumns = []string{"Domain", "IP", "Family", "Status", "Subject", "Issuer", "ValidTo", "Score", "Note", "Screenshot", "FaviconHash", "QUIC", "MX", "Port", "TLSVersion", "CipherSuite", "Curve", "SerialNumber", "NotBefore", "SPKI", "SharedWith", "DomainUnicode", "ClientHello", "ChainValidTo", "ChainLimitedBy", "LegacyChain", "Trust", "OpenPorts", "Services", "HostOrg", "OtherCerts", "ThreatMatch", "Owner", "Ticket", "Annotation", "ScannedAt", "RTT", "EstimatedRegion", "SNIVariants", "InsecureRenegotiation", "Heartbeat", "Compression", "DeprecatedExtensions", "MustStaple", "EKU", "CertType", "ValidityDays", "ValidityViolation", "Redirects", "FinalURL"}
+
+func resultRow(res ScanResult) []string {
+	return []string{res.Domain, res.IP, res.Family, res.Status, res.Subject, res.Issuer, res.ValidTo, strconv.Itoa(res.Score), res.Note, res.Screenshot, res.FaviconHash, res.QUIC, res.MX, res.Port, res.TLSVersion, res.CipherSuite, res.Curve, res.SerialNumber, res.NotBefore, res.SPKI, strconv.Itoa(res.SharedWith), res.DomainUnicode, res.ClientHello, res.ChainValidTo, res.ChainLimitedBy, res.LegacyChain, res.Trust, res.OpenPorts, res.Services, res.HostOrg, strconv.Itoa(res.OtherCerts), res.ThreatMatch, res.Owner, res.Ticket, res.Annotation, res.ScannedAt, strconv.Itoa(res.RTT), res.EstimatedRegion, res.SNIVariants, boolCell(res.InsecureRenegotiation), boolCell(res.Heartbeat), boolCell(res.Compression), res.DeprecatedExtensions, res.MustStaple, res.EKU, res.CertType, strconv.Itoa(res.ValidityDays), res.ValidityViolation, redirectCell(res.Redirects), res.FinalURL}
+}
+
+func exportToCsv(baseDomain string, results chan ScanResult) {
+	fileName := exportPath(baseDomain, "csv")
+	sink := createSink(fileName, "csv", baseDomain, func(r ScanResult) []byte { return csvRecord(resultRow(r)) })
+	sink.writeBytes(csvRecord(resultColumns))
 
 	var DomainsNotFound []string
 	for res := range results {
 		if res.Status == "NXDOMAIN" {
-			// After changing the logger implementation, this line may be a debug log
-			// logger.Printf("Domain %s does not exist\n", res.Domain)
+			debugf("Domain %s does not exist", res.Domain)
 			DomainsNotFound = append(DomainsNotFound, res.Domain)
 			continue // skip non-existent domains
 		}
-		writer.Write([]string{res.Domain, res.IP, res.Status, res.Subject, res.Issuer, res.ValidTo})
+		sink.send(res)
 	}
 
 	logger.Printf("Found %d domains that do not exist: ", len(DomainsNotFound))
-	logger.Printf("Domains not found: ", strings.Join(DomainsNotFound, ", "))
+	logger.Printf("Domains not found: %s", strings.Join(DomainsNotFound, ", "))
 
-	logger.Printf("Results exported to %s\n", fileName)
+	if sink.close() {
+		logger.Printf("Results exported to %s\n", fileName)
+	}
+}
+
+// csvRecord is one CSV line.
+func csvRecord(fields []string) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(fields)
+	w.Flush()
+	return b.Bytes()
 }
 
 func loadTLDs(useCache bool) ([]string, error) {
@@ -111,7 +762,8 @@ func loadTLDs(useCache bool) ([]string, error) {
 	var tlds []string
 	var err error
 
-	if useCache {
+	cacheFile := filepath.Join(cacheRoot(), "tlds.cache")
+	if useCache && !noCache {
 		if _, err := os.Stat(cacheFile); err == nil {
 			logger.Println("Loading TLDs from cache...")
 			file, err := os.Open(cacheFile)
@@ -132,13 +784,16 @@ func loadTLDs(useCache bool) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		if noCache {
+			return tlds, nil
+		}
 
-		if err := os.MkdirAll(cacheDir, os.ModePerm); err == nil {
-			file, err := os.Create(cacheFile)
-			if err == nil {
-				defer file.Close()
-				file.WriteString(strings.Join(tlds, cache_sep))
+		if err := os.MkdirAll(filepath.Dir(cacheFile), os.ModePerm); err == nil {
+			// A truncated cache would silently shorten every later sweep.
+			if err := writeFileAtomic(cacheFile, []byte(strings.Join(tlds, cache_sep)), 0o644); err == nil {
 				logger.Println("TLDs cached.")
+			} else {
+				debugf("Not caching TLDs: %v", err)
 			}
 		}
 	}
@@ -148,13 +803,11 @@ func loadTLDs(useCache bool) ([]string, error) {
 func fetchTLDs() ([]string, error) {
 	var tlds []string
 
-	resp, err := http.Get(ianaTLDListURL)
+	// The TLD list has its own cache, see loadTLDs.
+	body, err := metadata().get(ianaTLDListURL, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch TLDs: %v", err)
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 	lines := strings.Split(string(body), "\n")
 	for _, line := range lines[1:] {
 		tld := strings.ToLower(strings.TrimSpace(line))
@@ -165,44 +818,358 @@ func fetchTLDs() ([]string, error) {
 	return tlds, nil
 }
 
-func worker(tasks <-chan string, results chan<- ScanResult, wg *sync.WaitGroup) {
+// scanTask is a domain to scan, with its addresses when the precheck
+// already resolved it.
+type scanTask struct {
+	domain string
+	ips    []string
+}
+
+func worker(s *scanner, tasks <-chan scanTask, results chan<- ScanResult, wg *sync.WaitGroup) {
 	defer wg.Done()
-	for domain := range tasks {
-		result := scanDomain(domain)
-		results <- result
+	for t := range tasks {
+		s.runTask(t, results)
 	}
 }
 
-func scanDomain(domain string) ScanResult {
-	ips, err := net.LookupHost(domain)
-	if err != nil || len(ips) == 0 {
-		return ScanResult{Domain: domain, IP: "-", Status: "NXDOMAIN"}
+// runTask scans t, retrying failures, and delivers its result to results,
+// or one result per MX host and port with --mx.
+func (s *scanner) runTask(t scanTask, results chan<- ScanResult) {
+	defer scanned.Add(1)
+	sp := s.span.child("scan target", stringAttr("tls_sweep.domain", t.domain))
+	if s.mx {
+		for _, r := range s.scanMX(t.domain) {
+			s.deliver(r, 1, results)
+		}
+		sp.end()
+		return
 	}
-	ip := ips[0]
 
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", domain+":443", &tls.Config{
-		InsecureSkipVerify: true,
-		ServerName:         domain,
-	})
+	var r ScanResult
+	attempt := 1
+	for ; ; attempt++ {
+		ips := t.ips
+		if attempt > 1 {
+			ips = nil
+		}
+		r = s.tracedScan(sp, t.domain, ips)
+		if !isFailure(r.Status) || attempt > s.retries {
+			break
+		}
+		s.errLog.record(r, attempt)
+		time.Sleep(time.Duration(attempt) * retryBackoff)
+	}
+	sp.endResult(r)
+	s.deliver(r, attempt, results)
+}
+
+// deliver sends the final result of a scan, attempt being how many it
+// took, to results: into the error log and the target counts, labelled.
+func (s *scanner) deliver(r ScanResult, attempt int, results chan<- ScanResult) {
+	s.errLog.record(r, attempt)
+	warnFDExhausted(r, s.workerCount())
+	tracing.countTarget(r.Status)
+	results <- s.label(r)
+}
+
+// scanner probes a single domain. The resolver and port are injectable so
+// that the bench subcommand can point it at a local test server.
+type scanner struct {
+	port       string
+	timeout    time.Duration
+	lookupHost func(host string) ([]string, error)
+	// torProxy is the SOCKS5 proxy for .onion targets.
+	torProxy string
+	// dialContext is the shared newScanDialer, and a plain net.Dialer when
+	// nil.
+	dialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// hostLimit is keyed by IP so that many domains parked on the same
+	// address never exceed --max-per-host connections to it.
+	hostLimit *keyedLimiter
+	dnsLimit  *keyedLimiter
+	favicons  bool
+	quic      bool
+
+	// preamble runs the protocol-specific exchange before the handshake.
+	preamble func(conn net.Conn) (net.Conn, error)
+	// clientAuth reports the certificate of servers that then refuse the
+	// handshake for want of a client certificate.
+	clientAuth bool
+	// hello shapes the ClientHello of every TCP handshake, within the
+	// tlsMin and tlsMax versions when set.
+	hello          clientHello
+	tlsMin, tlsMax uint16
+
+	// retries is how often a failed scan is repeated; every failed
+	// attempt goes to errLog, which may be nil.
+	retries int
+	errLog  *errorLog
+
+	// workers is the number of concurrent scans, --workers unless the
+	// open file limit holds fewer; see workerCount.
+	workers int
+
+	// precheck, when set, is the connect timeout of a fast TCP pass that
+	// weeds out dead hosts before they cost a full timeout each.
+	precheck        time.Duration
+	precheckWorkers int
+
+	// mx switches to probing the domain's mail servers on mxPorts.
+	mx       bool
+	mxPorts  []mailPort
+	lookupMX func(domain string) ([]*net.MX, error)
+
+	// regions, when set, fills EstimatedRegion from the round trip.
+	regions *regionEstimator
+	// sniFuzz is --sni-fuzz, the other server names tried on OK IPs.
+	sniFuzz string
+	// insecure probes OK IPs for legacy handshake features.
+	insecure bool
+	// redirects is how many redirects of an OK HTTPS result are followed.
+	redirects int
+
+	// span, when tracing, is the parent of every target's span.
+	span *span
+}
+
+func newScanner() *scanner {
+	workers, precheck := fitWorkersToFDLimit(maxWorkers, precheckWorkers)
+	p := profiles[scanProfile]
+	return &scanner{
+		workers:     workers,
+		port:        p.port,
+		preamble:    p.preamble,
+		clientAuth:  p.clientAuth,
+		hello:       scanClientHello,
+		tlsMin:      scanTLSMin,
+		tlsMax:      scanTLSMax,
+		timeout:     5 * time.Second,
+		lookupHost:  net.LookupHost,
+		torProxy:    torProxy,
+		dialContext: newScanDialer().DialContext,
+		hostLimit:   newKeyedLimiter(maxPerHost),
+		dnsLimit:    newKeyedLimiter(maxDNSLookups),
+		favicons:    fetchFavicons && scanProfile == "https",
+		quic:        probeQUIC && scanProfile == "https",
+		mx:          mxMode,
+		mxPorts:     defaultMailPorts,
+		lookupMX:    net.LookupMX,
+
+		precheck:        precheckTimeout,
+		precheckWorkers: precheck,
+		retries:         scanRetries,
+		errLog:          openScanErrorLog(),
+		regions:         regionAnchors(),
+		sniFuzz:         sniFuzz,
+		insecure:        probeInsecure,
+		redirects:       followRedirectsFor(scanProfile),
+	}
+}
+
+// workerCount is s.workers, or --workers for a scanner built without one.
+func (s *scanner) workerCount() int {
+	if s.workers > 0 {
+		return s.workers
+	}
+	return maxWorkers
+}
+
+func (s *scanner) scan(domain string) ScanResult {
+	if isOnion(domain) {
+		return s.scanOnion(domain)
+	}
+	ips, failed, ok := s.resolve(domain)
+	if !ok {
+		return failed
+	}
+	return s.scanIPs(domain, ips)
+}
+
+// resolve looks domain up, or returns the result of a lookup that found
+// nothing to scan.
+func (s *scanner) resolve(domain string) ([]string, ScanResult, bool) {
+	ips, err := s.lookup(domain)
+	if err != nil {
+		return nil, ScanResult{Domain: domain, IP: "-", Status: dnsStatus(err), Err: err}, false
+	}
+	if len(ips) == 0 {
+		return nil, ScanResult{Domain: domain, IP: "-", Status: "NXDOMAIN"}, false
+	}
+	return ips, ScanResult{}, true
+}
+
+// scanIPs is scan for a domain already resolved to ips.
+func (s *scanner) scanIPs(domain string, ips []string) ScanResult {
+	start := time.Now()
+	raw, err := s.dialRace(ips, s.port)
 	if err != nil {
-		return ScanResult{Domain: domain, IP: ip, Status: "TLS ERROR"}
+		ip := "-"
+		if len(ips) > 0 {
+			ip = ips[0]
+		}
+		return ScanResult{Domain: domain, IP: ip, Status: connectStatus(err), Err: err}
+	}
+	connect := time.Since(start)
+	ip := remoteIP(raw)
+	conn, err := s.handshake(raw, domain)
+	if err != nil {
+		// A TCP connection that works followed by a stalled handshake is the
+		// usual symptom of a broken IPv6 path, so give the other family a go.
+		if others := otherFamily(ips, ipFamily(ip)); len(others) > 0 && retryOtherFamily(err) {
+			if retry, dialErr := s.dialRace(others, s.port); dialErr == nil {
+				ip = remoteIP(retry)
+				conn, err = s.handshake(retry, domain)
+			}
+		}
+		if errors.Is(err, errNoTLS) {
+			return ScanResult{Domain: domain, IP: ip, Family: ipFamily(ip), Status: "NO TLS"}
+		}
+		if authErr := (*clientAuthError)(nil); errors.As(err, &authErr) {
+			return certResult(domain, ip, authErr.chain)
+		}
+		if err != nil {
+			return ScanResult{Domain: domain, IP: ip, Family: ipFamily(ip), Status: handshakeStatus(err), Err: err}
+		}
 	}
-	defer conn.Close()
 
 	state := conn.ConnectionState()
 	if len(state.PeerCertificates) == 0 {
-		return ScanResult{Domain: domain, IP: ip, Status: "NO CERT"}
+		conn.Close()
+		return ScanResult{Domain: domain, IP: ip, Family: ipFamily(ip), Status: "NO CERT"}
 	}
 	cert := state.PeerCertificates[0]
 
-	return ScanResult{
-		Domain:  domain,
-		IP:      ip,
-		Status:  "OK",
-		Subject: certSubject(cert),
-		Issuer:  cert.Issuer.CommonName,
-		ValidTo: cert.NotAfter.Format("2006-01-02"),
+	var favicon string
+	if s.favicons {
+		if favicon, err = fetchFavicon(conn, domain, time.Now().Add(s.timeout)); err != nil {
+			debugf("No favicon for %s: %v", domain, err)
+		}
+	}
+
+	r := certResult(domain, ip, state.PeerCertificates)
+	setHandshake(&r, conn)
+	// The probes below connect to ip again, each taking a --max-per-host
+	// slot, so this connection gives its own back first.
+	conn.Close()
+	r.MustStaple = mustStaple(cert, state.OCSPResponse)
+	r.FaviconHash = favicon
+	r.RTT = millis(connect)
+	if s.quic {
+		r.QUIC = s.probeQUIC(ip, domain, cert)
+	}
+	if s.regions != nil {
+		s.estimateRegion(&r, connect)
+	}
+	if s.sniFuzz != "" {
+		r.SNIVariants = s.fuzzSNI(domain, ip, cert)
+	}
+	if s.insecure {
+		s.checkInsecure(&r)
+	}
+	if s.redirects > 0 {
+		r.Redirects, r.FinalURL = s.followRedirects(domain, ip)
+	}
+	return r
+}
+
+// label adds the scan-wide annotations to a finished result.
+func (s *scanner) label(r ScanResult) ScanResult {
+	r = withUnicode(r)
+	r.ClientHello = s.hello.name
+	r.ScannedAt = timestamp(time.Now())
+	return r
+}
+
+// dnsStatus classifies a failed lookup. Only an authoritative "no such
+// host" is final; timeouts and SERVFAIL are failures worth retrying.
+func dnsStatus(err error) string {
+	if fdExhausted(err) {
+		return "FD EXHAUSTED"
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return "NXDOMAIN"
+	}
+	return "DNS ERROR"
+}
+
+// retryOtherFamily reports whether a failed handshake is worth retrying
+// over the other address family. A server that answered but declined TLS or
+// wanted a client certificate would only do so again.
+func retryOtherFamily(err error) bool {
+	var authErr *clientAuthError
+	return !errors.Is(err, errNoTLS) && !errors.As(err, &authErr)
+}
+
+// certResult is the OK result for the chain served by ip, leaf first.
+func certResult(domain, ip string, chain []*x509.Certificate) ScanResult {
+	cert := chain[0]
+	r := ScanResult{
+		Domain:    domain,
+		IP:        ip,
+		Family:    ipFamily(ip),
+		Status:    "OK",
+		Subject:   certSubject(cert),
+		Issuer:    cert.Issuer.CommonName,
+		ValidTo:   timestamp(cert.NotAfter),
+		NotBefore: timestamp(cert.NotBefore),
+		Chain:     chain,
+
+		SerialNumber: fmt.Sprintf("%x", cert.SerialNumber),
+		SPKI:         spkiHash(cert),
+	}
+	setChainValidity(&r, chain)
+	setCertType(&r, cert)
+	r.LegacyChain = legacyChain(chain, mozillaRoots(), time.Now())
+	return r
+}
+
+// handshake runs the TLS client handshake on raw, closing it on failure.
+func (s *scanner) handshake(raw net.Conn, domain string) (*tls.Conn, error) {
+	return s.handshakeVersion(raw, domain, 0)
+}
+
+// handshakeVersion is handshake pinned to one protocol version, or using
+// the crypto/tls defaults when version is 0.
+func (s *scanner) handshakeVersion(raw net.Conn, domain string, version uint16) (*tls.Conn, error) {
+	raw.SetDeadline(time.Now().Add(s.timeout))
+	if s.preamble != nil {
+		wrapped, err := s.preamble(raw)
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+		raw = wrapped
+	}
+	raw = &helloRecorder{Conn: raw}
+	// The chain is captured as soon as it arrives, before the server gets a
+	// chance to refuse our (empty) client certificate.
+	var chain []*x509.Certificate
+	config := &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         domain,
+		MinVersion:         version,
+		MaxVersion:         version,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			for _, raw := range rawCerts {
+				if cert, err := x509.ParseCertificate(raw); err == nil {
+					chain = append(chain, cert)
+				}
+			}
+			return nil
+		},
+	}
+	s.shape(config)
+	conn := tls.Client(raw, config)
+	if err := conn.Handshake(); err != nil {
+		conn.Close()
+		if s.clientAuth && len(chain) > 0 {
+			return nil, &clientAuthError{chain: chain, err: err}
+		}
+		return nil, err
 	}
+	return conn, nil
 }
 
 func certSubject(cert *x509.Certificate) string {
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifest is tamper-evident audit evidence for one sweep: what was run,
+// when, and the digest of every file it produced.
+type manifest struct {
+	SchemaVersion string            `json:"schema_version"`
+	CreatedAt     time.Time         `json:"created_at"`
+	BaseDomain    string            `json:"base_domain"`
+	Parameters    map[string]string `json:"parameters"`
+	Files         []manifestFile    `json:"files"`
+}
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+func manifestPath(baseDomain string) string {
+	return outputPath(fmt.Sprintf("%s.manifest.json", baseDomain))
+}
+
+// flagParameters returns the flags explicitly set on fs.
+func flagParameters(fs *flag.FlagSet) map[string]string {
+	params := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { params[f.Name] = f.Value.String() })
+	return params
+}
+
+func hashFile(path string) (manifestFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	return manifestFile{Path: path, SHA256: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+// writeManifest records files in <base-domain>.manifest.json and, when
+// keyFile is set, signs it into <manifest>.sig.
+func writeManifest(baseDomain string, params map[string]string, files []string, keyFile string) error {
+	m := manifest{
+		SchemaVersion: resultSchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		BaseDomain:    baseDomain,
+		Parameters:    params,
+	}
+	path := manifestPath(baseDomain)
+	for _, f := range files {
+		mf, err := hashFile(f)
+		if err != nil {
+			return err
+		}
+		// Paths are relative to the manifest, in slash form, so that the
+		// directory verifies wherever and on whichever OS it is copied to.
+		if rel, err := filepath.Rel(filepath.Dir(path), f); err == nil {
+			mf.Path = filepath.ToSlash(rel)
+		}
+		m.Files = append(m.Files, mf)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	logger.Printf("Manifest written to %s\n", path)
+
+	if keyFile == "" {
+		return nil
+	}
+	key, err := loadSigningKey(keyFile)
+	if err != nil {
+		return err
+	}
+	sig, err := signManifest(key, append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path+".sig", []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0o644); err != nil {
+		return err
+	}
+	logger.Printf("Manifest signed into %s.sig\n", path)
+	return nil
+}
+
+func loadSigningKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM type %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: key cannot sign", path)
+	}
+	return signer, nil
+}
+
+// signManifest signs Ed25519 keys over the data itself and ECDSA or RSA
+// (PKCS #1 v1.5) keys over its SHA-256 digest.
+func signManifest(key crypto.Signer, data []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func verifySignature(pub crypto.PublicKey, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		if ed25519.Verify(pub, data, sig) {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	default:
+		return fmt.Errorf("unsupported public key %T", pub)
+	}
+	return errors.New("signature mismatch")
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported PEM type %q", path, block.Type)
+}
+
+// verifyManifest checks the manifest's signature, when pubKeyFile is set,
+// and that every file it lists is unchanged. Paths are relative to the
+// manifest.
+func verifyManifest(path, pubKeyFile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if pubKeyFile != "" {
+		pub, err := loadPublicKey(pubKeyFile)
+		if err != nil {
+			return err
+		}
+		encoded, err := os.ReadFile(path + ".sig")
+		if err != nil {
+			return err
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil {
+			return fmt.Errorf("%s.sig: %v", path, err)
+		}
+		if err := verifySignature(pub, data, sig); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	for _, f := range m.Files {
+		got, err := hashFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		if got.SHA256 != f.SHA256 {
+			return fmt.Errorf("%s: digest mismatch", f.Path)
+		}
+	}
+	return nil
+}
+
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep verify [--key public.pem] <manifest>")
+		fs.PrintDefaults()
+	}
+	pubKey := fs.String("key", "", "PEM public key or certificate the manifest signature is checked against")
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := verifyManifest(args[0], *pubKey); err != nil {
+		logger.Fatalf("Verification failed: %v\n", err)
+	}
+	logger.Printf("%s verified\n", args[0])
+}
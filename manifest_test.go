@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestSignAndVerify(t *testing.T) {
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	for name, key := range map[string]any{"ed25519": edKey, "ecdsa": ecKey, "rsa": rsaKey} {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyFile := filepath.Join(dir, name+".key")
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+		signer, _ := loadSigningKey(keyFile)
+		pubDER, _ := x509.MarshalPKIXPublicKey(signer.Public())
+		pubFile := filepath.Join(dir, name+".pub")
+		os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644)
+
+		os.WriteFile("example.csv", []byte("Domain,IP\na.example,192.0.2.1\n"), 0o644)
+		if err := writeManifest("example", map[string]string{"workers": "4"}, []string{"example.csv"}, keyFile); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := verifyManifest("example.manifest.json", pubFile); err != nil {
+			t.Errorf("%s: fresh manifest: %v", name, err)
+		}
+
+		os.WriteFile("example.csv", []byte("Domain,IP\na.example,192.0.2.66\n"), 0o644)
+		if err := verifyManifest("example.manifest.json", pubFile); err == nil {
+			t.Errorf("%s: tampered export verified", name)
+		}
+
+		data, _ := os.ReadFile("example.manifest.json")
+		os.WriteFile("example.manifest.json", append(data, ' '), 0o644)
+		if err := verifyManifest("example.manifest.json", pubFile); err == nil {
+			t.Errorf("%s: tampered manifest verified", name)
+		}
+	}
+}
+
+func TestManifestInOutputDir(t *testing.T) {
+	outputDir = filepath.Join(t.TempDir(), "reports")
+	defer func() { outputDir = "." }()
+	os.MkdirAll(outputDir, 0o755)
+
+	export := exportPath("example", "csv")
+	if export != filepath.Join(outputDir, "example.csv") {
+		t.Errorf("exportPath = %s", export)
+	}
+	os.WriteFile(export, []byte("Domain\n"), 0o644)
+	if err := writeManifest("example", nil, []string{export}, ""); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(manifestPath("example"))
+	if !strings.Contains(string(data), `"path": "example.csv"`) {
+		t.Errorf("manifest paths are not relative to it:\n%s", data)
+	}
+	if err := verifyManifest(manifestPath("example"), ""); err != nil {
+		t.Error(err)
+	}
+}
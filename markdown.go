@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportToMarkdown writes <base-domain>.md: a one-paragraph summary and a
+// table of the domains that answered, short enough to paste into an issue
+// or post to a chat channel.
+func exportToMarkdown(baseDomain string, results chan ScanResult) {
+	fileName := exportPath(baseDomain, "markdown")
+	var all []ScanResult
+	for res := range results {
+		all = append(all, res)
+	}
+	var doc bytes.Buffer
+	writeMarkdown(&doc, baseDomain, all, time.Now())
+	sink := createSink(fileName, "markdown", baseDomain, nil)
+	if !sink.writeBytes(doc.Bytes()) {
+		sink.spoolAll(all)
+	}
+	if sink.close() {
+		logger.Printf("Results exported to %s\n", fileName)
+	}
+}
+
+var markdownEscape = strings.NewReplacer("|", `\|`, "\n", " ", "\r", "")
+
+func writeMarkdown(w io.Writer, baseDomain string, all []ScanResult, now time.Time) error {
+	var rows []ScanResult
+	byStatus := make(map[string]int)
+	notFound, expired, expiring := 0, 0, 0
+	for _, r := range all {
+		if r.Status == "NXDOMAIN" {
+			notFound++
+			continue
+		}
+		byStatus[r.Status]++
+		if t, ok := parseValidTo(r.ValidTo); ok {
+			switch {
+			case t.Before(now):
+				expired++
+			case t.Before(now.AddDate(0, 0, 30)):
+				expiring++
+			}
+		}
+		rows = append(rows, r)
+	}
+	// Failures first: they are what the reader has to act on.
+	sort.SliceStable(rows, func(i, j int) bool {
+		if fi, fj := isFailure(rows[i].Status), isFailure(rows[j].Status); fi != fj {
+			return fi
+		}
+		return rows[i].Domain < rows[j].Domain
+	})
+
+	statuses := make([]string, 0, len(byStatus))
+	for s := range byStatus {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	var counts []string
+	for _, s := range statuses {
+		counts = append(counts, fmt.Sprintf("%d %s", byStatus[s], s))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "## TLS sweep: %s\n\n", markdownEscape.Replace(baseDomain))
+	fmt.Fprintf(&b, "Scanned %d domains on %s", len(all), now.UTC().Format("2006-01-02"))
+	if len(counts) > 0 {
+		fmt.Fprintf(&b, ": %s", strings.Join(counts, ", "))
+	}
+	fmt.Fprintf(&b, "; %d do not exist.", notFound)
+	if expired > 0 || expiring > 0 {
+		fmt.Fprintf(&b, " **%d expired, %d expiring within 30 days.**", expired, expiring)
+	}
+	b.WriteString("\n")
+
+	if len(rows) > 0 {
+		b.WriteString("\n| Domain | IP | Status | Issuer | Valid to | Score |\n")
+		b.WriteString("|--------|----|--------|--------|----------|-------|\n")
+		for _, r := range rows {
+			validTo := r.ValidTo
+			if t, ok := parseValidTo(validTo); ok && t.Before(now) {
+				validTo = "**" + validTo + " (expired)**"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n",
+				markdownEscape.Replace(displayDomain(r.Domain)), markdownEscape.Replace(r.IP), markdownEscape.Replace(r.Status),
+				markdownEscape.Replace(r.Issuer), validTo, strconv.Itoa(r.Score))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
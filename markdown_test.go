@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	results := []ScanResult{
+		{Domain: "b.example", IP: "192.0.2.1", Status: "OK", Issuer: "R|11", ValidTo: "2024-01-01", Score: 45},
+		{Domain: "a.example", IP: "192.0.2.2", Status: "OK", Issuer: "DigiCert", ValidTo: "2024-05-10"},
+		{Domain: "c.example", IP: "192.0.2.3", Status: "TLS ERROR"},
+		{Domain: "gone.example", IP: "-", Status: "NXDOMAIN"},
+	}
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, "example", results, now); err != nil {
+		t.Fatal(err)
+	}
+	want := `## TLS sweep: example
+
+Scanned 4 domains on 2024-05-01: 2 OK, 1 TLS ERROR; 1 do not exist. **1 expired, 1 expiring within 30 days.**
+
+| Domain | IP | Status | Issuer | Valid to | Score |
+|--------|----|--------|--------|----------|-------|
+| c.example | 192.0.2.3 | TLS ERROR |  |  | 0 |
+| a.example | 192.0.2.2 | OK | DigiCert | 2024-05-10 | 0 |
+| b.example | 192.0.2.1 | OK | R\|11 | **2024-01-01 (expired)** | 45 |
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep merge -o <merged.json> <results.json|results.ndjson>...")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "file the merged results are written to, as NDJSON when it ends in .ndjson")
+	inputs := parseArgs(fs, args)
+	if len(inputs) == 0 || *output == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var sets [][]ScanResult
+	total := 0
+	for _, path := range inputs {
+		results, err := loadExport(path)
+		if err != nil {
+			logger.Fatalf("Failed to load results: %v\n", err)
+		}
+		sets = append(sets, results)
+		total += len(results)
+	}
+	merged := mergeResults(sets...)
+	if err := writeExport(*output, merged); err != nil {
+		logger.Fatalf("Failed to write %s: %v\n", *output, err)
+	}
+	logger.Printf("Merged %d results from %d files into %d targets, written to %s\n", total, len(inputs), len(merged), *output)
+}
+
+// mergeKey identifies a target: the domain, and with --mx the mail host,
+// on a port.
+type mergeKey struct{ domain, mx, port string }
+
+// mergeResults keeps the newest result per target by ScannedAt, in the
+// order targets first appear. On a tie, or without timestamps, the later
+// set wins.
+func mergeResults(sets ...[]ScanResult) []ScanResult {
+	index := make(map[mergeKey]int)
+	var merged []ScanResult
+	for _, results := range sets {
+		for _, r := range results {
+			k := mergeKey{r.Domain, r.MX, r.Port}
+			i, ok := index[k]
+			if !ok {
+				index[k] = len(merged)
+				merged = append(merged, r)
+				continue
+			}
+			if !scannedAt(r).Before(scannedAt(merged[i])) {
+				merged[i] = r
+			}
+		}
+	}
+	return merged
+}
+
+// scannedAt is when r was taken, or the zero time for results exported
+// before ScannedAt existed.
+func scannedAt(r ScanResult) time.Time {
+	t, _ := time.Parse(time.RFC3339, r.ScannedAt)
+	return t
+}
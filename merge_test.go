@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeResults(t *testing.T) {
+	a := []ScanResult{
+		{Domain: "a.example", Status: "OK", ScannedAt: "2026-10-01T10:00:00Z"},
+		{Domain: "b.example", Status: "REFUSED", ScannedAt: "2026-10-01T10:00:00Z"},
+		{Domain: "c.example", MX: "mx1.c.example", Port: "25", Status: "OK"},
+	}
+	b := []ScanResult{
+		{Domain: "b.example", Status: "OK", ScannedAt: "2026-10-02T10:00:00Z"},
+		{Domain: "a.example", Status: "RESET", ScannedAt: "2026-09-30T10:00:00Z"},
+		{Domain: "c.example", MX: "mx1.c.example", Port: "465", Status: "OK"},
+		{Domain: "c.example", MX: "mx1.c.example", Port: "25", Status: "TLS ERROR"},
+	}
+	merged := mergeResults(a, b)
+	if len(merged) != 4 {
+		t.Fatalf("got %d results: %+v", len(merged), merged)
+	}
+	for i, want := range []struct{ domain, port, status string }{
+		{"a.example", "", "OK"},          // the other record is older
+		{"b.example", "", "OK"},          // newer
+		{"c.example", "25", "TLS ERROR"}, // no timestamps: the later set wins
+		{"c.example", "465", "OK"},
+	} {
+		if r := merged[i]; r.Domain != want.domain || r.Port != want.port || r.Status != want.status {
+			t.Errorf("merged[%d] = %s:%s %s, want %+v", i, r.Domain, r.Port, r.Status, want)
+		}
+	}
+}
+
+func TestMergeExports(t *testing.T) {
+	dir := t.TempDir()
+	a, b, out := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.ndjson"), filepath.Join(dir, "merged.json")
+	writeExport(a, []ScanResult{{Domain: "a.example", Status: "OK", ScannedAt: "2026-10-01T10:00:00Z"}})
+	writeExport(b, []ScanResult{{Domain: "a.example", Status: "RESET", ScannedAt: "2026-10-02T10:00:00Z"}, {Domain: "b.example", Status: "OK"}})
+	runMerge([]string{"-o", out, a, b})
+
+	merged, err := loadExport(out)
+	if err != nil || len(merged) != 2 || merged[0].Status != "RESET" {
+		t.Errorf("got %+v (%v)", merged, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var monitorFrom string
+
+// loadExport reads the results of a JSON or NDJSON export, from stdin for
+// "-".
+func loadExport(path string) ([]ScanResult, error) {
+	var f io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		f = file
+	}
+
+	// A JSON export is a single object wrapping the results; NDJSON is a
+	// stream of results, each carrying schema_version.
+	var results []ScanResult
+	dec := json.NewDecoder(f)
+	for {
+		var v struct {
+			versionedResult
+			Results []ScanResult `json:"results"`
+		}
+		if err := dec.Decode(&v); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if v.Results != nil {
+			results = append(results, v.Results...)
+		} else {
+			results = append(results, v.ScanResult)
+		}
+	}
+	return results, nil
+}
+
+// monitorTargets returns the domains that were OK in the export at path,
+// in their original order.
+func monitorTargets(path string) ([]string, error) {
+	results, err := loadExport(path)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var domains []string
+	for _, r := range results {
+		if r.Status == "OK" && !seen[r.Domain] {
+			seen[r.Domain] = true
+			domains = append(domains, r.Domain)
+		}
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("%s has no OK domains", path)
+	}
+	return domains, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMonitorTargets(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	results := func() chan ScanResult {
+		ch := make(chan ScanResult, 4)
+		ch <- ScanResult{Domain: "b.example", Status: "OK"}
+		ch <- ScanResult{Domain: "a.example", Status: "OK"}
+		ch <- ScanResult{Domain: "broken.example", Status: "TLS ERROR"}
+		ch <- ScanResult{Domain: "gone.example", Status: "NXDOMAIN"}
+		close(ch)
+		return ch
+	}
+	exportToJSON("prev", results(), false)
+	exportToJSON("prev", results(), true)
+
+	want := []string{"b.example", "a.example"}
+	for _, name := range []string{"prev.json", "prev.ndjson"} {
+		got, err := monitorTargets(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %v, want %v", name, got, want)
+		}
+	}
+
+	os.WriteFile("empty.json", []byte(`{"schema_version": "1.0.0", "results": []}`), 0o644)
+	if _, err := monitorTargets("empty.json"); err == nil {
+		t.Error("export without OK domains accepted")
+	}
+}
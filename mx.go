@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var errNoStartTLS = errors.New("STARTTLS not offered")
+
+// mailPort is a port mail servers listen on. Submissions over 465 speak
+// TLS right away; 25 and 587 upgrade with STARTTLS.
+type mailPort struct {
+	port     string
+	implicit bool
+}
+
+var defaultMailPorts = []mailPort{{"25", false}, {"465", true}, {"587", false}}
+
+// scanMX probes every mail server of domain on each of s.mxPorts and
+// returns one result per server and port.
+func (s *scanner) scanMX(domain string) []ScanResult {
+	release, err := s.dnsLimit.acquire(context.Background(), "dns")
+	if err != nil {
+		return []ScanResult{{Domain: domain, IP: "-", Status: "DNS ERROR", Err: err}}
+	}
+	mxs, err := s.lookupMX(domain)
+	release()
+	if err != nil {
+		return []ScanResult{{Domain: domain, IP: "-", Status: dnsStatus(err), Err: err}}
+	}
+
+	var results []ScanResult
+	for _, mx := range mxs {
+		host := strings.TrimSuffix(mx.Host, ".")
+		if host == "" {
+			continue // RFC 7505 null MX: the domain accepts no mail
+		}
+		ips, err := s.lookup(host)
+		if err != nil || len(ips) == 0 {
+			results = append(results, ScanResult{Domain: domain, IP: "-", Status: "DNS ERROR", MX: host, Err: err})
+			continue
+		}
+		for _, p := range s.mxPorts {
+			r := s.probeMail(domain, host, ips, p)
+			r.MX, r.Port = host, p.port
+			results = append(results, r)
+		}
+	}
+	if len(results) == 0 {
+		return []ScanResult{{Domain: domain, IP: "-", Status: "NO MX"}}
+	}
+	return results
+}
+
+func (s *scanner) probeMail(domain, host string, ips []string, p mailPort) ScanResult {
+	raw, err := s.dialRace(ips, p.port)
+	if err != nil {
+		return ScanResult{Domain: domain, IP: ips[0], Status: connectStatus(err), Err: err}
+	}
+	defer raw.Close()
+	ip := remoteIP(raw)
+
+	if p.implicit {
+		conn, err := s.handshake(raw, host)
+		if err != nil {
+			return ScanResult{Domain: domain, IP: ip, Family: ipFamily(ip), Status: handshakeStatus(err), Err: err}
+		}
+		if chain := conn.ConnectionState().PeerCertificates; len(chain) > 0 {
+			r := certResult(domain, ip, chain)
+			setHandshake(&r, conn)
+			return r
+		}
+	} else {
+		state, err := s.startTLS(raw, host)
+		if errors.Is(err, errNoStartTLS) {
+			return ScanResult{Domain: domain, IP: ip, Family: ipFamily(ip), Status: "NO STARTTLS"}
+		}
+		if err != nil {
+			debugf("STARTTLS with %s:%s failed: %v", host, p.port, err)
+			return ScanResult{Domain: domain, IP: ip, Family: ipFamily(ip), Status: "TLS ERROR", Err: err}
+		}
+		if chain := state.PeerCertificates; len(chain) > 0 {
+			// The SMTP dialogue precedes the handshake, so the group is
+			// not recorded.
+			r := certResult(domain, ip, chain)
+			r.TLSVersion = tls.VersionName(state.Version)
+			r.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+			return r
+		}
+	}
+	return ScanResult{Domain: domain, IP: ip, Family: ipFamily(ip), Status: "NO CERT"}
+}
+
+// startTLS runs the SMTP dialogue up to a STARTTLS handshake and returns
+// the resulting connection state. Mail servers often delay their greeting to slow
+// down spammers, so the dialogue gets three timeouts' worth of time.
+func (s *scanner) startTLS(conn net.Conn, host string) (tls.ConnectionState, error) {
+	conn.SetDeadline(time.Now().Add(3 * s.timeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer c.Close()
+	if err := c.Hello("localhost"); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		return tls.ConnectionState{}, errNoStartTLS
+	}
+	config := &tls.Config{InsecureSkipVerify: true, ServerName: host}
+	s.shape(config)
+	if err := c.StartTLS(config); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	state, _ := c.TLSConnectionState()
+	c.Quit()
+	return state, nil
+}
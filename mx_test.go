@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSMTP answers just enough SMTP for a STARTTLS probe.
+func serveSMTP(t *testing.T, cert tls.Certificate, startTLS bool) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer func() { c.Close() }()
+				offerTLS := startTLS
+				r := bufio.NewReader(c)
+				c.Write([]byte("220 mx.example ESMTP\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+					case "EHLO":
+						if offerTLS {
+							c.Write([]byte("250-mx.example\r\n250 STARTTLS\r\n"))
+						} else {
+							c.Write([]byte("250-mx.example\r\n250 8BITMIME\r\n"))
+						}
+					case "STARTTLS":
+						c.Write([]byte("220 ready\r\n"))
+						// net/smtp says EHLO again over the upgraded connection.
+						c = tls.Server(c, &tls.Config{Certificates: []tls.Certificate{cert}})
+						r = bufio.NewReader(c)
+						offerTLS = false
+					default:
+						c.Write([]byte("221 bye\r\n"))
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func TestScanMX(t *testing.T) {
+	cert, err := selfSignedCert("mx.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	starttls := serveSMTP(t, cert, true)
+	plain := serveSMTP(t, cert, false)
+
+	implicit, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer implicit.Close()
+	go func() {
+		for {
+			c, err := implicit.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	_, implicitPort, _ := net.SplitHostPort(implicit.Addr().String())
+
+	s := &scanner{
+		timeout:    time.Second,
+		mxPorts:    []mailPort{{starttls, false}, {implicitPort, true}, {plain, false}},
+		lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+		lookupMX: func(domain string) ([]*net.MX, error) {
+			if domain == "nomail.example" {
+				return []*net.MX{{Host: ".", Pref: 0}}, nil
+			}
+			return []*net.MX{{Host: "mx.example.", Pref: 10}}, nil
+		},
+	}
+
+	got := s.scanMX("example.com")
+	want := []struct{ port, status string }{{starttls, "OK"}, {implicitPort, "OK"}, {plain, "NO STARTTLS"}}
+	if len(got) != len(want) {
+		t.Fatalf("scanMX = %+v", got)
+	}
+	for i, w := range want {
+		if r := got[i]; r.Port != w.port || r.Status != w.status || r.MX != "mx.example" || r.Domain != "example.com" {
+			t.Errorf("result %d = %+v, want %s on port %s", i, r, w.status, w.port)
+		}
+	}
+	if got[0].Subject != "mx.example" {
+		t.Errorf("STARTTLS certificate subject = %q", got[0].Subject)
+	}
+
+	if got := s.scanMX("nomail.example"); len(got) != 1 || got[0].Status != "NO MX" {
+		t.Errorf("null MX = %+v, want NO MX", got)
+	}
+}
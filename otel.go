@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otlpEndpoint is the base URL of an OTLP/HTTP collector, such as
+// http://otel-collector:4318; traces go to /v1/traces and metrics to
+// /v1/metrics, JSON-encoded.
+var otlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+
+// tracing is the tracer of the current process, nil without --otlp-endpoint.
+// Every method of a nil tracer or span does nothing.
+var tracing *tracer
+
+var otlpClient = &http.Client{Timeout: 10 * time.Second}
+
+const (
+	otlpFlushInterval = 5 * time.Second
+	maxQueuedSpans    = 65536
+)
+
+// stageBounds are the histogram buckets of tls_sweep.stage.duration, in ms.
+var stageBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// tracer batches finished spans and counts the pipeline metrics, exporting
+// both every otlpFlushInterval and on shutdown.
+type tracer struct {
+	endpoint string
+	service  string
+	headers  map[string]string
+	started  time.Time
+
+	mu      sync.Mutex
+	spans   []otlpSpan
+	dropped int
+	targets map[string]int64          // by status
+	stages  map[string]*stageDuration // by stage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type stageDuration struct {
+	count   int64
+	sum     float64
+	buckets []int64
+}
+
+// startTracing starts exporting to --otlp-endpoint, if set.
+func startTracing() {
+	if otlpEndpoint == "" {
+		return
+	}
+	tracing = newTracer(otlpEndpoint)
+	go tracing.run()
+}
+
+func newTracer(endpoint string) *tracer {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "tls-sweep"
+	}
+	return &tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		service:  service,
+		headers:  otlpHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		started:  time.Now(),
+		targets:  make(map[string]int64),
+		stages:   make(map[string]*stageDuration),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// otlpHeaders parses OTEL_EXPORTER_OTLP_HEADERS, "key=value,key=value",
+// which usually carries the collector's API key.
+func otlpHeaders(spec string) map[string]string {
+	headers := make(map[string]string)
+	for _, kv := range strings.Split(spec, ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.TrimSpace(k) != "" {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return headers
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.stop:
+			t.flush()
+			return
+		}
+	}
+}
+
+// shutdown exports what is left and stops the background export.
+func (t *tracer) shutdown() {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+}
+
+// span is one timed stage of the pipeline.
+type span struct {
+	t        *tracer
+	traceID  string
+	id       string
+	parentID string
+	name     string
+	start    time.Time
+	attrs    []otlpKeyValue
+	err      string
+}
+
+// start opens the root span of a trace.
+func (t *tracer) start(name string, attrs ...otlpKeyValue) *span {
+	if t == nil {
+		return nil
+	}
+	return &span{t: t, traceID: randomHex(16), id: randomHex(8), name: name, start: time.Now(), attrs: attrs}
+}
+
+// child opens a span under sp.
+func (sp *span) child(name string, attrs ...otlpKeyValue) *span {
+	if sp == nil {
+		return nil
+	}
+	return &span{t: sp.t, traceID: sp.traceID, id: randomHex(8), parentID: sp.id, name: name, start: time.Now(), attrs: attrs}
+}
+
+func (sp *span) set(attrs ...otlpKeyValue) {
+	if sp != nil {
+		sp.attrs = append(sp.attrs, attrs...)
+	}
+}
+
+// fail marks the span as failed with msg.
+func (sp *span) fail(msg string) {
+	if sp != nil {
+		sp.err = msg
+	}
+}
+
+// endResult ends a span that produced r, recording its status and IP and
+// marking it failed for failure statuses.
+func (sp *span) endResult(r ScanResult) {
+	if sp == nil {
+		return
+	}
+	sp.set(stringAttr("tls_sweep.status", r.Status))
+	if r.IP != "" && r.IP != "-" {
+		sp.set(stringAttr("net.peer.ip", r.IP))
+	}
+	if isFailure(r.Status) {
+		msg := r.Status
+		if r.Err != nil {
+			msg += ": " + r.Err.Error()
+		}
+		sp.fail(msg)
+	}
+	sp.end()
+}
+
+func (sp *span) end() {
+	if sp == nil {
+		return
+	}
+	now := time.Now()
+	s := otlpSpan{
+		TraceID:      sp.traceID,
+		SpanID:       sp.id,
+		ParentSpanID: sp.parentID,
+		Name:         sp.name,
+		Kind:         1, // internal
+		Start:        unixNano(sp.start),
+		End:          unixNano(now),
+		Attributes:   sp.attrs,
+	}
+	if sp.err != "" {
+		s.Status = &otlpStatus{Code: 2, Message: sp.err}
+	}
+	t := sp.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) < maxQueuedSpans {
+		t.spans = append(t.spans, s)
+	} else {
+		t.dropped++
+	}
+	switch sp.name {
+	case "dns", "handshake":
+		t.observe(sp.name, float64(now.Sub(sp.start))/float64(time.Millisecond))
+	}
+}
+
+// observe adds one stage duration to the histogram; t.mu is held.
+func (t *tracer) observe(stage string, ms float64) {
+	d := t.stages[stage]
+	if d == nil {
+		d = &stageDuration{buckets: make([]int64, len(stageBounds)+1)}
+		t.stages[stage] = d
+	}
+	d.count++
+	d.sum += ms
+	i := sort.SearchFloat64s(stageBounds, ms)
+	d.buckets[i]++
+}
+
+// countTarget counts a scanned target by status.
+func (t *tracer) countTarget(status string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.targets[status]++
+}
+
+// flush exports the spans finished so far and the metrics as they stand.
+// Spans that fail to export are dropped rather than retried, so a missing
+// collector never holds up a sweep.
+func (t *tracer) flush() {
+	t.mu.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	metrics := t.metrics(time.Now())
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		logger.Printf("Dropped %d spans over the export queue limit\n", dropped)
+	}
+	resource := otlpResource{Attributes: []otlpKeyValue{stringAttr("service.name", t.service), stringAttr("service.version", version)}}
+	scope := otlpScope{Name: "tls-sweep", Version: version}
+	if len(spans) > 0 {
+		body := map[string]any{"resourceSpans": []any{map[string]any{
+			"resource":   resource,
+			"scopeSpans": []any{map[string]any{"scope": scope, "spans": spans}},
+		}}}
+		if err := t.post("/v1/traces", body); err != nil {
+			logger.Printf("Failed to export %d spans: %v\n", len(spans), err)
+		}
+	}
+	if len(metrics) > 0 {
+		body := map[string]any{"resourceMetrics": []any{map[string]any{
+			"resource":     resource,
+			"scopeMetrics": []any{map[string]any{"scope": scope, "metrics": metrics}},
+		}}}
+		if err := t.post("/v1/metrics", body); err != nil {
+			logger.Printf("Failed to export metrics: %v\n", err)
+		}
+	}
+}
+
+// metrics are the cumulative pipeline metrics at now; t.mu is held.
+func (t *tracer) metrics(now time.Time) []any {
+	start, at := unixNano(t.started), unixNano(now)
+	var metrics []any
+	if len(t.targets) > 0 {
+		var points []any
+		for _, status := range sortedKeys(t.targets) {
+			points = append(points, map[string]any{
+				"attributes":        []otlpKeyValue{stringAttr("tls_sweep.status", status)},
+				"startTimeUnixNano": start, "timeUnixNano": at,
+				"asInt": strconv.FormatInt(t.targets[status], 10),
+			})
+		}
+		metrics = append(metrics, map[string]any{
+			"name": "tls_sweep.targets", "description": "Targets scanned, by status", "unit": "{target}",
+			"sum": map[string]any{"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": points},
+		})
+	}
+	if len(t.stages) > 0 {
+		var points []any
+		for _, stage := range sortedKeys(t.stages) {
+			d := t.stages[stage]
+			buckets := make([]string, len(d.buckets))
+			for i, n := range d.buckets {
+				buckets[i] = strconv.FormatInt(n, 10)
+			}
+			points = append(points, map[string]any{
+				"attributes":        []otlpKeyValue{stringAttr("tls_sweep.stage", stage)},
+				"startTimeUnixNano": start, "timeUnixNano": at,
+				"count": strconv.FormatInt(d.count, 10), "sum": d.sum,
+				"bucketCounts": buckets, "explicitBounds": stageBounds,
+			})
+		}
+		metrics = append(metrics, map[string]any{
+			"name": "tls_sweep.stage.duration", "description": "Duration of the DNS and handshake stages", "unit": "ms",
+			"histogram": map[string]any{"aggregationTemporality": 2, "dataPoints": points},
+		})
+	}
+	return metrics
+}
+
+func (t *tracer) post(path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := otlpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding: IDs in hex, 64-bit integers as strings.
+type otlpSpan struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"`
+	Start        string         `json:"startTimeUnixNano"`
+	End          string         `json:"endTimeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	Status       *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"`
+}
+
+func stringAttr(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{String: &value}}
+}
+
+func intAttr(key string, value int) otlpKeyValue {
+	s := strconv.Itoa(value)
+	return otlpKeyValue{Key: key, Value: otlpValue{Int: &s}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tracedScan is scan, or scanIPs for a domain already resolved to ips, with
+// the lookup and the handshake as spans under sp.
+func (s *scanner) tracedScan(sp *span, domain string, ips []string) ScanResult {
+	if sp == nil {
+		if len(ips) > 0 {
+			return s.scanIPs(domain, ips)
+		}
+		return s.scan(domain)
+	}
+	if isOnion(domain) {
+		hs := sp.child("handshake")
+		r := s.scanOnion(domain)
+		hs.endResult(r)
+		return r
+	}
+	if len(ips) == 0 {
+		dns := sp.child("dns")
+		resolved, failed, ok := s.resolve(domain)
+		if !ok {
+			dns.endResult(failed)
+			return failed
+		}
+		dns.set(intAttr("tls_sweep.ips", len(resolved)))
+		dns.end()
+		ips = resolved
+	}
+	hs := sp.child("handshake")
+	r := s.scanIPs(domain, ips)
+	hs.endResult(r)
+	return r
+}
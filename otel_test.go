@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracing(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string][]byte)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Api-Key") != "secret" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer collector.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Api-Key=secret")
+	tr := newTracer(collector.URL + "/")
+	defer func(prev *tracer) { tracing = prev }(tracing)
+	tracing = tr
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	root := tr.start("sweep", stringAttr("tls_sweep.base_domain", "example"))
+	s := &scanner{
+		port:    port,
+		timeout: time.Second,
+		lookupHost: func(host string) ([]string, error) {
+			if host == "gone.example" {
+				return nil, nil
+			}
+			return []string{"127.0.0.1"}, nil
+		},
+		span: root,
+	}
+	tasks := make(chan scanTask, 2)
+	results := make(chan ScanResult, 2)
+	tasks <- scanTask{domain: "closed.example"}
+	tasks <- scanTask{domain: "gone.example"}
+	close(tasks)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	worker(s, tasks, results, &wg)
+	root.end()
+	tr.flush()
+
+	var traces struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(bodies["/v1/traces"], &traces); err != nil {
+		t.Fatal(err)
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	byName := make(map[string][]otlpSpan)
+	ids := make(map[string]otlpSpan)
+	for _, sp := range spans {
+		byName[sp.Name] = append(byName[sp.Name], sp)
+		ids[sp.SpanID] = sp
+		if sp.TraceID != root.traceID {
+			t.Errorf("%s is in trace %s", sp.Name, sp.TraceID)
+		}
+	}
+	if len(byName["sweep"]) != 1 || len(byName["scan target"]) != 2 || len(byName["dns"]) != 2 || len(byName["handshake"]) != 1 {
+		t.Fatalf("spans = %+v", spans)
+	}
+	hs := byName["handshake"][0]
+	if hs.Status == nil || hs.Status.Code != 2 || ids[hs.ParentSpanID].Name != "scan target" || ids[ids[hs.ParentSpanID].ParentSpanID].Name != "sweep" {
+		t.Errorf("handshake span = %+v", hs)
+	}
+	for _, sp := range byName["dns"] {
+		if sp.Status != nil {
+			t.Errorf("dns span failed: %+v", sp.Status)
+		}
+	}
+
+	var metrics struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string `json:"name"`
+					Sum  struct {
+						DataPoints []struct {
+							Attributes []otlpKeyValue `json:"attributes"`
+							AsInt      string         `json:"asInt"`
+						} `json:"dataPoints"`
+					} `json:"sum"`
+					Histogram struct {
+						DataPoints []struct {
+							Attributes []otlpKeyValue `json:"attributes"`
+							Count      string         `json:"count"`
+						} `json:"dataPoints"`
+					} `json:"histogram"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(bodies["/v1/metrics"], &metrics); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, m := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		for _, p := range m.Sum.DataPoints {
+			got[m.Name+" "+*p.Attributes[0].Value.String] = p.AsInt
+		}
+		for _, p := range m.Histogram.DataPoints {
+			got[m.Name+" "+*p.Attributes[0].Value.String] = p.Count
+		}
+	}
+	want := map[string]string{
+		"tls_sweep.targets NXDOMAIN":         "1",
+		"tls_sweep.targets REFUSED":          "1",
+		"tls_sweep.stage.duration dns":       "2",
+		"tls_sweep.stage.duration handshake": "1",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q (all: %v)", k, got[k], v, got)
+		}
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	var tr *tracer
+	sp := tr.start("sweep")
+	sp.child("dns").endResult(ScanResult{Status: "REFUSED"})
+	sp.end()
+	tr.countTarget("OK")
+	tr.shutdown()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var pagerClient = &http.Client{Timeout: 10 * time.Second}
+
+// pager raises and clears incidents. key identifies the incident so that
+// repeated triggers of an open one are folded into it.
+type pager interface {
+	trigger(key, summary, domain string) error
+	resolve(key string) error
+}
+
+// newPager returns the pager --pager names, keyed from the environment so
+// the key stays out of ps output.
+func newPager(name string) (pager, error) {
+	switch name {
+	case "pagerduty":
+		key := os.Getenv("PAGERDUTY_ROUTING_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("--pager pagerduty needs $PAGERDUTY_ROUTING_KEY")
+		}
+		return &pagerDuty{url: "https://events.pagerduty.com/v2/enqueue", routingKey: key}, nil
+	case "opsgenie":
+		key := os.Getenv("OPSGENIE_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("--pager opsgenie needs $OPSGENIE_API_KEY")
+		}
+		return &opsgenie{api: "https://api.opsgenie.com", apiKey: key}, nil
+	}
+	return nil, fmt.Errorf("unknown pager %q (want pagerduty or opsgenie)", name)
+}
+
+// criticalAlerts pages on the domains tagged critical: when their
+// certificate is within expiryDays of expiring, and when they fail
+// validation (no certificate, an untrusted chain or one not covering the
+// domain). Each scan re-evaluates both and resolves what has cleared.
+type criticalAlerts struct {
+	pager      pager
+	expiryDays int
+
+	// mu guards domains, which SIGHUP replaces while profiles scan.
+	mu      sync.Mutex
+	domains map[string]bool
+}
+
+func (a *criticalAlerts) setDomains(domains map[string]bool) {
+	a.mu.Lock()
+	a.domains = domains
+	a.mu.Unlock()
+}
+
+// loadCriticalDomains reads the --critical file, one domain per line.
+func loadCriticalDomains(path string) (map[string]bool, error) {
+	domains, _, err := readDomains(path)
+	if err != nil {
+		return nil, err
+	}
+	critical := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		critical[toASCII(d)] = true
+	}
+	return critical, nil
+}
+
+// evaluate returns the summaries of the expiry and validation incidents
+// of r; empty means the condition is clear.
+func (a *criticalAlerts) evaluate(r ScanResult, now time.Time) (expiry, validation string) {
+	if r.Status != "OK" {
+		return "", fmt.Sprintf("%s: TLS scan failed with %s", displayDomain(r.Domain), r.Status)
+	}
+	opts := checkOptions{now: now}
+	for _, name := range []string{"untrusted", "hostname"} {
+		if detail, failed := checks[name](nil, r, opts); failed {
+			validation = fmt.Sprintf("%s: certificate fails validation: %s", displayDomain(r.Domain), detail)
+			break
+		}
+	}
+	if exp, ok := parseValidTo(r.ValidTo); ok && exp.Before(now.AddDate(0, 0, a.expiryDays)) {
+		days := int(exp.Sub(now).Hours() / 24)
+		if days < 0 {
+			expiry = fmt.Sprintf("%s: certificate expired on %s", displayDomain(r.Domain), r.ValidTo)
+		} else {
+			expiry = fmt.Sprintf("%s: certificate expires in %d days (%s)", displayDomain(r.Domain), days, r.ValidTo)
+		}
+	}
+	return expiry, validation
+}
+
+// page triggers or resolves the incidents of every critical domain in
+// results. It stops at the first pager error, as the next ones would most
+// likely fail the same way.
+func (a *criticalAlerts) page(results []ScanResult, now time.Time) error {
+	a.mu.Lock()
+	domains := a.domains
+	a.mu.Unlock()
+	for _, r := range results {
+		if !domains[r.Domain] || r.MX != "" {
+			continue
+		}
+		expiry, validation := a.evaluate(r, now)
+		for _, incident := range [][2]string{{"expiry", expiry}, {"validation", validation}} {
+			key, summary := "tls-sweep/"+r.Domain+"/"+incident[0], incident[1]
+			var err error
+			if summary != "" {
+				logger.Printf("PAGE: %s\n", summary)
+				err = a.pager.trigger(key, summary, r.Domain)
+			} else {
+				err = a.pager.resolve(key)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pagerDuty sends Events API v2 events.
+type pagerDuty struct {
+	url, routingKey string
+}
+
+func (p *pagerDuty) send(event map[string]any) error {
+	event["routing_key"] = p.routingKey
+	req, _ := http.NewRequest("POST", p.url, jsonBody(event))
+	return pagerRequest(req)
+}
+
+func (p *pagerDuty) trigger(key, summary, domain string) error {
+	return p.send(map[string]any{
+		"event_action": "trigger",
+		"dedup_key":    key,
+		"payload":      map[string]string{"summary": summary, "source": domain, "severity": "critical", "component": "tls"},
+	})
+}
+
+func (p *pagerDuty) resolve(key string) error {
+	return p.send(map[string]any{"event_action": "resolve", "dedup_key": key})
+}
+
+// opsgenie uses the Alert API, with the key as alias.
+type opsgenie struct {
+	api, apiKey string
+}
+
+func (o *opsgenie) request(path string, body map[string]any) error {
+	req, _ := http.NewRequest("POST", o.api+path, jsonBody(body))
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+	return pagerRequest(req)
+}
+
+func (o *opsgenie) trigger(key, summary, domain string) error {
+	return o.request("/v2/alerts", map[string]any{
+		"message":  summary,
+		"alias":    key,
+		"entity":   domain,
+		"priority": "P1",
+		"tags":     []string{"tls-sweep", strings.TrimPrefix(key[strings.LastIndex(key, "/"):], "/")},
+	})
+}
+
+func (o *opsgenie) resolve(key string) error {
+	return o.request("/v2/alerts/"+url.PathEscape(key)+"/close?identifierType=alias", map[string]any{"source": "tls-sweep"})
+}
+
+func pagerRequest(req *http.Request) error {
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := pagerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
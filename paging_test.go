@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakePager struct{ events []string }
+
+func (p *fakePager) trigger(key, summary, _ string) error {
+	p.events = append(p.events, "trigger "+key+" "+summary)
+	return nil
+}
+
+func (p *fakePager) resolve(key string) error {
+	p.events = append(p.events, "resolve "+key)
+	return nil
+}
+
+func TestCriticalAlerts(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := &fakePager{}
+	a := &criticalAlerts{pager: p, expiryDays: 14, domains: map[string]bool{"shop.example": true, "api.example": true, "www.example": true}}
+	err := a.page([]ScanResult{
+		{Domain: "shop.example", Status: "OK", ValidTo: "2024-05-08"},
+		{Domain: "api.example", Status: "TLS ERROR"},
+		{Domain: "www.example", Status: "OK", ValidTo: "2025-01-01"},
+		{Domain: "blog.example", Status: "TLS ERROR"}, // not critical
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"trigger tls-sweep/shop.example/expiry shop.example: certificate expires in 6 days (2024-05-08)",
+		"resolve tls-sweep/shop.example/validation",
+		"resolve tls-sweep/api.example/expiry",
+		"trigger tls-sweep/api.example/validation api.example: TLS scan failed with TLS ERROR",
+		"resolve tls-sweep/www.example/expiry",
+		"resolve tls-sweep/www.example/validation",
+	}
+	if strings.Join(p.events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(p.events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPagerRequests(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		got = append(got, r.URL.RequestURI()+" "+r.Header.Get("Authorization")+" "+strings.TrimSpace(toJSON(body)))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	pd := &pagerDuty{url: srv.URL + "/v2/enqueue", routingKey: "R0UTE"}
+	og := &opsgenie{api: srv.URL, apiKey: "K3Y"}
+	for _, p := range []pager{pd, og} {
+		if err := p.trigger("tls-sweep/shop.example/expiry", "shop.example: certificate expires in 6 days", "shop.example"); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.resolve("tls-sweep/shop.example/expiry"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		`/v2/enqueue  {"dedup_key":"tls-sweep/shop.example/expiry","event_action":"trigger","payload":{"component":"tls","severity":"critical","source":"shop.example","summary":"shop.example: certificate expires in 6 days"},"routing_key":"R0UTE"}`,
+		`/v2/enqueue  {"dedup_key":"tls-sweep/shop.example/expiry","event_action":"resolve","routing_key":"R0UTE"}`,
+		`/v2/alerts GenieKey K3Y {"alias":"tls-sweep/shop.example/expiry","entity":"shop.example","message":"shop.example: certificate expires in 6 days","priority":"P1","tags":["tls-sweep","expiry"]}`,
+		`/v2/alerts/tls-sweep%2Fshop.example%2Fexpiry/close?identifierType=alias GenieKey K3Y {"source":"tls-sweep"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	t.Setenv("PAGERDUTY_ROUTING_KEY", "")
+	if _, err := newPager("pagerduty"); err == nil {
+		t.Error("pagerduty without a routing key accepted")
+	}
+}
+
+func toJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	pdfBrand = "tls-sweep"
+	pdfColor = "1f4e79" // hex RGB of the cover band and headings
+)
+
+// pdfExpiringDays is how far ahead the expiring-soon table looks.
+const pdfExpiringDays = 30
+
+func registerPDFFlags(fs *flag.FlagSet) {
+	fs.StringVar(&pdfBrand, "pdf-brand", pdfBrand, "organization name on the PDF report cover")
+	fs.StringVar(&pdfColor, "pdf-color", pdfColor, "hex RGB accent color of the PDF report")
+}
+
+// pdfReport is what the PDF summary shows. It is built from a scanRecord,
+// the same data the dashboard renders.
+type pdfReport struct {
+	Summary  scanSummary
+	Findings []ScanResult    // highest risk score first
+	Expiring []timelineEntry // soonest first, expired included
+}
+
+func buildPDFReport(rec *scanRecord, now time.Time) pdfReport {
+	rep := pdfReport{Summary: rec.summary()}
+	for _, r := range rec.Results {
+		if r.Score > 0 {
+			rep.Findings = append(rep.Findings, r)
+		}
+	}
+	sort.SliceStable(rep.Findings, func(i, j int) bool { return rep.Findings[i].Score > rep.Findings[j].Score })
+	if len(rep.Findings) > 15 {
+		rep.Findings = rep.Findings[:15]
+	}
+	for _, m := range expiryTimeline(rec.Results, now) {
+		for _, e := range m.Entries {
+			if e.DaysLeft < pdfExpiringDays {
+				rep.Expiring = append(rep.Expiring, e)
+			}
+		}
+	}
+	return rep
+}
+
+// writePDFReport writes rep as a cover page followed by the statistics,
+// the top findings and the expiring-soon table.
+func writePDFReport(w io.Writer, rep pdfReport, brand, color string, now time.Time) error {
+	accent, err := parseHexColor(color)
+	if err != nil {
+		return err
+	}
+	d := &pdfDoc{}
+
+	d.newPage()
+	d.fill(0, pdfHeight-220, pdfWidth, 220, accent)
+	d.text(pdfMargin, pdfHeight-110, "F2", 28, brand, [3]float64{1, 1, 1})
+	d.text(pdfMargin, pdfHeight-150, "F1", 16, "TLS certificate report", [3]float64{1, 1, 1})
+	d.y = pdfHeight - 280
+	d.line("F2", 14, strings.Join(rep.Summary.BaseDomains, ", "))
+	d.line("F1", 11, "Generated "+now.UTC().Format("2 January 2006 15:04 MST"))
+	if !rep.Summary.StartedAt.IsZero() {
+		d.line("F1", 11, "Scan started "+rep.Summary.StartedAt.UTC().Format("2 January 2006 15:04 MST"))
+	}
+
+	d.newPage()
+	d.heading("Summary", accent)
+	failures := 0
+	for status, n := range rep.Summary.ByStatus {
+		if isFailure(status) {
+			failures += n
+		}
+	}
+	expired := 0
+	for _, e := range rep.Expiring {
+		if e.DaysLeft < 0 {
+			expired++
+		}
+	}
+	cols := []float64{0, 300}
+	d.row(cols, []string{"Targets scanned", fmt.Sprint(rep.Summary.Total)}, false)
+	d.row(cols, []string{"Certificates found", fmt.Sprint(rep.Summary.ByStatus["OK"])}, false)
+	d.row(cols, []string{"Not registered", fmt.Sprint(rep.Summary.ByStatus["NXDOMAIN"])}, false)
+	d.row(cols, []string{"Failed scans", fmt.Sprint(failures)}, false)
+	d.row(cols, []string{"Expired certificates", fmt.Sprint(expired)}, false)
+	d.row(cols, []string{fmt.Sprintf("Expiring within %d days", pdfExpiringDays), fmt.Sprint(len(rep.Expiring) - expired)}, false)
+	d.gap()
+	d.row(cols, []string{"Status", "Targets"}, true)
+	statuses := make([]string, 0, len(rep.Summary.ByStatus))
+	for s := range rep.Summary.ByStatus {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	for _, s := range statuses {
+		d.row(cols, []string{s, fmt.Sprint(rep.Summary.ByStatus[s])}, false)
+	}
+
+	d.gap()
+	d.heading("Top findings", accent)
+	if len(rep.Findings) == 0 {
+		d.line("F1", 10, "No domain scored any brand-abuse risk.")
+	} else {
+		cols := []float64{0, 190, 230, 360}
+		d.row(cols, []string{"Domain", "Score", "Issuer", "Note"}, true)
+		for _, r := range rep.Findings {
+			d.row(cols, []string{displayDomain(r.Domain), fmt.Sprint(r.Score), r.Issuer, r.Note}, false)
+		}
+	}
+
+	d.gap()
+	d.heading("Expiring soon", accent)
+	if len(rep.Expiring) == 0 {
+		d.line("F1", 10, fmt.Sprintf("No certificate expires within %d days.", pdfExpiringDays))
+	} else {
+		cols := []float64{0, 190, 270, 340}
+		d.row(cols, []string{"Domain", "Expires", "Days left", "Issuer"}, true)
+		for _, e := range rep.Expiring {
+			d.row(cols, []string{displayDomain(e.Result.Domain), e.Expires.Format("2006-01-02"), fmt.Sprint(e.DaysLeft), e.Result.Issuer}, false)
+		}
+	}
+	return d.write(w)
+}
+
+// exportToPDF writes <base-domain>.pdf from the results of this run.
+func exportToPDF(baseDomain string, results []ScanResult) error {
+	rec := &scanRecord{BaseDomains: []string{baseDomain}, Results: results}
+	f, err := createAtomic(exportPath(baseDomain, "pdf"), 0o644)
+	if err != nil {
+		return err
+	}
+	if err := writePDFReport(f, buildPDFReport(rec, time.Now()), pdfBrand, pdfColor, time.Now()); err != nil {
+		f.abort()
+		return err
+	}
+	return f.Close()
+}
+
+func parseHexColor(s string) ([3]float64, error) {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(strings.TrimPrefix(s, "#"), "%02x%02x%02x", &r, &g, &b); err != nil {
+		return [3]float64{}, fmt.Errorf("bad color %q, want hex RGB such as 1f4e79", s)
+	}
+	return [3]float64{float64(r) / 255, float64(g) / 255, float64(b) / 255}, nil
+}
+
+// A4 in points.
+const (
+	pdfWidth  = 595.0
+	pdfHeight = 842.0
+	pdfMargin = 50.0
+)
+
+// pdfDoc lays out text top to bottom over as many pages as needed, in the
+// standard Helvetica fonts every viewer has: F1 regular, F2 bold.
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfHeight - pdfMargin
+}
+
+func (d *pdfDoc) cur() *bytes.Buffer { return d.pages[len(d.pages)-1] }
+
+func (d *pdfDoc) text(x, y float64, font string, size float64, s string, rgb [3]float64) {
+	fmt.Fprintf(d.cur(), "%.3f %.3f %.3f rg BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", rgb[0], rgb[1], rgb[2], font, size, x, y, pdfEscape(s))
+}
+
+func (d *pdfDoc) fill(x, y, w, h float64, rgb [3]float64) {
+	fmt.Fprintf(d.cur(), "%.3f %.3f %.3f rg %.1f %.1f %.1f %.1f re f\n", rgb[0], rgb[1], rgb[2], x, y, w, h)
+}
+
+// advance moves down by h, starting a new page when the bottom margin is
+// reached.
+func (d *pdfDoc) advance(h float64) {
+	if d.y-h < pdfMargin {
+		d.newPage()
+	}
+	d.y -= h
+}
+
+func (d *pdfDoc) gap() { d.advance(12) }
+
+func (d *pdfDoc) line(font string, size float64, s string) {
+	d.advance(size * 1.5)
+	d.text(pdfMargin, d.y, font, size, s, [3]float64{})
+}
+
+func (d *pdfDoc) heading(s string, accent [3]float64) {
+	d.advance(28)
+	d.text(pdfMargin, d.y, "F2", 16, s, accent)
+	d.advance(4)
+}
+
+// row writes cells at the column offsets, cutting each to fit before the
+// next column.
+func (d *pdfDoc) row(cols []float64, cells []string, bold bool) {
+	const size = 9.0
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	d.advance(size * 1.6)
+	for i, c := range cells {
+		width := pdfWidth - 2*pdfMargin - cols[i]
+		if i+1 < len(cols) {
+			width = cols[i+1] - cols[i] - 8
+		}
+		// Helvetica averages about half the font size per character.
+		if fit := int(width / (size * 0.5)); utf8.RuneCountInString(c) > fit && fit > 1 {
+			c = string([]rune(c)[:fit-1]) + "~"
+		}
+		d.text(pdfMargin+cols[i], d.y, font, size, c, [3]float64{})
+	}
+}
+
+// pdfEscape encodes s for a literal string in the standard fonts'
+// WinAnsi encoding; runes outside Latin-1 become ?.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// write emits the document: catalog, page tree, the two fonts, then a page
+// and a content stream per page, and the cross-reference table.
+func (d *pdfDoc) write(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfWidth, pdfHeight, 6+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
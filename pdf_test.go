@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPDFReport(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	rec := &scanRecord{BaseDomains: []string{"example"}, StartedAt: now.Add(-time.Hour), Results: []ScanResult{
+		{Domain: "example.com", Status: "OK", Issuer: "Test CA", ValidTo: "2024-05-10"},
+		{Domain: "example.net", Status: "OK", Issuer: "Test CA", ValidTo: "2024-04-01", Score: 20},
+		{Domain: "example.org", Status: "OK", Issuer: "Test CA", ValidTo: "2025-01-01", Score: 80, Note: "brand (in title)"},
+		{Domain: "example.io", Status: "TLS ERROR"},
+		{Domain: "example.de", Status: "NXDOMAIN"},
+	}}
+	rep := buildPDFReport(rec, now)
+	if len(rep.Findings) != 2 || rep.Findings[0].Domain != "example.org" {
+		t.Errorf("findings = %+v, want example.org first", rep.Findings)
+	}
+	if len(rep.Expiring) != 2 || rep.Expiring[0].Result.Domain != "example.net" || rep.Expiring[0].DaysLeft >= 0 {
+		t.Errorf("expiring = %+v, want the expired example.net first", rep.Expiring)
+	}
+
+	// Enough findings to spill onto further pages.
+	for i := 0; i < 100; i++ {
+		rep.Findings = append(rep.Findings, ScanResult{Domain: fmt.Sprintf("d%d.example", i), Score: 10})
+	}
+	var buf bytes.Buffer
+	if err := writePDFReport(&buf, rep, "Acme (Security)", "#c0392b", now); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatal("not a PDF")
+	}
+	for _, want := range []string{`(Acme \(Security\)) Tj`, "(Expiring soon) Tj", "(example.net) Tj", "0.753 0.224 0.169 rg"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF does not contain %q", want)
+		}
+	}
+	if n := strings.Count(pdf, "/Type /Page "); n < 4 {
+		t.Errorf("%d pages, want the findings to run over several", n)
+	}
+
+	// Every xref offset must point at its object.
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(pdf)
+	xref, _ := strconv.Atoi(m[1])
+	entries := strings.Split(pdf[xref:], "\n")[3:]
+	for i := 1; strings.HasSuffix(entries[i-1], " n "); i++ {
+		off, _ := strconv.Atoi(entries[i-1][:10])
+		if want := fmt.Sprintf("%d 0 obj", i); !strings.HasPrefix(pdf[off:], want) {
+			t.Fatalf("xref entry %d points at %q", i, pdf[off:off+10])
+		}
+	}
+
+	if err := writePDFReport(&buf, rep, "Acme", "blue", now); err == nil {
+		t.Error("bad color accepted")
+	}
+}
+
+func TestPDFEscape(t *testing.T) {
+	if got := pdfEscape(`a\b(c) é ✓`); got != `a\\b\(c\) \351 ?` {
+		t.Errorf("pdfEscape = %q", got)
+	}
+}
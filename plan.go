@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	planOnly   bool
+	budgetSpec string
+)
+
+// assumedMXHosts is how many mail servers the plan expects per --mx domain.
+const assumedMXHosts = 2
+
+// sweepPlan is the worst case of a sweep: every target resolves and every
+// connection runs into the timeout.
+type sweepPlan struct {
+	targets        int
+	workers        int
+	connsPerTarget int           // including retries
+	targetTime     time.Duration // worst case for one target
+}
+
+func (p sweepPlan) connections() int { return p.targets * p.connsPerTarget }
+
+func (p sweepPlan) duration() time.Duration {
+	waves := (p.targets + p.workers - 1) / p.workers
+	return time.Duration(waves) * p.targetTime
+}
+
+// plan estimates the sweep of targets by s with workers workers.
+func (s *scanner) plan(targets, workers int) sweepPlan {
+	// One probe is a connect and a handshake, each up to the timeout.
+	probes := 1
+	if s.mx {
+		probes = len(s.mxPorts) * assumedMXHosts
+	}
+	extra := 0
+	if s.quic {
+		extra++
+	}
+	if s.insecure {
+		extra++
+	}
+	if s.regions != nil {
+		extra += rttProbes - 1
+	}
+	extra += len(sniNames(s.sniFuzz, "example.invalid"))
+	if s.redirects > 0 {
+		extra += s.redirects + 1
+	}
+
+	attempts := 1 + s.retries
+	p := sweepPlan{
+		targets:        targets,
+		workers:        workers,
+		connsPerTarget: attempts*probes + extra,
+		targetTime:     time.Duration(attempts*probes+extra) * 2 * s.timeout,
+	}
+	if s.precheck > 0 && !s.mx {
+		p.connsPerTarget++
+		p.targetTime += s.precheck
+	}
+	return p
+}
+
+func (p sweepPlan) write(w io.Writer) {
+	fmt.Fprintf(w, "Targets:      %d\n", p.targets)
+	fmt.Fprintf(w, "Connections:  at most %d (%d per target)\n", p.connections(), p.connsPerTarget)
+	fmt.Fprintf(w, "Duration:     at most %v with %d workers\n", p.duration().Round(time.Second), p.workers)
+}
+
+// scanBudget is --budget; zero fields are unlimited.
+type scanBudget struct {
+	connections int
+	duration    time.Duration
+}
+
+func parseBudget(v string) (scanBudget, error) {
+	var b scanBudget
+	for _, part := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return b, fmt.Errorf("--budget %q: want connections=N,duration=D", v)
+		}
+		var err error
+		switch key {
+		case "connections":
+			if b.connections, err = strconv.Atoi(value); err == nil && b.connections < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "duration":
+			if b.duration, err = time.ParseDuration(value); err == nil && b.duration <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		default:
+			return b, fmt.Errorf("--budget: unknown limit %s, want connections or duration", key)
+		}
+		if err != nil {
+			return b, fmt.Errorf("--budget %s: %v", key, err)
+		}
+	}
+	return b, nil
+}
+
+// fit is how many of the plan's targets stay within b.
+func (b scanBudget) fit(p sweepPlan) int {
+	n := p.targets
+	if b.connections > 0 {
+		n = min(n, b.connections/p.connsPerTarget)
+	}
+	if b.duration > 0 {
+		n = min(n, int(b.duration/p.targetTime)*p.workers)
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	s := &scanner{timeout: 5 * time.Second}
+	p := s.plan(1000, 50)
+	if p.connections() != 1000 || p.duration() != 20*10*time.Second {
+		t.Errorf("plain sweep: %d connections, %v", p.connections(), p.duration())
+	}
+
+	s = &scanner{timeout: time.Second, retries: 1, insecure: true, sniFuzz: "www.{domain},-", precheck: 500 * time.Millisecond}
+	p = s.plan(10, 10)
+	// 2 attempts, the insecure probe, 2 SNIs and the precheck connect.
+	if p.connsPerTarget != 6 || p.targetTime != 10*time.Second+500*time.Millisecond {
+		t.Errorf("got %d connections and %v per target", p.connsPerTarget, p.targetTime)
+	}
+
+	var buf bytes.Buffer
+	p.write(&buf)
+	if !strings.Contains(buf.String(), "at most 60 (6 per target)") {
+		t.Errorf("plan output:\n%s", buf.String())
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b, err := parseBudget("connections=10000, duration=20m")
+	if err != nil || b.connections != 10000 || b.duration != 20*time.Minute {
+		t.Fatalf("got %+v, %v", b, err)
+	}
+	for _, bad := range []string{"connections", "connections=0", "duration=soon", "rate=5"} {
+		if _, err := parseBudget(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	p := sweepPlan{targets: 1500, workers: 50, connsPerTarget: 2, targetTime: 10 * time.Second}
+	for _, c := range []struct {
+		budget scanBudget
+		want   int
+	}{
+		{scanBudget{}, 1500},
+		{scanBudget{connections: 1000}, 500},
+		{scanBudget{duration: time.Minute}, 300},
+		{scanBudget{connections: 1000, duration: time.Minute}, 300},
+		{scanBudget{duration: 5 * time.Second}, 0},
+	} {
+		if got := c.budget.fit(p); got != c.want {
+			t.Errorf("fit(%+v) = %d, want %d", c.budget, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	precheckTimeout time.Duration
+	precheckWorkers int
+)
+
+// precheckStage resolves every domain and tries a TCP connect with the
+// short precheck timeout on many more goroutines than the scan itself uses.
+// Domains that answer go to tasks with their addresses; the others are sent
+// straight to results, so parked permutations without a listener never cost
+// a full scan timeout. It returns once every domain was handed out or ctx
+// was cancelled.
+func (s *scanner) precheckStage(ctx context.Context, domains []string, tasks chan<- scanTask, results chan<- ScanResult) {
+	workers := s.precheckWorkers
+	if workers < 1 {
+		workers = 8 * s.workerCount()
+	}
+	quick := *s
+	quick.timeout = s.precheck
+
+	in := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range in {
+				ips, dead := quick.precheckDomain(domain)
+				if dead != nil {
+					s.deliver(*dead, 1, results)
+					scanned.Add(1)
+					continue
+				}
+				feedTask(ctx, tasks, scanTask{domain: domain, ips: ips})
+			}
+		}()
+	}
+
+feed:
+	for _, domain := range domains {
+		select {
+		case in <- domain:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(in)
+	wg.Wait()
+}
+
+// precheckDomain returns the addresses of domain when one of them accepts
+// a TCP connection, or the result to report otherwise.
+func (s *scanner) precheckDomain(domain string) ([]string, *ScanResult) {
+	if isOnion(domain) {
+		return nil, nil // no address to check; scanned through Tor
+	}
+	ips, err := s.lookup(domain)
+	if err != nil {
+		return nil, &ScanResult{Domain: domain, IP: "-", Status: dnsStatus(err), Err: err}
+	}
+	if len(ips) == 0 {
+		return nil, &ScanResult{Domain: domain, IP: "-", Status: "NXDOMAIN"}
+	}
+	conn, err := s.dialRace(ips, s.port)
+	if err != nil {
+		debugf("Precheck of %s failed: %v", domain, err)
+		return nil, &ScanResult{Domain: domain, IP: ips[0], Status: connectStatus(err), Err: err}
+	}
+	conn.Close()
+	return ips, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPrecheckSkipsDeadHosts(t *testing.T) {
+	cert, err := selfSignedCert("live.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	addrs := map[string]string{"live.example": "127.0.0.1", "parked.example": "192.0.2.1"}
+	s := &scanner{
+		port:     port,
+		timeout:  5 * time.Second,
+		precheck: 50 * time.Millisecond,
+		lookupHost: func(host string) ([]string, error) {
+			if ip, ok := addrs[host]; ok {
+				return []string{ip}, nil
+			}
+			return nil, &net.DNSError{IsNotFound: true}
+		},
+		dialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if host, _, _ := net.SplitHostPort(addr); host == "192.0.2.1" {
+				<-ctx.Done() // never answers
+				return nil, ctx.Err()
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+
+	start := time.Now()
+	results := make(chan ScanResult, 3)
+	sweep(context.Background(), s, []string{"live.example", "parked.example", "gone.example"}, results)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("sweep took %v; the parked host cost a full timeout", elapsed)
+	}
+	got := make(map[string]string)
+	for r := range results {
+		got[r.Domain] = r.Status
+		// Results of the precheck are labelled like those of the scan.
+		if r.ScannedAt == "" {
+			t.Errorf("%s has no ScannedAt", r.Domain)
+		}
+	}
+	want := map[string]string{"live.example": "OK", "parked.example": "FILTERED", "gone.example": "NXDOMAIN"}
+	for d, status := range want {
+		if got[d] != status {
+			t.Errorf("%s: %s, want %s", d, got[d], status)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// errNoTLS is returned by a preamble when the server declines TLS.
+var errNoTLS = errors.New("server does not offer TLS")
+
+// profile describes how to reach the TLS handshake of one kind of service.
+// preamble runs the plaintext part of the protocol on conn and returns the
+// connection the handshake runs over; nil means TLS starts right away.
+//
+// clientAuth profiles target servers that demand a client certificate,
+// which the scanner never has; their serving certificate is reported even
+// when the handshake is then refused.
+type profile struct {
+	port       string
+	preamble   func(conn net.Conn) (net.Conn, error)
+	clientAuth bool
+}
+
+var profiles = map[string]profile{
+	"https":    {port: "443"},
+	"ldaps":    {port: "636"},
+	"postgres": {port: "5432", preamble: postgresPreamble},
+	"mysql":    {port: "3306", preamble: mysqlPreamble},
+	"mssql":    {port: "1433", preamble: mssqlPreamble},
+	"rdp":      {port: "3389", preamble: rdpPreamble},
+
+	"kube-apiserver": {port: "6443", clientAuth: true},
+	"kubelet":        {port: "10250", clientAuth: true},
+	"etcd":           {port: "2379", clientAuth: true},
+}
+
+// clientAuthError is returned by handshake when the server aborted the
+// handshake after sending its certificate, typically because it requires a
+// client certificate.
+type clientAuthError struct {
+	chain []*x509.Certificate
+	err   error
+}
+
+func (e *clientAuthError) Error() string { return e.err.Error() }
+func (e *clientAuthError) Unwrap() error { return e.err }
+
+var scanProfile = "https"
+
+func profileNames() string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func setProfile(name string) error {
+	if _, ok := profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q (want one of %s)", name, profileNames())
+	}
+	scanProfile = name
+	return nil
+}
+
+// postgresPreamble sends an SSLRequest; the server answers S or N.
+func postgresPreamble(conn net.Conn) (net.Conn, error) {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:], 8)
+	binary.BigEndian.PutUint32(req[4:], 80877103)
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	var resp [1]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return nil, err
+	}
+	if resp[0] != 'S' {
+		return nil, errNoTLS
+	}
+	return conn, nil
+}
+
+// mysqlPreamble reads the server greeting and answers with an SSLRequest
+// packet when the server has the CLIENT_SSL capability.
+func mysqlPreamble(conn net.Conn) (net.Conn, error) {
+	const (
+		clientLongPassword     = 0x00000001
+		clientProtocol41       = 0x00000200
+		clientSSL              = 0x00000800
+		clientSecureConnection = 0x00008000
+	)
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+	greeting := make([]byte, size)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return nil, err
+	}
+	if len(greeting) == 0 || greeting[0] != 10 {
+		return nil, fmt.Errorf("mysql: unexpected greeting")
+	}
+	// protocol version, NUL-terminated server version, connection id (4),
+	// auth data (8), filler (1), then the low capability bytes.
+	end := bytes.IndexByte(greeting[1:], 0)
+	if end < 0 || len(greeting) < 1+end+1+13+2 {
+		return nil, fmt.Errorf("mysql: short greeting")
+	}
+	capsAt := 1 + end + 1 + 13
+	if binary.LittleEndian.Uint16(greeting[capsAt:])&clientSSL == 0 {
+		return nil, errNoTLS
+	}
+
+	req := make([]byte, 4+32)
+	req[0], req[3] = 32, 1 // payload length, sequence id
+	binary.LittleEndian.PutUint32(req[4:], clientLongPassword|clientProtocol41|clientSSL|clientSecureConnection)
+	binary.LittleEndian.PutUint32(req[8:], 1<<24)
+	req[12] = 0x21 // utf8_general_ci
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// rdpPreamble sends an X.224 Connection Request negotiating TLS or
+// CredSSP, which both start with a TLS handshake.
+func rdpPreamble(conn net.Conn) (net.Conn, error) {
+	req := []byte{
+		0x03, 0x00, 0x00, 0x13, // TPKT, 19 bytes
+		0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, // X.224 Connection Request
+		0x01, 0x00, 0x08, 0x00, 0x03, 0x00, 0x00, 0x00, // RDP_NEG_REQ: PROTOCOL_SSL | PROTOCOL_HYBRID
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	var tpkt [4]byte
+	if _, err := io.ReadFull(conn, tpkt[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint16(tpkt[2:]))
+	if tpkt[0] != 0x03 || size < 4 {
+		return nil, fmt.Errorf("rdp: unexpected response")
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	// Without an RDP_NEG_RSP the server only speaks legacy RDP security.
+	if len(resp) < 15 || resp[7] != 0x02 {
+		return nil, errNoTLS
+	}
+	return conn, nil
+}
+
+const (
+	tdsPrelogin = 0x12
+	tdsReply    = 0x04
+)
+
+// mssqlPreamble exchanges PRELOGIN packets asking for encryption. SQL
+// Server then expects the TLS handshake wrapped in PRELOGIN packets.
+func mssqlPreamble(conn net.Conn) (net.Conn, error) {
+	payload := []byte{
+		0x00, 0x00, 0x0b, 0x00, 0x06, // VERSION at 11, 6 bytes
+		0x01, 0x00, 0x11, 0x00, 0x01, // ENCRYPTION at 17, 1 byte
+		0xff,
+		0x0f, 0x00, 0x07, 0xd0, 0x00, 0x00, // version
+		0x01, // ENCRYPT_ON
+	}
+	if err := writeTDS(conn, tdsPrelogin, payload); err != nil {
+		return nil, err
+	}
+	typ, resp, err := readTDS(conn)
+	if err != nil {
+		return nil, err
+	}
+	if typ != tdsReply {
+		return nil, fmt.Errorf("mssql: unexpected packet type %#x", typ)
+	}
+	for i := 0; i+5 <= len(resp) && resp[i] != 0xff; i += 5 {
+		if resp[i] != 0x01 {
+			continue
+		}
+		off := int(binary.BigEndian.Uint16(resp[i+1:]))
+		if off >= len(resp) {
+			break
+		}
+		if resp[off] == 0x02 { // ENCRYPT_NOT_SUP
+			return nil, errNoTLS
+		}
+		return &tdsConn{Conn: conn}, nil
+	}
+	return nil, fmt.Errorf("mssql: no encryption option in PRELOGIN response")
+}
+
+func writeTDS(w io.Writer, typ byte, payload []byte) error {
+	pkt := make([]byte, 8+len(payload))
+	pkt[0], pkt[1] = typ, 0x01 // end of message
+	binary.BigEndian.PutUint16(pkt[2:], uint16(len(pkt)))
+	pkt[6] = 1
+	copy(pkt[8:], payload)
+	_, err := w.Write(pkt)
+	return err
+}
+
+func readTDS(r io.Reader) (byte, []byte, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	size := int(binary.BigEndian.Uint16(hdr[2:]))
+	if size < 8 {
+		return 0, nil, fmt.Errorf("tds: bad packet length %d", size)
+	}
+	payload := make([]byte, size-8)
+	_, err := io.ReadFull(r, payload)
+	return hdr[0], payload, err
+}
+
+// tdsConn carries TLS records inside PRELOGIN packets, which is how SQL
+// Server runs the handshake. Only the handshake is needed to read the
+// certificate, so the connection is never switched back to raw TLS.
+type tdsConn struct {
+	net.Conn
+	buf []byte
+}
+
+func (c *tdsConn) Read(b []byte) (int, error) {
+	for len(c.buf) == 0 {
+		_, payload, err := readTDS(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.buf = payload
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *tdsConn) Write(b []byte) (int, error) {
+	const maxPayload = 4096 - 8
+	for written := 0; written < len(b); {
+		chunk := b[written:min(len(b), written+maxPayload)]
+		if err := writeTDS(c.Conn, tdsPrelogin, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveProfile accepts connections, runs serverSide on each and, when it
+// returns a connection, completes a TLS handshake over it.
+func serveProfile(t *testing.T, serverSide func(c net.Conn) net.Conn) string {
+	cert, err := selfSignedCert("db.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				if tc := serverSide(c); tc != nil {
+					tls.Server(tc, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+				}
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func TestProfiles(t *testing.T) {
+	postgres := func(answer byte) func(net.Conn) net.Conn {
+		return func(c net.Conn) net.Conn {
+			req := make([]byte, 8)
+			if _, err := io.ReadFull(c, req); err != nil || binary.BigEndian.Uint32(req[4:]) != 80877103 {
+				return nil
+			}
+			c.Write([]byte{answer})
+			if answer != 'S' {
+				return nil
+			}
+			return c
+		}
+	}
+	mysql := func(caps uint16) func(net.Conn) net.Conn {
+		return func(c net.Conn) net.Conn {
+			var g bytes.Buffer
+			g.WriteByte(10)
+			g.WriteString("8.0.36\x00")
+			g.Write(make([]byte, 4+8+1))
+			binary.Write(&g, binary.LittleEndian, caps)
+			g.Write(make([]byte, 16))
+			c.Write(append([]byte{byte(g.Len()), 0, 0, 0}, g.Bytes()...))
+			req := make([]byte, 36)
+			if _, err := io.ReadFull(c, req); err != nil || binary.LittleEndian.Uint32(req[4:])&0x800 == 0 {
+				return nil
+			}
+			return c
+		}
+	}
+	rdp := func(negType byte) func(net.Conn) net.Conn {
+		return func(c net.Conn) net.Conn {
+			req := make([]byte, 19)
+			if _, err := io.ReadFull(c, req); err != nil {
+				return nil
+			}
+			c.Write([]byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xd0, 0, 0, 0x12, 0x34, 0, negType, 0, 0x08, 0, 0x01, 0, 0, 0})
+			if negType != 0x02 {
+				return nil
+			}
+			return c
+		}
+	}
+	mssql := func(encryption byte) func(net.Conn) net.Conn {
+		return func(c net.Conn) net.Conn {
+			if typ, _, err := readTDS(c); err != nil || typ != tdsPrelogin {
+				return nil
+			}
+			writeTDS(c, tdsReply, []byte{0x00, 0x00, 0x0b, 0x00, 0x06, 0x01, 0x00, 0x11, 0x00, 0x01, 0xff, 16, 0, 0, 0, 0, 0, encryption})
+			if encryption == 0x02 {
+				return nil
+			}
+			return &tdsConn{Conn: c}
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		profile string
+		server  func(net.Conn) net.Conn
+		want    string
+	}{
+		{"ldaps", "ldaps", func(c net.Conn) net.Conn { return c }, "OK"},
+		{"postgres", "postgres", postgres('S'), "OK"},
+		{"postgres without ssl", "postgres", postgres('N'), "NO TLS"},
+		{"mysql", "mysql", mysql(0xffff), "OK"},
+		{"mysql without ssl", "mysql", mysql(0xf7ff), "NO TLS"},
+		{"rdp", "rdp", rdp(0x02), "OK"},
+		{"rdp legacy security", "rdp", rdp(0x03), "NO TLS"},
+		{"mssql", "mssql", mssql(0x01), "OK"},
+		{"mssql without encryption", "mssql", mssql(0x02), "NO TLS"},
+	} {
+		port := serveProfile(t, tc.server)
+		s := &scanner{
+			port:       port,
+			timeout:    time.Second,
+			preamble:   profiles[tc.profile].preamble,
+			lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+		}
+		r := s.scan("db.example")
+		if r.Status != tc.want {
+			t.Errorf("%s: status %s, want %s", tc.name, r.Status, tc.want)
+		}
+		if tc.want == "OK" && r.Subject != "db.example" {
+			t.Errorf("%s: subject %q", tc.name, r.Subject)
+		}
+	}
+}
+
+func TestSetProfile(t *testing.T) {
+	defer func() { scanProfile = "https" }()
+	if err := setProfile("postgres"); err != nil || scanProfile != "postgres" {
+		t.Errorf("setProfile(postgres) = %v, profile %s", err, scanProfile)
+	}
+	if err := setProfile("gopher"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
+
+func TestClientAuthProfile(t *testing.T) {
+	cert, err := selfSignedCert("kubelet.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequireAnyClientCert,
+			MaxVersion:   version,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer c.Close()
+					c.(*tls.Conn).Handshake()
+				}()
+			}
+		}()
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+		for _, tolerate := range []bool{false, true} {
+			s := &scanner{
+				port:       port,
+				timeout:    time.Second,
+				clientAuth: tolerate,
+				lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+			}
+			r := s.scan("kubelet.example")
+			// TLS 1.3 clients finish before the server checks their
+			// certificate, so only TLS 1.2 needs the profile.
+			want := "OK"
+			if version == tls.VersionTLS12 && !tolerate {
+				want = "TLS ERROR"
+			}
+			if r.Status != want || (want == "OK" && r.Subject != "kubelet.example") {
+				t.Errorf("TLS %x, clientAuth %v: %+v, want %s", version, tolerate, r, want)
+			}
+		}
+		ln.Close()
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// profileRunner scans one daemon profile on its schedule into its own
+// store, until stopped.
+type profileRunner struct {
+	store   *fileStore
+	dash    http.Handler
+	stop    context.CancelFunc
+	trigger chan string
+
+	mu      sync.Mutex
+	profile daemonProfile
+}
+
+func (p *profileRunner) current() daemonProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.profile
+}
+
+// run scans right away and then every interval of the current definition,
+// which a reload may change in between, or sooner when triggered.
+func (p *profileRunner) run(ctx context.Context, sink *syslogSink, alerts *criticalAlerts, params map[string]string) {
+	triggeredBy := "startup"
+	for {
+		prof := p.current()
+		audit := auditEntry{Mode: "daemon", Profile: prof.name, TriggeredBy: triggeredBy, Parameters: params}
+		if err := daemonScan(ctx, p.store, prof.bases, prof.templates, nil, prof.script, prof.webhook, sink, alerts, audit); err != nil && ctx.Err() == nil {
+			logger.Printf("Scan of profile %s failed: %v\n", prof.name, err)
+		}
+		select {
+		case <-time.After(prof.interval):
+			triggeredBy = "schedule"
+		case by := <-p.trigger:
+			triggeredBy = "api token " + by
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// profileSet is the running profiles of the daemon, each with a history
+// under dir/<name> and a dashboard under /profiles/<name>/.
+type profileSet struct {
+	dir string
+	wg  sync.WaitGroup
+
+	mu      sync.Mutex
+	runners map[string]*profileRunner
+}
+
+// update starts the profiles that are new, hands the changed definitions
+// to the running ones for their next scan, and stops the removed ones.
+func (ps *profileSet) update(ctx context.Context, profiles []daemonProfile, run func(context.Context, *profileRunner)) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	keep := make(map[string]bool)
+	for _, prof := range profiles {
+		keep[prof.name] = true
+		if p, ok := ps.runners[prof.name]; ok {
+			p.mu.Lock()
+			p.profile = prof
+			p.mu.Unlock()
+			continue
+		}
+		store, err := newFileStore(filepath.Join(ps.dir, prof.name))
+		if err != nil {
+			return err
+		}
+		if err := importAnnotationsFile(store); err != nil {
+			logger.Printf("Failed to import annotations for profile %s: %v\n", prof.name, err)
+		}
+		prefix := "/profiles/" + prof.name
+		dash, err := newDashboard(store, prefix)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		dash.routes(mux)
+		pctx, stop := context.WithCancel(ctx)
+		p := &profileRunner{store: store, dash: http.StripPrefix(prefix, mux), stop: stop, trigger: make(chan string, 1), profile: prof}
+		ps.runners[prof.name] = p
+		ps.wg.Add(1)
+		go func() {
+			defer ps.wg.Done()
+			run(pctx, p)
+		}()
+	}
+	for name, p := range ps.runners {
+		if !keep[name] {
+			p.stop()
+			delete(ps.runners, name)
+		}
+	}
+	// Each profile scans alongside the daemon's own base domains.
+	fdShares.Store(int32(1 + len(ps.runners)))
+	return nil
+}
+
+func (ps *profileSet) names() []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var names []string
+	for name := range ps.runners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// trigger queues a scan of the named profile on behalf of by, unless one is
+// queued already, and reports whether the profile exists.
+func (ps *profileSet) trigger(name, by string) bool {
+	ps.mu.Lock()
+	p, ok := ps.runners[name]
+	ps.mu.Unlock()
+	if ok {
+		queueScan(p.trigger, by)
+	}
+	return ok
+}
+
+// importAnnotations merges --annotations into every profile's store.
+func (ps *profileSet) importAnnotations() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for name, p := range ps.runners {
+		if err := importAnnotationsFile(p.store); err != nil {
+			logger.Printf("Reload failed, keeping previous annotations of profile %s: %v\n", name, err)
+		}
+	}
+}
+
+// wait returns once every profile has stopped scanning.
+func (ps *profileSet) wait() {
+	ps.wg.Wait()
+}
+
+// ServeHTTP lists the profiles at /profiles/ and hands /profiles/<name>/...
+// to the profile's dashboard.
+func (ps *profileSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/profiles/")
+	if rest == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintln(w, "<!DOCTYPE html><title>Profiles</title><h1>Profiles</h1><ul>")
+		for _, name := range ps.names() {
+			fmt.Fprintf(w, "<li><a href=\"/profiles/%s/\">%s</a></li>\n", name, html.EscapeString(name))
+		}
+		fmt.Fprintln(w, "</ul>")
+		return
+	}
+	name, _, found := strings.Cut(rest, "/")
+	ps.mu.Lock()
+	p, ok := ps.runners[name]
+	ps.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !found {
+		http.Redirect(w, r, "/profiles/"+name+"/", http.StatusMovedPermanently)
+		return
+	}
+	p.dash.ServeHTTP(w, r)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProfileSet(t *testing.T) {
+	ps := &profileSet{dir: t.TempDir(), runners: make(map[string]*profileRunner)}
+	var mu sync.Mutex
+	started := make(map[string]int)
+	run := func(ctx context.Context, p *profileRunner) {
+		mu.Lock()
+		started[p.current().name]++
+		mu.Unlock()
+		<-ctx.Done()
+	}
+	travel := daemonProfile{name: "travel", bases: []string{"booking"}, interval: time.Hour}
+	retail := daemonProfile{name: "retail", bases: []string{"amazon"}, interval: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := ps.update(ctx, []daemonProfile{travel, retail}, run); err != nil {
+		t.Fatal(err)
+	}
+	rec := &scanRecord{ID: "20240501T000000Z", BaseDomains: []string{"booking"}, StartedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Results: []ScanResult{{Domain: "booking.com", Status: "OK", ValidTo: "2025-06-01"}}}
+	if err := ps.runners["travel"].store.save(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reload changes travel in place, drops retail and adds media.
+	travel.bases = []string{"booking", "expedia"}
+	media := daemonProfile{name: "media", bases: []string{"netflix"}, interval: time.Hour}
+	if err := ps.update(ctx, []daemonProfile{travel, media}, run); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ps.names(), ","); got != "media,travel" {
+		t.Errorf("profiles = %s", got)
+	}
+	if got := ps.runners["travel"].current().bases; len(got) != 2 {
+		t.Errorf("travel not updated: %v", got)
+	}
+	cancel()
+	ps.wait()
+	if started["travel"] != 1 || started["retail"] != 1 || started["media"] != 1 {
+		t.Errorf("started = %v", started)
+	}
+
+	for _, tc := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/profiles/", 200, `href="/profiles/travel/"`},
+		{"/profiles/travel", 301, ""},
+		{"/profiles/travel/", 200, `href="/profiles/travel/scans/20240501T000000Z"`},
+		{"/profiles/travel/domains/booking.com", 200, "2025-06-01"},
+		{"/profiles/media/domains/booking.com", 200, ""},
+		{"/profiles/retail/", 404, ""},
+	} {
+		w := httptest.NewRecorder()
+		ps.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+		if w.Code != tc.code || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("GET %s = %d %q, want %d with %q", tc.path, w.Code, w.Body.String(), tc.code, tc.want)
+		}
+	}
+}
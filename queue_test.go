@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTask(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "Example.COM\n", want: "example.com"},
+		{in: `{"domain":"amazon.de"}`, want: "amazon.de"},
+		{in: "", wantErr: true},
+		{in: "a b", wantErr: true},
+		{in: `{"domain":`, wantErr: true},
+		{in: "https://x/y", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTask([]byte(tt.in))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseTask(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestRespRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeRespCommand(&buf, []string{"XACK", "s", "g", "1-0"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "*4\r\n$4\r\nXACK\r\n$1\r\ns\r\n$1\r\ng\r\n$3\r\n1-0\r\n"; buf.String() != want {
+		t.Errorf("command = %q, want %q", buf.String(), want)
+	}
+
+	reply := "*3\r\n+OK\r\n:42\r\n*2\r\n$5\r\nhello\r\n$-1\r\n"
+	got, err := readResp(bufio.NewReader(strings.NewReader(reply)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"OK", int64(42), []any{"hello", nil}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reply = %#v, want %#v", got, want)
+	}
+
+	if _, err := readResp(bufio.NewReader(strings.NewReader("-BUSYGROUP exists\r\n"))); err == nil || !strings.Contains(err.Error(), "BUSYGROUP") {
+		t.Errorf("error reply = %v", err)
+	}
+}
+
+func TestRedisParseEntries(t *testing.T) {
+	q := &redisQueue{}
+	reply := []any{
+		[]any{"tasks", []any{
+			[]any{"1-0", []any{"domain", "a.example"}},
+			[]any{"2-0", []any{"task", `{"domain":"b.example"}`}},
+		}},
+	}
+	tasks := q.parseEntries(reply)
+	if len(tasks) != 2 || tasks[0].domain != "a.example" || tasks[1].domain != "b.example" {
+		t.Errorf("tasks = %+v", tasks)
+	}
+	if q.parseEntries(nil) != nil {
+		t.Error("nil reply (BLOCK timeout) should yield no tasks")
+	}
+}
+
+func TestRedisParseClaim(t *testing.T) {
+	q := &redisQueue{claimCursor: "0-0"}
+	reply := []any{
+		"5-0",
+		[]any{[]any{"3-0", []any{"domain", "stale.example"}}},
+		[]any{},
+	}
+	tasks := q.parseClaim(reply)
+	if len(tasks) != 1 || tasks[0].domain != "stale.example" {
+		t.Errorf("tasks = %+v", tasks)
+	}
+	if q.claimCursor != "5-0" {
+		t.Errorf("cursor = %q, want 5-0", q.claimCursor)
+	}
+}
+
+// TestNATSQueue runs the client against a scripted fake server.
+func TestNATSQueue(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	got := make(chan string, 8)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		r := bufio.NewReader(c)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			got <- line
+			switch {
+			case line == "PING":
+				c.Write([]byte("PONG\r\nMSG tasks 1 9\r\na.example\r\n"))
+			case strings.HasPrefix(line, "PUB "):
+				payload, _ := r.ReadString('\n')
+				got <- strings.TrimRight(payload, "\r\n")
+			}
+		}
+	}()
+
+	q, err := dialNATS("nats://tok@"+ln.Addr().String(), "tasks", "results", "grp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	task, err := q.next(ctx)
+	if err != nil || task.domain != "a.example" {
+		t.Fatalf("next = %+v, %v", task, err)
+	}
+	if err := q.publish(ScanResult{Domain: "a.example", Status: "OK"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for len(lines) < 5 {
+		select {
+		case l := <-got:
+			lines = append(lines, l)
+		case <-ctx.Done():
+			t.Fatalf("server saw %q", lines)
+		}
+	}
+	if !strings.HasPrefix(lines[0], "CONNECT ") || !strings.Contains(lines[0], `"auth_token":"tok"`) {
+		t.Errorf("CONNECT = %q", lines[0])
+	}
+	if lines[1] != "SUB tasks grp 1" {
+		t.Errorf("SUB = %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[3], "PUB results ") || !strings.Contains(lines[4], `"domain":"a.example"`) {
+		t.Errorf("PUB = %q %q", lines[3], lines[4])
+	}
+}
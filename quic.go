@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+// probeQUIC runs a QUIC handshake offering HTTP/3 on the UDP port matching
+// the TCP one and compares the certificate with the one served over TCP.
+// It returns NONE when no HTTP/3 endpoint answered, and SAME or DIFFERENT
+// otherwise.
+func (s *scanner) probeQUIC(ip, domain string, tcpLeaf *x509.Certificate) string {
+	release, err := s.hostLimit.acquire(context.Background(), ip)
+	if err != nil {
+		return "NONE"
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, net.JoinHostPort(ip, s.port), &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         domain,
+		NextProtos:         []string{"h3"},
+	}, &quic.Config{HandshakeIdleTimeout: s.timeout})
+	if err != nil {
+		debugf("No QUIC on %s (%s): %v", domain, ip, err)
+		return "NONE"
+	}
+	defer conn.CloseWithError(0, "")
+
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return "NONE"
+	}
+	if !bytes.Equal(certs[0].Raw, tcpLeaf.Raw) {
+		debugf("QUIC certificate of %s differs: %s issued by %s, valid to %s",
+			domain, certSubject(certs[0]), certs[0].Issuer.CommonName, certs[0].NotAfter.Format("2006-01-02"))
+		return "DIFFERENT"
+	}
+	return "SAME"
+}
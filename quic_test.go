@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestScanProbesQUIC(t *testing.T) {
+	tcpCert, err := selfSignedCert("h3.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, err := selfSignedCert("h3.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{tcpCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	s := &scanner{
+		port:       port,
+		timeout:    500 * time.Millisecond,
+		quic:       true,
+		lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+	}
+	if r := s.scan("h3.example"); r.Status != "OK" || r.QUIC != "NONE" {
+		t.Errorf("without an HTTP/3 listener: %+v, want QUIC NONE", r)
+	}
+
+	for _, tc := range []struct {
+		cert tls.Certificate
+		want string
+	}{{tcpCert, "SAME"}, {otherCert, "DIFFERENT"}} {
+		ql, err := quic.ListenAddr("127.0.0.1:"+port, &tls.Config{Certificates: []tls.Certificate{tc.cert}, NextProtos: []string{"h3"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				c, err := ql.Accept(context.Background())
+				if err != nil {
+					return
+				}
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					c.CloseWithError(0, "")
+				}()
+			}
+		}()
+		if r := s.scan("h3.example"); r.QUIC != tc.want {
+			t.Errorf("QUIC = %q, want %s", r.QUIC, tc.want)
+		}
+		ql.Close()
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRedirects is --follow-redirects: how many redirects are followed from
+// https://<domain>/ of every OK result, 0 for none.
+var maxRedirects int
+
+// followRedirectsFor is --follow-redirects for profile: redirects are only
+// followed over HTTPS.
+func followRedirectsFor(profile string) int {
+	if profile != "https" {
+		return 0
+	}
+	return maxRedirects
+}
+
+// redirectHop is one request of a redirect chain: where it went, what
+// answered and, over HTTPS, with which certificate.
+type redirectHop struct {
+	URL     string `json:"url"`
+	IP      string `json:"ip,omitempty"`
+	Status  int    `json:"status,omitempty"` // 0 when the request failed
+	Error   string `json:"error,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+	ValidTo string `json:"valid_to,omitempty"`
+	SPKI    string `json:"spki_sha256,omitempty"`
+}
+
+// followRedirects requests https://<domain>/ from ip and follows the
+// Location of every redirect, each hop over a connection of its own, for
+// at most s.redirects redirects. It returns the hops and the URL the chain
+// ended on: the page that was served, or the hop that failed.
+func (s *scanner) followRedirects(domain, ip string) ([]redirectHop, string) {
+	host := domain
+	if s.port != "443" {
+		host = net.JoinHostPort(domain, s.port)
+	}
+	next := &url.URL{Scheme: "https", Host: host, Path: "/"}
+	var hops []redirectHop
+	seen := make(map[string]bool)
+	for {
+		hop, location := s.requestHop(next, ip)
+		hops = append(hops, hop)
+		seen[next.String()] = true
+		if location == "" {
+			return hops, hop.URL
+		}
+		target, err := next.Parse(location)
+		switch {
+		case err != nil:
+			hops[len(hops)-1].Error = fmt.Sprintf("bad Location %q: %v", location, err)
+		case target.Scheme != "http" && target.Scheme != "https":
+			hops[len(hops)-1].Error = fmt.Sprintf("redirect to unsupported scheme %q", target.Scheme)
+		case seen[target.String()]:
+			hops[len(hops)-1].Error = "redirect loop to " + target.String()
+		case len(hops) > s.redirects:
+			hops[len(hops)-1].Error = fmt.Sprintf("more than %d redirects", s.redirects)
+		default:
+			next, ip = target, ""
+			continue
+		}
+		return hops, hop.URL
+	}
+}
+
+// requestHop sends a GET for u, to ip when set and to the first address
+// of its host otherwise, and returns the hop and the Location of a
+// redirect.
+func (s *scanner) requestHop(u *url.URL, ip string) (redirectHop, string) {
+	hop := redirectHop{URL: u.String()}
+	fail := func(err error) (redirectHop, string) {
+		hop.Error = err.Error()
+		return hop, ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	if ip == "" {
+		ips, err := s.lookup(u.Hostname())
+		if err != nil {
+			return fail(err)
+		}
+		if len(ips) == 0 {
+			return fail(fmt.Errorf("%s has no addresses", u.Hostname()))
+		}
+		ip = ips[0]
+	}
+	hop.IP = ip
+	raw, err := s.dialHost(context.Background(), ip, port)
+	if err != nil {
+		return fail(err)
+	}
+	var conn net.Conn = raw
+	if u.Scheme == "https" {
+		tlsConn, err := s.handshake(raw, u.Hostname())
+		if err != nil {
+			return fail(err)
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			hop.Subject, hop.Issuer = certSubject(certs[0]), certs[0].Issuer.CommonName
+			hop.ValidTo, hop.SPKI = timestamp(certs[0].NotAfter), spkiHash(certs[0])
+		}
+		conn = tlsConn
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: tls-sweep\r\nAccept: */*\r\nConnection: close\r\n\r\n", u.RequestURI(), u.Host)
+	if _, err := io.WriteString(conn, req); err != nil {
+		return fail(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return fail(err)
+	}
+	resp.Body.Close()
+	hop.Status = resp.StatusCode
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return hop, resp.Header.Get("Location")
+	}
+	return hop, ""
+}
+
+// redirectCell flattens hops for the CSV, as "url status subject" per hop
+// separated by " -> ".
+func redirectCell(hops []redirectHop) string {
+	cells := make([]string, len(hops))
+	for i, h := range hops {
+		cell := h.URL
+		if h.Status != 0 {
+			cell += fmt.Sprintf(" %d", h.Status)
+		}
+		if h.Subject != "" {
+			cell += " " + h.Subject
+		}
+		if h.Error != "" {
+			cell += " (" + h.Error + ")"
+		}
+		cells[i] = cell
+	}
+	return strings.Join(cells, " -> ")
+}
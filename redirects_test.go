@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// redirectServers serves https and http on loopback, answering every host
+// with handler; the HTTPS certificate is issued to the requested name.
+func redirectServers(t *testing.T, handler func(httpsPort, httpPort string) http.HandlerFunc) (httpsPort, httpPort string) {
+	t.Helper()
+	tlsLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tlsLn.Close(); plainLn.Close() })
+	_, httpsPort, _ = net.SplitHostPort(tlsLn.Addr().String())
+	_, httpPort, _ = net.SplitHostPort(plainLn.Addr().String())
+	config := &tls.Config{GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		c, err := selfSignedCert(hello.ServerName)
+		return &c, err
+	}}
+	h := handler(httpsPort, httpPort)
+	go http.Serve(tls.NewListener(tlsLn, config), h)
+	go http.Serve(plainLn, h)
+	return httpsPort, httpPort
+}
+
+func redirectScanner(port string, redirects int) *scanner {
+	return &scanner{
+		port:       port,
+		timeout:    time.Second,
+		lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+		redirects:  redirects,
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+	httpsPort, _ := redirectServers(t, func(httpsPort, httpPort string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			switch r.Host {
+			case "brand.example:" + httpsPort:
+				http.Redirect(w, r, "https://tracker.example:"+httpsPort+"/click?id=1", http.StatusMovedPermanently)
+			case "tracker.example:" + httpsPort:
+				http.Redirect(w, r, "http://phish.example:"+httpPort+"/login", http.StatusFound)
+			default:
+				w.Write([]byte("sign in"))
+			}
+		}
+	})
+	r := redirectScanner(httpsPort, 5).scan("brand.example")
+	if r.Status != "OK" {
+		t.Fatalf("status %s", r.Status)
+	}
+	if len(r.Redirects) != 3 {
+		t.Fatalf("got %d hops: %+v", len(r.Redirects), r.Redirects)
+	}
+	for i, want := range []struct {
+		url     string
+		status  int
+		subject string
+	}{
+		{"https://brand.example:" + httpsPort + "/", 301, "brand.example"},
+		{"https://tracker.example:" + httpsPort + "/click?id=1", 302, "tracker.example"},
+		{"", 200, ""},
+	} {
+		h := r.Redirects[i]
+		if (want.url != "" && h.URL != want.url) || h.Status != want.status || h.Subject != want.subject || h.IP != "127.0.0.1" {
+			t.Errorf("hop %d = %+v", i, h)
+		}
+	}
+	if !strings.HasPrefix(r.FinalURL, "http://phish.example:") || !strings.HasSuffix(r.FinalURL, "/login") {
+		t.Errorf("FinalURL = %s", r.FinalURL)
+	}
+	if cell := redirectCell(r.Redirects); !strings.Contains(cell, " 301 brand.example -> https://tracker.example:") {
+		t.Errorf("CSV cell %q", cell)
+	}
+}
+
+func TestFollowRedirectsStops(t *testing.T) {
+	httpsPort, _ := redirectServers(t, func(httpsPort, _ string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/":
+				http.Redirect(w, r, "/a", http.StatusFound)
+			case "/a":
+				http.Redirect(w, r, "/b", http.StatusFound)
+			default:
+				http.Redirect(w, r, "/a", http.StatusFound)
+			}
+		}
+	})
+	r := redirectScanner(httpsPort, 5).scan("brand.example")
+	if n := len(r.Redirects); n != 3 || !strings.HasPrefix(r.Redirects[n-1].Error, "redirect loop to ") {
+		t.Errorf("loop: %+v", r.Redirects)
+	}
+	r = redirectScanner(httpsPort, 1).scan("brand.example")
+	if n := len(r.Redirects); n != 2 || r.Redirects[n-1].Error != "more than 1 redirects" || !strings.HasSuffix(r.FinalURL, "/a") {
+		t.Errorf("limit: %+v, final %s", r.Redirects, r.FinalURL)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// regionAnchorSpecs are the --region-anchor values, name=host:port.
+var regionAnchorSpecs []string
+
+// rttProbes is how many TCP connects a round trip is the minimum of.
+const rttProbes = 3
+
+func addRegionAnchor(v string) error {
+	name, addr, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want name=host:port, got %q", v)
+	}
+	if err := checkAddr(addr); err != nil {
+		return fmt.Errorf("%s: %v", v, err)
+	}
+	regionAnchorSpecs = append(regionAnchorSpecs, v)
+	return nil
+}
+
+// regionAnchor is a host of known location and its round trip from here.
+type regionAnchor struct {
+	name string
+	rtt  time.Duration
+}
+
+// regionEstimator guesses where a host is from its round trip: close to the
+// anchor whose round trip is nearest. It only tells regions apart that are
+// at clearly different distances from the scanner, and says nothing when
+// no anchor is near enough.
+type regionEstimator struct {
+	anchors []regionAnchor
+}
+
+// estimate is the region of a host rtt away, or "" when no anchor is
+// within 30% (and at least 10ms) of it.
+func (e *regionEstimator) estimate(rtt time.Duration) string {
+	best, bestDiff := "", time.Duration(math.MaxInt64)
+	for _, a := range e.anchors {
+		diff := rtt - a.rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= max(a.rtt*3/10, 10*time.Millisecond) && diff < bestDiff {
+			best, bestDiff = a.name, diff
+		}
+	}
+	return best
+}
+
+// regionAnchors measures the --region-anchor hosts once. It is nil without
+// anchors or when none answered.
+var regionAnchors = sync.OnceValue(func() *regionEstimator {
+	if len(regionAnchorSpecs) == 0 {
+		return nil
+	}
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	e := &regionEstimator{}
+	for _, spec := range regionAnchorSpecs {
+		name, addr, _ := strings.Cut(spec, "=")
+		rtt, err := minRTT(context.Background(), dial, addr, rttProbes)
+		if err != nil {
+			logger.Printf("Region anchor %s unreachable, ignored: %v\n", name, err)
+			continue
+		}
+		debugf("Region anchor %s is %v away", name, rtt)
+		e.anchors = append(e.anchors, regionAnchor{name, rtt})
+	}
+	if len(e.anchors) == 0 {
+		logger.Printf("No region anchor answered, EstimatedRegion stays empty\n")
+		return nil
+	}
+	return e
+})
+
+// minRTT is the fastest of n TCP connects to addr, which is close to the
+// network round trip.
+func minRTT(ctx context.Context, dial func(ctx context.Context, addr string) (net.Conn, error), addr string, n int) (time.Duration, error) {
+	best := time.Duration(0)
+	var lastErr error
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		conn, err := dial(ctx, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		if best == 0 || rtt < best {
+			best = rtt
+		}
+	}
+	if best == 0 {
+		return 0, lastErr
+	}
+	return best, nil
+}
+
+// estimateRegion refines the round trip of the connect that found r with
+// more probes of its IP and fills EstimatedRegion.
+func (s *scanner) estimateRegion(r *ScanResult, connect time.Duration) {
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		host, port, _ := net.SplitHostPort(addr)
+		return s.dialHost(ctx, host, port)
+	}
+	rtt := connect
+	if probed, err := minRTT(context.Background(), dial, net.JoinHostPort(r.IP, s.port), rttProbes-1); err == nil {
+		rtt = min(rtt, probed)
+	}
+	r.EstimatedRegion = s.regions.estimate(rtt)
+}
+
+// millis is d in whole milliseconds, at least 1.
+func millis(d time.Duration) int {
+	return max(int(d.Milliseconds()), 1)
+}
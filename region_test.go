@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRegionEstimate(t *testing.T) {
+	e := &regionEstimator{anchors: []regionAnchor{
+		{"eu-west", 12 * time.Millisecond},
+		{"us-east", 85 * time.Millisecond},
+		{"ap-southeast", 240 * time.Millisecond},
+	}}
+	for rtt, want := range map[time.Duration]string{
+		3 * time.Millisecond:   "eu-west",
+		20 * time.Millisecond:  "eu-west",
+		95 * time.Millisecond:  "us-east",
+		150 * time.Millisecond: "", // between anchors
+		270 * time.Millisecond: "ap-southeast",
+	} {
+		if got := e.estimate(rtt); got != want {
+			t.Errorf("estimate(%v) = %q, want %q", rtt, got, want)
+		}
+	}
+}
+
+func TestAddRegionAnchor(t *testing.T) {
+	defer func() { regionAnchorSpecs = nil }()
+	if err := addRegionAnchor("eu-west=ec2.eu-west-1.amazonaws.com:443"); err != nil {
+		t.Error(err)
+	}
+	for _, bad := range []string{"eu-west", "=host:443", "eu-west=host"} {
+		if addRegionAnchor(bad) == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestMinRTT(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	calls := 0
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("lost")
+		}
+		return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if rtt, err := minRTT(context.Background(), dial, l.Addr().String(), 3); err != nil || rtt <= 0 || calls != 3 {
+		t.Errorf("got %v, %v after %d connects", rtt, err, calls)
+	}
+	failing := func(context.Context, string) (net.Conn, error) { return nil, errors.New("down") }
+	if _, err := minRTT(context.Background(), failing, l.Addr().String(), 3); err == nil {
+		t.Error("no error when every connect failed")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Certificates valid for at most maxAutomatedLifetime are assumed to be
+// renewed by an ACME client, which renews once two thirds of the lifetime
+// have passed (day 60 of Let's Encrypt's 90).
+const maxAutomatedLifetime = 100 * 24 * time.Hour
+
+// renewalOverdue reports whether leaf is a short-lived certificate past its
+// renewal window at now.
+func renewalOverdue(leaf *x509.Certificate, now time.Time) bool {
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return lifetime <= maxAutomatedLifetime && now.Sub(leaf.NotBefore) > lifetime*2/3
+}
+
+// ctEntry is one certificate of a crt.sh JSON search result.
+type ctEntry struct {
+	ID        int64  `json:"id"`
+	NameValue string `json:"name_value"` // newline-separated names
+	NotBefore string `json:"not_before"` // 2006-01-02T15:04:05, UTC
+}
+
+// crtshLookup returns the certificates crt.sh has logged for domain. An
+// answer is reused for an hour: crt.sh is slow and quick to throttle.
+func crtshLookup(domain string) ([]ctEntry, error) {
+	body, err := metadata().get("https://crt.sh/?output=json&q="+url.QueryEscape(domain), time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ctEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("crt.sh: %v", err)
+	}
+	return entries, nil
+}
+
+// newerLogged returns the issue date of the newest certificate for domain
+// in entries issued after leaf, if any.
+func newerLogged(entries []ctEntry, domain string, leaf *x509.Certificate) (time.Time, bool) {
+	var newest time.Time
+	for _, e := range entries {
+		issued, err := time.Parse("2006-01-02T15:04:05", e.NotBefore)
+		if err != nil || !issued.After(leaf.NotBefore.Add(time.Minute)) {
+			continue
+		}
+		for _, name := range strings.Split(e.NameValue, "\n") {
+			if strings.EqualFold(strings.TrimSpace(name), domain) && issued.After(newest) {
+				newest = issued
+			}
+		}
+	}
+	return newest, !newest.IsZero()
+}
+
+// renewalCheck fails short-lived certificates past their renewal window.
+// With a CT lookup it tells automation that stopped issuing apart from a
+// renewed certificate that was never deployed.
+func renewalCheck(_ *scanner, r ScanResult, o checkOptions) (string, bool) {
+	leaf := leafOf(r)
+	if leaf == nil || !renewalOverdue(leaf, o.now) {
+		return "", false
+	}
+	age := int(o.now.Sub(leaf.NotBefore).Hours() / 24)
+	lifetime := int(leaf.NotAfter.Sub(leaf.NotBefore).Hours() / 24)
+	detail := fmt.Sprintf("%d-day certificate is %d days old", lifetime, age)
+	if o.lookupCT == nil {
+		return detail, true
+	}
+	entries, err := o.lookupCT(r.Domain)
+	if err != nil {
+		return detail + " (CT lookup failed: " + err.Error() + ")", true
+	}
+	if issued, ok := newerLogged(entries, r.Domain, leaf); ok {
+		return detail + ", a replacement was logged on " + issued.Format("2006-01-02") + " but is not deployed", true
+	}
+	return detail + ", no replacement in CT", true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenewalCheck(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cert := func(issued time.Time, days int) ScanResult {
+		leaf := &x509.Certificate{NotBefore: issued, NotAfter: issued.AddDate(0, 0, days)}
+		return ScanResult{Domain: "a.example", Status: "OK", Chain: []*x509.Certificate{leaf}}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		r      ScanResult
+		failed bool
+	}{
+		{"fresh 90-day", cert(now.AddDate(0, 0, -30), 90), false},
+		{"overdue 90-day", cert(now.AddDate(0, 0, -65), 90), true},
+		{"old 1-year", cert(now.AddDate(0, 0, -300), 365), false},
+		{"tls error", ScanResult{Status: "TLS ERROR"}, false},
+	} {
+		if detail, failed := renewalCheck(nil, tc.r, checkOptions{now: now}); failed != tc.failed {
+			t.Errorf("%s: failed = %v (%s)", tc.name, failed, detail)
+		}
+	}
+
+	overdue := cert(now.AddDate(0, 0, -65), 90)
+	logged := []ctEntry{
+		{NameValue: "a.example\nwww.a.example", NotBefore: "2024-04-01T10:00:00"},
+		{NameValue: "other.example", NotBefore: "2024-04-20T10:00:00"},
+	}
+	opts := checkOptions{now: now, lookupCT: func(string) ([]ctEntry, error) { return logged, nil }}
+	if detail, _ := renewalCheck(nil, overdue, opts); !strings.Contains(detail, "logged on 2024-04-01 but is not deployed") {
+		t.Errorf("with replacement in CT: %s", detail)
+	}
+	logged = logged[1:]
+	if detail, _ := renewalCheck(nil, overdue, opts); !strings.HasSuffix(detail, "no replacement in CT") {
+		t.Errorf("without replacement in CT: %s", detail)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func runRetry(args []string) {
+	fs := flag.NewFlagSet("retry", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep retry [flags] <results.json|results.ndjson>")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "file the merged results are written to (default: overwrite the input)")
+	registerScanFlags(fs)
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if maxWorkers < 1 {
+		logger.Fatalf("--workers must be at least 1\n")
+	}
+	if err := checkTLSRange(); err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+	input := args[0]
+	if *output == "" {
+		*output = input
+	}
+
+	results, err := loadExport(input)
+	if err != nil {
+		logger.Fatalf("Failed to load results: %v\n", err)
+	}
+	s := newScanner()
+	for _, r := range results {
+		if r.MX != "" {
+			s.mx = true // the previous run was an --mx sweep
+			break
+		}
+	}
+
+	var failed []string
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if isFailure(r.Status) && !seen[r.Domain] {
+			seen[r.Domain] = true
+			failed = append(failed, r.Domain)
+		}
+	}
+	logger.Printf("Retrying %d of %d results\n", len(failed), len(results))
+
+	retried := make(chan ScanResult, len(failed))
+	go sweep(context.Background(), s, failed, retried)
+	var fresh []ScanResult
+	for r := range retried {
+		fresh = append(fresh, r)
+	}
+	merged := mergeRetried(results, fresh)
+
+	fixed := 0
+	for _, r := range merged {
+		if seen[r.Domain] && !isFailure(r.Status) {
+			fixed++
+		}
+	}
+	if err := writeExport(*output, merged); err != nil {
+		logger.Fatalf("Failed to write %s: %v\n", *output, err)
+	}
+	logger.Printf("%d retried results no longer fail, written to %s\n", fixed, *output)
+}
+
+// mergeRetried replaces every row of a retried domain with its fresh
+// results, in the place of the domain's first row. Domains that now turn
+// out not to exist are dropped, as in any export.
+func mergeRetried(results, fresh []ScanResult) []ScanResult {
+	byDomain := make(map[string][]ScanResult)
+	for _, r := range fresh {
+		byDomain[r.Domain] = append(byDomain[r.Domain], r)
+	}
+	var merged []ScanResult
+	done := make(map[string]bool)
+	for _, r := range results {
+		rows, ok := byDomain[r.Domain]
+		if !ok {
+			merged = append(merged, r)
+			continue
+		}
+		if done[r.Domain] {
+			continue
+		}
+		done[r.Domain] = true
+		for _, n := range rows {
+			if n.Status != "NXDOMAIN" {
+				merged = append(merged, n)
+			}
+		}
+	}
+	return merged
+}
+
+// writeExport writes results to path as a JSON export, or NDJSON when the
+// path ends in .ndjson, replacing the file atomically.
+func writeExport(path string, results []ScanResult) error {
+	tmp, err := createAtomic(path, 0o644)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(tmp)
+	if strings.HasSuffix(path, ".ndjson") {
+		for _, r := range results {
+			if err = enc.Encode(versionedResult{resultSchemaVersion, r}); err != nil {
+				break
+			}
+		}
+	} else {
+		if results == nil {
+			results = []ScanResult{}
+		}
+		err = enc.Encode(jsonExport{resultSchemaVersion, results})
+	}
+	if err != nil {
+		tmp.abort()
+		return err
+	}
+	return tmp.Close()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeRetried(t *testing.T) {
+	results := []ScanResult{
+		{Domain: "a.example", Status: "OK"},
+		{Domain: "b.example", Status: "TLS ERROR"},
+		{Domain: "c.example", Status: "FILTERED"},
+		{Domain: "d.example", Status: "DNS ERROR"},
+	}
+	fresh := []ScanResult{
+		{Domain: "c.example", Status: "FILTERED"},
+		{Domain: "b.example", Status: "OK", IP: "192.0.2.1"},
+		{Domain: "d.example", Status: "NXDOMAIN"},
+	}
+	want := []ScanResult{
+		{Domain: "a.example", Status: "OK"},
+		{Domain: "b.example", Status: "OK", IP: "192.0.2.1"},
+		{Domain: "c.example", Status: "FILTERED"},
+	}
+	merged := mergeRetried(results, fresh)
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("merged = %+v, want %+v", merged, want)
+	}
+
+	for _, name := range []string{"out.json", "out.ndjson"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := writeExport(path, merged); err != nil {
+			t.Fatal(err)
+		}
+		back, err := loadExport(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(back, want) {
+			t.Errorf("%s round trip = %+v", name, back)
+		}
+	}
+}
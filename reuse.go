@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+var certReuse bool
+
+// spkiHash is the hex SHA-256 of cert's SubjectPublicKeyInfo, the pin that
+// stays the same when a certificate is renewed on the same key.
+func spkiHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// reuseResults holds back every result until the sweep is done, then sets
+// SharedWith to the number of other domains presenting the same key.
+// Domains sharing a key share hosting or, for a key nobody else has, an
+// operator.
+func reuseResults(in <-chan ScanResult) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		var all []ScanResult
+		for r := range in {
+			all = append(all, r)
+		}
+		markSharedKeys(all)
+		for _, r := range all {
+			out <- r
+		}
+	}()
+	return out
+}
+
+func markSharedKeys(results []ScanResult) {
+	domains := make(map[string]map[string]bool)
+	for _, r := range results {
+		if r.SPKI == "" {
+			continue
+		}
+		if domains[r.SPKI] == nil {
+			domains[r.SPKI] = make(map[string]bool)
+		}
+		domains[r.SPKI][r.Domain] = true
+	}
+	for i, r := range results {
+		if r.SPKI != "" {
+			results[i].SharedWith = len(domains[r.SPKI]) - 1
+		}
+	}
+}
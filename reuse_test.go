@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestReuseResults(t *testing.T) {
+	shared, err := selfSignedCert("shared.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := selfSignedCert("own.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := func(der []byte) *x509.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	sharedLeaf, ownLeaf := leaf(shared.Certificate[0]), leaf(own.Certificate[0])
+
+	in := make(chan ScanResult, 5)
+	in <- certResult("a.example", "192.0.2.1", []*x509.Certificate{sharedLeaf})
+	in <- certResult("b.example", "192.0.2.2", []*x509.Certificate{sharedLeaf})
+	// Two MX rows of the same domain count once.
+	in <- certResult("b.example", "192.0.2.3", []*x509.Certificate{sharedLeaf})
+	in <- certResult("c.example", "192.0.2.4", []*x509.Certificate{ownLeaf})
+	in <- ScanResult{Domain: "d.example", Status: "TLS ERROR"}
+	close(in)
+
+	got := make(map[string]int)
+	for r := range reuseResults(in) {
+		got[r.Domain+"/"+r.IP] = r.SharedWith
+	}
+	want := map[string]int{"a.example/192.0.2.1": 1, "b.example/192.0.2.2": 1, "b.example/192.0.2.3": 1, "c.example/192.0.2.4": 0, "d.example/": 0}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: SharedWith %d, want %d", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// SARIF 2.1.0, trimmed to the properties code-scanning importers read.
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogical         `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation struct {
+		URI string `json:"uri"`
+	} `json:"artifactLocation"`
+	Region struct {
+		StartLine int `json:"startLine"`
+	} `json:"region"`
+}
+
+type sarifLogical struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// writeSARIF emits findings as a SARIF log with one rule per enabled check.
+// Code-scanning dashboards need a file location, so each result points at
+// the domain's line in input; with input from stdin only the logical
+// location (the domain) is set.
+func writeSARIF(w io.Writer, input string, lines map[string]int, enabled []string, findings []checkFinding) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "tls-sweep",
+			InformationURI: "https://github.com/mberlanda/tls-sweep",
+		}},
+		Results: []sarifResult{},
+	}
+	rules := append([]string(nil), enabled...)
+	sort.Strings(rules)
+	for _, name := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: name, ShortDescription: sarifMessage{checkDescriptions[name]}})
+	}
+
+	for _, f := range findings {
+		loc := sarifLocation{LogicalLocations: []sarifLogical{{Name: f.Domain, Kind: "resource"}}}
+		if line, ok := lines[f.Domain]; ok && input != "-" {
+			loc.PhysicalLocation = &sarifPhysicalLocation{}
+			loc.PhysicalLocation.ArtifactLocation.URI = input
+			loc.PhysicalLocation.Region.StartLine = line
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    f.Check,
+			Level:     "error",
+			Message:   sarifMessage{f.Domain + ": " + f.Detail},
+			Locations: []sarifLocation{loc},
+			// Keeps the alert identity stable across runs even when the
+			// detail changes, e.g. the days left before expiry.
+			PartialFingerprints: map[string]string{"domainCheck/v1": f.Domain + "/" + f.Check},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	findings := []checkFinding{{"a.example", "expired", "expired 2024-01-01"}}
+	lines := map[string]int{"a.example": 3}
+	if err := writeSARIF(&buf, "domains.txt", lines, []string{"unreachable", "expired"}, findings); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log %s", buf.String())
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "expired" {
+		t.Errorf("rules = %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 1 {
+		t.Fatalf("results = %+v", run.Results)
+	}
+	res := run.Results[0]
+	loc := res.Locations[0]
+	if res.RuleID != "expired" || loc.PhysicalLocation == nil ||
+		loc.PhysicalLocation.ArtifactLocation.URI != "domains.txt" || loc.PhysicalLocation.Region.StartLine != 3 {
+		t.Errorf("result = %s", buf.String())
+	}
+	if loc.LogicalLocations[0].Name != "a.example" {
+		t.Errorf("logical location = %+v", loc.LogicalLocations)
+	}
+
+	buf.Reset()
+	writeSARIF(&buf, "-", lines, []string{"expired"}, findings)
+	var stdinLog sarifLog
+	json.Unmarshal(buf.Bytes(), &stdinLog)
+	if stdinLog.Runs[0].Results[0].Locations[0].PhysicalLocation != nil {
+		t.Error("stdin input got a physical location")
+	}
+}
+
+func TestCheckDescriptions(t *testing.T) {
+	for name := range checks {
+		if checkDescriptions[name] == "" {
+			t.Errorf("check %s has no description", name)
+		}
+	}
+}
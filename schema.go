@@ -0,0 +1,74 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// resultSchemaVersion is the version of schema/result.schema.json. Bump the
+// minor version when adding fields and the major one for anything that
+// could break an existing parser.
+const resultSchemaVersion = "2.1.0"
+
+//go:embed schema/result.schema.json
+var resultSchema []byte
+
+func runSchema(args []string) {
+	if len(args) > 0 && args[0] == "--version" {
+		fmt.Println(resultSchemaVersion)
+		return
+	}
+	os.Stdout.Write(resultSchema)
+}
+
+// versionedResult is one NDJSON line.
+type versionedResult struct {
+	SchemaVersion string `json:"schema_version"`
+	ScanResult
+}
+
+// jsonExport is the document of a JSON export.
+type jsonExport struct {
+	SchemaVersion string       `json:"schema_version"`
+	Results       []ScanResult `json:"results"`
+}
+
+// exportToJSON writes results to <base-domain>.json, or <base-domain>.ndjson
+// with one result per line. NXDOMAIN results are skipped as in the CSV.
+func exportToJSON(baseDomain string, results chan ScanResult, ndjson bool) {
+	fileName := exportPath(baseDomain, "json")
+	if ndjson {
+		fileName = exportPath(baseDomain, "ndjson")
+	}
+	sink := createSink(fileName, "json", baseDomain, func(r ScanResult) []byte {
+		line, _ := json.Marshal(versionedResult{resultSchemaVersion, r})
+		return append(line, '\n')
+	})
+
+	all := []ScanResult{}
+	notFound := 0
+	for res := range results {
+		if res.Status == "NXDOMAIN" {
+			notFound++
+			continue
+		}
+		if ndjson {
+			sink.send(res)
+		} else {
+			all = append(all, res)
+		}
+	}
+	if !ndjson {
+		doc, _ := json.Marshal(jsonExport{resultSchemaVersion, all})
+		if !sink.writeBytes(append(doc, '\n')) {
+			sink.spoolAll(all)
+		}
+	}
+
+	logger.Printf("Found %d domains that do not exist\n", notFound)
+	if sink.close() {
+		logger.Printf("Results exported to %s\n", fileName)
+	}
+}
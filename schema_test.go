@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestSchemaCoversResult keeps the published schema in step with the
+// fields ScanResult actually emits.
+func TestSchemaCoversResult(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(resultSchema, &schema); err != nil {
+		t.Fatalf("embedded schema is not valid JSON: %v", err)
+	}
+
+	want := []string{"schema_version"}
+	rt := reflect.TypeOf(ScanResult{})
+	for i := 0; i < rt.NumField(); i++ {
+		if name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ","); name != "-" {
+			want = append(want, name)
+		}
+	}
+	var got []string
+	for name := range schema.Properties {
+		got = append(got, name)
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("schema properties %v, ScanResult fields %v", got, want)
+	}
+}
+
+func TestExportToJSON(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, ndjson := range []bool{false, true} {
+		results := make(chan ScanResult, 2)
+		results <- ScanResult{Domain: "a.example", Status: "OK"}
+		results <- ScanResult{Domain: "b.example", Status: "NXDOMAIN"}
+		close(results)
+		exportToJSON("example", results, ndjson)
+	}
+
+	var doc struct {
+		SchemaVersion string       `json:"schema_version"`
+		Results       []ScanResult `json:"results"`
+	}
+	data, err := os.ReadFile("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.SchemaVersion != resultSchemaVersion || len(doc.Results) != 1 {
+		t.Errorf("example.json = %s (%v)", data, err)
+	}
+
+	f, err := os.Open("example.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	n := 0
+	for lines.Scan() {
+		var line versionedResult
+		if err := json.Unmarshal(lines.Bytes(), &line); err != nil || line.SchemaVersion != resultSchemaVersion || line.Domain != "a.example" {
+			t.Errorf("ndjson line %s (%v)", lines.Text(), err)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("ndjson has %d lines, want 1", n)
+	}
+}
+
+// TestExportToStdout is --output -: the export goes to stdout and nothing
+// is written to disk.
+func TestExportToStdout(t *testing.T) {
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	outputDir = "-"
+	defer func() { outputDir = "." }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	results := make(chan ScanResult, 1)
+	results <- ScanResult{Domain: "a.example", Status: "OK"}
+	close(results)
+	exportToJSON("example", results, true)
+	w.Close()
+
+	var line versionedResult
+	if err := json.NewDecoder(r).Decode(&line); err != nil || line.Domain != "a.example" {
+		t.Errorf("stdout line %+v (%v)", line, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files written: %v", entries)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	minScore      int
+	asnReputation string
+	scoreTitles   bool
+)
+
+// registerScoreFlags binds the brand-protection scoring flags of the
+// default sweep.
+func registerScoreFlags(fs *flag.FlagSet) {
+	fs.IntVar(&minScore, "min-score", 0, "only export results with at least this risk score (0-100)")
+	fs.StringVar(&asnReputation, "asn-reputation", "", "file of \"AS<number> <points>\" lines scoring the hosting ASN")
+	fs.Func("ioc-feed", "blocklist of IPs, domains or certificate fingerprints as [name=]path, such as an abuse.ch CSV; repeatable, hits go to ThreatMatch", func(v string) error {
+		iocFeedFiles = append(iocFeedFiles, v)
+		return nil
+	})
+	fs.BoolVar(&scoreTitles, "score-titles", false, "fetch each live site's page title and score it when it names the brand")
+}
+
+// Points per signal. The sum is capped at 100.
+const (
+	scoreRecentCert    = 25 // certificate issued in the last 30 days
+	scoreFreeCA        = 20
+	scoreBrandInCert   = 15 // certificate subject names the brand
+	scoreTitleMatch    = 30
+	scoreThreatMatch   = 60 // IP, domain or certificate on an --ioc-feed
+	scoreInsecure      = 10 // a --probe-insecure finding: unmaintained TLS stack
+	scoreLookalikeName = 25 // a label is a homoglyph or typo of the brand
+	recentCertDuration = 30 * 24 * time.Hour
+)
+
+// freeCAs are issuers handing out certificates to anyone for free, which
+// is what most throwaway phishing sites use. Let's Encrypt certificates
+// name one of its intermediates rather than the organisation.
+var (
+	freeCAs                  = []string{"let's encrypt", "zerossl", "buypass"}
+	letsEncryptIntermediates = []string{"r3", "r10", "r11", "r12", "r13", "r14", "e1", "e5", "e6", "e7", "e8", "e9"}
+)
+
+func isFreeCA(issuer string) bool {
+	issuer = strings.ToLower(issuer)
+	for _, ca := range freeCAs {
+		if strings.Contains(issuer, ca) {
+			return true
+		}
+	}
+	return slices.Contains(letsEncryptIntermediates, issuer)
+}
+
+type scorer struct {
+	brand string
+	now   time.Time
+	// asnPoints maps an AS number (without the AS prefix) to points.
+	asnPoints  map[string]int
+	lookupTXT  func(name string) ([]string, error)
+	fetchTitle func(domain string) (string, error)
+	feeds      []*iocFeed
+}
+
+func newScorer(brand string) (*scorer, error) {
+	sc := &scorer{brand: strings.ToLower(brand), now: time.Now(), lookupTXT: net.LookupTXT}
+	if asnReputation != "" {
+		points, err := loadASNReputation(asnReputation)
+		if err != nil {
+			return nil, err
+		}
+		sc.asnPoints = points
+	}
+	if scoreTitles {
+		sc.fetchTitle = fetchTitle
+	}
+	for _, arg := range iocFeedFiles {
+		feed, err := loadIOCFeed(arg)
+		if err != nil {
+			return nil, err
+		}
+		sc.feeds = append(sc.feeds, feed)
+	}
+	return sc, nil
+}
+
+func loadASNReputation(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	points := make(map[string]int)
+	lines := bufio.NewScanner(f)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"AS<number> <points>\"", path, n)
+		}
+		p, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		points[strings.TrimPrefix(strings.ToUpper(fields[0]), "AS")] = p
+	}
+	return points, lines.Err()
+}
+
+// score rates how likely r is to be brand abuse worth a look, with the
+// signals that contributed.
+func (sc *scorer) score(r ScanResult) (int, []string) {
+	if r.Status == "NXDOMAIN" || r.Status == "DNS ERROR" {
+		return 0, nil
+	}
+
+	total := 0
+	var reasons []string
+	add := func(points int, reason string) {
+		total += points
+		reasons = append(reasons, reason)
+	}
+
+	if sc.lookalikeName(r.Domain) {
+		add(scoreLookalikeName, "lookalike name")
+	}
+	if r.ThreatMatch != "" {
+		add(scoreThreatMatch, "threat feed "+r.ThreatMatch)
+	}
+	for _, f := range insecureFeatures(r) {
+		add(scoreInsecure, f)
+	}
+	if sc.asnPoints != nil && r.IP != "" && r.IP != "-" {
+		if asn, err := sc.lookupASN(r.IP); err == nil {
+			if p, ok := sc.asnPoints[asn]; ok {
+				add(p, "AS"+asn)
+			}
+		}
+	}
+	if r.Status == "OK" {
+		if issued, ok := parseValidTo(r.NotBefore); ok && sc.now.Sub(issued) < recentCertDuration {
+			add(scoreRecentCert, "recent certificate")
+		}
+		if isFreeCA(r.Issuer) {
+			add(scoreFreeCA, "free CA")
+		}
+		if strings.Contains(strings.ToLower(r.Subject), sc.brand) {
+			add(scoreBrandInCert, "brand in certificate")
+		}
+		if sc.fetchTitle != nil {
+			if title, err := sc.fetchTitle(r.Domain); err == nil && strings.Contains(strings.ToLower(title), sc.brand) {
+				add(scoreTitleMatch, "brand in page title")
+			}
+		}
+	}
+	return min(total, 100), reasons
+}
+
+// lookalikeName reports whether a label of domain, other than its TLD, is
+// not the brand but within two edits of it once confusable letters are
+// folded to ASCII, such as "аmazon" with a Cyrillic а or "amazom".
+func (sc *scorer) lookalikeName(domain string) bool {
+	labels := strings.Split(strings.ToLower(toUnicode(domain)), ".")
+	for _, l := range labels[:len(labels)-1] {
+		if l == sc.brand {
+			continue
+		}
+		folded := strings.Map(func(r rune) rune {
+			if a, ok := confusables[r]; ok {
+				return a
+			}
+			return r
+		}, l)
+		if folded == sc.brand || len(sc.brand) >= 5 && editDistance(folded, sc.brand) <= 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance between a and b, in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// lookupASN returns the AS number announcing ip, using Team Cymru's DNS
+// interface.
+func (sc *scorer) lookupASN(ip string) (string, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", fmt.Errorf("invalid IP %q", ip)
+	}
+	var name string
+	if v4 := addr.To4(); v4 != nil {
+		name = fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", v4[3], v4[2], v4[1], v4[0])
+	} else {
+		const hex = "0123456789abcdef"
+		var b strings.Builder
+		for i := len(addr) - 1; i >= 0; i-- {
+			b.WriteByte(hex[addr[i]&0xf])
+			b.WriteByte('.')
+			b.WriteByte(hex[addr[i]>>4])
+			b.WriteByte('.')
+		}
+		name = b.String() + "origin6.asn.cymru.com"
+	}
+	txts, err := sc.lookupTXT(name)
+	if err != nil {
+		return "", err
+	}
+	// "13335 | 1.1.1.0/24 | AU | apnic | 2011-08-11"; multi-origin
+	// prefixes list several ASNs in the first field.
+	for _, txt := range txts {
+		if asn, _, ok := strings.Cut(txt, "|"); ok {
+			if f := strings.Fields(asn); len(f) > 0 {
+				return f[0], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no ASN for %s", ip)
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+var titleClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+func fetchTitle(domain string) (string, error) {
+	resp, err := titleClient.Get("https://" + domain + "/")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	m := titlePattern.FindSubmatch(body)
+	if m == nil {
+		return "", fmt.Errorf("no title")
+	}
+	return strings.TrimSpace(html.UnescapeString(string(m[1]))), nil
+}
+
+// scoreResults sets the ThreatMatch and Score of every result, dropping those below
+// --min-score. Scoring may do network lookups, so it runs on maxWorkers
+// goroutines.
+func scoreResults(in <-chan ScanResult, sc *scorer) chan ScanResult {
+	out := make(chan ScanResult)
+	var wg sync.WaitGroup
+	for i := 0; i < maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range in {
+				if sc.feeds != nil {
+					r.ThreatMatch = threatMatch(r, sc.feeds)
+				}
+				var reasons []string
+				r.Score, reasons = sc.score(r)
+				if len(reasons) > 0 {
+					debugf("Scored %s %d: %s", r.Domain, r.Score, strings.Join(reasons, ", "))
+				}
+				if r.Score >= minScore {
+					out <- r
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sc := &scorer{
+		brand:     "acme",
+		now:       now,
+		asnPoints: map[string]int{"64500": 10},
+		lookupTXT: func(name string) ([]string, error) {
+			if name != "2.2.0.192.origin.asn.cymru.com" {
+				t.Errorf("unexpected TXT lookup %s", name)
+			}
+			return []string{"64500 | 192.0.2.0/24 | ZZ | test | 2020-01-01"}, nil
+		},
+		fetchTitle: func(domain string) (string, error) { return "ACME Login", nil },
+	}
+
+	for _, tc := range []struct {
+		name string
+		r    ScanResult
+		want int
+	}{
+		{"nxdomain", ScanResult{Status: "NXDOMAIN"}, 0},
+		{"established", ScanResult{Status: "OK", Issuer: "DigiCert", Subject: "shop.example", NotBefore: now.AddDate(-1, 0, 0).Format("2006-01-02")}, scoreTitleMatch},
+		{"fresh phish", ScanResult{Domain: "acme.zz", IP: "192.0.2.2", Status: "OK", Issuer: "R11", Subject: "acme.zz", NotBefore: now.AddDate(0, 0, -3).Format("2006-01-02")}, 100},
+		{"tls error on bad ASN", ScanResult{IP: "192.0.2.2", Status: "TLS ERROR"}, 10},
+	} {
+		if got, reasons := sc.score(tc.r); got != tc.want {
+			t.Errorf("%s: score %d (%v), want %d", tc.name, got, reasons, tc.want)
+		}
+	}
+}
+
+func TestLookalikeName(t *testing.T) {
+	sc := &scorer{brand: "amazon"}
+	for domain, want := range map[string]bool{
+		"amazon.de":           false, // the brand itself, as the sweep expects
+		"xn--mazon-3ve.com":   true,  // Cyrillic а
+		"amazom.de":           true,
+		"login.arnazon.co.uk": true,
+		"amazon-login.de":     false,
+		"google.de":           false,
+	} {
+		if got := sc.lookalikeName(domain); got != want {
+			t.Errorf("lookalikeName(%s) = %v, want %v", domain, got, want)
+		}
+	}
+	if d := editDistance("kitten", "sitting"); d != 3 {
+		t.Errorf("editDistance = %d, want 3", d)
+	}
+}
+
+func TestIsFreeCA(t *testing.T) {
+	for issuer, want := range map[string]bool{"R3": true, "E6": true, "ZeroSSL RSA Domain Secure Site CA": true, "Sectigo RSA": false, "E100": false} {
+		if got := isFreeCA(issuer); got != want {
+			t.Errorf("isFreeCA(%q) = %v", issuer, got)
+		}
+	}
+}
+
+func TestLoadASNReputation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.txt")
+	if err := os.WriteFile(path, []byte("# bulletproof hosting\nAS64500 30\nas64501 5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	points, err := loadASNReputation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if points["64500"] != 30 || points["64501"] != 5 {
+		t.Errorf("points = %v", points)
+	}
+
+	if err := os.WriteFile(path, []byte("AS64500\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadASNReputation(path); err == nil {
+		t.Error("a line without points should be rejected")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	screenshotDir string
+	chromePath    string
+)
+
+// screenshotConcurrency bounds the headless browsers running at once; each
+// one costs a few hundred MB of memory, unlike a TLS probe.
+const screenshotConcurrency = 4
+
+func registerScreenshotFlags(fs *flag.FlagSet) {
+	fs.StringVar(&screenshotDir, "screenshots", "", "save a screenshot of every HTTPS-responsive domain to this directory")
+	fs.StringVar(&chromePath, "chrome", "", "Chrome or Chromium binary used for --screenshots (default: search PATH)")
+}
+
+// findChrome returns the browser binary used for screenshots.
+func findChrome() (string, error) {
+	if chromePath != "" {
+		return chromePath, nil
+	}
+	for _, name := range []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("no Chrome or Chromium found in PATH; set --chrome")
+}
+
+// screenshot renders https://domain/ with headless Chrome into dir and
+// returns the file written.
+func screenshot(chrome, dir, domain string) (string, error) {
+	path := filepath.Join(dir, domain+".png")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, chrome,
+		"--headless", "--disable-gpu", "--hide-scrollbars", "--no-first-run",
+		"--ignore-certificate-errors", "--window-size=1280,800",
+		"--screenshot="+path, "https://"+domain+"/")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%v: %s", err, out)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// screenshotResults sets Screenshot on every OK result it manages to
+// capture. Failures are logged and leave the result unchanged.
+func screenshotResults(in <-chan ScanResult, chrome, dir string) chan ScanResult {
+	out := make(chan ScanResult)
+	var wg sync.WaitGroup
+	for i := 0; i < screenshotConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range in {
+				if r.Status == "OK" {
+					if path, err := screenshot(chrome, dir, r.Domain); err != nil {
+						logger.Printf("Screenshot of %s failed: %v\n", r.Domain, err)
+					} else {
+						r.Screenshot = path
+					}
+				}
+				out <- r
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScreenshotResults(t *testing.T) {
+	dir := t.TempDir()
+	// A stand-in browser that writes the --screenshot file it was asked for.
+	chrome := filepath.Join(dir, "fake-chrome")
+	script := "#!/bin/sh\nfor a; do case $a in --screenshot=*) echo png > \"${a#--screenshot=}\";; esac; done\n"
+	if err := os.WriteFile(chrome, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan ScanResult, 2)
+	in <- ScanResult{Domain: "a.example", Status: "OK"}
+	in <- ScanResult{Domain: "b.example", Status: "TLS ERROR"}
+	close(in)
+
+	got := make(map[string]string)
+	for r := range screenshotResults(in, chrome, dir) {
+		got[r.Domain] = r.Screenshot
+	}
+	if want := filepath.Join(dir, "a.example.png"); got["a.example"] != want {
+		t.Errorf("a.example screenshot = %q, want %q", got["a.example"], want)
+	}
+	if path, ok := got["b.example"]; !ok || path != "" {
+		t.Errorf("b.example screenshot = %q (present %v), want none", path, ok)
+	}
+}
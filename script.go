@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+var scriptPath string
+
+// resultScript is a user-provided Starlark program defining
+// process(result). It receives each result as a dict keyed by the JSON
+// field names and returns None or False to drop the result, True to keep it
+// unchanged, or a dict with the fields to overwrite (e.g. "note").
+type resultScript struct {
+	thread  *starlark.Thread
+	process starlark.Callable
+}
+
+func loadScript(path string) (*resultScript, error) {
+	thread := &starlark.Thread{
+		Name:  path,
+		Print: func(_ *starlark.Thread, msg string) { logger.Printf("%s: %s\n", path, msg) },
+	}
+	globals, err := starlark.ExecFile(thread, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	process, ok := globals["process"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s does not define process(result)", path)
+	}
+	return &resultScript{thread: thread, process: process}, nil
+}
+
+// apply runs process on r. It is not safe for concurrent use.
+func (s *resultScript) apply(r ScanResult) (ScanResult, bool, error) {
+	fields, err := resultDict(r)
+	if err != nil {
+		return r, true, err
+	}
+	v, err := starlark.Call(s.thread, s.process, starlark.Tuple{fields}, nil)
+	if err != nil {
+		return r, true, err
+	}
+
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return r, false, nil
+	case starlark.Bool:
+		return r, bool(v), nil
+	case *starlark.Dict:
+		out, err := mergeDict(r, v)
+		return out, true, err
+	}
+	return r, true, fmt.Errorf("process returned %s, want None, bool or dict", v.Type())
+}
+
+// resultDict converts r to a dict keyed by JSON field name. Empty fields
+// are included, so scripts can index any field without checking for it.
+func resultDict(r ScanResult) (*starlark.Dict, error) {
+	rv := reflect.ValueOf(r)
+	d := starlark.NewDict(rv.NumField())
+	for i := 0; i < rv.NumField(); i++ {
+		name, _, _ := strings.Cut(rv.Type().Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		data, err := json.Marshal(rv.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		sv, err := toStarlark(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", name, err)
+		}
+		d.SetKey(starlark.String(name), sv)
+	}
+	return d, nil
+}
+
+// mergeDict overwrites the fields of r named by the keys of d. Unknown keys
+// are an error so that typos do not silently drop annotations.
+func mergeDict(r ScanResult, d *starlark.Dict) (ScanResult, error) {
+	m := make(map[string]any, d.Len())
+	for _, item := range d.Items() {
+		k, ok := starlark.AsString(item[0])
+		if !ok {
+			return r, fmt.Errorf("result key %s is not a string", item[0])
+		}
+		v, err := fromStarlark(item[1])
+		if err != nil {
+			return r, fmt.Errorf("field %s: %v", k, err)
+		}
+		m[k] = v
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return r, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	out := r
+	if err := dec.Decode(&out); err != nil {
+		return r, err
+	}
+	return out, nil
+}
+
+func toStarlark(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case string:
+		return starlark.String(v), nil
+	case bool:
+		return starlark.Bool(v), nil
+	case float64:
+		if v == float64(int64(v)) {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case []any:
+		l := make([]starlark.Value, len(v))
+		for i, e := range v {
+			sv, err := toStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = sv
+		}
+		return starlark.NewList(l), nil
+	}
+	return nil, fmt.Errorf("unsupported value %T", v)
+}
+
+func fromStarlark(v starlark.Value) (any, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("integer %s out of range", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.List:
+		l := make([]any, v.Len())
+		for i := range l {
+			e, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			l[i] = e
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %s", v.Type())
+}
+
+// scriptResults runs every result through s, dropping those it rejects. A
+// script error keeps the result unchanged.
+func scriptResults(in <-chan ScanResult, s *resultScript) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		for r := range in {
+			processed, keep, err := s.apply(r)
+			if err != nil {
+				logger.Printf("Script failed for %s: %v\n", r.Domain, err)
+			}
+			if keep {
+				out <- processed
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResultScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.star")
+	src := `
+def process(result):
+    if result["status"] == "NXDOMAIN":
+        return None
+    if result["issuer"] == "Let's Encrypt":
+        return {"note": "free CA"}
+    if result["domain"].endswith(".test"):
+        return {"bogus": 1}
+    return True
+`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, keep, err := s.apply(ScanResult{Domain: "a.com", Status: "NXDOMAIN"}); err != nil || keep {
+		t.Errorf("NXDOMAIN kept=%v err=%v, want dropped", keep, err)
+	}
+	r, keep, err := s.apply(ScanResult{Domain: "b.com", Status: "OK", Issuer: "Let's Encrypt"})
+	if err != nil || !keep || r.Note != "free CA" || r.Domain != "b.com" {
+		t.Errorf("annotated result = %+v kept=%v err=%v", r, keep, err)
+	}
+	if r, keep, err := s.apply(ScanResult{Domain: "c.com", Status: "OK"}); err != nil || !keep || r.Note != "" {
+		t.Errorf("unchanged result = %+v kept=%v err=%v", r, keep, err)
+	}
+	if r, keep, err := s.apply(ScanResult{Domain: "d.test", Status: "OK"}); err == nil || !keep || r.Domain != "d.test" {
+		t.Errorf("unknown field: result %+v kept=%v err=%v, want error and original result", r, keep, err)
+	}
+
+	if err := os.WriteFile(path, []byte("x = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadScript(path); err == nil {
+		t.Error("a script without process() should be rejected")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// maxHelloRecord bounds how much of the server's first flight is kept. TLS
+// 1.2 sends its curve after the certificate chain, which rarely exceeds a
+// few kilobytes.
+const maxHelloRecord = 64 << 10
+
+// helloRecorder keeps a copy of what the server sends until stopped, so
+// the plaintext part of the handshake can be parsed for the parameters
+// crypto/tls does not expose, such as the key exchange group.
+type helloRecorder struct {
+	net.Conn
+	mu   sync.Mutex
+	buf  []byte
+	done bool
+}
+
+func (r *helloRecorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	r.mu.Lock()
+	if !r.done && len(r.buf) < maxHelloRecord {
+		r.buf = append(r.buf, p[:min(n, maxHelloRecord-len(r.buf))]...)
+	}
+	r.mu.Unlock()
+	return n, err
+}
+
+// stop ends recording and returns what was recorded.
+func (r *helloRecorder) stop() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf := r.buf
+	r.buf, r.done = nil, true
+	return buf
+}
+
+// setHandshake records the negotiated protocol version, cipher suite and
+// key exchange group of conn on r.
+func setHandshake(r *ScanResult, conn *tls.Conn) {
+	state := conn.ConnectionState()
+	r.TLSVersion = tls.VersionName(state.Version)
+	r.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	if rec, ok := conn.NetConn().(*helloRecorder); ok {
+		r.Curve = serverGroup(rec.stop())
+	}
+}
+
+// serverGroup extracts the key exchange group from the server's plaintext
+// handshake records: the key_share extension of the (last) ServerHello in
+// TLS 1.3, the named curve of the ServerKeyExchange in TLS 1.2 ECDHE.
+// Returns "" when there is none, e.g. for RSA key exchange.
+func serverGroup(records []byte) string {
+	var hs []byte
+	for len(records) >= 5 {
+		typ, n := records[0], int(binary.BigEndian.Uint16(records[3:5]))
+		if len(records) < 5+n {
+			break
+		}
+		if typ == 22 {
+			hs = append(hs, records[5:5+n]...)
+		} else if typ != 20 { // change_cipher_spec precedes TLS 1.3's encrypted records
+			break
+		}
+		records = records[5+n:]
+	}
+
+	group := ""
+	for len(hs) >= 4 {
+		typ, n := hs[0], int(hs[1])<<16|int(hs[2])<<8|int(hs[3])
+		if len(hs) < 4+n {
+			break
+		}
+		body := hs[4 : 4+n]
+		switch typ {
+		case 2: // ServerHello
+			if g, ok := keyShareGroup(body); ok {
+				group = groupName(g)
+			}
+		case 12: // ServerKeyExchange
+			if len(body) >= 3 && body[0] == 3 { // named_curve
+				group = groupName(binary.BigEndian.Uint16(body[1:3]))
+			} else if group == "" {
+				group = "DHE"
+			}
+		}
+		hs = hs[4+n:]
+	}
+	return group
+}
+
+// keyShareGroup returns the group of the key_share extension of a
+// ServerHello body.
+func keyShareGroup(b []byte) (uint16, bool) {
+	// legacy_version, random
+	if len(b) < 35 {
+		return 0, false
+	}
+	b = b[34:]
+	sid := int(b[0])
+	// session id, cipher suite, compression method, extensions length
+	if len(b) < 1+sid+5 {
+		return 0, false
+	}
+	b = b[1+sid+3:]
+	extLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < extLen {
+		return 0, false
+	}
+	b = b[:extLen]
+	for len(b) >= 4 {
+		typ, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			break
+		}
+		if typ == 51 && n >= 2 { // key_share; a HelloRetryRequest carries the group alone
+			return binary.BigEndian.Uint16(b[4:]), true
+		}
+		b = b[4+n:]
+	}
+	return 0, false
+}
+
+var groupNames = map[uint16]string{
+	23: "P-256", 24: "P-384", 25: "P-521", 29: "X25519", 30: "X448",
+	256: "ffdhe2048", 257: "ffdhe3072", 258: "ffdhe4096", 259: "ffdhe6144", 260: "ffdhe8192",
+	0x11ec: "X25519MLKEM768", 0x6399: "X25519Kyber768Draft00",
+}
+
+func groupName(id uint16) string {
+	if name, ok := groupNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", id)
+}
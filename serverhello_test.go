@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshakeParameters(t *testing.T) {
+	cert, err := selfSignedCert("params.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name                          string
+		config                        *tls.Config
+		wantVersion, wantCipher, want string
+	}{
+		{
+			// The client's default key shares do not include P-256, so
+			// this also covers a HelloRetryRequest.
+			"tls13 P-256",
+			&tls.Config{MinVersion: tls.VersionTLS13, CurvePreferences: []tls.CurveID{tls.CurveP256}},
+			"TLS 1.3", "", "P-256",
+		},
+		{
+			"tls12 ecdhe",
+			&tls.Config{MaxVersion: tls.VersionTLS12, CurvePreferences: []tls.CurveID{tls.CurveP384},
+				CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+			"TLS 1.2", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "P-384",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Certificates = []tls.Certificate{cert}
+			ln, err := tls.Listen("tcp", "127.0.0.1:0", tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			go func() {
+				for {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						conn.(*tls.Conn).Handshake()
+						// Keep the connection open until the client is done.
+						conn.Read(make([]byte, 1))
+						conn.Close()
+					}()
+				}
+			}()
+			_, port, _ := net.SplitHostPort(ln.Addr().String())
+			s := &scanner{port: port, timeout: 2 * time.Second, lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil }}
+
+			r := s.scan("params.example")
+			if r.Status != "OK" || r.TLSVersion != tc.wantVersion || r.Curve != tc.want {
+				t.Errorf("scan = %s %s %s %s, want OK %s %s", r.Status, r.TLSVersion, r.CipherSuite, r.Curve, tc.wantVersion, tc.want)
+			}
+			if tc.wantCipher != "" && r.CipherSuite != tc.wantCipher {
+				t.Errorf("cipher = %s, want %s", r.CipherSuite, tc.wantCipher)
+			}
+			if r.CipherSuite == "" {
+				t.Error("no cipher suite recorded")
+			}
+		})
+	}
+}
+
+func TestServerGroupIgnoresTruncatedRecords(t *testing.T) {
+	for _, b := range [][]byte{nil, {22, 3, 3}, {22, 3, 3, 0, 10, 2, 0, 0}, {22, 3, 3, 0, 4, 2, 0, 0, 0}} {
+		if g := serverGroup(b); g != "" {
+			t.Errorf("serverGroup(%v) = %q", b, g)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// sniFuzz is --sni-fuzz: the server names tried on every responsive IP.
+var sniFuzz string
+
+// sniNames expands --sni-fuzz for domain: {domain} is the scanned domain
+// and - sends no SNI at all. The domain itself is left out.
+func sniNames(spec, domain string) []string {
+	var names []string
+	seen := map[string]bool{domain: true}
+	for _, v := range strings.Split(spec, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		name := strings.ReplaceAll(v, "{domain}", domain)
+		if v == "-" {
+			name = ""
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fuzzSNI handshakes with ip under every --sni-fuzz name and lists those
+// answered with another certificate than leaf, as "name=subject", "-" for
+// the certificate served without SNI. Names that fail are skipped.
+func (s *scanner) fuzzSNI(domain, ip string, leaf *x509.Certificate) string {
+	var variants []string
+	for _, name := range sniNames(s.sniFuzz, domain) {
+		raw, err := s.dialHost(context.Background(), ip, s.port)
+		if err != nil {
+			debugf("SNI %q on %s: %v", name, ip, err)
+			continue
+		}
+		conn, err := s.handshake(raw, name)
+		if err != nil {
+			debugf("SNI %q on %s: %v", name, ip, err)
+			continue
+		}
+		certs := conn.ConnectionState().PeerCertificates
+		conn.Close()
+		if len(certs) == 0 || bytes.Equal(certs[0].Raw, leaf.Raw) {
+			continue
+		}
+		if name == "" {
+			name = "-"
+		}
+		variants = append(variants, fmt.Sprintf("%s=%s", name, certSubject(certs[0])))
+	}
+	return strings.Join(variants, "; ")
+}
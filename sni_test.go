@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSNINames(t *testing.T) {
+	got := sniNames("www.{domain}, {domain},intranet.corp,-,www.{domain}", "example.com")
+	if want := []string{"www.example.com", "intranet.corp", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFuzzSNI(t *testing.T) {
+	certs := make(map[string]tls.Certificate)
+	for _, cn := range []string{"example.com", "intranet.corp", "default.invalid"} {
+		c, err := selfSignedCert(cn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs[cn] = c
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	config := &tls.Config{GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		switch hello.ServerName {
+		case "intranet.corp":
+			c := certs["intranet.corp"]
+			return &c, nil
+		case "":
+			c := certs["default.invalid"]
+			return &c, nil
+		}
+		c := certs["example.com"]
+		return &c, nil
+	}}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				tls.Server(c, config).Handshake()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	s := &scanner{
+		port:       port,
+		timeout:    time.Second,
+		lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil },
+		sniFuzz:    "www.{domain},intranet.corp,-",
+	}
+	r := s.scan("example.com")
+	if r.Status != "OK" || r.SNIVariants != "intranet.corp=intranet.corp; -=default.invalid" {
+		t.Errorf("got %s, SNIVariants %q", r.Status, r.SNIVariants)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// spoolDir is --spool-dir, where sinks that gave up leave their results.
+var spoolDir string
+
+// A failed write is retried exportRetries times, exportBackoff apart at
+// first and twice as long each time: 1+2+4+8 seconds by default.
+var (
+	exportRetries = 4
+	exportBackoff = time.Second
+)
+
+// exportPause holds back new targets while a sink retries, so results do
+// not pile up behind it.
+var exportPause pauseGate
+
+type pauseGate struct {
+	mu      sync.Mutex
+	paused  int
+	resumed chan struct{} // closed once paused is back to 0
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == 0 {
+		g.resumed = make(chan struct{})
+	}
+	g.paused++
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused--; g.paused == 0 {
+		close(g.resumed)
+	}
+}
+
+// wait returns once no sink is retrying, or ctx is done.
+func (g *pauseGate) wait(ctx context.Context) {
+	g.mu.Lock()
+	paused, resumed := g.paused > 0, g.resumed
+	g.mu.Unlock()
+	if paused {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// deliver runs write until it succeeds, pausing the sweep and backing off
+// in between, and returns the last error once the retries are spent.
+func deliver(what string, write func() error) error {
+	err := write()
+	if err == nil {
+		return nil
+	}
+	exportPause.pause()
+	defer exportPause.resume()
+	backoff := exportBackoff
+	for attempt := 1; attempt <= exportRetries; attempt++ {
+		logger.Printf("Failed to write %s, pausing the sweep and retrying in %v: %v\n", what, backoff, err)
+		time.Sleep(backoff)
+		if err = write(); err == nil {
+			logger.Printf("Writing %s recovered\n", what)
+			return nil
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// writeAll writes data to w through deliver, going on after a partial
+// write from where it stopped.
+func writeAll(what string, w io.Writer, data []byte) error {
+	return deliver(what, func() error {
+		n, err := w.Write(data)
+		data = data[n:]
+		return err
+	})
+}
+
+// spool is the local fallback of a sink that gave up: the results it could
+// not take, as NDJSON that merge and retry read. The file is created on
+// the first result.
+type spool struct {
+	path string
+	f    *os.File
+	n    int
+}
+
+func newSpool(sink, name string) *spool {
+	root := spoolDir
+	if root == "" {
+		root = filepath.Join(cacheRoot(), "spool")
+	}
+	return &spool{path: filepath.Join(root, fmt.Sprintf("%s.%s.%s.ndjson", name, sink, newScanID(time.Now())))}
+}
+
+func (s *spool) add(r ScanResult) error {
+	if s.f == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		s.f = f
+	}
+	line, _ := json.Marshal(versionedResult{resultSchemaVersion, r})
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.n++
+	return nil
+}
+
+// close reports what was spooled.
+func (s *spool) close() {
+	if s.f == nil {
+		return
+	}
+	if err := s.f.Close(); err != nil {
+		logger.Printf("Failed to close spool %s: %v\n", s.path, err)
+	}
+	logger.Printf("Spooled %d results to %s\n", s.n, s.path)
+}
+
+// resultSink hands results to an export through deliver until it gives
+// up, and to a spool from then on. Byte streams, such as a CSV file, set w
+// and encode so that a retry resumes a partial write; the others set write.
+type resultSink struct {
+	what   string
+	w      io.Writer
+	encode func(ScanResult) []byte
+	write  func(ScanResult) error
+	closer io.Closer
+	spool  *spool
+	failed bool
+	// written is what an export file took so far; a file that fails is
+	// dropped whole, so these go to the spool with the rest.
+	written []ScanResult
+}
+
+// createSink creates the export file path, retrying like a write, and
+// streams results into it with encode.
+func createSink(path, sink, name string, encode func(ScanResult) []byte) *resultSink {
+	s := newStreamSink(path, sink, name, nil, encode)
+	var f io.WriteCloser
+	if err := deliver(path, func() (err error) { f, err = createOutput(path); return err }); err != nil {
+		s.giveUp(err)
+		return s
+	}
+	s.w, s.closer = f, f
+	return s
+}
+
+// newStreamSink spools to sink-named files under --spool-dir for the export
+// of name, e.g. the "csv" sink of "amazon".
+func newStreamSink(what, sink, name string, w io.Writer, encode func(ScanResult) []byte) *resultSink {
+	return &resultSink{what: what, w: w, encode: encode, spool: newSpool(sink, name)}
+}
+
+func newResultSink(what, sink, name string, write func(ScanResult) error) *resultSink {
+	return &resultSink{what: what, write: write, spool: newSpool(sink, name)}
+}
+
+func (s *resultSink) send(r ScanResult) {
+	if !s.failed {
+		var err error
+		if s.encode != nil {
+			err = writeAll(s.what, s.w, s.encode(r))
+		} else {
+			err = deliver(s.what, func() error { return s.write(r) })
+		}
+		if err == nil {
+			if s.closer != nil {
+				s.written = append(s.written, r)
+			}
+			return
+		}
+		s.giveUp(err)
+	}
+	s.addToSpool(r)
+}
+
+// writeBytes writes data that is not a result, such as a header, and
+// reports whether the sink still works.
+func (s *resultSink) writeBytes(data []byte) bool {
+	if s.failed {
+		return false
+	}
+	if err := writeAll(s.what, s.w, data); err != nil {
+		s.giveUp(err)
+		return false
+	}
+	return true
+}
+
+func (s *resultSink) giveUp(err error) {
+	logger.Printf("Giving up on %s, spooling the results to %s: %v\n", s.what, s.spool.path, err)
+	s.failed = true
+	s.spoolAll(s.written)
+	s.written = nil
+}
+
+func (s *resultSink) addToSpool(r ScanResult) {
+	if err := s.spool.add(r); err != nil {
+		logger.Printf("Failed to spool %s, result lost: %v\n", r.Domain, err)
+	}
+}
+
+// spoolAll is the fallback of an export written in one go at the end.
+func (s *resultSink) spoolAll(results []ScanResult) {
+	for _, r := range results {
+		s.addToSpool(r)
+	}
+}
+
+// close publishes the export, or drops it once the sink gave up, closes
+// the spool and reports whether every result made it into the export.
+func (s *resultSink) close() bool {
+	if s.closer != nil {
+		if s.failed {
+			discardOutput(s.closer)
+		} else if err := s.closer.Close(); err != nil {
+			s.giveUp(err)
+		}
+	}
+	s.spool.close()
+	return !s.failed
+}
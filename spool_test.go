@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyWriter takes half of each write and then fails, fails times over.
+type flakyWriter struct {
+	bytes.Buffer
+	fails int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.fails > 0 {
+		w.fails--
+		n := len(p) / 2
+		w.Buffer.Write(p[:n])
+		return n, errors.New("no space left on device")
+	}
+	return w.Buffer.Write(p)
+}
+
+func withFastRetries(t *testing.T) {
+	t.Helper()
+	backoff, dir := exportBackoff, spoolDir
+	t.Cleanup(func() { exportBackoff, spoolDir = backoff, dir })
+	exportBackoff, spoolDir = time.Millisecond, t.TempDir()
+}
+
+func TestWriteAllResumes(t *testing.T) {
+	withFastRetries(t)
+	w := &flakyWriter{fails: 3}
+	if err := writeAll("test export", w, []byte("amazon.com,OK\n")); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "amazon.com,OK\n" {
+		t.Errorf("written %q", w.String())
+	}
+
+	w = &flakyWriter{fails: exportRetries + 1}
+	if err := writeAll("test export", w, []byte("amazon.com,OK\n")); err == nil {
+		t.Error("a writer that keeps failing should give up")
+	}
+}
+
+func TestExportSpoolsWhenTheSinkFails(t *testing.T) {
+	withFastRetries(t)
+	defer func() { outputDir = "." }()
+	outputDir = filepath.Join(t.TempDir(), "missing") // every create fails
+
+	results := make(chan ScanResult, 3)
+	results <- ScanResult{Domain: "amazon.com", Status: "OK", ScannedAt: "2024-05-01T00:00:00Z"}
+	results <- ScanResult{Domain: "amazon.zz", Status: "NXDOMAIN"}
+	results <- ScanResult{Domain: "amazon.de", Status: "TIMEOUT"}
+	close(results)
+	exportToCsv("amazon", results)
+
+	spooled, _ := filepath.Glob(filepath.Join(spoolDir, "amazon.csv.*.ndjson"))
+	if len(spooled) != 1 {
+		t.Fatalf("spool files = %v", spooled)
+	}
+	got, err := loadExport(spooled[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Domain != "amazon.com" || got[1].Domain != "amazon.de" {
+		t.Errorf("spooled = %+v", got)
+	}
+}
+
+func TestResultSinkGivesUpThenSpools(t *testing.T) {
+	withFastRetries(t)
+	calls := 0
+	sink := newResultSink("syslog test", "syslog", "tls-sweep", func(ScanResult) error {
+		calls++
+		return errors.New("connection refused")
+	})
+	sink.send(ScanResult{Domain: "a.example", Status: "OK"})
+	sink.send(ScanResult{Domain: "b.example", Status: "OK"})
+	if sink.close() {
+		t.Error("close should report the sink as failed")
+	}
+	if calls != exportRetries+1 {
+		t.Errorf("write called %d times, want only the first result retried", calls)
+	}
+	data, _ := os.ReadFile(sink.spool.path)
+	if strings.Count(string(data), "\n") != 2 {
+		t.Errorf("spool = %s", data)
+	}
+}
+
+func TestPauseGate(t *testing.T) {
+	var g pauseGate
+	g.wait(context.Background()) // not paused: returns at once
+
+	g.pause()
+	g.pause()
+	released := make(chan struct{})
+	go func() {
+		g.wait(context.Background())
+		close(released)
+	}()
+	g.resume()
+	select {
+	case <-released:
+		t.Fatal("released while a sink still retries")
+	case <-time.After(20 * time.Millisecond):
+	}
+	g.resume()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("not released after the last resume")
+	}
+
+	g.pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g.wait(ctx)
+	g.resume()
+}
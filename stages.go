@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// resolvedTarget is one line of the resolve stage's output and of the
+// handshake stage's input.
+type resolvedTarget struct {
+	Domain string   `json:"domain"`
+	Status string   `json:"status"` // OK, NXDOMAIN or DNS ERROR
+	IPs    []string `json:"ips,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// resolveTargets looks every domain up on s.workerCount() workers, keeping the
+// order of domains. A .onion target is OK without addresses: it is
+// reached through Tor.
+func resolveTargets(ctx context.Context, s *scanner, domains []string) []resolvedTarget {
+	out := make([]resolvedTarget, len(domains))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.workerCount(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				t := resolvedTarget{Domain: domains[i], Status: "OK"}
+				if !isOnion(t.Domain) {
+					ips, failed, ok := s.resolve(t.Domain)
+					if ok {
+						t.IPs = ips
+					} else {
+						t.Status = failed.Status
+						if failed.Err != nil {
+							t.Error = failed.Err.Error()
+						}
+					}
+				}
+				out[i] = t
+			}
+		}()
+	}
+	n := 0
+feed:
+	for ; n < len(domains); n++ {
+		select {
+		case next <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	return out[:n]
+}
+
+func readResolved(path string) ([]resolvedTarget, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var targets []resolvedTarget
+	dec := json.NewDecoder(r)
+	for {
+		var t resolvedTarget
+		if err := dec.Decode(&t); errors.Is(err, io.EOF) {
+			return targets, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		targets = append(targets, t)
+	}
+}
+
+// stageOutput is the file a stage writes to, atomically, or stdout for
+// "-".
+func stageOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return createAtomic(path, 0o644)
+}
+
+// writeStageResults writes results as NDJSON to stdout for "-", and as
+// writeExport does otherwise.
+func writeStageResults(path string, results []ScanResult) error {
+	if path != "-" {
+		return writeExport(path, results)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range results {
+		if err := enc.Encode(versionedResult{resultSchemaVersion, r}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageTargets is the targets of a stage: the domains of --input, or
+// baseDomain under every TLD.
+func stageTargets(input string, args []string) ([]string, error) {
+	if input != "" {
+		domains, _, err := readDomains(input)
+		return domains, err
+	}
+	tlds, err := loadTLDs(!forceRefresh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLDs: %v", err)
+	}
+	return expandTargets(toASCII(args[0]), tlds), nil
+}
+
+// runResolve is the DNS stage alone: the addresses of every target, as
+// NDJSON for tls-sweep handshake.
+func runResolve(args []string) {
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep resolve [flags] <base-domain>")
+		fmt.Fprintln(fs.Output(), "       tls-sweep resolve [flags] --input <domains.txt>")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "-", "file the resolved targets are written to as NDJSON, - for stdout")
+	input := fs.String("input", "", "resolve the domains of this file, one per line, instead of a base domain under every TLD")
+	fs.BoolVar(&scanIDN, "idn", false, "also resolve the internationalized (xn--) TLDs")
+	fs.BoolVar(&forceRefresh, "force-tld-refresh", false, "ignore the cached TLD list and fetch it from IANA")
+	registerScanFlags(fs)
+	args = parseArgs(fs, args)
+	if (len(args) != 1) == (*input == "") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if maxWorkers < 1 {
+		logger.Fatalf("--workers must be at least 1\n")
+	}
+	if *output == "-" {
+		logger.SetOutput(os.Stderr)
+	}
+	domains, err := stageTargets(*input, args)
+	if err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	targets := resolveTargets(ctx, newScanner(), domains)
+	w, err := stageOutput(*output)
+	if err != nil {
+		logger.Fatalf("Failed to create %s: %v\n", *output, err)
+	}
+	enc := json.NewEncoder(w)
+	resolved := 0
+	for _, t := range targets {
+		if err := enc.Encode(t); err != nil {
+			discardOutput(w)
+			logger.Fatalf("Failed to write %s: %v\n", *output, err)
+		}
+		if t.Status == "OK" {
+			resolved++
+		}
+	}
+	if err := w.Close(); err != nil {
+		logger.Fatalf("Failed to write %s: %v\n", *output, err)
+	}
+	logger.Printf("Resolved %d of %d targets in %v\n", resolved, len(targets), time.Since(start).Round(time.Millisecond))
+}
+
+// handshakeTasks is the scans of the targets that resolved, and the
+// results of those that did not. A target resolved to no addresses is
+// looked up again.
+func handshakeTasks(targets []resolvedTarget) ([]scanTask, []ScanResult) {
+	var tasks []scanTask
+	var carried []ScanResult
+	for _, t := range targets {
+		if t.Status != "OK" {
+			carried = append(carried, ScanResult{Domain: t.Domain, IP: "-", Status: t.Status})
+			continue
+		}
+		var ips []string
+		if len(t.IPs) > 0 {
+			ips = t.IPs
+		}
+		tasks = append(tasks, scanTask{domain: t.Domain, ips: ips})
+	}
+	return tasks, carried
+}
+
+// runHandshake is the TLS stage alone: it scans the addresses a resolve
+// stage found, without looking them up again, and writes the results.
+// Targets that did not resolve are carried over as results.
+func runHandshake(args []string) {
+	fs := flag.NewFlagSet("handshake", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep handshake [flags] <resolved.ndjson>")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "-", "file the results are written to, as JSON or, for .ndjson and -, NDJSON")
+	registerScanFlags(fs)
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if maxWorkers < 1 {
+		logger.Fatalf("--workers must be at least 1\n")
+	}
+	if err := checkTLSRange(); err != nil {
+		logger.Fatalf("%v\n", err)
+	}
+	if *output == "-" {
+		logger.SetOutput(os.Stderr)
+	}
+	targets, err := readResolved(args[0])
+	if err != nil {
+		logger.Fatalf("Failed to read resolved targets: %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s := newScanner()
+	tasks, results := handshakeTasks(targets)
+	carried := len(results)
+	scannedResults := make(chan ScanResult, len(tasks))
+	go runWorkers(s, scannedResults, func(c chan<- scanTask) {
+		for _, t := range tasks {
+			if !feedTask(ctx, c, t) {
+				return
+			}
+		}
+	})
+	for r := range scannedResults {
+		results = append(results, r)
+	}
+	if err := writeStageResults(*output, results); err != nil {
+		logger.Fatalf("Failed to write %s: %v\n", *output, err)
+	}
+	logger.Printf("Scanned %d targets, %d carried over unresolved\n", len(tasks), carried)
+}
+
+// runEnrich is the stages after the handshake alone: host enrichment,
+// scoring, annotations, the script and filters, over the results of an
+// earlier export. Certificates are not exported, so checks of the served
+// chain itself, such as IOC fingerprints, need the handshake stage.
+func runEnrich(args []string) {
+	fs := flag.NewFlagSet("enrich", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep enrich [flags] <results.json|results.ndjson>")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "-", "file the results are written to, as JSON or, for .ndjson and -, NDJSON")
+	brand := fs.String("brand", "", "brand the results are scored against (default: the first label of the first domain)")
+	fs.StringVar(&enrichSource, "source", "", "add open ports, services and other certificates of each OK result's IP from shodan ($SHODAN_API_KEY) or censys ($CENSYS_API_ID, $CENSYS_API_SECRET)")
+	fs.StringVar(&annotationsFile, "annotations", "", "CSV of domain,owner,ticket,note merged into Owner, Ticket and Annotation")
+	fs.StringVar(&scriptPath, "script", "", "Starlark file defining process(result) to filter or annotate each result")
+	fs.Func("only", "only keep results matching this filter, e.g. status=OK or 'expiry<30d'; repeatable", addFilter)
+	fs.IntVar(&maxWorkers, "workers", maxWorkers, "number of concurrent enrichment and scoring workers")
+	registerScoreFlags(fs)
+	registerFetchFlags(fs)
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if maxWorkers < 1 {
+		logger.Fatalf("--workers must be at least 1\n")
+	}
+	if *output == "-" {
+		logger.SetOutput(os.Stderr)
+	}
+	prior, err := loadExport(args[0])
+	if err != nil {
+		logger.Fatalf("Failed to load results: %v\n", err)
+	}
+	if *brand == "" && len(prior) > 0 {
+		*brand, _, _ = strings.Cut(prior[0].Domain, ".")
+	}
+	sc, err := newScorer(*brand)
+	if err != nil {
+		logger.Fatalf("Failed to load scoring data: %v\n", err)
+	}
+
+	processed := make(chan ScanResult, len(prior))
+	for _, r := range prior {
+		processed <- r
+	}
+	close(processed)
+	if enrichSource != "" {
+		src, err := newIntelSource(enrichSource)
+		if err != nil {
+			logger.Fatalf("%v\n", err)
+		}
+		processed = enrichResults(processed, newEnricher(src))
+	}
+	processed = scoreResults(processed, sc)
+	if annotationsFile != "" {
+		notes, err := loadAnnotations(annotationsFile)
+		if err != nil {
+			logger.Fatalf("Failed to load annotations: %v\n", err)
+		}
+		processed = annotateResults(processed, notes)
+	}
+	if scriptPath != "" {
+		script, err := loadScript(scriptPath)
+		if err != nil {
+			logger.Fatalf("Failed to load script: %v\n", err)
+		}
+		processed = scriptResults(processed, script)
+	}
+	if len(onlyFilters) > 0 {
+		processed = filterResults(processed, onlyFilters)
+	}
+	var results []ScanResult
+	for r := range processed {
+		results = append(results, r)
+	}
+	if err := writeStageResults(*output, results); err != nil {
+		logger.Fatalf("Failed to write %s: %v\n", *output, err)
+	}
+	logger.Printf("Wrote %d of %d results to %s\n", len(results), len(prior), *output)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveTargets(t *testing.T) {
+	s := &scanner{dnsLimit: newKeyedLimiter(0), lookupHost: func(host string) ([]string, error) {
+		switch host {
+		case "shop.example":
+			return []string{"192.0.2.1", "2001:db8::1"}, nil
+		case "flaky.example":
+			return nil, &net.DNSError{Err: "server misbehaving", Name: host}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}}
+	got := resolveTargets(context.Background(), s, []string{"shop.example", "gone.example", "flaky.example", "hidden.onion"})
+	want := []resolvedTarget{
+		{Domain: "shop.example", Status: "OK", IPs: []string{"192.0.2.1", "2001:db8::1"}},
+		{Domain: "gone.example", Status: "NXDOMAIN", Error: "lookup gone.example: no such host"},
+		{Domain: "flaky.example", Status: "DNS ERROR", Error: "lookup flaky.example: server misbehaving"},
+		{Domain: "hidden.onion", Status: "OK"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestReadResolved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolved.ndjson")
+	os.WriteFile(path, []byte(`{"domain":"shop.example","status":"OK","ips":["192.0.2.1"]}
+{"domain":"gone.example","status":"NXDOMAIN"}
+`), 0o644)
+	got, err := readResolved(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].IPs[0] != "192.0.2.1" || got[1].Status != "NXDOMAIN" {
+		t.Errorf("got %+v", got)
+	}
+	os.WriteFile(path, []byte("{not json"), 0o644)
+	if _, err := readResolved(path); err == nil {
+		t.Error("read a broken file")
+	}
+}
+
+// TestHandshakeUsesResolvedIPs scans the addresses of a resolve stage
+// without a lookup of its own.
+func TestHandshakeUsesResolvedIPs(t *testing.T) {
+	cert, err := selfSignedCert("shop.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &scanner{
+		port:       port,
+		timeout:    time.Second,
+		hostLimit:  newKeyedLimiter(0),
+		dnsLimit:   newKeyedLimiter(0),
+		lookupHost: func(string) ([]string, error) { return nil, errors.New("the handshake stage looked up") },
+	}
+	results := make(chan ScanResult, 1)
+	go runWorkers(s, results, func(tasks chan<- scanTask) {
+		feedTask(context.Background(), tasks, scanTask{domain: "shop.example", ips: []string{"127.0.0.1"}})
+	})
+	var got []ScanResult
+	for r := range results {
+		got = append(got, r)
+	}
+	if len(got) != 1 || got[0].Status != "OK" || got[0].Subject != "shop.example" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+// TestHandshakeResolvesEmptyIPs looks a resolved target without addresses
+// up again instead of dialing nothing.
+func TestHandshakeResolvesEmptyIPs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolved.ndjson")
+	os.WriteFile(path, []byte(`{"domain":"example.com","status":"OK","ips":[]}`), 0o644)
+	targets, err := readResolved(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	looked := false
+	s := &scanner{
+		port:      "1",
+		timeout:   time.Second,
+		hostLimit: newKeyedLimiter(0),
+		dnsLimit:  newKeyedLimiter(0),
+		lookupHost: func(string) ([]string, error) {
+			looked = true
+			return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+		},
+	}
+	results := make(chan ScanResult, 1)
+	go runWorkers(s, results, func(c chan<- scanTask) {
+		tasks, _ := handshakeTasks(targets)
+		for _, task := range tasks {
+			feedTask(context.Background(), c, task)
+		}
+	})
+	if r := <-results; !looked || r.Status != "NXDOMAIN" {
+		t.Errorf("got %+v, looked up: %v", r, looked)
+	}
+	if _, err := s.dialRace(nil, "443"); err == nil {
+		t.Error("dialRace connected to no addresses")
+	}
+}
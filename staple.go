@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+// oidTLSFeature is the RFC 7633 TLS Feature extension; status_request (5)
+// in it is OCSP Must-Staple.
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+const tlsFeatureStatusRequest = 5
+
+// hasMustStaple reports whether cert requires a stapled OCSP response.
+func hasMustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, f := range features {
+			if f == tlsFeatureStatusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mustStaple is the MustStaple column: "stapled" or "missing" for a leaf
+// with Must-Staple depending on whether the server sent an OCSP response,
+// "" for any other leaf. Clients enforcing Must-Staple, such as Firefox,
+// refuse "missing" hosts outright.
+func mustStaple(cert *x509.Certificate, ocspResponse []byte) string {
+	switch {
+	case !hasMustStaple(cert):
+		return ""
+	case len(ocspResponse) == 0:
+		return "missing"
+	}
+	return "stapled"
+}
+
+func mustStapleCheck(_ *scanner, r ScanResult, _ checkOptions) (string, bool) {
+	return "Must-Staple certificate served without an OCSP response", r.MustStaple == "missing"
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// mustStapleCert is a self-signed certificate for cn with the TLS Feature
+// extension listing features.
+func mustStapleCert(t *testing.T, cn string, features ...int) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	if features != nil {
+		value, err := asn1.Marshal(features)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oidTLSFeature, Value: value}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMustStaple(t *testing.T) {
+	leaf := func(c tls.Certificate) *x509.Certificate {
+		cert, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	plain := leaf(mustStapleCert(t, "a.example"))
+	other := leaf(mustStapleCert(t, "a.example", 17)) // status_request_v2 only
+	staple := leaf(mustStapleCert(t, "a.example", tlsFeatureStatusRequest))
+	for _, c := range []struct {
+		cert *x509.Certificate
+		ocsp []byte
+		want string
+	}{
+		{plain, nil, ""},
+		{other, nil, ""},
+		{staple, nil, "missing"},
+		{staple, []byte{0x30}, "stapled"},
+	} {
+		if got := mustStaple(c.cert, c.ocsp); got != c.want {
+			t.Errorf("mustStaple = %q, want %q", got, c.want)
+		}
+	}
+}
+
+func TestScanMustStaple(t *testing.T) {
+	cert := mustStapleCert(t, "staple.example", tlsFeatureStatusRequest)
+	for _, ocsp := range [][]byte{nil, []byte("ocsp response")} {
+		cert.OCSPStaple = ocsp
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			c, err := ln.Accept()
+			if err == nil {
+				c.(*tls.Conn).Handshake()
+				c.Close()
+			}
+		}()
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		s := &scanner{port: port, timeout: time.Second}
+		r := s.scanIPs("staple.example", []string{"127.0.0.1"})
+		ln.Close()
+
+		want := "missing"
+		if ocsp != nil {
+			want = "stapled"
+		}
+		if r.MustStaple != want {
+			t.Errorf("staple %q: MustStaple %q, want %q", ocsp, r.MustStaple, want)
+		}
+		if _, failed := mustStapleCheck(s, r, checkOptions{}); failed != (want == "missing") {
+			t.Errorf("staple %q: must-staple check failed = %v", ocsp, failed)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	syslogURL    string
+	syslogFormat string
+)
+
+// sdID names the RFC 5424 structured data element. 32473 is the private
+// enterprise number reserved for documentation (RFC 5612); collectors only
+// need it to be stable.
+const sdID = "tls-sweep@32473"
+
+// syslogSink sends one message per result to a syslog collector, as
+// RFC 5424 or as CEF carried in RFC 5424. TCP messages use octet-counting
+// framing (RFC 6587).
+type syslogSink struct {
+	network, addr string
+	format        string
+	hostname      string
+	conn          net.Conn
+}
+
+func dialSyslog(rawURL, format string) (*syslogSink, error) {
+	network, addr, err := parseSyslogURL(rawURL, format)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "-"
+	}
+	s := &syslogSink{network: network, addr: addr, format: format, hostname: host}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseSyslogURL checks --syslog and --syslog-format and returns the
+// collector's network and address, port 514 unless the URL has one.
+func parseSyslogURL(rawURL, format string) (network, addr string, err error) {
+	if format != "rfc5424" && format != "cef" {
+		return "", "", fmt.Errorf("unknown syslog format %q (want rfc5424 or cef)", format)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return "", "", fmt.Errorf("unsupported syslog scheme %q (want udp or tcp)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", "", fmt.Errorf("%s has no collector host", rawURL)
+	}
+	if u.Port() == "" {
+		return u.Scheme, net.JoinHostPort(u.Hostname(), "514"), nil
+	}
+	if err := checkAddr(u.Host); err != nil {
+		return "", "", err
+	}
+	return u.Scheme, u.Host, nil
+}
+
+func (s *syslogSink) dial() error {
+	conn, err := net.DialTimeout(s.network, s.addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// send writes r, redialing once if a TCP collector dropped the connection.
+func (s *syslogSink) send(r ScanResult) error {
+	msg := s.message(r, time.Now())
+	if s.network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.conn.Close()
+		if err := s.dial(); err != nil {
+			return err
+		}
+		_, err = s.conn.Write([]byte(msg))
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) close() error {
+	return s.conn.Close()
+}
+
+// severity maps a result to a syslog severity: warning for failures and
+// high scores, informational otherwise.
+func severity(r ScanResult) int {
+	if isFailure(r.Status) || r.Score >= 70 {
+		return 4
+	}
+	return 6
+}
+
+func (s *syslogSink) message(r ScanResult, now time.Time) string {
+	const facility = 16 // local0
+	header := fmt.Sprintf("<%d>1 %s %s tls-sweep %d result", facility*8+severity(r), now.UTC().Format(time.RFC3339), s.hostname, os.Getpid())
+	if s.format == "cef" {
+		return header + " - " + cefMessage(r)
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[" + sdID)
+	for _, p := range resultParams(r) {
+		fmt.Fprintf(&sd, ` %s="%s"`, p[0], sdEscape(p[1]))
+	}
+	sd.WriteString("]")
+	return fmt.Sprintf("%s %s %s %s", header, sd.String(), r.Domain, r.Status)
+}
+
+func resultParams(r ScanResult) [][2]string {
+	params := [][2]string{{"domain", r.Domain}, {"ip", r.IP}, {"status", r.Status}}
+	for _, p := range [][2]string{{"subject", r.Subject}, {"issuer", r.Issuer}, {"valid_to", r.ValidTo}, {"port", r.Port}, {"mx", r.MX}, {"note", r.Note}} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+	if r.Score > 0 {
+		params = append(params, [2]string{"score", strconv.Itoa(r.Score)})
+	}
+	return params
+}
+
+var sdEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace
+
+var (
+	cefHeaderEscape    = strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace
+	cefExtensionEscape = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace
+)
+
+// cefMessage formats r as ArcSight CEF. The signature ID is the status, so
+// SIEM rules can match on it directly.
+func cefMessage(r ScanResult) string {
+	sev := 1
+	switch {
+	case r.Score >= 70:
+		sev = 8
+	case isFailure(r.Status):
+		sev = 5
+	}
+	ext := []string{"dhost=" + cefExtensionEscape(r.Domain), "outcome=" + cefExtensionEscape(r.Status)}
+	if net.ParseIP(r.IP) != nil {
+		ext = append(ext, "dst="+r.IP)
+	}
+	if r.Port != "" {
+		ext = append(ext, "dpt="+r.Port)
+	}
+	for i, p := range [][2]string{{"subject", r.Subject}, {"issuer", r.Issuer}, {"validTo", r.ValidTo}} {
+		if p[1] != "" {
+			ext = append(ext, fmt.Sprintf("cs%dLabel=%s cs%d=%s", i+1, p[0], i+1, cefExtensionEscape(p[1])))
+		}
+	}
+	if r.Score > 0 {
+		ext = append(ext, fmt.Sprintf("cn1Label=score cn1=%d", r.Score))
+	}
+	return fmt.Sprintf("CEF:0|tls-sweep|tls-sweep|%s|%s|TLS scan result %s|%d|%s",
+		resultSchemaVersion, cefHeaderEscape(r.Status), cefHeaderEscape(r.Status), sev, strings.Join(ext, " "))
+}
+
+// syslogResults sends every result except NXDOMAIN to sink as it passes
+// through.
+func syslogResults(in <-chan ScanResult, sink *syslogSink) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		spooled := newResultSink("syslog "+sink.addr, "syslog", "tls-sweep", sink.send)
+		defer spooled.close()
+		for r := range in {
+			if r.Status != "NXDOMAIN" {
+				spooled.send(r)
+			}
+			out <- r
+		}
+	}()
+	return out
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink, err := dialSyslog("udp://"+pc.LocalAddr().String(), "rfc5424")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.close()
+
+	in := make(chan ScanResult, 2)
+	in <- ScanResult{Domain: "gone.com", Status: "NXDOMAIN"}
+	in <- ScanResult{Domain: "a.com", IP: "192.0.2.1", Status: "TLS ERROR", Note: `say "hi"]`}
+	close(in)
+	for range syslogResults(in, sink) {
+	}
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<132>1 ") {
+		t.Errorf("want local0.warning priority, got %q", msg)
+	}
+	for _, want := range []string{`[tls-sweep@32473 domain="a.com" ip="192.0.2.1" status="TLS ERROR" note="say \"hi\"\]"]`, " a.com TLS ERROR"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q lacks %q", msg, want)
+		}
+	}
+}
+
+func TestSyslogCEFOverTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		got <- line
+	}()
+
+	sink, err := dialSyslog("tcp://"+ln.Addr().String(), "cef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := ScanResult{Domain: "a.com", IP: "192.0.2.1", Status: "OK", Subject: "CN=a|b=c", Score: 80}
+	if err := sink.send(r); err != nil {
+		t.Fatal(err)
+	}
+	sink.conn.Write([]byte("\n"))
+	sink.close()
+
+	var msg string
+	select {
+	case msg = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collector received nothing")
+	}
+	length, rest, _ := strings.Cut(strings.TrimSuffix(msg, "\n"), " ")
+	if length == "" || len(rest) == 0 {
+		t.Fatalf("message %q is not octet-counted", msg)
+	}
+	for _, want := range []string{"CEF:0|tls-sweep|tls-sweep|", "|OK|TLS scan result OK|8|", "dhost=a.com", "dst=192.0.2.1", `cs1=CN\=a|b\=c`, "cn1=80"} {
+		if !strings.Contains(rest, want) {
+			t.Errorf("message %q lacks %q", rest, want)
+		}
+	}
+}
+
+func TestDialSyslogRejectsBadConfig(t *testing.T) {
+	if _, err := dialSyslog("udp://127.0.0.1:514", "json"); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if _, err := dialSyslog("http://127.0.0.1:514", "cef"); err == nil {
+		t.Error("unknown scheme accepted")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sampleSpec is --sample, a share ("5%") or a number of targets.
+var sampleSpec string
+
+// dedupeTargets drops repeated targets, keeping the first occurrence and the
+// order. Names differing only in case or a trailing dot are the same
+// target. It returns how many were removed.
+func dedupeTargets(domains []string) ([]string, int) {
+	seen := make(map[string]bool, len(domains))
+	out := domains[:0:0]
+	for _, d := range domains {
+		key := strings.TrimSuffix(strings.ToLower(d), ".")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, d)
+	}
+	return out, len(domains) - len(out)
+}
+
+// sampleCount is how many of total targets spec asks for, at least one.
+func sampleCount(spec string, total int) (int, error) {
+	if pct, ok := strings.CutSuffix(spec, "%"); ok {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("--sample %q: want a share in (0%%, 100%%]", spec)
+		}
+		return min(max(int(float64(total)*p/100+0.5), 1), total), nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("--sample %q: want a share such as 5%% or a number of targets", spec)
+	}
+	return min(n, total), nil
+}
+
+// sampleTargets picks n of domains at random, keeping their order.
+func sampleTargets(domains []string, n int, rnd *rand.Rand) []string {
+	picked := rnd.Perm(len(domains))[:n]
+	sort.Ints(picked)
+	out := make([]string, n)
+	for i, j := range picked {
+		out[i] = domains[j]
+	}
+	return out
+}
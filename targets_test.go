@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDedupeTargets(t *testing.T) {
+	got, removed := dedupeTargets([]string{"example.com", "example.net", "Example.com", "example.com.", "example.org", "example.net"})
+	if want := []string{"example.com", "example.net", "example.org"}; !reflect.DeepEqual(got, want) || removed != 3 {
+		t.Errorf("got %v, %d removed", got, removed)
+	}
+}
+
+func TestExpandTargetsDedupes(t *testing.T) {
+	if got := expandTargets("example", []string{"com", "net", "com"}); len(got) != 2 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestSampleCount(t *testing.T) {
+	for _, c := range []struct {
+		spec  string
+		total int
+		want  int
+	}{
+		{"5%", 1500, 75},
+		{"0.1%", 100, 1},
+		{"100%", 30, 30},
+		{"20", 1500, 20},
+		{"20", 10, 10},
+	} {
+		if n, err := sampleCount(c.spec, c.total); err != nil || n != c.want {
+			t.Errorf("sampleCount(%q, %d) = %d, %v; want %d", c.spec, c.total, n, err, c.want)
+		}
+	}
+	for _, spec := range []string{"0%", "150%", "x%", "0", "-3", "five"} {
+		if _, err := sampleCount(spec, 100); err == nil {
+			t.Errorf("sampleCount(%q) accepted", spec)
+		}
+	}
+}
+
+func TestSampleTargets(t *testing.T) {
+	domains := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	got := sampleTargets(domains, 3, rand.New(rand.NewSource(1)))
+	if len(got) != 3 {
+		t.Fatalf("got %v", got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i-1] >= got[i] {
+			t.Errorf("order lost: %v", got)
+		}
+	}
+}
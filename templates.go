@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// targetTemplates are the --template values: the shapes targets are
+// generated in, {base} and {tld} standing for the base domain and each
+// TLD. None means {base}.{tld}.
+var targetTemplates []string
+
+// templateLiteral is what a template may hold besides its placeholders.
+var templateLiteral = regexp.MustCompile(`^[a-z0-9.-]*$`)
+
+// checkTemplate checks that tmpl names the base domain and the TLD, and
+// that the rest of it can be part of a host name.
+func checkTemplate(tmpl string) error {
+	if !strings.Contains(tmpl, "{base}") || !strings.HasSuffix(tmpl, ".{tld}") {
+		return fmt.Errorf("template %q: want {base} and a trailing .{tld}, e.g. {base}-login.{tld}", tmpl)
+	}
+	rest := strings.NewReplacer("{base}", "", "{tld}", "").Replace(tmpl)
+	if !templateLiteral.MatchString(rest) {
+		return fmt.Errorf("template %q: only {base}, {tld}, lower-case letters, digits, dots and hyphens are allowed", tmpl)
+	}
+	if strings.Contains(tmpl, "..") || strings.HasPrefix(tmpl, ".") || strings.HasPrefix(tmpl, "-") {
+		return fmt.Errorf("template %q does not make a valid host name", tmpl)
+	}
+	return nil
+}
+
+func addTemplate(v string) error {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if err := checkTemplate(v); err != nil {
+		return err
+	}
+	targetTemplates = append(targetTemplates, v)
+	return nil
+}
+
+// expandTemplates is baseDomain under every TLD in the shape of each
+// template in turn, or as {base}.{tld} without templates.
+func expandTemplates(baseDomain string, tlds, templates []string) []string {
+	if len(templates) == 0 {
+		templates = []string{"{base}.{tld}"}
+	}
+	var domains []string
+	for _, tmpl := range templates {
+		for _, tld := range tlds {
+			if strings.HasPrefix(tld, "xn--") && !scanIDN {
+				continue
+			}
+			domains = append(domains, strings.NewReplacer("{base}", baseDomain, "{tld}", tld).Replace(tmpl))
+		}
+	}
+	return domains
+}
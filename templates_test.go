@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckTemplate(t *testing.T) {
+	for _, tmpl := range []string{"{base}.{tld}", "{base}-login.{tld}", "{base}shop.{tld}", "login.{base}.{tld}", "my{base}.co.{tld}"} {
+		if err := checkTemplate(tmpl); err != nil {
+			t.Errorf("checkTemplate(%q) = %v", tmpl, err)
+		}
+	}
+	for _, tmpl := range []string{"secure-{tld}", "{base}-login", "{base}.{tld}.evil", "{base}_x.{tld}", "{brand}.{tld}", "-{base}.{tld}", "{base}..{tld}"} {
+		if err := checkTemplate(tmpl); err == nil {
+			t.Errorf("checkTemplate(%q) accepted", tmpl)
+		}
+	}
+}
+
+func TestExpandTemplates(t *testing.T) {
+	tlds := []string{"com", "de", "xn--p1ai"}
+	if got := strings.Join(expandTemplates("shop", tlds, nil), ","); got != "shop.com,shop.de" {
+		t.Errorf("no templates = %s", got)
+	}
+	got := expandTargetsWith("shop", tlds, []string{"{base}-login.{tld}", "{base}.{tld}", "{base}-login.{tld}"})
+	if strings.Join(got, ",") != "shop-login.com,shop-login.de,shop.com,shop.de" {
+		t.Errorf("templates = %v", got)
+	}
+}
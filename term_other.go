@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+type terminal struct{}
+
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("--tui is only supported on Linux and macOS")
+}
+
+func (t *terminal) restore()                  {}
+func (t *terminal) size() (width, height int) { return 80, 24 }
+func (t *terminal) draw(lines []string)       {}
@@ -0,0 +1,74 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// terminal is the controlling terminal in raw mode, showing the
+// alternate screen.
+type terminal struct {
+	fd    int
+	saved syscall.Termios
+}
+
+func openTerminal() (*terminal, error) {
+	t := &terminal{fd: int(os.Stdin.Fd())}
+	if err := ioctl(t.fd, ioctlGetTermios, unsafe.Pointer(&t.saved)); err != nil {
+		return nil, fmt.Errorf("--tui needs a terminal on stdin: %v", err)
+	}
+	raw := t.saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	return t, nil
+}
+
+func (t *terminal) restore() {
+	os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+	ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&t.saved))
+}
+
+// size returns the window size, 80x24 when it cannot be read.
+func (t *terminal) size() (width, height int) {
+	var ws struct{ rows, cols, x, y uint16 }
+	if err := ioctl(int(os.Stdout.Fd()), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil || ws.cols == 0 {
+		return 80, 24
+	}
+	return int(ws.cols), int(ws.rows)
+}
+
+// draw replaces the screen with lines in one write, so it does not
+// flicker.
+func (t *terminal) draw(lines []string) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(l)
+		b.WriteString("\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
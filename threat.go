@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// iocFeedFiles are the --ioc-feed arguments, [name=]path.
+var iocFeedFiles []string
+
+// iocFeed is one blocklist of IPs or networks, domains and certificate
+// fingerprints.
+type iocFeed struct {
+	name    string
+	ips     map[string]bool
+	nets    []*net.IPNet
+	domains map[string]bool
+	certs   map[string]bool // lowercase hex SHA-1 or SHA-256
+}
+
+// loadIOCFeed reads a feed named after its file unless given as
+// name=path. It takes the first indicator of every line, so abuse.ch
+// CSVs (SSLBL, Feodo, URLhaus), hosts files and plain lists all load.
+func loadIOCFeed(arg string) (*iocFeed, error) {
+	name, path, ok := strings.Cut(arg, "=")
+	if !ok {
+		path = arg
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	feed := &iocFeed{name: name, ips: make(map[string]bool), domains: make(map[string]bool), certs: make(map[string]bool)}
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ';' || r == ' ' || r == '\t' }) {
+			if feed.add(strings.Trim(field, `"'`)) {
+				break
+			}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return feed, nil
+}
+
+var (
+	fingerprintPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+	domainPattern      = regexp.MustCompile(`^([a-z0-9-]+\.)+[a-z][a-z0-9-]*$`)
+)
+
+// add records field if it is an indicator. Loopback and unspecified
+// addresses, the sink column of hosts files, are not.
+func (f *iocFeed) add(field string) bool {
+	v := strings.ToLower(field)
+	if ip := net.ParseIP(v); ip != nil {
+		if ip.IsLoopback() || ip.IsUnspecified() {
+			return false
+		}
+		f.ips[ip.String()] = true
+		return true
+	}
+	if _, n, err := net.ParseCIDR(v); err == nil {
+		f.nets = append(f.nets, n)
+		return true
+	}
+	if fingerprintPattern.MatchString(strings.ReplaceAll(v, ":", "")) {
+		f.certs[strings.ReplaceAll(v, ":", "")] = true
+		return true
+	}
+	if strings.Contains(v, "://") {
+		u, err := url.Parse(v)
+		if err != nil || u.Hostname() == "" {
+			return false
+		}
+		v = u.Hostname()
+		if ip := net.ParseIP(v); ip != nil {
+			f.ips[ip.String()] = true
+			return true
+		}
+	}
+	if domainPattern.MatchString(v) {
+		f.domains[strings.TrimSuffix(v, ".")] = true
+		return true
+	}
+	return false
+}
+
+// matches returns the indicators of f that r hits: its IP, its domain or
+// MX host or a parent of them, or its leaf certificate.
+func (f *iocFeed) matches(r ScanResult) []string {
+	var hits []string
+	if ip := net.ParseIP(r.IP); ip != nil {
+		if f.ips[ip.String()] {
+			hits = append(hits, ip.String())
+		}
+		for _, n := range f.nets {
+			if n.Contains(ip) {
+				hits = append(hits, n.String())
+			}
+		}
+	}
+	for _, host := range []string{r.Domain, r.MX} {
+		for name := strings.ToLower(host); name != ""; {
+			if f.domains[name] {
+				hits = append(hits, name)
+				break
+			}
+			_, parent, ok := strings.Cut(name, ".")
+			if !ok {
+				break
+			}
+			name = parent
+		}
+	}
+	if len(r.Chain) > 0 {
+		s1 := sha1.Sum(r.Chain[0].Raw)
+		s256 := sha256.Sum256(r.Chain[0].Raw)
+		for _, fp := range []string{hex.EncodeToString(s1[:]), hex.EncodeToString(s256[:])} {
+			if f.certs[fp] {
+				hits = append(hits, fp)
+			}
+		}
+	}
+	return hits
+}
+
+// threatMatch lists the hits of r in feeds as "feed=indicator", sorted.
+func threatMatch(r ScanResult, feeds []*iocFeed) string {
+	var all []string
+	for _, f := range feeds {
+		for _, hit := range f.matches(r) {
+			all = append(all, f.name+"="+hit)
+		}
+	}
+	sort.Strings(all)
+	return strings.Join(slices.Compact(all), " ")
+}
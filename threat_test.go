@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestThreatMatch(t *testing.T) {
+	pair, _ := selfSignedCert("c2.example")
+	cert, _ := x509.ParseCertificate(pair.Certificate[0])
+	sum := sha1.Sum(cert.Raw)
+	fp := hex.EncodeToString(sum[:])
+
+	dir := t.TempDir()
+	sslbl := filepath.Join(dir, "sslipblacklist.csv")
+	os.WriteFile(sslbl, []byte("# abuse.ch SSLBL\n# Firstseen,DstIP,DstPort\n2024-01-02 10:00:00,198.51.100.7,443\n"), 0o644)
+	certs := filepath.Join(dir, "certs.csv")
+	os.WriteFile(certs, []byte("# Listingdate,SHA1,Listingreason\n2024-01-02 10:00:00,"+fp+",C2\n"), 0o644)
+	custom := filepath.Join(dir, "mine.txt")
+	os.WriteFile(custom, []byte("0.0.0.0 evil.example\n\"https://phish.example/login\",credential phishing\n203.0.113.0/24,bulletproof host\n"), 0o644)
+
+	var feeds []*iocFeed
+	for _, arg := range []string{sslbl, certs, "ours=" + custom} {
+		f, err := loadIOCFeed(arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		feeds = append(feeds, f)
+	}
+	if feeds[0].name != "sslipblacklist" || feeds[2].name != "ours" {
+		t.Errorf("feed names %q, %q", feeds[0].name, feeds[2].name)
+	}
+	if feeds[2].ips["0.0.0.0"] {
+		t.Error("hosts-file sink address loaded as an indicator")
+	}
+
+	for _, tc := range []struct {
+		r    ScanResult
+		want string
+	}{
+		{ScanResult{Domain: "a.example", IP: "198.51.100.7"}, "sslipblacklist=198.51.100.7"},
+		{ScanResult{Domain: "login.evil.example", IP: "192.0.2.1"}, "ours=evil.example"},
+		{ScanResult{Domain: "phish.example", IP: "203.0.113.9"}, "ours=203.0.113.0/24 ours=phish.example"},
+		{ScanResult{Domain: "b.example", IP: "192.0.2.1", Chain: []*x509.Certificate{cert}}, "certs=" + fp},
+		{ScanResult{Domain: "mail.example", MX: "mx.evil.example", IP: "192.0.2.1"}, "ours=evil.example"},
+		{ScanResult{Domain: "notevil.example", IP: "192.0.2.1"}, ""},
+	} {
+		if got := threatMatch(tc.r, feeds); got != tc.want {
+			t.Errorf("threatMatch(%s, %s) = %q, want %q", tc.r.Domain, tc.r.IP, got, tc.want)
+		}
+	}
+
+	sc := &scorer{brand: "brand"}
+	if score, _ := sc.score(ScanResult{Status: "TIMEOUT", ThreatMatch: "ours=evil.example"}); score != scoreThreatMatch {
+		t.Errorf("score with a threat match = %d, want %d", score, scoreThreatMatch)
+	}
+}
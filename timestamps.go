@@ -0,0 +1,44 @@
+package main
+
+import "time"
+
+// localTimes is --local-time: result timestamps in the local zone instead
+// of UTC.
+var localTimes bool
+
+// timestamp formats t for a result, in RFC 3339 so that the time of day of
+// an expiry is kept.
+func timestamp(t time.Time) string {
+	if localTimes {
+		return t.Local().Format(time.RFC3339)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseValidTo parses a ValidTo, NotBefore or ChainValidTo column, RFC 3339
+// or the bare date of exports and history written before schema 2.
+func parseValidTo(v string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	return t, err == nil
+}
+
+// sameTimestamp reports whether a and b are the same instant, or the same
+// day when either is a bare date, so that history from before schema 2 does
+// not show every certificate as changed.
+func sameTimestamp(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ta, okA := parseValidTo(a)
+	tb, okB := parseValidTo(b)
+	if !okA || !okB {
+		return false
+	}
+	if len(a) == len(time.DateOnly) || len(b) == len(time.DateOnly) {
+		return ta.UTC().Format(time.DateOnly) == tb.UTC().Format(time.DateOnly)
+	}
+	return ta.Equal(tb)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	expiry := time.Date(2024, 8, 18, 23, 59, 59, 0, time.FixedZone("CEST", 2*3600))
+	if got := timestamp(expiry); got != "2024-08-18T21:59:59Z" {
+		t.Errorf("UTC: %s", got)
+	}
+	localTimes = true
+	defer func() { localTimes = false }()
+	if got := timestamp(expiry); got != expiry.Local().Format(time.RFC3339) {
+		t.Errorf("local: %s", got)
+	}
+}
+
+func TestParseValidTo(t *testing.T) {
+	for v, want := range map[string]time.Time{
+		"2024-08-18T21:59:59Z":      time.Date(2024, 8, 18, 21, 59, 59, 0, time.UTC),
+		"2024-08-18T23:59:59+02:00": time.Date(2024, 8, 18, 21, 59, 59, 0, time.UTC),
+		"2024-08-18":                time.Date(2024, 8, 18, 0, 0, 0, 0, time.UTC),
+	} {
+		if got, ok := parseValidTo(v); !ok || !got.Equal(want) {
+			t.Errorf("parseValidTo(%q) = %v %v", v, got, ok)
+		}
+	}
+	if _, ok := parseValidTo("18/08/2024"); ok {
+		t.Error("parsed 18/08/2024")
+	}
+}
+
+func TestSameTimestamp(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want bool
+	}{
+		{"2024-08-18T21:59:59Z", "2024-08-18T23:59:59+02:00", true},
+		{"2024-08-18T21:59:59Z", "2024-08-18T22:59:59Z", false},
+		{"2024-08-18", "2024-08-18T21:59:59Z", true}, // history from before schema 2
+		{"2024-08-18", "2024-08-19T21:59:59Z", false},
+		{"", "2024-08-18T21:59:59Z", false},
+	} {
+		if got := sameTimestamp(c.a, c.b); got != c.want {
+			t.Errorf("sameTimestamp(%q, %q) = %v", c.a, c.b, got)
+		}
+	}
+}
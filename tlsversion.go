@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// scanTLSMin and scanTLSMax bound the protocol versions every probe
+// offers; 0 leaves the ClientHello fingerprint's range.
+var scanTLSMin, scanTLSMax uint16
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsVersionFlag parses 1.0 to 1.3 into *v.
+func tlsVersionFlag(v *uint16) func(string) error {
+	return func(s string) error {
+		version, ok := tlsVersions[s]
+		if !ok {
+			return fmt.Errorf("unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", s)
+		}
+		*v = version
+		return nil
+	}
+}
+
+// checkTLSRange rejects a --tls-min above --tls-max, which no server
+// could satisfy.
+func checkTLSRange() error {
+	if scanTLSMin != 0 && scanTLSMax != 0 && scanTLSMin > scanTLSMax {
+		return fmt.Errorf("--tls-min %s is above --tls-max %s", tls.VersionName(scanTLSMin), tls.VersionName(scanTLSMax))
+	}
+	return nil
+}
+
+// shape applies the ClientHello fingerprint and the --tls-min/--tls-max
+// bounds to config, unless config already pins a version.
+func (s *scanner) shape(config *tls.Config) {
+	pinned := config.MinVersion != 0 || config.MaxVersion != 0
+	s.hello.apply(config)
+	if pinned {
+		return
+	}
+	if s.tlsMin != 0 {
+		config.MinVersion = s.tlsMin
+	}
+	if s.tlsMax != 0 {
+		config.MaxVersion = s.tlsMax
+		// crypto/tls clients start at TLS 1.2 by default, which leaves
+		// nothing to offer under a lower maximum.
+		if s.tlsMin == 0 && (config.MinVersion == 0 || config.MinVersion > s.tlsMax) {
+			config.MinVersion = tls.VersionTLS10
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTLSVersionFlag(t *testing.T) {
+	var v uint16
+	if err := tlsVersionFlag(&v)("1.1"); err != nil || v != tls.VersionTLS11 {
+		t.Errorf("1.1 = %#x, %v", v, err)
+	}
+	if err := tlsVersionFlag(&v)("SSLv3"); err == nil {
+		t.Error("SSLv3 accepted")
+	}
+
+	defer func(min, max uint16) { scanTLSMin, scanTLSMax = min, max }(scanTLSMin, scanTLSMax)
+	scanTLSMin, scanTLSMax = tls.VersionTLS13, tls.VersionTLS12
+	if checkTLSRange() == nil {
+		t.Error("inverted range accepted")
+	}
+}
+
+func TestTLSVersionBounds(t *testing.T) {
+	cert, err := selfSignedCert("bounds.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS10,
+		MaxVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Read(make([]byte, 1))
+				conn.Close()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	for _, tc := range []struct {
+		name           string
+		min, max       uint16
+		status, wanted string
+	}{
+		{"unbounded", 0, 0, "OK", "TLS 1.2"},
+		{"legacy only", 0, tls.VersionTLS10, "OK", "TLS 1.0"},
+		{"tls13 only", tls.VersionTLS13, 0, "TLS ERROR", ""},
+	} {
+		s := &scanner{port: port, timeout: 2 * time.Second, tlsMin: tc.min, tlsMax: tc.max, lookupHost: func(string) ([]string, error) { return []string{"127.0.0.1"}, nil }}
+		if r := s.scan("bounds.example"); r.Status != tc.status || r.TLSVersion != tc.wanted {
+			t.Errorf("%s: got %s %q, want %s %q (%v)", tc.name, r.Status, r.TLSVersion, tc.status, tc.wanted, r.Err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// torProxy is --tor-proxy, the SOCKS5 address .onion targets are reached
+// through.
+var torProxy = "127.0.0.1:9050"
+
+func isOnion(domain string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(domain, ".")), ".onion")
+}
+
+// socksError is a failed SOCKS5 CONNECT, with the reply code.
+type socksError byte
+
+func (e socksError) Error() string {
+	switch e {
+	case 0x04:
+		return "socks: host unreachable"
+	case 0x05:
+		return "socks: connection refused"
+	case 0x06:
+		return "socks: TTL expired"
+	case 0xf0:
+		return "socks: onion service descriptor not found"
+	case 0xf2:
+		return "socks: onion service introduction failed"
+	case 0xf3:
+		return "socks: onion service rendezvous failed"
+	}
+	return fmt.Sprintf("socks: reply %#x", byte(e))
+}
+
+// onionStatus classifies a failed CONNECT through Tor. Tor's extended
+// codes (0xf0-0xf7) say why an onion service could not be reached.
+func onionStatus(err error) string {
+	var code socksError
+	if !errors.As(err, &code) {
+		return connectStatus(err)
+	}
+	switch code {
+	case 0x05:
+		return "REFUSED"
+	case 0xf0, 0xf1:
+		return "NXDOMAIN"
+	}
+	return "FILTERED"
+}
+
+// dialSOCKS connects to host:port through the SOCKS5 proxy at proxy,
+// letting the proxy resolve host.
+func dialSOCKS(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), proxy, host, port string) (net.Conn, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 || len(host) > 255 {
+		return nil, fmt.Errorf("socks: invalid target %s:%s", host, port)
+	}
+	conn, err := dial(ctx, "tcp", proxy)
+	if err != nil {
+		return nil, fmt.Errorf("tor proxy %s: %w", proxy, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := socksConnect(conn, host, uint16(p)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socksConnect runs the RFC 1928 greeting, without authentication, and a
+// CONNECT to a domain name.
+func socksConnect(conn net.Conn, host string, port uint16) error {
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		return err
+	}
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil {
+		return err
+	}
+	if choice[0] != 5 || choice[1] != 0 {
+		return fmt.Errorf("socks: proxy wants authentication method %#x", choice[1])
+	}
+
+	req := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	req = binary.BigEndian.AppendUint16(req, port)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return socksError(reply[1])
+	}
+	// Skip the bound address, which Tor sets to zeros.
+	var skip int
+	switch reply[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("socks: bad address type %d", reply[3])
+	}
+	_, err := io.CopyN(io.Discard, conn, int64(skip+2))
+	return err
+}
+
+// scanOnion probes an onion service through Tor. Circuits take seconds
+// to build, so the connect gets three timeouts' worth of time. The
+// result has no IP; its Family is Tor.
+func (s *scanner) scanOnion(domain string) ScanResult {
+	failed := func(status string, err error) ScanResult {
+		return ScanResult{Domain: domain, IP: "-", Family: "Tor", Status: status, Err: err}
+	}
+	dial := s.dialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*s.timeout)
+	defer cancel()
+	raw, err := dialSOCKS(ctx, dial, s.torProxy, domain, s.port)
+	if err != nil {
+		return failed(onionStatus(err), err)
+	}
+	conn, err := s.handshake(raw, domain)
+	if errors.Is(err, errNoTLS) {
+		return failed("NO TLS", nil)
+	}
+	if authErr := (*clientAuthError)(nil); errors.As(err, &authErr) {
+		r := certResult(domain, "-", authErr.chain)
+		r.Family = "Tor"
+		return r
+	}
+	if err != nil {
+		return failed(handshakeStatus(err), err)
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return failed("NO CERT", nil)
+	}
+	r := certResult(domain, "-", state.PeerCertificates)
+	setHandshake(&r, conn)
+	r.Family = "Tor"
+	return r
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeTor is a SOCKS5 proxy that connects every CONNECT for onion to
+// target and answers reply for any other name.
+func fakeTor(t *testing.T, onion, target string, reply byte) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				greeting := make([]byte, 3)
+				io.ReadFull(conn, greeting)
+				conn.Write([]byte{5, 0})
+				head := make([]byte, 5)
+				io.ReadFull(conn, head)
+				name := make([]byte, int(head[4])+2)
+				io.ReadFull(conn, name)
+				host := string(name[:len(name)-2])
+				if host != onion {
+					conn.Write([]byte{5, reply, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				up, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer up.Close()
+				conn.Write(binary.BigEndian.AppendUint16([]byte{5, 0, 0, 1, 0, 0, 0, 0}, 0))
+				go io.Copy(up, conn)
+				io.Copy(conn, up)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestScanOnion(t *testing.T) {
+	onion := "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion"
+	cert, err := selfSignedCert(onion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Read(make([]byte, 1))
+				conn.Close()
+			}()
+		}
+	}()
+
+	s := &scanner{port: "443", timeout: 2 * time.Second, torProxy: fakeTor(t, onion, ln.Addr().String(), 0xf0),
+		lookupHost: func(host string) ([]string, error) {
+			t.Errorf("%s resolved outside Tor", host)
+			return nil, nil
+		}}
+	r := s.scan(onion)
+	if r.Status != "OK" || r.Family != "Tor" || r.IP != "-" || r.Subject != onion {
+		t.Errorf("onion scan = %s %s %s %q (%v)", r.Status, r.Family, r.IP, r.Subject, r.Err)
+	}
+	if r := s.scan("missing.onion"); r.Status != "NXDOMAIN" {
+		t.Errorf("unknown onion = %s (%v), want NXDOMAIN", r.Status, r.Err)
+	}
+	if ips, dead := s.precheckDomain(onion); ips != nil || dead != nil {
+		t.Errorf("precheck of an onion = %v, %+v; want it left to the scan", ips, dead)
+	}
+}
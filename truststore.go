@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/x509"
+	"embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Root bundles built into the binary, one PEM file per trust store. Drop
+// further bundles (apple.pem, android-7.pem, java.pem) into truststores/
+// before building to ship them too.
+//
+//go:embed truststores/*.pem
+var embeddedTrustStores embed.FS
+
+var (
+	trustMatrix     bool
+	extraTrustStore []string // name=path, from --trust-store
+)
+
+// trustStore is a named set of roots a chain is validated against.
+type trustStore struct {
+	name  string
+	roots *x509.CertPool
+	certs []*x509.Certificate
+}
+
+// addTrustStore is the --trust-store flag: name=path of a PEM bundle. It
+// implies --trust-matrix.
+func addTrustStore(v string) error {
+	name, file, ok := strings.Cut(v, "=")
+	if !ok || name == "" || file == "" {
+		return fmt.Errorf("want name=path, got %q", v)
+	}
+	extraTrustStore = append(extraTrustStore, v)
+	trustMatrix = true
+	return nil
+}
+
+// loadTrustStores returns the embedded stores followed by those given as
+// name=path, sorted by name. A later store replaces an earlier one of the
+// same name.
+func loadTrustStores(extra []string) ([]trustStore, error) {
+	bundles := make(map[string][]byte)
+	files, err := embeddedTrustStores.ReadDir("truststores")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, err := embeddedTrustStores.ReadFile(path.Join("truststores", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		bundles[strings.TrimSuffix(f.Name(), ".pem")] = data
+	}
+	for _, e := range extra {
+		name, file, _ := strings.Cut(e, "=")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		bundles[name] = data
+	}
+
+	var stores []trustStore
+	for name, data := range bundles {
+		st, err := parseTrustStore(name, data)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, st)
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i].name < stores[j].name })
+	return stores, nil
+}
+
+func parseTrustStore(name string, data []byte) (trustStore, error) {
+	st := trustStore{name: name, roots: x509.NewCertPool()}
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue // bundles carry the odd certificate Go rejects
+		}
+		st.roots.AddCert(cert)
+		st.certs = append(st.certs, cert)
+	}
+	if len(st.certs) == 0 {
+		return trustStore{}, fmt.Errorf("trust store %s: no certificates", name)
+	}
+	return st, nil
+}
+
+// mozillaRoots is the embedded Mozilla store, parsed on first use.
+var mozillaRoots = sync.OnceValue(func() []*x509.Certificate {
+	data, err := embeddedTrustStores.ReadFile("truststores/mozilla.pem")
+	if err != nil {
+		return nil
+	}
+	st, err := parseTrustStore("mozilla", data)
+	if err != nil {
+		return nil
+	}
+	return st.certs
+})
+
+// trustStatus validates chain against one store: trusted, expired,
+// untrusted when no root of the store anchors it, or invalid.
+func trustStatus(chain []*x509.Certificate, roots *x509.CertPool, now time.Time) string {
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: now})
+	var invalid x509.CertificateInvalidError
+	switch {
+	case err == nil:
+		return "trusted"
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return "expired"
+	case errors.As(err, new(x509.UnknownAuthorityError)):
+		return "untrusted"
+	}
+	return "invalid"
+}
+
+// trustVerdicts is the Trust field for chain: store=status pairs.
+func trustVerdicts(chain []*x509.Certificate, stores []trustStore, now time.Time) string {
+	verdicts := make([]string, len(stores))
+	for i, st := range stores {
+		verdicts[i] = st.name + "=" + trustStatus(chain, st.roots, now)
+	}
+	return strings.Join(verdicts, " ")
+}
+
+// trustResults sets Trust on every result with a certificate.
+func trustResults(in <-chan ScanResult, stores []trustStore) chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		for r := range in {
+			if len(r.Chain) > 0 {
+				r.Trust = trustVerdicts(r.Chain, stores, time.Now())
+			}
+			out <- r
+		}
+	}()
+	return out
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate for cn signed by parent, or self-signed when
+// parent is nil.
+func issue(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestTrustMatrix(t *testing.T) {
+	root, rootKey := issue(t, "Test Root", true, nil, nil)
+	inter, interKey := issue(t, "Test Intermediate", true, root, rootKey)
+	leaf, _ := issue(t, "shop.example", false, inter, interKey)
+	other, _ := issue(t, "Other Root", true, nil, nil)
+
+	dir := t.TempDir()
+	bundle := func(name string, c *x509.Certificate) string {
+		p := filepath.Join(dir, name+".pem")
+		if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return name + "=" + p
+	}
+	stores, err := loadTrustStores([]string{bundle("corp", root), bundle("old-device", other)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, st := range stores {
+		names = append(names, st.name)
+	}
+	if got := strings.Join(names, ","); got != "corp,mozilla,old-device" {
+		t.Fatalf("stores = %s, want the embedded mozilla bundle between the extra ones", got)
+	}
+
+	chain := []*x509.Certificate{leaf, inter}
+	if got := trustVerdicts(chain, stores, time.Now()); got != "corp=trusted mozilla=untrusted old-device=untrusted" {
+		t.Errorf("verdicts = %s", got)
+	}
+	if got := trustStatus(chain, stores[0].roots, time.Now().Add(48*time.Hour)); got != "expired" {
+		t.Errorf("after expiry = %s, want expired", got)
+	}
+
+	if _, err := loadTrustStores([]string{"empty=" + os.DevNull}); err == nil {
+		t.Error("empty bundle accepted")
+	}
+	if err := addTrustStore("no-path"); err == nil {
+		t.Error("--trust-store without a path accepted")
+	}
+}
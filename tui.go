@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var tuiMode bool
+
+// tuiModel is the state of the --tui screen: the results so far, the
+// filter narrowing them and where the user is looking.
+type tuiModel struct {
+	total   int
+	scanned func() int64
+	done    bool
+
+	results  []ScanResult // all but NXDOMAIN, in arrival order
+	notFound int
+	shown    []int // indices into results passing the filter
+
+	filter  string
+	filters []resultFilter
+	terms   []string // filter words without an operator, matched on the domain
+	input   string
+	editing bool
+	err     string
+	lastLog string
+
+	detail    bool
+	cursor    int
+	top       int
+	detailTop int
+}
+
+func (m *tuiModel) add(r ScanResult) {
+	if r.Status == "NXDOMAIN" {
+		m.notFound++
+		return
+	}
+	m.results = append(m.results, r)
+	if m.matches(r) {
+		m.shown = append(m.shown, len(m.results)-1)
+	}
+}
+
+func (m *tuiModel) matches(r ScanResult) bool {
+	now := time.Now()
+	for _, f := range m.filters {
+		if !f.match(r, now) {
+			return false
+		}
+	}
+	for _, t := range m.terms {
+		if !strings.Contains(strings.ToLower(r.Domain), t) {
+			return false
+		}
+	}
+	return true
+}
+
+// setFilter applies space-separated --only expressions; words without an
+// operator match a substring of the domain.
+func (m *tuiModel) setFilter(expr string) error {
+	var filters []resultFilter
+	var terms []string
+	for _, word := range strings.Fields(expr) {
+		if !strings.ContainsAny(word, "!=~<>") {
+			terms = append(terms, strings.ToLower(word))
+			continue
+		}
+		f, err := parseFilter(word)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, f)
+	}
+	m.filter, m.filters, m.terms = expr, filters, terms
+	m.shown = m.shown[:0]
+	for i, r := range m.results {
+		if m.matches(r) {
+			m.shown = append(m.shown, i)
+		}
+	}
+	m.cursor, m.top = 0, 0
+	return nil
+}
+
+// key handles one key press and reports whether the user asked to quit.
+func (m *tuiModel) key(k string) bool {
+	if m.editing {
+		switch k {
+		case "enter":
+			if err := m.setFilter(m.input); err != nil {
+				m.err = err.Error()
+			} else {
+				m.err = ""
+				m.editing = false
+			}
+		case "esc":
+			m.editing, m.err = false, ""
+		case "backspace":
+			if _, size := utf8.DecodeLastRuneInString(m.input); size > 0 {
+				m.input = m.input[:len(m.input)-size]
+			}
+		default:
+			if utf8.RuneCountInString(k) == 1 {
+				m.input += k
+			}
+		}
+		return false
+	}
+
+	switch k {
+	case "q", "ctrl-c":
+		return true
+	case "/":
+		m.editing, m.input = true, m.filter
+	case "enter":
+		if len(m.shown) > 0 {
+			m.detail, m.detailTop = true, 0
+		}
+	case "esc", "backspace":
+		m.detail = false
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-10)
+	case "pgdown":
+		m.move(10)
+	case "home", "g":
+		m.move(-len(m.results))
+	case "end", "G":
+		m.move(len(m.results))
+	}
+	return false
+}
+
+func (m *tuiModel) move(n int) {
+	if m.detail {
+		m.detailTop = max(m.detailTop+n, 0)
+		return
+	}
+	m.cursor = min(max(m.cursor+n, 0), max(len(m.shown)-1, 0))
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiDim   = "\x1b[2m"
+	ansiRev   = "\x1b[7m"
+)
+
+// render draws the screen as width x height lines.
+func (m *tuiModel) render(width, height int) []string {
+	progress := fmt.Sprintf("scanned %d/%d", m.scanned(), m.total)
+	if m.done {
+		progress = fmt.Sprintf("done, %d scanned", m.total)
+	}
+	lines := []string{ansiBold + clip(fmt.Sprintf("tls-sweep  %s  %d shown of %d  %d NXDOMAIN hidden", progress, len(m.shown), len(m.results), m.notFound), width) + ansiReset}
+
+	body := height - 3
+	if m.detail && len(m.shown) > 0 {
+		lines = append(lines, m.renderDetail(width, body)...)
+	} else {
+		lines = append(lines, m.renderTable(width, body)...)
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+
+	switch {
+	case m.editing && m.err != "":
+		lines = append(lines, ansiRed+clip(m.err, width)+ansiReset)
+	case m.lastLog != "":
+		lines = append(lines, ansiDim+clip(m.lastLog, width)+ansiReset)
+	default:
+		lines = append(lines, "")
+	}
+	switch {
+	case m.editing:
+		lines = append(lines, clip("filter: "+m.input+"_", width))
+	case m.detail:
+		lines = append(lines, ansiDim+clip("↑↓ scroll  esc back  q quit and export", width)+ansiReset)
+	default:
+		help := "↑↓ move  enter details  / filter  q quit and export"
+		if m.filter != "" {
+			help = "filter: " + m.filter + "  |  " + help
+		}
+		lines = append(lines, ansiDim+clip(help, width)+ansiReset)
+	}
+	return lines
+}
+
+func (m *tuiModel) renderTable(width, rows int) []string {
+	row := func(domain, status, ip, validTo, score, issuer string) string {
+		return fmt.Sprintf("%-32s %-11s %-15s %-10s %5s  %s", clip(domain, 32), clip(status, 11), clip(ip, 15), validTo, score, issuer)
+	}
+	lines := []string{ansiDim + clip(row("Domain", "Status", "IP", "ValidTo", "Score", "Issuer"), width) + ansiReset}
+	rows--
+
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if rows > 0 && m.cursor >= m.top+rows {
+		m.top = m.cursor - rows + 1
+	}
+	for i := m.top; i < len(m.shown) && i < m.top+rows; i++ {
+		r := m.results[m.shown[i]]
+		line := clip(row(r.Domain, r.Status, r.IP, r.ValidTo, fmt.Sprint(r.Score), r.Issuer), width)
+		switch {
+		case i == m.cursor:
+			line = ansiRev + line + ansiReset
+		case r.Status == "OK":
+			line = ansiGreen + line + ansiReset
+		case isFailure(r.Status):
+			line = ansiRed + line + ansiReset
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderDetail lists every non-empty column of the selected result.
+func (m *tuiModel) renderDetail(width, rows int) []string {
+	r := m.results[m.shown[m.cursor]]
+	var all []string
+	for i, v := range resultRow(r) {
+		if v != "" && v != "0" {
+			all = append(all, fmt.Sprintf("%-15s %s", resultColumns[i], v))
+		}
+	}
+	if r.Err != nil {
+		all = append(all, fmt.Sprintf("%-15s %v", "Error", r.Err))
+	}
+	m.detailTop = min(m.detailTop, max(len(all)-rows, 0))
+	var lines []string
+	for _, l := range all[m.detailTop:min(m.detailTop+rows, len(all))] {
+		lines = append(lines, clip(l, width))
+	}
+	return lines
+}
+
+// clip cuts s to n runes, marking the cut with an ellipsis.
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string([]rune(s)[:max(n, 0)])
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// parseKeys splits what one read of the terminal returned into key names:
+// arrows and the like, enter, esc, backspace, ctrl-c or a character.
+func parseKeys(b []byte) []string {
+	sequences := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1bOA": "up", "\x1bOB": "down",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdown",
+		"\x1b[H": "home", "\x1b[F": "end", "\x1b[1~": "home", "\x1b[4~": "end",
+	}
+	var keys []string
+	for len(b) > 0 {
+		if b[0] == 0x1b && len(b) > 2 && (b[1] == '[' || b[1] == 'O') {
+			found := false
+			for seq, name := range sequences {
+				if strings.HasPrefix(string(b), seq) {
+					keys, b, found = append(keys, name), b[len(seq):], true
+					break
+				}
+			}
+			if !found {
+				// An unknown sequence: skip it whole.
+				end := 2
+				for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+					end++
+				}
+				b = b[min(end+1, len(b)):]
+			}
+			continue
+		}
+		switch b[0] {
+		case 0x1b:
+			keys = append(keys, "esc")
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl-c")
+		default:
+			r, size := utf8.DecodeRune(b)
+			if r >= ' ' {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// tuiLog keeps the last log line for the status bar while the screen is
+// taken.
+type tuiLog struct{ last chan string }
+
+func (l tuiLog) Write(p []byte) (int, error) {
+	select {
+	case l.last <- strings.TrimSpace(string(p)):
+	default:
+	}
+	return len(p), nil
+}
+
+// runTUI shows results as they arrive and holds them until the user quits,
+// then passes all of them on to the export. Quitting before the sweep has
+// finished stops it and exports what was scanned.
+func runTUI(in <-chan ScanResult, total int, stop context.CancelFunc) (chan ScanResult, error) {
+	term, err := openTerminal()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(chan []string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- parseKeys(buf[:n])
+		}
+	}()
+	logs := tuiLog{last: make(chan string, 16)}
+	logOutput := logger.Writer()
+	logger.SetOutput(logs)
+
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		m := &tuiModel{total: total, scanned: scanned.Load}
+		var all []ScanResult
+		ticker := time.NewTicker(250 * time.Millisecond)
+		draw := func() {
+			w, h := term.size()
+			term.draw(m.render(w, h))
+		}
+		draw()
+	loop:
+		for {
+			select {
+			case r, ok := <-in:
+				if !ok {
+					in, m.done = nil, true
+					draw()
+					continue
+				}
+				all = append(all, r)
+				m.add(r)
+			case ks, ok := <-keys:
+				if !ok {
+					break loop
+				}
+				for _, k := range ks {
+					if m.key(k) {
+						break loop
+					}
+				}
+				draw()
+			case line := <-logs.last:
+				m.lastLog = line
+			case <-ticker.C:
+				draw()
+			}
+		}
+		ticker.Stop()
+		if in != nil {
+			m.lastLog = "Stopping the sweep…"
+			draw()
+			stop()
+			for r := range in {
+				all = append(all, r)
+			}
+		}
+		term.restore()
+		logger.SetOutput(logOutput)
+		for _, r := range all {
+			out <- r
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	got := strings.Join(parseKeys([]byte("j\x1b[A\x1b[6~/é\r\x7f\x1b\x03\x1b[1;5C")), ",")
+	// The trailing ctrl-right sequence is unknown and skipped.
+	if got != "j,up,pgdown,/,é,enter,backspace,esc,ctrl-c" {
+		t.Errorf("keys = %s", got)
+	}
+}
+
+func TestTUIModel(t *testing.T) {
+	m := &tuiModel{total: 4, scanned: func() int64 { return 3 }}
+	m.add(ScanResult{Domain: "brand.com", Status: "OK", IP: "192.0.2.1", Issuer: "R3", ValidTo: "2030-01-01", Score: 45})
+	m.add(ScanResult{Domain: "brand.net", Status: "TLS ERROR", IP: "192.0.2.2", Err: errors.New("handshake failure")})
+	m.add(ScanResult{Domain: "brand.org", Status: "NXDOMAIN"})
+	m.add(ScanResult{Domain: "shop-brand.io", Status: "OK", Score: 10})
+
+	screen := strings.Join(m.render(100, 12), "\n")
+	if !strings.Contains(screen, "scanned 3/4") || !strings.Contains(screen, "3 shown of 3") || !strings.Contains(screen, "1 NXDOMAIN hidden") {
+		t.Errorf("header missing progress:\n%s", screen)
+	}
+
+	// Filter with --only expressions and a plain domain substring.
+	for _, k := range strings.Split("/|s|t|a|t|u|s|=|O|K| |s|h|o|p|enter", "|") {
+		m.key(k)
+	}
+	if m.editing || len(m.shown) != 1 || m.results[m.shown[0]].Domain != "shop-brand.io" {
+		t.Fatalf("filter %q shows %v (err %q)", m.filter, m.shown, m.err)
+	}
+	for _, k := range []string{"/", "backspace", "backspace", "backspace", "backspace", "backspace", "enter"} {
+		m.key(k)
+	}
+	if m.filter != "status=OK" || len(m.shown) != 2 {
+		t.Fatalf("filter %q shows %v", m.filter, m.shown)
+	}
+	for _, k := range []string{"/", " ", "x", "<", "1", "enter"} {
+		m.key(k)
+	}
+	if !m.editing || m.err == "" || m.filter != "status=OK" {
+		t.Errorf("bad filter applied: editing %v, err %q, filter %q", m.editing, m.err, m.filter)
+	}
+	m.key("esc")
+	m.setFilter("")
+
+	m.key("down")
+	m.key("enter")
+	detail := strings.Join(m.render(100, 20), "\n")
+	if !m.detail || !strings.Contains(detail, "handshake failure") || !strings.Contains(detail, "192.0.2.2") {
+		t.Errorf("detail view:\n%s", detail)
+	}
+	m.key("esc")
+	if m.detail || m.key("x") || !m.key("q") {
+		t.Error("esc should close the detail view and only q quit")
+	}
+}
+
+func TestClip(t *testing.T) {
+	if clip("bücher.example", 6) != "büche…" || clip("short", 10) != "short" {
+		t.Errorf("clip = %q, %q", clip("bücher.example", 6), clip("short", 10))
+	}
+}
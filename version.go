@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// Without them the VCS stamp of the Go toolchain is used.
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+	// releaseKey is the base64 DER (PKIX) public key release binaries are
+	// signed with; self-update needs it or --key.
+	releaseKey string
+)
+
+// buildInfo returns the version, commit and build date of this binary.
+func buildInfo() (v, rev, date string) {
+	v, rev, date = version, commit, buildDate
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && rev == "":
+			rev = s.Value
+		case s.Key == "vcs.time" && date == "":
+			date = s.Value
+		case s.Key == "vcs.modified" && s.Value == "true" && rev != "" && !strings.HasSuffix(rev, "-dirty"):
+			rev += "-dirty"
+		}
+	}
+	return
+}
+
+func versionString() string {
+	v, rev, date := buildInfo()
+	if rev == "" {
+		rev = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("tls-sweep %s (commit %s, built %s, %s %s/%s)", v, rev, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+func runVersion(args []string) {
+	fmt.Println(versionString())
+}
+
+// release is the part of the GitHub latest-release answer self-update
+// needs.
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// releaseAsset is the binary of a release for this platform; its
+// signature is the asset of the same name with a .sig suffix.
+func releaseAsset() string {
+	name := fmt.Sprintf("tls-sweep_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// selfUpdate replaces target with the latest release of repo when it
+// differs from current and its signature verifies against pub. It
+// returns the release installed, or "" when target is up to date.
+func selfUpdate(f *fetcher, api, repo, target, current string, pub crypto.PublicKey, checkOnly bool) (string, error) {
+	body, err := f.get(fmt.Sprintf("%s/repos/%s/releases/latest", api, repo), 0)
+	if err != nil {
+		return "", err
+	}
+	var rel release
+	if err := json.Unmarshal(body, &rel); err != nil {
+		return "", fmt.Errorf("latest release: %v", err)
+	}
+	if rel.Tag == "" || rel.Tag == current {
+		return "", nil
+	}
+	if checkOnly {
+		return rel.Tag, nil
+	}
+
+	urls := make(map[string]string)
+	for _, a := range rel.Assets {
+		urls[a.Name] = a.URL
+	}
+	name := releaseAsset()
+	if urls[name] == "" || urls[name+".sig"] == "" {
+		return "", fmt.Errorf("release %s has no signed %s", rel.Tag, name)
+	}
+	bin, err := f.get(urls[name], 0)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := f.get(urls[name+".sig"], 0)
+	if err != nil {
+		return "", err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return "", fmt.Errorf("%s.sig: %v", name, err)
+	}
+	if err := verifySignature(pub, bin, sig); err != nil {
+		return "", fmt.Errorf("%s of %s: %v", name, rel.Tag, err)
+	}
+
+	// Write next to target so that the rename stays on one filesystem.
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tls-sweep-update-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		// A running executable cannot be replaced, only renamed.
+		os.Remove(target + ".old")
+		if err := os.Rename(target, target+".old"); err != nil {
+			return "", err
+		}
+	}
+	return rel.Tag, os.Rename(tmp.Name(), target)
+}
+
+func runSelfUpdate(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tls-sweep self-update [--check] [--key release.pem]")
+		fs.PrintDefaults()
+	}
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	keyFile := fs.String("key", "", "PEM public key release binaries are signed with (default: the key built in)")
+	repo := fs.String("repo", "mberlanda/tls-sweep", "GitHub repository releases are fetched from")
+	registerFetchFlags(fs)
+	parseArgs(fs, args)
+
+	var pub crypto.PublicKey
+	var err error
+	switch {
+	case *keyFile != "":
+		pub, err = loadPublicKey(*keyFile)
+	case releaseKey != "":
+		var der []byte
+		if der, err = base64.StdEncoding.DecodeString(releaseKey); err == nil {
+			pub, err = x509.ParsePKIXPublicKey(der)
+		}
+	case !*check:
+		err = fmt.Errorf("this build has no release key; pass --key")
+	}
+	if err != nil {
+		logger.Fatalf("Failed to load the release key: %v\n", err)
+	}
+	target, err := os.Executable()
+	if err == nil {
+		target, err = filepath.EvalSymlinks(target)
+	}
+	if err != nil {
+		logger.Fatalf("Failed to locate the running binary: %v\n", err)
+	}
+
+	current, _, _ := buildInfo()
+	tag, err := selfUpdate(metadata(), "https://api.github.com", *repo, target, current, pub, *check)
+	switch {
+	case err != nil:
+		logger.Fatalf("Self-update failed: %v\n", err)
+	case tag == "":
+		logger.Printf("%s is the latest release\n", current)
+	case *check:
+		logger.Printf("%s is available (running %s)\n", tag, current)
+	default:
+		logger.Printf("Updated %s from %s to %s\n", target, current, tag)
+	}
+}
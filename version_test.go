@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	if v := versionString(); !strings.HasPrefix(v, "tls-sweep ") || !strings.Contains(v, "go1.") {
+		t.Errorf("version = %q", v)
+	}
+}
+
+func TestSelfUpdate(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	bin := []byte("#!/bin/sh\necho v2\n")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, bin))
+	asset := releaseAsset()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/tls-sweep/releases/latest":
+			fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [{"name": %q, "browser_download_url": "%s/dl/bin"}, {"name": %q, "browser_download_url": "%s/dl/sig"}]}`, asset, srv.URL, asset+".sig", srv.URL)
+		case "/dl/bin":
+			w.Write(bin)
+		case "/dl/sig":
+			fmt.Fprintln(w, sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	f := newFetcher(srv.Client(), 0, 0)
+
+	target := filepath.Join(t.TempDir(), "tls-sweep")
+	os.WriteFile(target, []byte("v1"), 0o755)
+
+	if tag, err := selfUpdate(f, srv.URL, "acme/tls-sweep", target, "v2.0.0", pub, false); err != nil || tag != "" {
+		t.Errorf("up to date: %q, %v", tag, err)
+	}
+	if tag, err := selfUpdate(f, srv.URL, "acme/tls-sweep", target, "v1.0.0", pub, true); err != nil || tag != "v2.0.0" {
+		t.Errorf("check: %q, %v", tag, err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "v1" {
+		t.Error("--check replaced the binary")
+	}
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := selfUpdate(f, srv.URL, "acme/tls-sweep", target, "v1.0.0", other, false); err == nil {
+		t.Error("binary signed by another key installed")
+	}
+	if got, _ := os.ReadFile(target); string(got) != "v1" {
+		t.Error("failed update touched the binary")
+	}
+
+	if tag, err := selfUpdate(f, srv.URL, "acme/tls-sweep", target, "v1.0.0", pub, false); err != nil || tag != "v2.0.0" {
+		t.Fatalf("update: %q, %v", tag, err)
+	}
+	got, _ := os.ReadFile(target)
+	info, _ := os.Stat(target)
+	if string(got) != string(bin) || info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("installed %q with mode %v", got, info.Mode())
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(target), ".tls-sweep-update-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files left: %v", leftovers)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxExpiringDays is how close to expiry a certificate is highlighted.
+const xlsxExpiringDays = 30
+
+// xlsxCell is one cell value: a number when num is set, a date when date
+// is, otherwise a string.
+type xlsxCell struct {
+	str  string
+	num  *int
+	date time.Time
+	bold bool
+}
+
+type xlsxSheet struct {
+	name string
+	rows [][]xlsxCell
+	// expiryColumn, when set, is the 1-based column highlighted red when
+	// expired and amber when expiring.
+	expiryColumn int
+}
+
+// exportToXLSX writes <base-domain>.xlsx with a Results sheet, a Summary
+// sheet and an Errors sheet listing failures and NXDOMAINs. Unlike the CSV,
+// ValidTo is a real date, so auditors can sort and filter on it.
+func exportToXLSX(baseDomain string, results chan ScanResult) {
+	fileName := exportPath(baseDomain, "xlsx")
+	var all []ScanResult
+	for res := range results {
+		all = append(all, res)
+	}
+	sheets := buildWorkbook(baseDomain, all, time.Now())
+	if err := deliver(fileName, func() error { return writeXLSX(fileName, sheets) }); err != nil {
+		sink := newResultSink(fileName, "xlsx", baseDomain, nil)
+		sink.giveUp(err)
+		sink.spoolAll(all)
+		sink.close()
+		return
+	}
+	logger.Printf("Results exported to %s\n", fileName)
+}
+
+func headerRow(names ...string) []xlsxCell {
+	row := make([]xlsxCell, len(names))
+	for i, n := range names {
+		row[i] = xlsxCell{str: n, bold: true}
+	}
+	return row
+}
+
+func buildWorkbook(baseDomain string, all []ScanResult, now time.Time) []xlsxSheet {
+	validTo := 1 + indexOf(resultColumns, "ValidTo")
+	score := indexOf(resultColumns, "Score")
+	notBefore := indexOf(resultColumns, "NotBefore")
+	chainValidTo := indexOf(resultColumns, "ChainValidTo")
+	resultsSheet := xlsxSheet{name: "Results", rows: [][]xlsxCell{headerRow(resultColumns...)}, expiryColumn: validTo}
+	errorsSheet := xlsxSheet{name: "Errors", rows: [][]xlsxCell{headerRow("Domain", "IP", "Status", "MX", "Port")}}
+
+	byStatus := make(map[string]int)
+	expired, expiring := 0, 0
+	for _, r := range all {
+		byStatus[r.Status]++
+		if r.Status == "NXDOMAIN" || isFailure(r.Status) {
+			errorsSheet.rows = append(errorsSheet.rows, []xlsxCell{{str: r.Domain}, {str: r.IP}, {str: r.Status}, {str: r.MX}, {str: r.Port}})
+			continue
+		}
+		var row []xlsxCell
+		for i, v := range resultRow(r) {
+			c := xlsxCell{str: v}
+			switch i {
+			case score:
+				n := r.Score
+				c = xlsxCell{num: &n}
+			case notBefore, chainValidTo:
+				if t, ok := parseValidTo(v); ok {
+					c = xlsxCell{date: t}
+				}
+			case validTo - 1:
+				if t, ok := parseValidTo(v); ok {
+					c = xlsxCell{date: t}
+					switch {
+					case t.Before(now):
+						expired++
+					case t.Before(now.AddDate(0, 0, xlsxExpiringDays)):
+						expiring++
+					}
+				}
+			}
+			row = append(row, c)
+		}
+		resultsSheet.rows = append(resultsSheet.rows, row)
+	}
+
+	count := func(label string, n int) []xlsxCell { return []xlsxCell{{str: label}, {num: &n}} }
+	summary := xlsxSheet{name: "Summary", rows: [][]xlsxCell{
+		headerRow("Base domain", baseDomain),
+		{{str: "Generated"}, {str: now.UTC().Format(time.RFC3339)}},
+		count("Domains scanned", len(all)),
+		count("Expired certificates", expired),
+		count(fmt.Sprintf("Expiring within %d days", xlsxExpiringDays), expiring),
+		{},
+		headerRow("Status", "Domains"),
+	}}
+	statuses := make([]string, 0, len(byStatus))
+	for s := range byStatus {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	for _, s := range statuses {
+		summary.rows = append(summary.rows, count(s, byStatus[s]))
+	}
+	return []xlsxSheet{resultsSheet, summary, errorsSheet}
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeXLSX writes a minimal SpreadsheetML package. Strings are stored
+// inline rather than in a shared-strings table, which every reader accepts.
+func writeXLSX(path string, sheets []xlsxSheet) error {
+	f, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(f)
+
+	var types, rels, names strings.Builder
+	for i, sh := range sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&names, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sh.name), i+1, i+1)
+	}
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + names.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1) +
+			`</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sh := range sheets {
+		parts = append(parts, struct{ name, body string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sh.xml()})
+	}
+
+	for _, p := range parts {
+		w, err := z.Create(p.name)
+		if err == nil {
+			_, err = io.WriteString(w, xml.Header+p.body)
+		}
+		if err != nil {
+			z.Close()
+			discardOutput(f)
+			return err
+		}
+	}
+	if err := z.Close(); err != nil {
+		discardOutput(f)
+		return err
+	}
+	return f.Close()
+}
+
+// Cell styles: 0 default, 1 bold, 2 yyyy-mm-dd hh:mm date. Differential
+// formats: 0 red (expired), 1 amber (expiring).
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`<dxfs count="2"><dxf><font><color rgb="FF9C0006"/></font><fill><patternFill><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf>` +
+	`<dxf><font><color rgb="FF9C5700"/></font><fill><patternFill><bgColor rgb="FFFFEB9C"/></patternFill></fill></dxf></dxfs>` +
+	`</styleSheet>`
+
+func (sh xlsxSheet) xml() string {
+	var b strings.Builder
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData>`)
+	width := 0
+	for i, row := range sh.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, c := range row {
+			ref := xlsxColumn(j+1) + strconv.Itoa(i+1)
+			switch {
+			case c.num != nil:
+				fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, *c.num)
+			case !c.date.IsZero():
+				fmt.Fprintf(&b, `<c r="%s" s="2"><v>%s</v></c>`, ref, excelDate(c.date))
+			case c.str != "":
+				style := ""
+				if c.bold {
+					style = ` s="1"`
+				}
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(c.str))
+			}
+		}
+		b.WriteString(`</row>`)
+		width = max(width, len(row))
+	}
+	b.WriteString(`</sheetData>`)
+	if len(sh.rows) > 1 && width > 0 {
+		fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`, xlsxColumn(width), len(sh.rows))
+	}
+	if sh.expiryColumn > 0 && len(sh.rows) > 1 {
+		col := xlsxColumn(sh.expiryColumn)
+		cell := col + "2"
+		fmt.Fprintf(&b, `<conditionalFormatting sqref="%s2:%s%d">`, col, col, len(sh.rows))
+		fmt.Fprintf(&b, `<cfRule type="expression" dxfId="0" priority="1" stopIfTrue="1"><formula>AND(ISNUMBER(%s),%s&lt;TODAY())</formula></cfRule>`, cell, cell)
+		fmt.Fprintf(&b, `<cfRule type="expression" dxfId="1" priority="2"><formula>AND(ISNUMBER(%s),%s&lt;TODAY()+%d)</formula></cfRule>`, cell, cell, xlsxExpiringDays)
+		b.WriteString(`</conditionalFormatting>`)
+	}
+	b.WriteString(`</worksheet>`)
+	return b.String()
+}
+
+// xlsxColumn converts a 1-based column number to its letters: 1 is A, 27
+// is AA.
+func xlsxColumn(n int) string {
+	var s string
+	for n > 0 {
+		n--
+		s = string(rune('A'+n%26)) + s
+		n /= 26
+	}
+	return s
+}
+
+// excelDate is t as a spreadsheet serial date, days since 1899-12-30 with
+// the time of day as the fraction.
+func excelDate(t time.Time) string {
+	// Spreadsheets have no zones: the wall time written in the export is
+	// the one shown.
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return strconv.FormatFloat(wall.Sub(epoch).Hours()/24, 'f', -1, 64)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
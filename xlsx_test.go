@@ -0,0 +1,86 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteXLSX(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	results := []ScanResult{
+		{Domain: "ok.example", IP: "192.0.2.1", Status: "OK", Subject: "R&D <ok>", ValidTo: "2024-05-10", Score: 45},
+		{Domain: "old.example", IP: "192.0.2.2", Status: "OK", ValidTo: "2024-01-01"},
+		{Domain: "broken.example", IP: "192.0.2.3", Status: "TLS ERROR"},
+		{Domain: "gone.example", IP: "-", Status: "NXDOMAIN"},
+	}
+	path := filepath.Join(t.TempDir(), "example.xlsx")
+	if err := writeXLSX(path, buildWorkbook("example", results, now)); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	parts := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		// Every part must at least be well-formed XML.
+		dec := xml.NewDecoder(strings.NewReader(string(data)))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = string(data)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/styles.xml", "xl/worksheets/sheet3.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="Summary" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("workbook: %s", parts["xl/workbook.xml"])
+	}
+
+	results1 := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{"R&amp;D &lt;ok&gt;", `<c r="G2" s="2"><v>45422</v></c>`, `<c r="H2"><v>45</v></c>`, `<conditionalFormatting sqref="G2:G3">`} {
+		if !strings.Contains(results1, want) {
+			t.Errorf("results sheet lacks %s", want)
+		}
+	}
+	if strings.Contains(results1, "broken.example") || strings.Contains(results1, "gone.example") {
+		t.Error("results sheet lists errors")
+	}
+	errorsSheet := parts["xl/worksheets/sheet3.xml"]
+	if !strings.Contains(errorsSheet, "broken.example") || !strings.Contains(errorsSheet, "gone.example") {
+		t.Errorf("errors sheet: %s", errorsSheet)
+	}
+	summary := parts["xl/worksheets/sheet2.xml"]
+	for _, want := range []string{"Expired certificates</t></is></c><c r=\"B4\"><v>1</v>", "Expiring within 30 days</t></is></c><c r=\"B5\"><v>1</v>"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary lacks %s", want)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for n, want := range map[int]string{1: "A", 26: "Z", 27: "AA", 52: "AZ", 703: "AAA"} {
+		if got := xlsxColumn(n); got != want {
+			t.Errorf("xlsxColumn(%d) = %s, want %s", n, got, want)
+		}
+	}
+}